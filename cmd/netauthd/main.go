@@ -1,20 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/netauth/netauth/internal/crypto"
 	_ "github.com/netauth/netauth/internal/crypto/bcrypt"
 	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/bbolt"
 	_ "github.com/netauth/netauth/internal/db/bitcask"
+	_ "github.com/netauth/netauth/internal/db/encrypted"
 	_ "github.com/netauth/netauth/internal/db/filesystem"
+	_ "github.com/netauth/netauth/internal/db/raft"
 	plugin "github.com/netauth/netauth/internal/plugin/tree/manager"
+	"github.com/netauth/netauth/internal/replication"
+	"github.com/netauth/netauth/internal/replication/replpb"
 
 	"github.com/netauth/netauth/pkg/token"
 	_ "github.com/netauth/netauth/pkg/token/jwt"
@@ -34,8 +42,6 @@ import (
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
-
-	rpb "github.com/netauth/protocol/v2"
 )
 
 var (
@@ -80,6 +86,36 @@ func init() {
 	viper.SetDefault("token.lifetime", time.Minute*10)
 	viper.SetDefault("server.port", 1729)
 	viper.SetDefault("server.readonly", false)
+	viper.SetDefault("realms", []string{})
+	viper.SetDefault("db.filesystem.watch", false)
+	viper.SetDefault("db.journal.enabled", false)
+	viper.SetDefault("db.journal.max-age", time.Duration(0))
+	viper.SetDefault("db.numbers.entity.min", 1)
+	viper.SetDefault("db.numbers.entity.max", 0)
+	viper.SetDefault("db.numbers.group.min", 1)
+	viper.SetDefault("db.numbers.group.max", 0)
+	viper.SetDefault("db.numbers.no-reuse", false)
+	viper.SetDefault("db.index.persistent", false)
+	viper.SetDefault("db.index.kv-keys", []string{})
+	viper.SetDefault("db.cache.size", 10000)
+	viper.SetDefault("db.events.queue-size", 1024)
+	viper.SetDefault("db.events.workers", 4)
+	viper.SetDefault("db.events.policy", "block")
+	viper.SetDefault("db.tombstones.retention", 30*24*time.Hour)
+	viper.SetDefault("db.history.depth", 20)
+	viper.SetDefault("db.secrets.depth", 0)
+	viper.SetDefault("tree.secrets.min-length", 0)
+	viper.SetDefault("tree.secrets.require-upper", false)
+	viper.SetDefault("tree.secrets.require-lower", false)
+	viper.SetDefault("tree.secrets.require-digit", false)
+	viper.SetDefault("tree.secrets.require-symbol", false)
+	viper.SetDefault("tree.secrets.reject-identity", false)
+	viper.SetDefault("tree.secrets.compromised-list", "")
+	viper.SetDefault("tree.secrets.max-age", time.Duration(0))
+	viper.SetDefault("replication.primary", false)
+	viper.SetDefault("replication.source", "")
+	viper.SetDefault("replication.log-size", 10000)
+	viper.SetDefault("replication.retry", time.Second*5)
 	viper.SetDefault("tls.certificate", "keys/tls.pem")
 	viper.SetDefault("tls.key", "keys/tls.key")
 	viper.SetDefault("plugin.path", filepath.Join(viper.GetString("core.home"), "plugins"))
@@ -144,6 +180,331 @@ func newGRPCServer() (*grpc.Server, error) {
 	return grpcServer, nil
 }
 
+// doRealmSetup brings up everything that serves a single realm: its
+// database, the tree on top of it, and its token service.  The realm's
+// journal and persistent index are kept apart from those of other
+// realms, and its token keys are the realm's own.
+func doRealmSetup(realm string, openDB func(string, ...db.Option) (*db.DB, error), cryptoImpl crypto.EMCrypto, kp keyprovider.KeyProvider, pluginManager plugin.Manager) (*db.DB, *rpc2.Server, error) {
+	l := appLogger
+	if realm != "" {
+		l = appLogger.With("realm", realm)
+	}
+
+	// The data storage layer is next to initialize.  This
+	// provides core services to the entity tree which initializes
+	// immediately afterwards.
+	dbOpts := []db.Option{
+		db.WithEntityNumbers(db.NumberPolicy{
+			Min:     viper.GetInt32("db.numbers.entity.min"),
+			Max:     viper.GetInt32("db.numbers.entity.max"),
+			NoReuse: viper.GetBool("db.numbers.no-reuse"),
+		}),
+		db.WithGroupNumbers(db.NumberPolicy{
+			Min:     viper.GetInt32("db.numbers.group.min"),
+			Max:     viper.GetInt32("db.numbers.group.max"),
+			NoReuse: viper.GetBool("db.numbers.no-reuse"),
+		}),
+	}
+	if viper.GetBool("db.journal.enabled") {
+		j, err := doJournalSetup(realm)
+		if err != nil {
+			return nil, nil, err
+		}
+		dbOpts = append(dbOpts, db.WithJournal(j))
+	}
+	if viper.GetBool("db.index.persistent") {
+		// With the index on disk the preload below only has
+		// to reindex what changed while the server was down.
+		path := viper.GetString("db.index.path")
+		if path == "" {
+			path = filepath.Join(viper.GetString("core.home"), "index")
+		}
+		path = filepath.Join(path, realm)
+		l.Info("Search index is persistent", "path", path)
+		dbOpts = append(dbOpts, db.WithIndexDir(path))
+	}
+	if keys := viper.GetStringSlice("db.index.kv-keys"); len(keys) > 0 {
+		// KV data is only searchable for the keys that have
+		// been chosen to be, since being able to search a key
+		// makes its values discoverable.
+		dbOpts = append(dbOpts, db.WithIndexOptions(db.IndexKV(keys...)))
+	}
+	dbOpts = append(dbOpts, db.WithCache(viper.GetInt("db.cache.size")))
+	dbOpts = append(dbOpts, db.WithHistory(viper.GetInt("db.history.depth")))
+	dbOpts = append(dbOpts, db.WithSecretHistory(viper.GetInt("db.secrets.depth")))
+	policy, err := db.ParseQueuePolicy(viper.GetString("db.events.policy"))
+	if err != nil {
+		l.Error("Bad event queue policy", "policy", viper.GetString("db.events.policy"), "error", err)
+		return nil, nil, err
+	}
+	dbOpts = append(dbOpts, db.WithDelivery(db.Delivery{
+		QueueSize: viper.GetInt("db.events.queue-size"),
+		Workers:   viper.GetInt("db.events.workers"),
+		Policy:    policy,
+	}))
+	dbImpl, err := openDB(realm, dbOpts...)
+	if err != nil {
+		l.Error("Fatal database error", "error", err)
+		return nil, nil, err
+	}
+	suffix := ""
+	if realm != "" {
+		suffix = "-" + realm
+	}
+	if viper.GetInt("db.cache.size") > 0 {
+		health.RegisterCheck("db-cache"+suffix, dbImpl.CacheHealthCheck)
+	}
+	if viper.GetInt("db.events.queue-size") > 0 {
+		health.RegisterCheck("db-events"+suffix, dbImpl.EventsHealthCheck)
+	}
+	l.Info("Database initialized", "backend", viper.GetString("db.backend"))
+
+	// The Tree is the core component of the server.  Its the part
+	// that actually provides the interface for working with
+	// entities, working with groups, and defining the
+	// relationships between the two.  If the plugin system is
+	// being used, then the tree action configurations (chains)
+	// need to be reconfigured to enable the external plugin
+	// hooks.  Operators may also replace or extend any chain
+	// from the config, which is checked here as well.
+	tree, err := tree.New(
+		tree.WithStorage(dbImpl),
+		tree.WithCrypto(cryptoImpl),
+		tree.WithLogger(l),
+		tree.WithEntityChains(chainConfig("tree.entity.chains")),
+		tree.WithEntityChainExtensions(chainConfig("tree.entity.extend")),
+		tree.WithGroupChains(chainConfig("tree.group.chains")),
+		tree.WithGroupChainExtensions(chainConfig("tree.group.extend")),
+		tree.WithSecretPolicy(tree.SecretPolicy{
+			MinLength:       viper.GetInt("tree.secrets.min-length"),
+			RequireUpper:    viper.GetBool("tree.secrets.require-upper"),
+			RequireLower:    viper.GetBool("tree.secrets.require-lower"),
+			RequireDigit:    viper.GetBool("tree.secrets.require-digit"),
+			RequireSymbol:   viper.GetBool("tree.secrets.require-symbol"),
+			RejectIdentity:  viper.GetBool("tree.secrets.reject-identity"),
+			CompromisedList: viper.GetString("tree.secrets.compromised-list"),
+			MaxAge:          viper.GetDuration("tree.secrets.max-age"),
+		}),
+	)
+	if err != nil {
+		l.Error("Fatal initialization error", "error", err)
+		return nil, nil, err
+	}
+	if viper.GetBool("plugin.enabled") {
+		pluginManager.ConfigureEntityChains(tree.RegisterEntityHookToChain)
+		pluginManager.ConfigureGroupChains(tree.RegisterGroupHookToChain)
+	}
+
+	// All internal components have initialized and registered for
+	// storage callbacks at this point.  We now run a storage
+	// callback claiming that everything on the server has been
+	// updated to allow data to load into memory that is not
+	// persisted to disk.
+	if err := dbImpl.EventUpdateAll(); err != nil {
+		l.Error("Error during initial event preload", "error", err)
+		return nil, nil, err
+	}
+	doTombstonePurge(dbImpl)
+
+	// NetAuth's internal security model is token based.  The
+	// token service is distinct from the tree, and can wait to
+	// come online until the tree has been initiailized (and by
+	// extension the plugin system).
+	tokenService, err := token.New(viper.GetString("token.backend"), keyprovider.ForRealm(kp, realm))
+	if err != nil {
+		l.Error("Fatal token error", "error", err)
+		return nil, nil, err
+	}
+	l.Info("Token backend successfully initialized", "backend", viper.GetString("token.backend"))
+
+	srvOpts := []rpc2.Option{
+		rpc2.WithLogger(l),
+		rpc2.WithTokenService(tokenService),
+		rpc2.WithEntityTree(tree),
+		rpc2.WithDisabledWrites(viper.GetBool("server.readonly")),
+	}
+	if _, clustered := dbImpl.Leader(); clustered {
+		// Only the leader of the cluster accepts writes, and
+		// which server that is changes over time.
+		srvOpts = append(srvOpts, rpc2.WithCluster(dbImpl))
+	}
+	return dbImpl, rpc2.New(srvOpts...), nil
+}
+
+// chainConfig reads the chains at key in the config.  Chain names are
+// upper case, but the config doesn't preserve the case of keys, so
+// they are put back in upper case here.
+func chainConfig(key string) tree.ChainConfig {
+	c := make(tree.ChainConfig)
+	for chain, hooks := range viper.GetStringMapStringSlice(key) {
+		c[strings.ToUpper(chain)] = hooks
+	}
+	return c
+}
+
+// doJournalSetup opens the change journal.  If a maximum age is
+// configured, entries older than that are pruned now and then once an
+// hour for as long as the server runs.  Each realm has a journal of
+// its own, named after the realm.
+func doJournalSetup(realm string) (*db.Journal, error) {
+	path := viper.GetString("db.journal.path")
+	if path == "" {
+		path = filepath.Join(viper.GetString("core.home"), "journal.log")
+	}
+	if realm != "" {
+		ext := filepath.Ext(path)
+		path = strings.TrimSuffix(path, ext) + "-" + realm + ext
+	}
+	j, err := db.OpenJournal(path)
+	if err != nil {
+		appLogger.Error("Journal could not be opened", "path", path, "error", err)
+		return nil, err
+	}
+	appLogger.Info("Journal opened", "path", path)
+
+	maxAge := viper.GetDuration("db.journal.max-age")
+	if maxAge <= 0 {
+		return j, nil
+	}
+	prune := func() {
+		n, err := j.Prune(time.Now().Add(-maxAge))
+		if err != nil {
+			appLogger.Warn("Error pruning journal", "error", err)
+			return
+		}
+		appLogger.Debug("Journal pruned", "removed", n)
+	}
+	prune()
+	go func() {
+		for range time.Tick(time.Hour) {
+			prune()
+		}
+	}()
+	return j, nil
+}
+
+// doTombstonePurge permanently removes destroyed entities and groups
+// once they have been kept for the configured retention period.  This
+// happens now and then once an hour for as long as the server runs.
+// Only a server that can write to its store purges, replicas have the
+// purge replicated to them.  In a cluster that is whichever server
+// leads it at the time.
+func doTombstonePurge(d *db.DB) {
+	retention := viper.GetDuration("db.tombstones.retention")
+	if retention <= 0 || viper.GetBool("server.readonly") {
+		return
+	}
+	mutable := func() bool {
+		for _, c := range d.Capabilities() {
+			if c == db.KVMutable {
+				return true
+			}
+		}
+		return false
+	}
+	if _, clustered := d.Leader(); !clustered && !mutable() {
+		return
+	}
+	purge := func() {
+		if !mutable() {
+			return
+		}
+		n, err := d.PurgeTombstones(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			appLogger.Warn("Error purging deleted objects", "error", err)
+			return
+		}
+		appLogger.Debug("Deleted objects purged", "removed", n)
+	}
+	purge()
+	go func() {
+		for range time.Tick(time.Hour) {
+			purge()
+		}
+	}()
+}
+
+// doReplicationSetup configures the replication subsystem.  A primary
+// serves the change stream on the same gRPC server as the NetAuth
+// protocol, and a replica follows the primary named in
+// replication.source until the context is cancelled.  A server may be
+// both, in which case it passes changes on to its own replicas.
+func doReplicationSetup(ctx context.Context, srv *grpc.Server, d *db.DB, kp keyprovider.KeyProvider) error {
+	primary := viper.GetBool("replication.primary")
+	source := viper.GetString("replication.source")
+	if !primary && source == "" {
+		return nil
+	}
+
+	secret, err := kp.Provide("replication", "secret")
+	if err != nil {
+		appLogger.Error("Replication secret could not be loaded", "error", err)
+		return err
+	}
+
+	opts := []replication.Option{
+		replication.WithLogger(appLogger),
+		replication.WithSecret(secret),
+		replication.WithLogSize(viper.GetInt("replication.log-size")),
+		replication.WithPositionFile(filepath.Join(viper.GetString("core.home"), "replication.pos")),
+		replication.WithRetryInterval(viper.GetDuration("replication.retry")),
+	}
+
+	if primary {
+		p, err := replication.NewPrimary(d, opts...)
+		if err != nil {
+			appLogger.Error("Replication primary could not be initialized", "error", err)
+			return err
+		}
+		replpb.RegisterReplicationServer(srv, p)
+	}
+
+	if source == "" {
+		return nil
+	}
+
+	// Writes made directly to a replica would be overwritten
+	// the next time the primary changed the same key, so they
+	// are refused entirely.
+	if !viper.GetBool("server.readonly") {
+		appLogger.Error("Replicas must be run with server.readonly")
+		return errors.New("replica is not readonly")
+	}
+
+	var dopts []grpc.DialOption
+	if *insecure {
+		dopts = []grpc.DialOption{grpc.WithInsecure()}
+	} else {
+		certPath := viper.GetString("replication.certificate")
+		if certPath == "" {
+			certPath = viper.GetString("tls.certificate")
+		}
+		if !filepath.IsAbs(certPath) {
+			certPath = filepath.Join(viper.GetString("core.conf"), certPath)
+		}
+		creds, err := credentials.NewClientTLSFromFile(certPath, "")
+		if err != nil {
+			appLogger.Error("Replication TLS could not be initialized", "error", err)
+			return err
+		}
+		dopts = []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	}
+	conn, err := grpc.Dial(source, dopts...)
+	if err != nil {
+		appLogger.Error("Replication source could not be dialed", "source", source, "error", err)
+		return err
+	}
+
+	r := replication.NewReplica(d.KV(), replpb.NewReplicationClient(conn), opts...)
+	health.RegisterCheck("replication", r.HealthCheck)
+	go func() {
+		r.Run(ctx)
+		conn.Close()
+	}()
+	appLogger.Info("Following replication source", "source", source)
+	return nil
+}
+
 // loadConfig is a convenience function that handles the loading of
 // the viper configuration singleton.  This function is called just
 // after flag parsing completes and if it is unsuccessful it aborts
@@ -256,74 +617,59 @@ func main() {
 	// system.
 	pluginManager := doPluginEarlySetup()
 
-	// The data storage layer and cryptographic engine are next to
-	// initialize.  These modules provide core services to the
-	// entity tree which initializes immediately afterwards.
-	dbImpl, err := db.New(viper.GetString("db.backend"))
-	if err != nil {
-		appLogger.Error("Fatal database error", "error", err)
-		os.Exit(1)
+	// A server always serves the default realm, and may serve
+	// other realms that each have their own entities, groups and
+	// token keys.  The realms share the storage backend.
+	realms := append([]string{""}, viper.GetStringSlice("realms")...)
+	for _, r := range realms {
+		if !db.ValidRealm(r) {
+			appLogger.Error("Bad realm name", "realm", r, "error", db.ErrBadRealm)
+			os.Exit(1)
+		}
 	}
-	appLogger.Info("Database initialized", "backend", viper.GetString("db.backend"))
-
-	cryptoImpl, err := crypto.New(viper.GetString("crypto.backend"))
-	if err != nil {
-		appLogger.Error("Fatal crypto error", "error", err)
+	if len(realms) > 1 && (viper.GetBool("replication.primary") || viper.GetString("replication.source") != "") {
+		appLogger.Error("Replication is not supported with more than one realm")
 		os.Exit(1)
 	}
-
-	opts := []tree.Option{
-		tree.WithStorage(dbImpl),
-		tree.WithCrypto(cryptoImpl),
-		tree.WithLogger(appLogger),
-	}
-
-	// The Tree is the core component of the server.  Its the part
-	// that actually provides the interface for working with
-	// entities, working with groups, and defining the
-	// relationships between the two.  If the plugin system is
-	// being used, then the tree action configurations (chains)
-	// need to be reconfigured to enable the external plugin
-	// hooks.
-	tree, err := tree.New(opts...)
-	if err != nil {
-		appLogger.Error("Fatal initialization error", "error", err)
-		os.Exit(1)
+	openDB := func(_ string, opts ...db.Option) (*db.DB, error) {
+		return db.New(viper.GetString("db.backend"), opts...)
 	}
-	if viper.GetBool("plugin.enabled") {
-		pluginManager.ConfigureEntityChains(tree.RegisterEntityHookToChain)
-		pluginManager.ConfigureGroupChains(tree.RegisterGroupHookToChain)
+	if len(realms) > 1 {
+		rs, err := db.NewRealmStore(viper.GetString("db.backend"))
+		if err != nil {
+			appLogger.Error("Fatal database error", "error", err)
+			os.Exit(1)
+		}
+		openDB = rs.Open
 	}
 
-	// All internal components have initialized and registered for
-	// storage callbacks at this point.  We now run a storage
-	// callback claiming that everything on the server has been
-	// updated to allow data to load into memory that is not
-	// persisted to disk.
-	if err := dbImpl.EventUpdateAll(); err != nil {
-		appLogger.Error("Error during initial event preload", "error", err)
+	// The cryptographic engine and the key provider for the
+	// token services are shared by all realms.  The token keys
+	// are retrieved using a KeyProvider to enable them to be
+	// fetched from non-local sources.
+	cryptoImpl, err := crypto.New(viper.GetString("crypto.backend"))
+	if err != nil {
+		appLogger.Error("Fatal crypto error", "error", err)
 		os.Exit(1)
 	}
 
-	// NetAuth's internal security model is token based.  The
-	// token service is distinct from the tree, and can wait to
-	// come online until the tree has been initiailized (and by
-	// extension the plugin system).  The keys are retrieved using
-	// a KeyProvider to enable them to be fetched from non-local
-	// sources.
 	kp, err := keyprovider.New(viper.GetString("token.keyprovider"))
 	if err != nil {
 		appLogger.Error("Fatal token error", "error", err)
 		os.Exit(1)
 	}
-
 	token.SetLifetime(viper.GetDuration("token.lifetime"))
-	tokenService, err := token.New(viper.GetString("token.backend"), kp)
-	if err != nil {
-		appLogger.Error("Fatal token error", "error", err)
-		os.Exit(1)
+
+	rpcServers := make(rpc2.Realms)
+	var dbs []*db.DB
+	for _, r := range realms {
+		d, srv, err := doRealmSetup(r, openDB, cryptoImpl, kp, pluginManager)
+		if err != nil {
+			os.Exit(1)
+		}
+		dbs = append(dbs, d)
+		rpcServers[r] = srv
 	}
-	appLogger.Info("Token backend successfully initialized", "backend", viper.GetString("token.backend"))
 
 	// Initializing the gRPC Server happens only once the
 	// primitives that it will consume have been initialized.  At
@@ -338,16 +684,18 @@ func main() {
 
 	// A NetAuth server may serve more than one protocol version
 	// at a time.  This section binds the different application
-	// protocol versions to the grpcServer.
-	rpb.RegisterNetAuth2Server(
-		grpcServer,
-		rpc2.New(
-			rpc2.WithLogger(appLogger),
-			rpc2.WithTokenService(tokenService),
-			rpc2.WithEntityTree(tree),
-			rpc2.WithDisabledWrites(viper.GetBool("server.readonly")),
-		),
-	)
+	// protocol versions to the grpcServer, each request being
+	// handled by the realm that it names.
+	rpcServers.Register(grpcServer)
+
+	// Replication keeps read-only servers in sync with a
+	// primary.  The primary side needs the gRPC server to serve
+	// the change stream, and the replica side needs to be
+	// stopped during shutdown.
+	replCtx, replCancel := context.WithCancel(context.Background())
+	if err := doReplicationSetup(replCtx, grpcServer, dbs[0], kp); err != nil {
+		os.Exit(1)
+	}
 
 	// While the server is for the most part stateless, the
 	// plugins might not be.  This block registers the shutdown
@@ -363,8 +711,12 @@ func main() {
 	go func() {
 		<-c
 		appLogger.Info("Shutting down...")
+		replCancel()
 		grpcServer.GracefulStop()
 		pluginManager.Shutdown()
+		for _, d := range dbs {
+			d.Shutdown()
+		}
 		close(done)
 	}()
 
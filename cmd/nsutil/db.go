@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Export and import the tree in a readable form",
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+}
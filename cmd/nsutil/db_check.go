@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/netauth/netauth/internal/crypto"
+	_ "github.com/netauth/netauth/internal/crypto/bcrypt"
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/bbolt"
+	_ "github.com/netauth/netauth/internal/db/bitcask"
+	_ "github.com/netauth/netauth/internal/db/encrypted"
+	_ "github.com/netauth/netauth/internal/db/filesystem"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+	"github.com/netauth/netauth/internal/tree/fsck"
+	_ "github.com/netauth/netauth/internal/tree/hooks"
+)
+
+var (
+	dbCheckCmd = &cobra.Command{
+		Use:   "check <backend>",
+		Short: "Check a datastore for dangling references and damage",
+		Long:  dbCheckCmdLongDocs,
+		Run:   dbCheckCmdRun,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	dbCheckCmdLongDocs = `
+The check command reads every entity and group in the named backend
+and reports:
+
+  - Objects that cannot be unmarshaled
+  - Entities that are members of, or have a primary group that is, a
+    group which does not exist
+  - Groups with expansions or a managing group naming a group which
+    does not exist
+  - Entities or groups that share a number
+
+With --repair the dangling references are removed using the same
+chains the server uses.  Unreadable objects and duplicate numbers are
+only reported, since they need a person to decide how to fix them.
+
+The command exits non-zero if any problems remain.
+`
+
+	dbCheckCmdRepair bool
+)
+
+func init() {
+	dbCheckCmd.Flags().BoolVar(&dbCheckCmdRepair, "repair", false, "Remove dangling references.")
+
+	dbCmd.AddCommand(dbCheckCmd)
+}
+
+func dbCheckCmdRun(c *cobra.Command, args []string) {
+	startup.DoCallbacks()
+	ctx := context.Background()
+
+	if !dbCheckCmdRepair {
+		viper.Set("db.readonly", true)
+	}
+	dbImpl, err := db.New(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing datastore: %s\n", err)
+		os.Exit(1)
+	}
+	defer dbImpl.Shutdown()
+
+	problems, err := fsck.Check(ctx, dbImpl.KV())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error checking datastore: %s\n", err)
+		os.Exit(1)
+	}
+	if len(problems) == 0 {
+		fmt.Println("No problems found.")
+		return
+	}
+
+	if !dbCheckCmdRepair {
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		fmt.Printf("%d problems found, pass --repair to fix those that can be.\n", len(problems))
+		dbImpl.Shutdown()
+		os.Exit(1)
+	}
+
+	cryptoImpl, err := crypto.New(viper.GetString("crypto.backend"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Fatal crypto error: %s\n", err)
+		os.Exit(1)
+	}
+	opts := []tree.Option{
+		tree.WithStorage(dbImpl),
+		tree.WithCrypto(cryptoImpl),
+		tree.WithLogger(hclog.NewNullLogger()),
+	}
+	t, err := tree.New(opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Fatal initialization error: %s\n", err)
+		os.Exit(1)
+	}
+
+	remaining := 0
+	for _, p := range problems {
+		if err := fsck.Repair(ctx, t, p); err != nil {
+			fmt.Printf("%s (not repaired: %s)\n", p, err)
+			remaining++
+			continue
+		}
+		fmt.Printf("%s (repaired)\n", p)
+	}
+	fmt.Printf("%d problems found, %d repaired.\n", len(problems), len(problems)-remaining)
+	if remaining > 0 {
+		dbImpl.Shutdown()
+		os.Exit(1)
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/bbolt"
 	_ "github.com/netauth/netauth/internal/db/bitcask"
+	_ "github.com/netauth/netauth/internal/db/encrypted"
 	_ "github.com/netauth/netauth/internal/db/filesystem"
 
 	"github.com/netauth/netauth/internal/startup"
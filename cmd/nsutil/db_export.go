@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	atomic "github.com/google/renameio"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/bbolt"
+	_ "github.com/netauth/netauth/internal/db/bitcask"
+	_ "github.com/netauth/netauth/internal/db/encrypted"
+	_ "github.com/netauth/netauth/internal/db/filesystem"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree/treeio"
+)
+
+var (
+	dbExportCmd = &cobra.Command{
+		Use:   "export <backend> <path>",
+		Short: "Write every entity and group to a file or directory",
+		Long:  dbExportCmdLongDocs,
+		Run:   dbExportCmdRun,
+		Args:  cobra.ExactArgs(2),
+	}
+
+	dbExportCmdLongDocs = `
+The export command writes every entity and group in the named backend
+as JSON or YAML.  By default everything is written to a single
+document at the given path.  With --dir the path is a directory which
+gets one file per entity and one per group, and files for objects that
+no longer exist are removed, which makes the directory suitable for
+keeping in version control.
+
+Secrets are left out unless --secrets is passed.  Exported secrets are
+in their secured form, but should still be handled with care.
+`
+
+	dbExportCmdFormat  string
+	dbExportCmdDir     bool
+	dbExportCmdSecrets bool
+)
+
+func init() {
+	dbExportCmd.Flags().StringVar(&dbExportCmdFormat, "format", treeio.JSON, "Format to write, json or yaml")
+	dbExportCmd.Flags().BoolVar(&dbExportCmdDir, "dir", false, "Write one file per object into a directory")
+	dbExportCmd.Flags().BoolVar(&dbExportCmdSecrets, "secrets", false, "Include secured entity secrets")
+
+	dbCmd.AddCommand(dbExportCmd)
+}
+
+func dbExportCmdRun(c *cobra.Command, args []string) {
+	startup.DoCallbacks()
+	ctx := context.Background()
+
+	viper.Set("db.readonly", true)
+	source, err := db.New(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing source: %s\n", err)
+		os.Exit(1)
+	}
+	defer source.Shutdown()
+
+	d, err := treeio.Export(ctx, source, dbExportCmdSecrets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading source: %s\n", err)
+		os.Exit(1)
+	}
+
+	if dbExportCmdDir {
+		err = d.WriteDir(args[1], dbExportCmdFormat)
+	} else {
+		var b []byte
+		b, err = d.Marshal(dbExportCmdFormat)
+		if err == nil {
+			err = atomic.WriteFile(args[1], b, 0600)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing export: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %d entities and %d groups to %s.\n", len(d.Entities), len(d.Groups), args[1])
+}
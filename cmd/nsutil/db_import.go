@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/netauth/netauth/internal/crypto"
+	_ "github.com/netauth/netauth/internal/crypto/bcrypt"
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/bbolt"
+	_ "github.com/netauth/netauth/internal/db/bitcask"
+	_ "github.com/netauth/netauth/internal/db/encrypted"
+	_ "github.com/netauth/netauth/internal/db/filesystem"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+	_ "github.com/netauth/netauth/internal/tree/hooks"
+	"github.com/netauth/netauth/internal/tree/treeio"
+)
+
+var (
+	dbImportCmd = &cobra.Command{
+		Use:   "import <path> <backend>",
+		Short: "Create entities and groups from an export",
+		Long:  dbImportCmdLongDocs,
+		Run:   dbImportCmdRun,
+		Args:  cobra.ExactArgs(2),
+	}
+
+	dbImportCmdLongDocs = `
+The import command reads a file or directory written by export and
+creates everything in it in the named backend.  Objects are created
+through the same chains the server uses, so an import that the server
+would reject is rejected here as well.  Objects that already exist
+are never overwritten, so importing into a non-empty backend fails on
+the first object that is already present.
+
+Entities that were exported without secrets are given a random one
+and must have a secret set before they can be used.
+
+The format of a single file is taken from its extension.  Nothing is
+changed unless --no-dry-run is passed.
+`
+
+	dbImportCmdNoDryRun bool
+)
+
+func init() {
+	dbImportCmd.Flags().BoolVar(&dbImportCmdNoDryRun, "no-dry-run", false, "Make changes, potentially destructive.")
+
+	dbCmd.AddCommand(dbImportCmd)
+}
+
+func dbImportCmdRun(c *cobra.Command, args []string) {
+	startup.DoCallbacks()
+	ctx := context.Background()
+
+	d, err := readExport(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading export: %s\n", err)
+		os.Exit(1)
+	}
+	for _, g := range d.Groups {
+		fmt.Printf("+ group %s\n", g.GetName())
+	}
+	for _, e := range d.Entities {
+		fmt.Printf("+ entity %s\n", e.GetID())
+	}
+	fmt.Printf("%d groups and %d entities will be created in %s.\n", len(d.Groups), len(d.Entities), args[1])
+
+	// Bail out at this point if we're in a dry-run, otherwise continue
+	if !dbImportCmdNoDryRun {
+		fmt.Println("You are in dry-run mode, pass --no-dry-run to make changes described above.")
+		return
+	}
+
+	dbImpl, err := db.New(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing target: %s\n", err)
+		os.Exit(1)
+	}
+	defer dbImpl.Shutdown()
+	cryptoImpl, err := crypto.New(viper.GetString("crypto.backend"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Fatal crypto error: %s\n", err)
+		os.Exit(1)
+	}
+
+	opts := []tree.Option{
+		tree.WithStorage(dbImpl),
+		tree.WithCrypto(cryptoImpl),
+		tree.WithLogger(hclog.NewNullLogger()),
+	}
+	t, err := tree.New(opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Fatal initialization error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if err := treeio.Import(ctx, t, d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error importing: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Import complete.")
+}
+
+// readExport reads either form written by the export command.
+func readExport(p string) (*treeio.Document, error) {
+	st, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return treeio.ReadDir(p)
+	}
+
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	format := treeio.JSON
+	if ext := strings.ToLower(filepath.Ext(p)); ext == ".yaml" || ext == ".yml" {
+		format = treeio.YAML
+	}
+	return treeio.Unmarshal(b, format)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/netauth/netauth/internal/db"
+)
+
+var (
+	journalCmd = &cobra.Command{
+		Use:   "journal",
+		Short: "Inspect and maintain the change journal",
+	}
+
+	journalPath string
+)
+
+func init() {
+	journalCmd.PersistentFlags().StringVar(&journalPath, "journal", "", "Path to the journal (default from db.journal.path)")
+	rootCmd.AddCommand(journalCmd)
+}
+
+// openJournal opens the journal named on the command line, or the one
+// the server is configured to use.
+func openJournal() *db.Journal {
+	path := journalPath
+	if path == "" {
+		path = viper.GetString("db.journal.path")
+	}
+	if path == "" {
+		path = filepath.Join(viper.GetString("core.home"), "journal.log")
+	}
+
+	j, err := db.OpenJournal(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening journal: %s\n", err)
+		os.Exit(1)
+	}
+	return j
+}
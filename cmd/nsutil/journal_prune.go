@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	journalPruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove old entries from the journal",
+		Long:  journalPruneCmdLongDocs,
+		Run:   journalPruneCmdRun,
+		Args:  cobra.NoArgs,
+	}
+
+	journalPruneCmdLongDocs = `
+The prune command removes entries from the change journal that are
+older than the given age.  The newest entry is always kept so that
+sequence numbers continue from where they left off.
+`
+
+	journalPruneOlderThan time.Duration
+)
+
+func init() {
+	journalPruneCmd.Flags().DurationVar(&journalPruneOlderThan, "older-than", time.Hour*24*90, "Remove entries older than this")
+	journalCmd.AddCommand(journalPruneCmd)
+}
+
+func journalPruneCmdRun(c *cobra.Command, args []string) {
+	j := openJournal()
+	defer j.Close()
+
+	n, err := j.Prune(time.Now().Add(-journalPruneOlderThan))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error pruning journal: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Removed %d entries.\n", n)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	journalShowCmd = &cobra.Command{
+		Use:   "show",
+		Short: "Print entries from the journal",
+		Long:  journalShowCmdLongDocs,
+		Run:   journalShowCmdRun,
+		Args:  cobra.NoArgs,
+	}
+
+	journalShowCmdLongDocs = `
+The show command prints the entries in the change journal, optionally
+limited to a range of sequence numbers.  Each line shows the sequence
+number, time, entity that made the change, the key, and the revision
+of the value that was written.
+`
+
+	journalShowFirst uint64
+	journalShowLast  uint64
+)
+
+func init() {
+	journalShowCmd.Flags().Uint64Var(&journalShowFirst, "from", 0, "First sequence number to show")
+	journalShowCmd.Flags().Uint64Var(&journalShowLast, "to", 0, "Last sequence number to show (0 for all)")
+	journalCmd.AddCommand(journalShowCmd)
+}
+
+func journalShowCmdRun(c *cobra.Command, args []string) {
+	j := openJournal()
+	defer j.Close()
+
+	entries, err := j.Range(journalShowFirst, journalShowLast)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading journal: %s\n", err)
+		os.Exit(1)
+	}
+
+	for _, e := range entries {
+		actor := e.Actor
+		if actor == "" {
+			actor = "-"
+		}
+		rev := e.Hash
+		if e.Deleted {
+			rev = "DELETED"
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\t%s\n", e.Seq, e.Time.Format(time.RFC3339), actor, e.Key, rev)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/internal/db/encrypted"
+)
+
+var (
+	keygenKVCmd = &cobra.Command{
+		Use:   "kv <id>",
+		Short: "Create a key for the encrypted KV store",
+		Long:  keygenKVCmdLongDocs,
+		Run:   keygenKVCmdRun,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	keygenKVCmdLongDocs = `The KV Keygen command generates a random key for use with the
+encrypted KV store wrapper.  The key is written to kv-<id>.tokenkey
+in the current directory, and should be moved to the keys directory
+alongside the token keys.  To start using the key, set
+db.encrypted.key to the ID.  IDs may only contain letters, digits,
+dashes and underscores.  Keep all the previous keys until every
+value has been rewritten, otherwise values sealed with an old key can
+no longer be read.
+`
+)
+
+func init() {
+	keygenCmd.AddCommand(keygenKVCmd)
+}
+
+func keygenKVCmdRun(cmd *cobra.Command, args []string) {
+	if !encrypted.ValidKeyID(args[0]) {
+		fmt.Fprintf(os.Stderr, "%v", encrypted.ErrBadKeyID)
+		os.Exit(1)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating key: %v", err)
+		os.Exit(1)
+	}
+
+	f := fmt.Sprintf("kv-%s.tokenkey", args[0])
+	if err := os.WriteFile(f, key, 0400); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing key: %v", err)
+		os.Exit(1)
+	}
+	fmt.Println("Key generated")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	keygenReplicationCmd = &cobra.Command{
+		Use:   "replication",
+		Short: "Create the shared secret for replication",
+		Long:  keygenReplicationCmdLongDocs,
+		Run:   keygenReplicationCmdRun,
+		Args:  cobra.NoArgs,
+	}
+
+	keygenReplicationCmdLongDocs = `The Replication Keygen command generates a random secret that
+replicas present to the primary when they ask for the change stream.
+The secret is written to replication-secret.tokenkey in the current
+directory, and the same file must be placed in the keys directory of
+the primary and of every replica.
+`
+)
+
+func init() {
+	keygenCmd.AddCommand(keygenReplicationCmd)
+}
+
+func keygenReplicationCmdRun(cmd *cobra.Command, args []string) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating secret: %v", err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile("replication-secret.tokenkey", key, 0400); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing secret: %v", err)
+		os.Exit(1)
+	}
+	fmt.Println("Secret generated")
+}
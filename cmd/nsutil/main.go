@@ -4,6 +4,8 @@ import (
 	"os"
 
 	"github.com/hashicorp/go-hclog"
+
+	_ "github.com/netauth/netauth/pkg/token/keyprovider/fs"
 )
 
 var (
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotCmd = &cobra.Command{
+		Use:   "snapshot",
+		Short: "Create and restore portable backups",
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	atomic "github.com/google/renameio"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/db/snapshot"
+	"github.com/netauth/netauth/internal/startup"
+)
+
+var (
+	snapshotCreateCmd = &cobra.Command{
+		Use:   "create <backend> <file>",
+		Short: "Write a snapshot of a datastore to a file",
+		Long:  snapshotCreateCmdLongDocs,
+		Run:   snapshotCreateCmdRun,
+		Args:  cobra.ExactArgs(2),
+	}
+
+	snapshotCreateCmdLongDocs = `
+The create command writes every entity and group in the named backend
+to a single checksummed file which can later be restored into any
+backend.  The datastore is opened read-only, so the filesystem and
+bitcask backends may be snapshotted while the server is running.  The
+bbolt backend must be stopped first.
+`
+)
+
+func init() {
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+}
+
+func snapshotCreateCmdRun(c *cobra.Command, args []string) {
+	startup.DoCallbacks()
+	ctx := context.Background()
+
+	viper.Set("db.readonly", true)
+	source, err := db.NewKV(args[0], nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing source: %s\n", err)
+		os.Exit(1)
+	}
+	defer source.Close()
+	source.SetEventFunc(func(db.Event) {})
+
+	var buf bytes.Buffer
+	n, err := snapshot.Write(ctx, &buf, source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading source: %s\n", err)
+		os.Exit(1)
+	}
+	if err := atomic.WriteFile(args[1], buf.Bytes(), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing snapshot: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Snapshot written to %s, contains %d objects.\n", args[1], n)
+}
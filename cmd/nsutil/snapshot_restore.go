@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/db/snapshot"
+	"github.com/netauth/netauth/internal/startup"
+)
+
+var (
+	snapshotRestoreCmd = &cobra.Command{
+		Use:   "restore <file> <backend>",
+		Short: "Restore a snapshot into a datastore",
+		Long:  snapshotRestoreCmdLongDocs,
+		Run:   snapshotRestoreCmdRun,
+		Args:  cobra.ExactArgs(2),
+	}
+
+	snapshotRestoreCmdLongDocs = `
+The restore command checks a snapshot file and then lists the objects
+that restoring it would add, change, or remove in the named backend.
+Objects that exist in the backend but not in the snapshot are only
+removed when --truncate is passed.  Nothing is changed unless
+--no-dry-run is also passed.
+`
+
+	snapshotRestoreCmdNoDryRun bool
+	snapshotRestoreCmdTruncate bool
+)
+
+func init() {
+	snapshotRestoreCmd.Flags().BoolVar(&snapshotRestoreCmdNoDryRun, "no-dry-run", false, "Make changes, potentially destructive.")
+	snapshotRestoreCmd.Flags().BoolVar(&snapshotRestoreCmdTruncate, "truncate", false, "Remove objects that are not in the snapshot.")
+
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+}
+
+func snapshotRestoreCmdRun(c *cobra.Command, args []string) {
+	startup.DoCallbacks()
+	ctx := context.Background()
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening snapshot: %s\n", err)
+		os.Exit(1)
+	}
+	s, err := snapshot.Read(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading snapshot: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Snapshot verified, created %s, contains %d objects.\n", s.Created.Format(time.RFC3339), len(s.Entries))
+
+	target, err := db.NewKV(args[1], nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing target: %s\n", err)
+		os.Exit(1)
+	}
+	defer target.Close()
+	target.SetEventFunc(func(db.Event) {})
+
+	d, err := snapshot.Compare(ctx, s, target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error comparing with target: %s\n", err)
+		os.Exit(1)
+	}
+	for _, k := range d.Added {
+		fmt.Printf("+ %s\n", k)
+	}
+	for _, k := range d.Changed {
+		fmt.Printf("~ %s\n", k)
+	}
+	if snapshotRestoreCmdTruncate {
+		for _, k := range d.Removed {
+			fmt.Printf("- %s\n", k)
+		}
+	}
+	fmt.Printf("%d objects will be added, %d changed", len(d.Added), len(d.Changed))
+	if snapshotRestoreCmdTruncate {
+		fmt.Printf(", and %d removed", len(d.Removed))
+	} else if len(d.Removed) > 0 {
+		fmt.Printf(", and %d not in the snapshot will be kept", len(d.Removed))
+	}
+	fmt.Println(".")
+
+	// Bail out at this point if we're in a dry-run, otherwise continue
+	if !snapshotRestoreCmdNoDryRun {
+		fmt.Println("You are in dry-run mode, pass --no-dry-run to make changes described above.")
+		return
+	}
+
+	if err := snapshot.Restore(ctx, s, target, d, snapshotRestoreCmdTruncate); err != nil {
+		fmt.Fprintf(os.Stderr, "Error restoring snapshot: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Restore complete.")
+}
@@ -25,7 +25,11 @@ var (
 	authChangeSecretLongDocs = `
 The change-secret command is used to change an entity's secret either
 reflexively (the entity requests the change) or administratively
-(another entity changes the secret).`
+(another entity changes the secret).
+
+If your own secret has expired, no token can be issued for it, but it
+can still be used to change itself.  The command notices this and
+carries on with the change, then gets a token with the new secret.`
 
 	authChangeSecretExample = `$ netauth auth change-secret
 Old Secret:
@@ -47,6 +51,7 @@ func init() {
 
 func authChangeSecretRun(cmd *cobra.Command, args []string) {
 	s := ""
+	expired := false
 
 	// Self change if unset
 	if csEntity == "" {
@@ -58,8 +63,17 @@ func authChangeSecretRun(cmd *cobra.Command, args []string) {
 		s = getSecret("Old Secret: ")
 
 		// Force the token to renew since we have the old
-		// secret.
-		refreshTokenWithSecret(s)
+		// secret.  An expired secret gets no token, but is
+		// still enough to change itself.
+		_, err := getTokenWithSecret(s)
+		switch {
+		case netauth.IsSecretExpired(err):
+			fmt.Println("Your secret has expired and must be changed")
+			expired = true
+		case err != nil:
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	} else {
 		refreshTokenWithSecret(getSecret("Your secret: "))
 	}
@@ -78,7 +92,9 @@ func authChangeSecretRun(cmd *cobra.Command, args []string) {
 	}
 
 	// Attach authorization
-	ctx = netauth.Authorize(ctx, token())
+	if !expired {
+		ctx = netauth.Authorize(ctx, token())
+	}
 
 	// Change the secret
 	if err := rpc.AuthChangeSecret(ctx, csEntity, csSecret, s); err != nil {
@@ -86,4 +102,8 @@ func authChangeSecretRun(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 	fmt.Println("Secret updated")
+
+	if expired {
+		refreshTokenWithSecret(csSecret)
+	}
 }
@@ -5,7 +5,6 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var (
@@ -33,7 +32,7 @@ func init() {
 
 func authDestroyTokenRun(cmd *cobra.Command, args []string) {
 	// Destroy the token
-	if err := tcache.DelToken(viper.GetString("entity")); err != nil {
+	if err := tcache.DelToken(tokenOwner()); err != nil {
 		fmt.Printf("Error during token destruction: %s\n", err)
 		os.Exit(1)
 	}
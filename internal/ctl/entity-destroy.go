@@ -22,7 +22,9 @@ var (
 	entityDestroyLongDocs = `
 Destroy the entity with the specified ID.  The entity is deleted
 immediately and without confirmation, please ensure you have typed the
-ID correctly.
+ID correctly.  The server keeps destroyed entities for a while before
+purging them, and until then they can be brought back with 'netauth
+entity restore'.
 
 It is possible to remove the entity running the command, but this is
 not recommended and may leave your system without any administrative
@@ -0,0 +1,47 @@
+package ctl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/pkg/netauth"
+)
+
+var (
+	entityExpireSecretCmd = &cobra.Command{
+		Use:     "expire-secret <ID>",
+		Short:   "Require the entity with the specified ID to change its secret",
+		Long:    entityExpireSecretLongDocs,
+		Example: entityExpireSecretExample,
+		Args:    cobra.ExactArgs(1),
+		Run:     entityExpireSecretRun,
+	}
+
+	entityExpireSecretLongDocs = `
+Expire the secret of the entity with the specified ID.  The entity
+can't authenticate until it changes its secret, which it can do with
+the expired secret using 'netauth auth change-secret'.
+
+The caller must possess the CHANGE_ENTITY_SECRET capability or be a
+GLOBAL_ROOT operator for this command to succeed.`
+
+	entityExpireSecretExample = `$ netauth entity expire-secret demo
+Secret Expired
+`
+)
+
+func init() {
+	entityCmd.AddCommand(entityExpireSecretCmd)
+}
+
+func entityExpireSecretRun(cmd *cobra.Command, args []string) {
+	ctx = netauth.Authorize(ctx, token())
+
+	if err := rpc.EntityExpireSecret(ctx, args[0]); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Secret Expired")
+}
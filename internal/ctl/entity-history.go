@@ -0,0 +1,66 @@
+package ctl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/pkg/netauth"
+
+	pb "github.com/netauth/protocol"
+)
+
+var (
+	entityHistoryCmd = &cobra.Command{
+		Use:     "history <ID>",
+		Short:   "Show the revision history of an entity",
+		Long:    entityHistoryLongDocs,
+		Example: entityHistoryExample,
+		Args:    cobra.ExactArgs(1),
+		Run:     entityHistoryRun,
+	}
+
+	entityHistoryLongDocs = `
+Show the revisions of an entity that the server still keeps, oldest
+first, along with who made each change and when.  Each revision lists
+the fields that changed from the one before it, with values that were
+removed marked by '-' and values that were added marked by '+'.  The
+oldest revision that is kept is compared against an empty entity.
+
+Secrets are never kept in the history.  An entity can be returned to
+an earlier revision with 'netauth entity rollback'.
+
+The caller must possess the MODIFY_ENTITY_META capability or be a
+GLOBAL_ROOT operator for this command to succeed.`
+
+	entityHistoryExample = `$ netauth entity history demo
+Revision 1 at 2021-09-18T10:02:11Z by admin
+  ID: +demo
+  Number: +10
+Revision 2 at 2021-09-20T14:45:37Z by admin
+  meta.Groups: +sudoers
+Revision 3 at 2021-09-21T09:12:03Z by jdoe
+  meta.Groups: -sudoers
+`
+)
+
+func init() {
+	entityCmd.AddCommand(entityHistoryCmd)
+}
+
+func entityHistoryRun(cmd *cobra.Command, args []string) {
+	ctx = netauth.Authorize(ctx, token())
+
+	h, err := rpc.EntityHistory(ctx, args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var prev *pb.Entity
+	for _, r := range h {
+		printRevision(r.Revision, netauth.Diff(prev, r.Entity))
+		prev = r.Entity
+	}
+}
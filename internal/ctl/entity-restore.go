@@ -0,0 +1,50 @@
+package ctl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/pkg/netauth"
+)
+
+var (
+	entityRestoreCmd = &cobra.Command{
+		Use:     "restore <ID>",
+		Short:   "Restore a destroyed entity",
+		Long:    entityRestoreLongDocs,
+		Example: entityRestoreExample,
+		Args:    cobra.ExactArgs(1),
+		Run:     entityRestoreRun,
+	}
+
+	entityRestoreLongDocs = `
+Restore the entity with the specified ID after it has been destroyed.
+The entity comes back exactly as it was when it was destroyed,
+including its secret, capabilities, and group memberships.
+
+An entity can only be restored until the server purges it, and only
+if no other entity has been created with the same ID or number in the
+meantime.
+
+The caller must possess the CREATE_ENTITY capability or be a
+GLOBAL_ROOT operator for this command to succeed.`
+
+	entityRestoreExample = `$ netauth entity restore demo
+Entity Restored`
+)
+
+func init() {
+	entityCmd.AddCommand(entityRestoreCmd)
+}
+
+func entityRestoreRun(cmd *cobra.Command, args []string) {
+	ctx = netauth.Authorize(ctx, token())
+
+	if err := rpc.EntityRestore(ctx, args[0]); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Entity Restored")
+}
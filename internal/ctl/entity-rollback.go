@@ -0,0 +1,54 @@
+package ctl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/pkg/netauth"
+)
+
+var (
+	entityRollbackTo int
+
+	entityRollbackCmd = &cobra.Command{
+		Use:     "rollback <ID> --to <rev>",
+		Short:   "Return an entity to an earlier revision",
+		Long:    entityRollbackLongDocs,
+		Example: entityRollbackExample,
+		Args:    cobra.ExactArgs(1),
+		Run:     entityRollbackRun,
+	}
+
+	entityRollbackLongDocs = `
+Return the entity with the specified ID to the way it was at an
+earlier revision, as shown by 'netauth entity history'.  Everything
+but the entity's ID, number, and secret is replaced, including its
+capabilities and group memberships.  The rollback is made through the
+same checks as any other change and is recorded in the history as a
+new revision.
+
+The caller must possess the MODIFY_ENTITY_META capability or be a
+GLOBAL_ROOT operator for this command to succeed.`
+
+	entityRollbackExample = `$ netauth entity rollback demo --to 2
+Entity Rolled Back
+`
+)
+
+func init() {
+	entityCmd.AddCommand(entityRollbackCmd)
+	entityRollbackCmd.Flags().IntVar(&entityRollbackTo, "to", 0, "Revision to return to")
+	entityRollbackCmd.MarkFlagRequired("to")
+}
+
+func entityRollbackRun(cmd *cobra.Command, args []string) {
+	ctx = netauth.Authorize(ctx, token())
+
+	if err := rpc.EntityRollback(ctx, args[0], entityRollbackTo); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Entity Rolled Back")
+}
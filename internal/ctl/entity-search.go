@@ -5,10 +5,16 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/pkg/netauth"
 )
 
 var (
-	entitySearchFields string
+	entitySearchFields    string
+	entitySearchPageSize  int
+	entitySearchPageToken string
+	entitySearchSort      []string
+	entitySearchAll       bool
 
 	entitySearchCmd = &cobra.Command{
 		Use:     "search <expression>",
@@ -29,7 +35,17 @@ only certain fields pass a comma separated list to the --fields
 argument of the field names you wish to display.
 
 Some fields on entities are part of the metadata, to address these
-fields in a search prefix them with 'meta.' as in 'meta.DisplayName'.`
+fields in a search prefix them with 'meta.' as in 'meta.DisplayName'.
+
+KV data can be searched by key as in 'kv.department:infra'.  Values
+are matched whole, so use a wildcard to match part of one.  Only the
+keys the server has been configured to index can be searched.
+
+Results are returned in pages of --page-size entities, ordered by ID
+unless other fields are given with --sort.  Prefix a sort field with
+'-' to reverse it.  When more results are available a token for the
+next page is printed to stderr, which can be passed back with
+--page-token.  Use --all to fetch every page.`
 
 	entitySearchExample = `$ netauth entity search 'ID:demo*'
 ID: demo2
@@ -51,21 +67,40 @@ shell: /bin/bash
 func init() {
 	entityCmd.AddCommand(entitySearchCmd)
 	entitySearchCmd.Flags().StringVar(&entitySearchFields, "fields", "", "Fields to be displayed")
+	entitySearchCmd.Flags().IntVar(&entitySearchPageSize, "page-size", 100, "Number of entities to fetch at once")
+	entitySearchCmd.Flags().StringVar(&entitySearchPageToken, "page-token", "", "Continue from an earlier page")
+	entitySearchCmd.Flags().StringSliceVar(&entitySearchSort, "sort", nil, "Fields to sort by")
+	entitySearchCmd.Flags().BoolVar(&entitySearchAll, "all", false, "Fetch all pages")
 }
 
 func entitySearchRun(cmd *cobra.Command, args []string) {
-	// Obtain entity info
-	res, err := rpc.EntitySearch(ctx, args[0])
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	opts := netauth.SearchOptions{
+		PageSize:  entitySearchPageSize,
+		PageToken: entitySearchPageToken,
+		Sort:      entitySearchSort,
 	}
 
-	// Print the fields
-	for i, e := range res {
-		printEntity(e, entitySearchFields)
-		if i < len(res)-1 {
-			fmt.Println("---")
+	shown := 0
+	for {
+		// Obtain entity info
+		res, page, err := rpc.EntitySearchPage(ctx, args[0], opts)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// Print the fields
+		for _, e := range res {
+			if shown > 0 {
+				fmt.Println("---")
+			}
+			printEntity(e, entitySearchFields)
+			shown++
+		}
+
+		if !morePages(page, entitySearchAll) {
+			return
 		}
+		opts.PageToken = page.NextPageToken
 	}
 }
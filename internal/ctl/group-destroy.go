@@ -22,7 +22,9 @@ var (
 	groupDestroyLongDocs = `
 Destroy the group with the specified name.  The group is deleted
 immediately and without confirmation, please ensure you have typed the
-ID correctly.
+ID correctly.  The server keeps destroyed groups for a while before
+purging them, and until then they can be brought back with 'netauth
+group restore'.
 
 Referential integrity is not checked before deletion.  You are
 strongly encouraged to empty groups before deleting them as well as
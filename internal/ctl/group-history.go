@@ -0,0 +1,67 @@
+package ctl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/pkg/netauth"
+
+	pb "github.com/netauth/protocol"
+)
+
+var (
+	groupHistoryCmd = &cobra.Command{
+		Use:     "history <name>",
+		Short:   "Show the revision history of a group",
+		Long:    groupHistoryLongDocs,
+		Example: groupHistoryExample,
+		Args:    cobra.ExactArgs(1),
+		Run:     groupHistoryRun,
+	}
+
+	groupHistoryLongDocs = `
+Show the revisions of a group that the server still keeps, oldest
+first, along with who made each change and when.  Each revision lists
+the fields that changed from the one before it, with values that were
+removed marked by '-' and values that were added marked by '+'.  The
+oldest revision that is kept is compared against an empty group.
+
+Direct members are stored on entities rather than on the group, so
+look at the history of an entity to see when it joined or left a
+group.  A group can be returned to an earlier revision with 'netauth
+group rollback'.
+
+The caller must possess the MODIFY_GROUP_META capability or be a
+GLOBAL_ROOT operator for this command to succeed.`
+
+	groupHistoryExample = `$ netauth group history demo-group
+Revision 1 at 2021-09-18T10:05:42Z by admin
+  Name: +demo-group
+  Number: +10
+Revision 2 at 2021-09-19T16:20:00Z by admin
+  DisplayName: +Demo Group
+  Expansions: +INCLUDE:other-group
+`
+)
+
+func init() {
+	groupCmd.AddCommand(groupHistoryCmd)
+}
+
+func groupHistoryRun(cmd *cobra.Command, args []string) {
+	ctx = netauth.Authorize(ctx, token())
+
+	h, err := rpc.GroupHistory(ctx, args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var prev *pb.Group
+	for _, r := range h {
+		printRevision(r.Revision, netauth.Diff(prev, r.Group))
+		prev = r.Group
+	}
+}
@@ -0,0 +1,52 @@
+package ctl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/pkg/netauth"
+)
+
+var (
+	groupRestoreCmd = &cobra.Command{
+		Use:     "restore <name>",
+		Short:   "Restore a destroyed group",
+		Long:    groupRestoreLongDocs,
+		Example: groupRestoreExample,
+		Args:    cobra.ExactArgs(1),
+		Run:     groupRestoreRun,
+	}
+
+	groupRestoreLongDocs = `
+Restore the group with the specified name after it has been destroyed.
+The group comes back exactly as it was when it was destroyed.  Group
+memberships are held by entities, so entities that were members of the
+group when it was destroyed are members again once it is restored.
+
+A group can only be restored until the server purges it, and only if
+no other group has been created with the same name or number in the
+meantime.
+
+The caller must possess the CREATE_GROUP capability or be a
+GLOBAL_ROOT operator for this command to succeed.
+`
+
+	groupRestoreExample = `$ netauth group restore demo-group
+Group Restored`
+)
+
+func init() {
+	groupCmd.AddCommand(groupRestoreCmd)
+}
+
+func groupRestoreRun(cmd *cobra.Command, args []string) {
+	ctx = netauth.Authorize(ctx, token())
+
+	if err := rpc.GroupRestore(ctx, args[0]); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Group Restored")
+}
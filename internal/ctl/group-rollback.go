@@ -0,0 +1,55 @@
+package ctl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/pkg/netauth"
+)
+
+var (
+	groupRollbackTo int
+
+	groupRollbackCmd = &cobra.Command{
+		Use:     "rollback <name> --to <rev>",
+		Short:   "Return a group to an earlier revision",
+		Long:    groupRollbackLongDocs,
+		Example: groupRollbackExample,
+		Args:    cobra.ExactArgs(1),
+		Run:     groupRollbackRun,
+	}
+
+	groupRollbackLongDocs = `
+Return the group with the specified name to the way it was at an
+earlier revision, as shown by 'netauth group history'.  Everything but
+the group's name and number is replaced.  Expansions in the earlier
+revision are checked as though they were being added again, so a
+rollback that would include a group that no longer exists or create
+a cycle fails.  The rollback is recorded in the history as a new
+revision.
+
+The caller must possess the MODIFY_GROUP_META capability or be a
+GLOBAL_ROOT operator for this command to succeed.`
+
+	groupRollbackExample = `$ netauth group rollback demo-group --to 1
+Group Rolled Back
+`
+)
+
+func init() {
+	groupCmd.AddCommand(groupRollbackCmd)
+	groupRollbackCmd.Flags().IntVar(&groupRollbackTo, "to", 0, "Revision to return to")
+	groupRollbackCmd.MarkFlagRequired("to")
+}
+
+func groupRollbackRun(cmd *cobra.Command, args []string) {
+	ctx = netauth.Authorize(ctx, token())
+
+	if err := rpc.GroupRollback(ctx, args[0], groupRollbackTo); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("Group Rolled Back")
+}
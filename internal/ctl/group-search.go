@@ -5,10 +5,16 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/pkg/netauth"
 )
 
 var (
-	groupSearchFields string
+	groupSearchFields    string
+	groupSearchPageSize  int
+	groupSearchPageToken string
+	groupSearchSort      []string
+	groupSearchAll       bool
 
 	groupSearchCmd = &cobra.Command{
 		Use:     "search <expression>",
@@ -26,7 +32,17 @@ sure to quote the expression if making a complex query.
 
 All set fields on returned groups will be displayed.  To display
 only certain fields pass a comma separated list to the --fields
-argument of the field names you wish to display.`
+argument of the field names you wish to display.
+
+KV data can be searched by key as in 'kv.department:infra'.  Values
+are matched whole, so use a wildcard to match part of one.  Only the
+keys the server has been configured to index can be searched.
+
+Results are returned in pages of --page-size groups, ordered by name
+unless other fields are given with --sort.  Prefix a sort field with
+'-' to reverse it.  When more results are available a token for the
+next page is printed to stderr, which can be passed back with
+--page-token.  Use --all to fetch every page.`
 
 	groupSearchExample = `$ netauth group search 'Name:example*'
 Name: example-group
@@ -43,20 +59,39 @@ Number: 11
 func init() {
 	groupCmd.AddCommand(groupSearchCmd)
 	groupSearchCmd.Flags().StringVar(&groupSearchFields, "fields", "", "Fields to be displayed")
+	groupSearchCmd.Flags().IntVar(&groupSearchPageSize, "page-size", 100, "Number of groups to fetch at once")
+	groupSearchCmd.Flags().StringVar(&groupSearchPageToken, "page-token", "", "Continue from an earlier page")
+	groupSearchCmd.Flags().StringSliceVar(&groupSearchSort, "sort", nil, "Fields to sort by")
+	groupSearchCmd.Flags().BoolVar(&groupSearchAll, "all", false, "Fetch all pages")
 }
 
 func groupSearchRun(cmd *cobra.Command, args []string) {
-	res, err := rpc.GroupSearch(ctx, args[0])
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	opts := netauth.SearchOptions{
+		PageSize:  groupSearchPageSize,
+		PageToken: groupSearchPageToken,
+		Sort:      groupSearchSort,
 	}
 
-	// Print the fields
-	for i, g := range res {
-		printGroup(g, groupSearchFields)
-		if i < len(res)-1 {
-			fmt.Println("---")
+	shown := 0
+	for {
+		res, page, err := rpc.GroupSearchPage(ctx, args[0], opts)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// Print the fields
+		for _, g := range res {
+			if shown > 0 {
+				fmt.Println("---")
+			}
+			printGroup(g, groupSearchFields)
+			shown++
+		}
+
+		if !morePages(page, groupSearchAll) {
+			return
 		}
+		opts.PageToken = page.NextPageToken
 	}
 }
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/bgentry/speakeasy"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/netauth/netauth/pkg/netauth"
 	"github.com/netauth/netauth/pkg/token/cache"
 
 	pb "github.com/netauth/protocol"
@@ -36,7 +38,7 @@ func getSecret(prompt string) string {
 // token.  Since this is for the CLI, it always uses the value of the
 // entity that the call is being made as.
 func token() string {
-	t, err := tcache.GetToken(viper.GetString("entity"))
+	t, err := tcache.GetToken(tokenOwner())
 	switch {
 	case err == cache.ErrNoCachedToken:
 		return refreshToken()
@@ -49,6 +51,17 @@ func token() string {
 	}
 }
 
+// tokenOwner returns the name that the token of the entity the call
+// is being made as is cached under.  Tokens from a realm other than
+// the default one are cached separately, since a token is only valid
+// in the realm that issued it.
+func tokenOwner() string {
+	if r := viper.GetString("core.realm"); r != "" {
+		return viper.GetString("entity") + "@" + r
+	}
+	return viper.GetString("entity")
+}
+
 // tokenIsExpired checks if a token is no longer valid.  Technically
 // it checks if the CLI can validate it, but in this case we can treat
 // a validation error as cause to renew it.
@@ -65,16 +78,30 @@ func refreshToken() string {
 
 // refreshTokenWithSecret performs an immediate refresh of the token.
 func refreshTokenWithSecret(secret string) string {
-	t, err := rpc.AuthGetToken(ctx, viper.GetString("entity"), secret)
+	t, err := getTokenWithSecret(secret)
+	if netauth.IsSecretExpired(err) {
+		fmt.Println("Your secret has expired, change it with 'netauth auth change-secret'")
+		os.Exit(1)
+	}
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	return t
+}
+
+// getTokenWithSecret acquires a token and caches it, returning any
+// error to the caller.
+func getTokenWithSecret(secret string) (string, error) {
+	t, err := rpc.AuthGetToken(ctx, viper.GetString("entity"), secret)
+	if err != nil {
+		return "", err
+	}
 
-	if err := tcache.PutToken(viper.GetString("entity"), t); err != nil {
+	if err := tcache.PutToken(tokenOwner(), t); err != nil {
 		fmt.Fprintf(os.Stderr, "Error caching token: %v\n", err)
 	}
-	return t
+	return t, nil
 }
 
 func kvArgs(cmd *cobra.Command, args []string) error {
@@ -213,3 +240,39 @@ func printGroup(group *pb.Group, fields string) {
 		}
 	}
 }
+
+// morePages reports whether a paged search should fetch the next
+// page.  If there are more pages but all wasn't requested, a note
+// on how to continue is printed to stderr so that the results on
+// stdout are left intact.
+func morePages(page netauth.SearchPage, all bool) bool {
+	if page.NextPageToken == "" {
+		return false
+	}
+	if all {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "%d results in total, continue with --page-token %s or use --all\n",
+		page.Total, page.NextPageToken)
+	return false
+}
+
+// printRevision prints one revision from the history of an entity or
+// group, along with what changed since the revision before it.
+func printRevision(r netauth.Revision, changes []netauth.FieldChange) {
+	actor := r.Actor
+	if actor == "" {
+		actor = "unknown"
+	}
+	fmt.Printf("Revision %d at %s by %s\n", r.Rev, r.Time.Format(time.RFC3339), actor)
+	for _, c := range changes {
+		var vals []string
+		for _, v := range c.Removed {
+			vals = append(vals, "-"+v)
+		}
+		for _, v := range c.Added {
+			vals = append(vals, "+"+v)
+		}
+		fmt.Printf("  %s: %s\n", c.Field, strings.Join(vals, " "))
+	}
+}
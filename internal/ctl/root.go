@@ -14,6 +14,8 @@ import (
 	tkn "github.com/netauth/netauth/pkg/token"
 	"github.com/netauth/netauth/pkg/token/cache"
 	"github.com/netauth/netauth/pkg/token/keyprovider"
+
+	pb "github.com/netauth/protocol"
 )
 
 var (
@@ -25,6 +27,9 @@ var (
 	cfg        string
 	rootEntity string
 	secret     string
+	realm      string
+	trace      bool
+	dryRun     bool
 
 	ctx context.Context
 
@@ -50,11 +55,15 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfg, "config", "", "Use an alternate config file")
 	rootCmd.PersistentFlags().StringVar(&rootEntity, "entity", "", "Specify a non-default entity to make requests as")
 	rootCmd.PersistentFlags().StringVar(&secret, "secret", "", "Specify the request secret on the command line")
+	rootCmd.PersistentFlags().StringVar(&realm, "realm", "", "Specify a non-default realm to make requests in")
+	rootCmd.PersistentFlags().BoolVar(&trace, "trace", false, "Print the hooks that the server runs for each request (requires GLOBAL_ROOT)")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Check changes and print what they would save without saving them")
 
 	viper.BindPFlag("entity", rootCmd.PersistentFlags().Lookup("entity"))
 	viper.BindEnv("entity")
 	viper.BindPFlag("secret", rootCmd.PersistentFlags().Lookup("secret"))
 	viper.BindEnv("secret")
+	viper.BindPFlag("core.realm", rootCmd.PersistentFlags().Lookup("realm"))
 }
 
 func onInit() {
@@ -92,7 +101,7 @@ func initialize(*cobra.Command, []string) {
 		os.Exit(1)
 	}
 
-	tsvc, err = tkn.New(viper.GetString("token.backend"), kp)
+	tsvc, err = tkn.New(viper.GetString("token.backend"), keyprovider.ForRealm(kp, viper.GetString("core.realm")))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing token service: %v", err)
 		os.Exit(1)
@@ -106,4 +115,33 @@ func initialize(*cobra.Command, []string) {
 
 	ctx = context.Background()
 	rpc.SetServiceName("netauth")
+	if trace {
+		rpc.SetTrace(printTrace)
+	}
+	if dryRun {
+		rpc.SetDryRun(printDryRun)
+	}
+}
+
+// printTrace prints the hooks that the server ran for a request.  It
+// goes to stderr so that it doesn't get mixed up with the output of
+// the command.
+func printTrace(method string, hooks []string) {
+	fmt.Fprintf(os.Stderr, "Trace of %s:\n", method)
+	for _, h := range hooks {
+		fmt.Fprintf(os.Stderr, "  %s\n", h)
+	}
+}
+
+// printDryRun prints what a change would have saved.
+func printDryRun(method string, entities []*pb.Entity, groups []*pb.Group) {
+	fmt.Printf("Dry run of %s, nothing was saved.\n", method)
+	for _, e := range entities {
+		fmt.Println("Entity would be saved as:")
+		printEntity(e, "")
+	}
+	for _, g := range groups {
+		fmt.Println("Group would be saved as:")
+		printGroup(g, "")
+	}
 }
@@ -0,0 +1,67 @@
+package ctl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netauth/netauth/pkg/netauth"
+)
+
+var (
+	systemChainsCmd = &cobra.Command{
+		Use:     "chains",
+		Short:   "List the hook chains of the server",
+		Long:    systemChainsLongDocs,
+		Example: systemChainsExample,
+		Args:    cobra.NoArgs,
+		Run:     systemChainsRun,
+	}
+
+	systemChainsLongDocs = `
+The chains command lists every entity and group chain that the server
+has, along with the hooks in each chain in the order that they run.
+Hooks that plugins provide are listed alongside the built in ones,
+which makes this the place to start when a request fails in a way
+that isn't expected.  To see which hooks ran for a single request and
+which of them failed, repeat the request with --trace.  Both require
+a token with GLOBAL_ROOT.`
+
+	systemChainsExample = `$ netauth system chains
+Entity chains:
+  CREATE
+    0   fail-on-existing-entity
+    50  set-entity-id
+    ...
+Group chains:
+  ...
+`
+)
+
+func init() {
+	systemCmd.AddCommand(systemChainsCmd)
+}
+
+func systemChainsRun(cmd *cobra.Command, args []string) {
+	ctx = netauth.Authorize(ctx, token())
+	entity, group, err := rpc.SystemChains(ctx)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Entity chains:")
+	printChains(entity)
+	fmt.Println("Group chains:")
+	printChains(group)
+}
+
+func printChains(chains []netauth.Chain) {
+	for _, c := range chains {
+		fmt.Printf("  %s\n", c.Name)
+		for _, h := range c.Hooks {
+			fmt.Printf("    %-3d %s\n", h.Priority, h.Name)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"path"
+
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+// A Batch collects changes to entities and groups so that they can be
+// committed to the KVStore together.  A Batch is not safe for
+// concurrent use.
+type Batch struct {
+	ops []KVOp
+
+	// checks holds the revision that each key must still be at
+	// when the batch is committed.
+	checks map[string]string
+
+	// undo holds what has to be given back if the batch is
+	// never committed, such as reserved numbers.
+	undo []func()
+}
+
+// batchKey locates the batch that Atomically collects saves in.
+type batchKey struct{}
+
+// batchFrom returns the batch held by the context, or nil if saves
+// made with the context are written straight away.
+func batchFrom(ctx context.Context) *Batch {
+	b, _ := ctx.Value(batchKey{}).(*Batch)
+	return b
+}
+
+// SaveEntity adds a write of the entity to the batch.
+func (b *Batch) SaveEntity(e *types.Entity) {
+	// This can't fail for the same reasons as in DB.SaveEntity.
+	v, _ := proto.Marshal(e)
+	b.ops = append(b.ops, KVOp{Key: path.Join("/entities", e.GetID()), Value: v})
+}
+
+// DeleteEntity adds the removal of an entity to the batch.
+func (b *Batch) DeleteEntity(ID string) {
+	b.ops = append(b.ops, KVOp{Key: path.Join("/entities", ID), Delete: true})
+}
+
+// SaveGroup adds a write of the group to the batch.
+func (b *Batch) SaveGroup(g *types.Group) {
+	// This can't fail for the same reasons as in DB.SaveGroup.
+	v, _ := proto.Marshal(g)
+	b.ops = append(b.ops, KVOp{Key: path.Join("/groups", g.GetName()), Value: v})
+}
+
+// DeleteGroup adds the removal of a group to the batch.
+func (b *Batch) DeleteGroup(name string) {
+	b.ops = append(b.ops, KVOp{Key: path.Join("/groups", name), Delete: true})
+}
+
+// pending returns the value that the batch will write to k, and
+// whether the batch deletes it instead.  The last change to k wins.
+func (b *Batch) pending(k string) ([]byte, bool, bool) {
+	for i := len(b.ops) - 1; i >= 0; i-- {
+		if b.ops[i].Key == k {
+			return b.ops[i].Value, b.ops[i].Delete, true
+		}
+	}
+	return nil, false, false
+}
+
+// put adds a write of v to k in place of any earlier change to k.  If
+// check is set the write is only made if k is at the revision want:
+// a key that the batch already changes is checked now, and any other
+// key is checked when the batch is committed.  Writing back a value
+// exactly as it was loaded only adds the check, so a chain that
+// doesn't change anything, such as authentication, commits nothing,
+// can't conflict, and can run on a server that can't write.
+func (b *Batch) put(k string, v []byte, want string, check bool) error {
+	cur, deleted, ok := b.pending(k)
+	switch {
+	case ok && check:
+		have := Revision(cur)
+		if deleted {
+			have = absentRevision
+		}
+		if have != want {
+			return ErrRevisionConflict
+		}
+	case check:
+		if b.checks == nil {
+			b.checks = make(map[string]string)
+		}
+		b.checks[k] = want
+		if want == Revision(v) {
+			return nil
+		}
+	}
+
+	ops := b.ops[:0]
+	for _, op := range b.ops {
+		if op.Key != k {
+			ops = append(ops, op)
+		}
+	}
+	b.ops = append(ops, KVOp{Key: k, Value: v})
+	return nil
+}
+
+// Batch calls f to populate a batch of changes and then commits the
+// changes to the KVStore.  If f returns an error nothing is
+// committed.  When the KVStore advertises KVBatch the changes are
+// applied all-or-nothing, otherwise they are applied in order and a
+// failure part way through may leave some of them applied.
+func (db *DB) Batch(ctx context.Context, f func(*Batch) error) error {
+	b := new(Batch)
+	if err := f(b); err != nil {
+		return err
+	}
+	return db.commitBatch(ctx, b)
+}
+
+// Atomically runs f with a context in which saves of entities and
+// groups are collected instead of written, and then commits them in
+// one batch as Batch does.  Loads made with the context see the saves
+// that have been collected so far.  If f returns an error nothing is
+// written, and revision conflicts are found when the batch is
+// committed.  Numbers that were reserved with the context are
+// released if the batch isn't committed.  A call with a context that
+// is already collecting saves joins the batch of the outer call.
+// Deletions, tombstones and restores are not collected and take
+// effect straight away.
+func (db *DB) Atomically(ctx context.Context, f func(context.Context) error) error {
+	if batchFrom(ctx) != nil {
+		return f(ctx)
+	}
+	b := new(Batch)
+	err := f(context.WithValue(ctx, batchKey{}, b))
+	if err == nil {
+		err = db.commitBatch(ctx, b)
+	}
+	if err != nil {
+		for _, u := range b.undo {
+			u()
+		}
+	}
+	return err
+}
+
+// commitBatch checks the revisions that the batch depends on and then
+// commits it along with the history it adds.  A batch that writes
+// nothing can't overwrite anything, so its revisions aren't checked.
+func (db *DB) commitBatch(ctx context.Context, b *Batch) error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+
+	db.wmu.Lock()
+	defer db.wmu.Unlock()
+	for k, want := range b.checks {
+		if err := db.checkRevision(ctx, k, want); err != nil {
+			return err
+		}
+	}
+	ops, err := db.withHistory(ctx, b.ops)
+	if err != nil {
+		return err
+	}
+	ops, err = db.withSecretHistory(ctx, ops)
+	if err != nil {
+		return err
+	}
+	return db.commit(ctx, ops)
+}
+
+// commit applies ops to the KVStore, atomically if it is able to.
+// The caller must hold wmu.
+func (db *DB) commit(ctx context.Context, ops []KVOp) error {
+	if kvb, ok := db.kv.(KVBatcher); ok && hasCapability(db.kv.Capabilities(), KVBatch) {
+		if err := kvb.Batch(ctx, ops); err != nil {
+			db.log.Warn("Error committing batch", "error", err, "ops", len(ops))
+			return ErrInternalError
+		}
+		return nil
+	}
+
+	db.log.Debug("KVStore does not support batches, changes will not be atomic", "ops", len(ops))
+	for _, op := range ops {
+		var err error
+		if op.Delete {
+			err = db.kv.Del(ctx, op.Key)
+		} else {
+			err = db.kv.Put(ctx, op.Key, op.Value)
+		}
+		if err != nil && err != ErrNoValue {
+			db.log.Warn("Error applying batch operation", "error", err, "key", op.Key)
+			return ErrInternalError
+		}
+	}
+	return nil
+}
+
+// MarshalBatch serializes a set of operations.  This is exported so
+// that KVStores which have to build atomicity on top of an intent
+// record can share a single format.
+func MarshalBatch(ops []KVOp) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(ops); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBatch is the inverse of MarshalBatch.
+func UnmarshalBatch(b []byte) ([]KVOp, error) {
+	var ops []KVOp
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// hasCapability checks for the presence of a single capability in a
+// list.
+func hasCapability(caps []KVCapability, c KVCapability) bool {
+	for _, have := range caps {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+func TestBatchAtomic(t *testing.T) {
+	ctx := context.Background()
+	RegisterKV("batch-mock", newBatchMockKV)
+	m, err := New("batch-mock")
+	assert.Nil(t, err)
+
+	ops := []KVOp{
+		{Key: "/entities/entity1", Value: goodEntityBytes1},
+		{Key: "/groups/group1", Delete: true},
+	}
+	m.kv.(*batchMockKV).On("Capabilities").Return([]KVCapability{KVMutable, KVBatch})
+	m.kv.(*batchMockKV).On("Batch", ops).Return(nil).Once()
+	m.kv.(*batchMockKV).On("Batch", ops).Return(errors.New("disk on fire")).Once()
+
+	f := func(b *Batch) error {
+		b.SaveEntity(&types.Entity{ID: proto.String("entity1"), Number: proto.Int32(1)})
+		b.DeleteGroup("group1")
+		return nil
+	}
+
+	assert.Nil(t, m.Batch(ctx, f))
+	assert.Equal(t, ErrInternalError, m.Batch(ctx, f))
+	m.kv.(*batchMockKV).AssertNumberOfCalls(t, "Batch", 2)
+}
+
+func TestBatchFallback(t *testing.T) {
+	ctx := context.Background()
+	RegisterKV("mock", newMockKV)
+	m, err := New("mock")
+	assert.Nil(t, err)
+
+	m.kv.(*mockKV).On("Capabilities").Return([]KVCapability{KVMutable})
+	m.kv.(*mockKV).On("Put", "/groups/group1", goodGroupBytes1).Return(nil)
+	m.kv.(*mockKV).On("Del", "/entities/entity1").Return(ErrNoValue)
+	m.kv.(*mockKV).On("Del", "/entities/bad").Return(errors.New("disk on fire"))
+
+	assert.Nil(t, m.Batch(ctx, func(b *Batch) error {
+		b.SaveGroup(&types.Group{Name: proto.String("group1"), Number: proto.Int32(1)})
+		b.DeleteEntity("entity1")
+		return nil
+	}))
+
+	assert.Equal(t, ErrInternalError, m.Batch(ctx, func(b *Batch) error {
+		b.DeleteEntity("bad")
+		return nil
+	}))
+}
+
+func TestBatchAbort(t *testing.T) {
+	ctx := context.Background()
+	RegisterKV("mock", newMockKV)
+	m, err := New("mock")
+	assert.Nil(t, err)
+
+	// Nothing may reach the KVStore if the batch is abandoned,
+	// and an empty batch has nothing to commit.
+	errAbort := errors.New("abort")
+	assert.Equal(t, errAbort, m.Batch(ctx, func(b *Batch) error {
+		b.DeleteEntity("entity1")
+		return errAbort
+	}))
+	assert.Nil(t, m.Batch(ctx, func(*Batch) error { return nil }))
+	m.kv.(*mockKV).AssertNotCalled(t, "Del", "/entities/entity1")
+}
+
+func TestAtomically(t *testing.T) {
+	RegisterKV("map", newMapKV)
+	m, err := New("map")
+	assert.Nil(t, err)
+	kv := m.kv.(*mapKV)
+	ctx := context.Background()
+
+	// A failure after the first save leaves nothing behind.
+	errAbort := errors.New("abort")
+	assert.Equal(t, errAbort, m.Atomically(ctx, func(ctx context.Context) error {
+		assert.Nil(t, m.SaveEntity(ctx, &types.Entity{ID: proto.String("foo")}))
+		assert.Nil(t, m.SaveGroup(ctx, &types.Group{Name: proto.String("bar")}))
+		return errAbort
+	}))
+	assert.Empty(t, kv.m)
+
+	// Saves are seen by loads made inside the batch, and only the
+	// last save of each object is written.
+	assert.Nil(t, m.Atomically(ctx, func(ctx context.Context) error {
+		assert.Nil(t, m.SaveEntity(ctx, &types.Entity{ID: proto.String("foo"), Number: proto.Int32(1)}))
+		e, err := m.LoadEntity(ctx, "foo")
+		assert.Nil(t, err)
+		e.Number = proto.Int32(2)
+		assert.Nil(t, m.SaveEntity(ctx, e))
+		_, err = m.LoadEntity(context.Background(), "foo")
+		assert.Equal(t, ErrUnknownEntity, err, "save was written before the batch was committed")
+		return m.SaveGroup(ctx, &types.Group{Name: proto.String("bar")})
+	}))
+	e, err := m.LoadEntity(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), e.GetNumber())
+	_, err = m.LoadGroup(ctx, "bar")
+	assert.Nil(t, err)
+
+	// A change made outside the batch to something it loaded
+	// makes the whole batch fail when it is committed.
+	assert.Equal(t, ErrRevisionConflict, m.Atomically(WithRevisions(ctx), func(ctx context.Context) error {
+		e, err := m.LoadEntity(ctx, "foo")
+		assert.Nil(t, err)
+		e.Number = proto.Int32(3)
+		assert.Nil(t, m.SaveEntity(ctx, e))
+		assert.Nil(t, m.SaveGroup(ctx, &types.Group{Name: proto.String("baz")}))
+		return m.SaveEntity(context.Background(), &types.Entity{ID: proto.String("foo"), Number: proto.Int32(4)})
+	}))
+	e, err = m.LoadEntity(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(4), e.GetNumber())
+	_, err = m.LoadGroup(ctx, "baz")
+	assert.Equal(t, ErrUnknownGroup, err)
+}
+
+// refusingKV is a mapKV that can't be written to, like a follower
+// in a cluster.
+type refusingKV struct{ *mapKV }
+
+func (refusingKV) Put(context.Context, string, []byte) error { return errors.New("read only") }
+func (refusingKV) Del(context.Context, string) error         { return errors.New("read only") }
+
+func TestAtomicallyUnchanged(t *testing.T) {
+	ctx := WithRevisions(context.Background())
+	kv := &mapKV{m: make(map[string][]byte)}
+	kv.m["/entities/foo"], _ = proto.Marshal(&types.Entity{ID: proto.String("foo"), Number: proto.Int32(1)})
+	m, err := open(refusingKV{kv})
+	assert.Nil(t, err)
+
+	// Saving an entity exactly as it was loaded writes nothing.
+	assert.Nil(t, m.Atomically(ctx, func(ctx context.Context) error {
+		e, err := m.LoadEntity(ctx, "foo")
+		assert.Nil(t, err)
+		return m.SaveEntity(ctx, e)
+	}))
+
+	// Nor does it conflict with a concurrent change, since there
+	// is nothing to overwrite.
+	assert.Nil(t, m.Atomically(WithRevisions(context.Background()), func(ctx context.Context) error {
+		e, err := m.LoadEntity(ctx, "foo")
+		assert.Nil(t, err)
+		kv.m["/entities/foo"], _ = proto.Marshal(&types.Entity{ID: proto.String("foo"), Number: proto.Int32(2)})
+		return m.SaveEntity(ctx, e)
+	}))
+
+	// But once the batch writes something, every revision it
+	// depends on is checked.
+	kv2 := &mapKV{m: make(map[string][]byte)}
+	kv2.m["/entities/foo"], _ = proto.Marshal(&types.Entity{ID: proto.String("foo"), Number: proto.Int32(1)})
+	m, err = open(kv2)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrRevisionConflict, m.Atomically(WithRevisions(context.Background()), func(ctx context.Context) error {
+		e, err := m.LoadEntity(ctx, "foo")
+		assert.Nil(t, err)
+		kv2.m["/entities/foo"], _ = proto.Marshal(&types.Entity{ID: proto.String("foo"), Number: proto.Int32(2)})
+		if err := m.SaveEntity(ctx, e); err != nil {
+			return err
+		}
+		return m.SaveGroup(ctx, &types.Group{Name: proto.String("bar")})
+	}))
+}
+
+func TestMarshalBatch(t *testing.T) {
+	ops := []KVOp{
+		{Key: "/entities/entity1", Value: []byte("some data")},
+		{Key: "/groups/group1", Delete: true},
+	}
+	b, err := MarshalBatch(ops)
+	assert.Nil(t, err)
+
+	res, err := UnmarshalBatch(b)
+	assert.Nil(t, err)
+	assert.Equal(t, ops, res)
+
+	_, err = UnmarshalBatch([]byte("garbage"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,254 @@
+// Package bbolt implements a key/value store on top of the bbolt
+// embedded database.  Unlike the filesystem store which needs one
+// file per object, and the bitcask store which is not available on
+// all platforms, bbolt keeps everything in a single file which is
+// updated with copy-on-write transactions, making it safe against
+// crashes at any point during a write.
+package bbolt
+
+import (
+	"context"
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/viper"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/startup"
+)
+
+// BoltStore is a store implementation based on the bbolt storage
+// engine.  Each top level segment of a key maps to a bucket, so
+// "/entities/foo" is stored as the key "foo" in the bucket
+// "entities".
+type BoltStore struct {
+	b *bolt.DB
+	l hclog.Logger
+
+	eF func(db.Event)
+}
+
+// event is an enum for what type of event to fire and subsequently
+// map to a DB event.
+type eventType int
+
+const (
+	eventUpdate eventType = iota
+	eventDelete
+)
+
+var (
+	// ErrInvalidKey is returned when a key cannot be split into
+	// a bucket and a name.
+	ErrInvalidKey = errors.New("key must be of the form /<bucket>/<name>")
+)
+
+func init() {
+	startup.RegisterCallback(cb)
+}
+
+func cb() {
+	db.RegisterKV("bbolt", New)
+}
+
+// New creates a new instance of the bbolt store.
+func New(l hclog.Logger) (db.KVStore, error) {
+	p := filepath.Join(viper.GetString("core.home"), "netauth.db")
+
+	x := &BoltStore{}
+	x.l = l.Named("bbolt")
+
+	// The timeout prevents a second process from hanging forever
+	// waiting on the file lock if the database is already open
+	// elsewhere.
+	b, err := bolt.Open(p, 0640, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	x.b = b
+	return x, nil
+}
+
+// Put stores the bytes of v at a location identitified by the key k.
+// If the operation fails an error will be returned explaining why.
+func (bs *BoltStore) Put(_ context.Context, k string, v []byte) error {
+	bucket, name, err := splitKey(k)
+	if err != nil {
+		return err
+	}
+
+	err = bs.b.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(name), v)
+	})
+	if err != nil {
+		return err
+	}
+	bs.fireEventForKey(k, eventUpdate)
+	return nil
+}
+
+// Get returns the key at k or an error explaning why no data was
+// returned.
+func (bs *BoltStore) Get(_ context.Context, k string) ([]byte, error) {
+	bucket, name, err := splitKey(k)
+	if err != nil {
+		return nil, db.ErrNoValue
+	}
+
+	var out []byte
+	bs.b.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		// Values returned by bolt are only valid for the life
+		// of the transaction, so a copy needs to be made.
+		if v := b.Get([]byte(name)); v != nil {
+			out = make([]byte, len(v))
+			copy(out, v)
+		}
+		return nil
+	})
+	if out == nil {
+		return nil, db.ErrNoValue
+	}
+	return out, nil
+}
+
+// Del removes any existing value at the location specified by the
+// provided key.
+func (bs *BoltStore) Del(_ context.Context, k string) error {
+	bucket, name, err := splitKey(k)
+	if err != nil {
+		return db.ErrNoValue
+	}
+
+	err = bs.b.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil || b.Get([]byte(name)) == nil {
+			return db.ErrNoValue
+		}
+		return b.Delete([]byte(name))
+	})
+	if err != nil {
+		return err
+	}
+	bs.fireEventForKey(k, eventDelete)
+	return nil
+}
+
+// Batch applies all the operations in a single bbolt transaction,
+// which either commits in full or not at all.
+func (bs *BoltStore) Batch(_ context.Context, ops []db.KVOp) error {
+	err := bs.b.Update(func(tx *bolt.Tx) error {
+		for _, op := range ops {
+			bucket, name, err := splitKey(op.Key)
+			if err != nil {
+				return err
+			}
+			if op.Delete {
+				b := tx.Bucket([]byte(bucket))
+				if b == nil {
+					continue
+				}
+				if err := b.Delete([]byte(name)); err != nil {
+					return err
+				}
+				continue
+			}
+			b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(name), op.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		if op.Delete {
+			bs.fireEventForKey(op.Key, eventDelete)
+			continue
+		}
+		bs.fireEventForKey(op.Key, eventUpdate)
+	}
+	return nil
+}
+
+// Keys is a way to enumerate the keys in the key/value store and to
+// optionally filter them based on a globbing expression.  Keys are
+// reconstructed from the bucket and name so that they can be matched
+// in the same form they were stored.
+func (bs *BoltStore) Keys(_ context.Context, f string) ([]string, error) {
+	out := []string{}
+	err := bs.b.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(bucket []byte, b *bolt.Bucket) error {
+			return b.ForEach(func(name, _ []byte) error {
+				k := path.Join("/", string(bucket), string(name))
+				if m, _ := path.Match(f, k); m {
+					out = append(out, k)
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Close releases the lock on the database file and flushes it to
+// disk.  The store must not be used after Close() is called.
+func (bs *BoltStore) Close() error {
+	return bs.b.Close()
+}
+
+// Capabilities returns that this key/value store supports the mutable
+// property, allowing it to be writeable to the higher level systems,
+// and that it can apply batches atomically.
+func (bs *BoltStore) Capabilities() []db.KVCapability {
+	return []db.KVCapability{db.KVMutable, db.KVBatch}
+}
+
+// SetEventFunc sets up a function to call to fire events to
+// subscribers.
+func (bs *BoltStore) SetEventFunc(f func(db.Event)) {
+	bs.eF = f
+}
+
+// fireEventForKey maps from a key to an entity or group and fires an
+// appropriate event for the given key.  Stores that were opened
+// without an event function, such as by tools, fire nothing.
+func (bs *BoltStore) fireEventForKey(k string, t eventType) {
+	if bs.eF == nil {
+		return
+	}
+	if e, ok := db.EventForKey(k, t == eventDelete); ok {
+		bs.eF(e)
+	}
+}
+
+// splitKey converts a key into the bucket and name that it is stored
+// under.
+func splitKey(k string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path.Clean(k), "/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", ErrInvalidKey
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,268 @@
+package bbolt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/netauth/netauth/internal/db"
+)
+
+func TestCB(t *testing.T) {
+	cb()
+}
+
+func TestNewBadLock(t *testing.T) {
+	viper.Set("core.home", t.TempDir())
+
+	// This one should work
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+
+	// This one shouldn't
+	_, err = New(hclog.NewNullLogger())
+	assert.NotNil(t, err)
+}
+
+func TestSetEventFunc(t *testing.T) {
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+
+	f := func(db.Event) {}
+
+	if kv.(*BoltStore).eF != nil {
+		t.Log("EventFunc somehow already set!")
+	}
+
+	kv.SetEventFunc(f)
+
+	if kv.(*BoltStore).eF == nil {
+		t.Error("EventFunc not set correctly!")
+	}
+}
+
+func TestPut(t *testing.T) {
+	ctx := context.Background()
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+	kv.SetEventFunc(func(db.Event) {})
+
+	assert.Nil(t, kv.Put(ctx, "/entities/entity1", []byte("some data")))
+	assert.Nil(t, kv.Put(ctx, "/groups/group1", []byte("some more data")))
+
+	b, err := kv.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("some data"), b, "Data stored but incorrect")
+
+	assert.Equal(t, ErrInvalidKey, kv.Put(ctx, "", []byte("data-with-no-key")))
+	assert.Equal(t, ErrInvalidKey, kv.Put(ctx, "/entities", []byte("data-with-no-name")))
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+	kv.SetEventFunc(func(db.Event) {})
+
+	assert.Nil(t, kv.Put(ctx, "/entities/entity1", []byte("lots of data")))
+
+	v, err := kv.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, v, []byte("lots of data"), "Data read but incorrect")
+
+	v, err = kv.Get(ctx, "/does/not/exist")
+	assert.Nil(t, v, "Data returned for key that does not exist")
+	assert.Equal(t, err, db.ErrNoValue, "KV made up some data")
+
+	v, err = kv.Get(ctx, "/entities/does-not-exist")
+	assert.Nil(t, v, "Data returned for key that does not exist")
+	assert.Equal(t, err, db.ErrNoValue, "KV made up some data")
+
+	_, err = kv.Get(ctx, "")
+	assert.Equal(t, err, db.ErrNoValue)
+}
+
+func TestDel(t *testing.T) {
+	ctx := context.Background()
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+	kv.SetEventFunc(func(db.Event) {})
+
+	assert.Nil(t, kv.Put(ctx, "/entities/entity1", []byte("lots of data")))
+	assert.Nil(t, kv.Put(ctx, "/groups/group1", []byte("lots of data")))
+
+	assert.Nil(t, kv.Del(ctx, "/entities/entity1"))
+	assert.Nil(t, kv.Del(ctx, "/groups/group1"))
+
+	_, err = kv.Get(ctx, "/entities/entity1")
+	assert.Equal(t, err, db.ErrNoValue)
+	_, err = kv.Get(ctx, "/groups/group1")
+	assert.Equal(t, err, db.ErrNoValue)
+
+	assert.Equal(t, db.ErrNoValue, kv.Del(ctx, "/entities/entity1"))
+	assert.Equal(t, db.ErrNoValue, kv.Del(ctx, "/no-bucket/entity1"))
+	assert.Equal(t, db.ErrNoValue, kv.Del(ctx, ""))
+}
+
+func TestKeys(t *testing.T) {
+	ctx := context.Background()
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+	kv.SetEventFunc(func(db.Event) {})
+
+	kv.Put(ctx, "/entities/entity1", []byte("lots of data"))
+	kv.Put(ctx, "/entities/entity2", []byte("lots of data"))
+	kv.Put(ctx, "/entities/purple", []byte("lots of data"))
+	kv.Put(ctx, "/groups/entity3", []byte("lots of data"))
+
+	res, err := kv.Keys(ctx, "/entities/entity*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/entities/entity1", "/entities/entity2"}, res)
+
+	res, err = kv.Keys(ctx, "/*/*")
+	assert.Nil(t, err)
+	assert.Len(t, res, 4)
+}
+
+func TestPersistence(t *testing.T) {
+	ctx := context.Background()
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	kv.SetEventFunc(func(db.Event) {})
+
+	assert.Nil(t, kv.Put(ctx, "/entities/entity1", []byte("durable data")))
+	assert.Nil(t, kv.Close())
+
+	kv, err = New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+
+	v, err := kv.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("durable data"), v)
+}
+
+func TestClose(t *testing.T) {
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	kv.SetEventFunc(func(db.Event) {})
+
+	assert.Nil(t, kv.Close())
+}
+
+func TestCapabilities(t *testing.T) {
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+	kv.SetEventFunc(func(db.Event) {})
+
+	assert.Equal(t, []db.KVCapability{db.KVMutable, db.KVBatch}, kv.Capabilities())
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+
+	events := []db.Event{}
+	kv.SetEventFunc(func(e db.Event) { events = append(events, e) })
+	assert.Nil(t, kv.Put(ctx, "/entities/entity2", []byte("old data")))
+	events = nil
+
+	ops := []db.KVOp{
+		{Key: "/entities/entity1", Value: []byte("some data")},
+		{Key: "/entities/entity2", Delete: true},
+		{Key: "/groups/missing", Delete: true},
+		{Key: "/groups/group1", Value: []byte("some more data")},
+	}
+	assert.Nil(t, kv.(db.KVBatcher).Batch(ctx, ops))
+
+	v, err := kv.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("some data"), v)
+	_, err = kv.Get(ctx, "/entities/entity2")
+	assert.Equal(t, db.ErrNoValue, err)
+	assert.Len(t, events, 4)
+
+	// A bad key anywhere in the batch must prevent all of it from
+	// being applied.
+	events = nil
+	ops = []db.KVOp{
+		{Key: "/entities/entity3", Value: []byte("some data")},
+		{Key: "", Value: []byte("bad key")},
+	}
+	assert.Equal(t, ErrInvalidKey, kv.(db.KVBatcher).Batch(ctx, ops))
+	_, err = kv.Get(ctx, "/entities/entity3")
+	assert.Equal(t, db.ErrNoValue, err)
+	assert.Len(t, events, 0)
+}
+
+type eventHandler struct{ mock.Mock }
+
+func (eh *eventHandler) FireEvent(e db.Event) {
+	eh.Called(e)
+}
+
+func TestFireEventForKey(t *testing.T) {
+	ef := eventHandler{}
+
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+
+	kv.SetEventFunc(ef.FireEvent)
+
+	ef.On("FireEvent", db.Event{PK: "entity1", Type: db.EventEntityUpdate})
+	ef.On("FireEvent", db.Event{PK: "entity1", Type: db.EventEntityDestroy})
+	ef.On("FireEvent", db.Event{PK: "group1", Type: db.EventGroupUpdate})
+	ef.On("FireEvent", db.Event{PK: "group1", Type: db.EventGroupDestroy})
+
+	kv.(*BoltStore).fireEventForKey("/entities/entity1", eventUpdate)
+	ef.AssertCalled(t, "FireEvent", db.Event{PK: "entity1", Type: db.EventEntityUpdate})
+
+	kv.(*BoltStore).fireEventForKey("/entities/entity1", eventDelete)
+	ef.AssertCalled(t, "FireEvent", db.Event{PK: "entity1", Type: db.EventEntityDestroy})
+
+	kv.(*BoltStore).fireEventForKey("/groups/group1", eventUpdate)
+	ef.AssertCalled(t, "FireEvent", db.Event{PK: "group1", Type: db.EventGroupUpdate})
+
+	kv.(*BoltStore).fireEventForKey("/groups/group1", eventDelete)
+	ef.AssertCalled(t, "FireEvent", db.Event{PK: "group1", Type: db.EventGroupDestroy})
+
+	kv.(*BoltStore).fireEventForKey("/not/an/event/key", eventUpdate)
+
+	// This assertion validates that the call for a key outside
+	// the fixed keyspace went to the default case and didn't
+	// trigger an event.
+	ef.AssertNumberOfCalls(t, "FireEvent", 4)
+}
+
+func TestPutWithoutEventFunc(t *testing.T) {
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+
+	assert.Nil(t, kv.Put(context.Background(), "/entities/entity1", []byte("value")))
+}
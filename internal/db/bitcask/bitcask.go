@@ -5,6 +5,8 @@ package bitcask
 
 import (
 	"context"
+	"io"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
@@ -31,6 +33,10 @@ type BCStore struct {
 	s *bitcask.Bitcask
 	l hclog.Logger
 
+	// tmp is the private copy that a read-only store is opened
+	// from.
+	tmp string
+
 	eF func(db.Event)
 }
 
@@ -43,6 +49,11 @@ const (
 	eventDelete
 )
 
+// batchKey is where the intent record for an in-flight batch is
+// stored.  It sits outside of the keyspace that Keys() is used to
+// enumerate, so it is never seen by the higher level systems.
+const batchKey = "/.batch"
+
 // New creates a new instance of the bitcask store.
 func New(l hclog.Logger) (db.KVStore, error) {
 	p := filepath.Join(viper.GetString("core.home"), "bc")
@@ -54,14 +65,86 @@ func New(l hclog.Logger) (db.KVStore, error) {
 		bitcask.WithMaxValueSize(1024 * 1000 * 5), // 5MiB
 		bitcask.WithSync(true),
 	}
+
+	// Bitcask locks its directory, so a store that is in use by
+	// the server can't be opened again.  A read-only store is
+	// opened from a copy of the data files instead, and recovery
+	// discards any entry that was being written as the copy was
+	// made.
+	if viper.GetBool("db.readonly") {
+		tmp, err := copyDatafiles(p)
+		if err != nil {
+			return nil, err
+		}
+		x.tmp = tmp
+		p = tmp
+		opts = append(opts, bitcask.WithAutoRecovery(true))
+	}
+
 	b, err := bitcask.Open(p, opts...)
 	if err != nil {
+		x.removeCopy()
 		return nil, err
 	}
 	x.s = b
+
+	if err := x.replayBatch(); err != nil {
+		b.Close()
+		x.removeCopy()
+		return nil, err
+	}
 	return x, nil
 }
 
+// copyDatafiles copies the data files of the store at p to a new
+// temporary directory.  The index is left behind so that it is
+// rebuilt from the copied data.
+func copyDatafiles(p string) (string, error) {
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp("", "netauth-bitcask-")
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !(strings.HasSuffix(e.Name(), ".data") || e.Name() == "config.json") {
+			continue
+		}
+		if err := copyFile(filepath.Join(p, e.Name()), filepath.Join(tmp, e.Name())); err != nil {
+			os.RemoveAll(tmp)
+			return "", err
+		}
+	}
+	return tmp, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// removeCopy removes the private copy of a read-only store.
+func (bcs *BCStore) removeCopy() {
+	if bcs.tmp != "" {
+		os.RemoveAll(bcs.tmp)
+	}
+}
+
 // Put stores the bytes of v at a location identitified by the key k.
 // If the operation fails an error will be returned explaining why.
 func (bcs *BCStore) Put(_ context.Context, k string, v []byte) error {
@@ -96,6 +179,68 @@ func (bcs *BCStore) Del(_ context.Context, k string) error {
 	return nil
 }
 
+// Batch applies all the operations as a unit.  Bitcask has no
+// transactions, so the batch is first written as an intent record
+// which is removed once all the operations have been applied.  If the
+// server stops part way through, the record is replayed the next
+// time the store is opened.
+func (bcs *BCStore) Batch(_ context.Context, ops []db.KVOp) error {
+	intent, err := db.MarshalBatch(ops)
+	if err != nil {
+		return err
+	}
+	if err := bcs.s.Put([]byte(batchKey), intent); err != nil {
+		return err
+	}
+	if err := bcs.applyBatch(ops); err != nil {
+		return err
+	}
+	bcs.s.Delete([]byte(batchKey))
+
+	for _, op := range ops {
+		if op.Delete {
+			bcs.fireEventForKey(op.Key, eventDelete)
+			continue
+		}
+		bcs.fireEventForKey(op.Key, eventUpdate)
+	}
+	return nil
+}
+
+// applyBatch performs the operations of a batch without firing any
+// events.
+func (bcs *BCStore) applyBatch(ops []db.KVOp) error {
+	for _, op := range ops {
+		if op.Delete {
+			bcs.s.Delete([]byte(op.Key))
+			continue
+		}
+		if err := bcs.s.Put([]byte(op.Key), op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayBatch completes any batch that was interrupted before it
+// could be fully applied.
+func (bcs *BCStore) replayBatch() error {
+	intent, err := bcs.s.Get([]byte(batchKey))
+	if err != nil {
+		// No pending batch.
+		return nil
+	}
+	ops, err := db.UnmarshalBatch(intent)
+	if err != nil {
+		return err
+	}
+	bcs.l.Info("Replaying interrupted batch", "ops", len(ops))
+	if err := bcs.applyBatch(ops); err != nil {
+		return err
+	}
+	return bcs.s.Delete([]byte(batchKey))
+}
+
 // Keys is a way to enumerate the keys in the key/value store and to
 // optionally filter them based on a globbing expression.  This cheats
 // and uses superior knowledge that NetAuth uses only a single key
@@ -117,41 +262,26 @@ func (bcs *BCStore) Keys(_ context.Context, f string) ([]string, error) {
 // Close terminates the connection to the bitcask and flushes it to
 // disk.  The cask must not be used after Close() is called.
 func (bcs *BCStore) Close() error {
+	defer bcs.removeCopy()
 	return bcs.s.Close()
 }
 
 // Capabilities returns that this key/value store supports te mutable
-// property, allowing it to be writeable to the higher level systems.
+// property, allowing it to be writeable to the higher level systems,
+// and that it can apply batches atomically.  A read-only store is
+// only a copy, so it doesn't claim to be mutable.
 func (bcs *BCStore) Capabilities() []db.KVCapability {
-	return []db.KVCapability{db.KVMutable}
+	if bcs.tmp != "" {
+		return []db.KVCapability{db.KVBatch}
+	}
+	return []db.KVCapability{db.KVMutable, db.KVBatch}
 }
 
 // fireEventForKey maps from a key to an entity or group and fires an
 // appropriate event for the given key.
 func (bcs *BCStore) fireEventForKey(k string, t eventType) {
-	switch {
-	case t == eventUpdate && strings.HasPrefix(k, "/entities/"):
-		bcs.eF(db.Event{
-			PK:   filepath.Base(k),
-			Type: db.EventEntityUpdate,
-		})
-	case t == eventDelete && strings.HasPrefix(k, "/entities/"):
-		bcs.eF(db.Event{
-			PK:   filepath.Base(k),
-			Type: db.EventEntityDestroy,
-		})
-	case t == eventUpdate && strings.HasPrefix(k, "/groups/"):
-		bcs.eF(db.Event{
-			PK:   filepath.Base(k),
-			Type: db.EventGroupUpdate,
-		})
-	case t == eventDelete && strings.HasPrefix(k, "/groups/"):
-		bcs.eF(db.Event{
-			PK:   filepath.Base(k),
-			Type: db.EventGroupDestroy,
-		})
-	default:
-		bcs.l.Warn("Event translation called with unknown key prefix", "type", t, "key", k)
+	if e, ok := db.EventForKey(k, t == eventDelete); ok {
+		bcs.eF(e)
 	}
 }
 
@@ -2,6 +2,7 @@ package bitcask
 
 import (
 	"context"
+	"os"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
@@ -136,7 +137,59 @@ func TestCapabilities(t *testing.T) {
 	assert.Nil(t, err)
 	kv.SetEventFunc(func(db.Event) {})
 
-	assert.Equal(t, []db.KVCapability{db.KVMutable}, kv.Capabilities())
+	assert.Equal(t, []db.KVCapability{db.KVMutable, db.KVBatch}, kv.Capabilities())
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+
+	events := []db.Event{}
+	kv.SetEventFunc(func(e db.Event) { events = append(events, e) })
+	assert.Nil(t, kv.Put(ctx, "/entities/entity2", []byte("old data")))
+	events = nil
+
+	ops := []db.KVOp{
+		{Key: "/entities/entity1", Value: []byte("some data")},
+		{Key: "/entities/entity2", Delete: true},
+		{Key: "/groups/group1", Value: []byte("some more data")},
+	}
+	assert.Nil(t, kv.(db.KVBatcher).Batch(ctx, ops))
+
+	v, err := kv.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("some data"), v)
+	_, err = kv.Get(ctx, "/entities/entity2")
+	assert.Equal(t, db.ErrNoValue, err)
+	_, err = kv.Get(ctx, batchKey)
+	assert.Equal(t, db.ErrNoValue, err)
+	assert.Len(t, events, 3)
+}
+
+func TestBatchReplay(t *testing.T) {
+	ctx := context.Background()
+	viper.Set("core.home", t.TempDir())
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+
+	// Simulate a crash after the intent was recorded but before
+	// any of the operations were applied.
+	intent, err := db.MarshalBatch([]db.KVOp{
+		{Key: "/entities/entity1", Value: []byte("some data")},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, kv.(*BCStore).s.Put([]byte(batchKey), intent))
+	assert.Nil(t, kv.Close())
+
+	kv, err = New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	v, err := kv.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("some data"), v)
+	_, err = kv.Get(ctx, batchKey)
+	assert.Equal(t, db.ErrNoValue, err)
 }
 
 type eventHandler struct{ mock.Mock }
@@ -177,3 +230,41 @@ func TestFireEventForKey(t *testing.T) {
 	// trigger an event.
 	ef.AssertNumberOfCalls(t, "FireEvent", 4)
 }
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	viper.Set("core.home", t.TempDir())
+	defer viper.Set("db.readonly", false)
+
+	live, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	live.SetEventFunc(func(db.Event) {})
+	assert.Nil(t, live.Put(ctx, "/entities/entity1", []byte("some data")))
+
+	// The live store holds the lock, but a read-only store can
+	// still be opened alongside it.
+	viper.Set("db.readonly", true)
+	kv, err := New(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	kv.SetEventFunc(func(db.Event) {})
+	assert.Equal(t, []db.KVCapability{db.KVBatch}, kv.Capabilities())
+
+	v, err := kv.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("some data"), v)
+
+	tmp := kv.(*BCStore).tmp
+	assert.Nil(t, kv.Close())
+	_, err = os.Stat(tmp)
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, live.Close())
+}
+
+func TestReadOnlyMissing(t *testing.T) {
+	viper.Set("core.home", t.TempDir())
+	viper.Set("db.readonly", true)
+	defer viper.Set("db.readonly", false)
+
+	_, err := New(hclog.NewNullLogger())
+	assert.NotNil(t, err)
+}
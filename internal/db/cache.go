@@ -0,0 +1,177 @@
+package db
+
+import (
+	"container/list"
+	"fmt"
+	"path"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/health"
+)
+
+// CacheStats reports how well the object cache is working.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// objectCache holds recently loaded entities and groups so that
+// repeated loads don't have to read and unmarshal them again.  The
+// bytes an object was decoded from are kept with it so that loads
+// from the cache can still record revisions.  A nil objectCache
+// caches nothing.
+type objectCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+
+	// epoch changes on every invalidation.  A load only adds
+	// to the cache if nothing was invalidated while it was
+	// reading, otherwise it could put back a value that was
+	// replaced in the meantime.
+	epoch uint64
+
+	hits   uint64
+	misses uint64
+}
+
+type cacheEntry struct {
+	key string
+	b   []byte
+	m   proto.Message
+}
+
+// WithCache keeps up to size recently loaded entities and groups in
+// memory.  The cache is kept up to date by events, so a KVStore that
+// is changed without firing events, such as a filesystem store that
+// is edited by hand without watching for changes, will be served
+// stale objects.
+func WithCache(size int) Option {
+	return func(db *DB) {
+		if size > 0 {
+			db.cache = newObjectCache(size)
+		}
+	}
+}
+
+func newObjectCache(size int) *objectCache {
+	return &objectCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// CacheStats returns the hit and miss counts of the object cache.
+// They are always zero if there is no cache.
+func (db *DB) CacheStats() CacheStats {
+	c := db.cache
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:   c.hits,
+		Misses: c.misses,
+		Size:   c.ll.Len(),
+	}
+}
+
+// CacheHealthCheck reports the hit and miss counts of the object
+// cache.  A cache can't be unhealthy, so this is only informational.
+func (db *DB) CacheHealthCheck() health.SubsystemStatus {
+	s := db.CacheStats()
+	return health.SubsystemStatus{
+		OK:     true,
+		Name:   "db-cache",
+		Status: fmt.Sprintf("%d objects, %d hits, %d misses", s.Size, s.Hits, s.Misses),
+	}
+}
+
+// get merges the cached object for k into m and returns the bytes it
+// was decoded from.
+func (c *objectCache) get(k string, m proto.Message) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[k]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.ll.MoveToFront(el)
+	ent := el.Value.(*cacheEntry)
+	proto.Merge(m, ent.m)
+	return ent.b, true
+}
+
+// start returns the epoch to pass to add once the object is loaded.
+func (c *objectCache) start() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch
+}
+
+// add caches a copy of m, unless something was invalidated since
+// epoch was obtained.
+func (c *objectCache) add(k string, b []byte, m proto.Message, epoch uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if epoch != c.epoch {
+		return
+	}
+	ent := &cacheEntry{key: k, b: b, m: proto.Clone(m)}
+	if el, ok := c.items[k]; ok {
+		el.Value = ent
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[k] = c.ll.PushFront(ent)
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *objectCache) invalidate(k string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	if el, ok := c.items[k]; ok {
+		c.ll.Remove(el)
+		delete(c.items, k)
+	}
+}
+
+// cacheCallback drops objects from the cache when they change.  It is
+// registered before any other callback so that callbacks which load
+// the object that changed don't get the old one from the cache.
+func (db *DB) cacheCallback(e Event) {
+	switch e.Type {
+	case EventEntityCreate, EventEntityUpdate, EventEntityDestroy:
+		db.cache.invalidate(path.Join("/entities", e.PK))
+	case EventGroupCreate, EventGroupUpdate, EventGroupDestroy:
+		db.cache.invalidate(path.Join("/groups", e.PK))
+	}
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+func TestCacheLoad(t *testing.T) {
+	ctx := context.Background()
+	RegisterKV("mock", newMockKV)
+	m, err := New("mock", WithCache(10))
+	assert.Nil(t, err)
+	mkv := m.kv.(*mockKV)
+	mkv.On("Get", "/entities/entity1").Return(goodEntityBytes1, nil).Once()
+	mkv.On("Get", "/groups/group1").Return(goodGroupBytes1, nil)
+
+	e, err := m.LoadEntity(ctx, "entity1")
+	assert.Nil(t, err)
+	e.Number = proto.Int32(42)
+	e, err = m.LoadEntity(ctx, "entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), e.GetNumber(), "cached entity was modified")
+	mkv.AssertNumberOfCalls(t, "Get", 1)
+
+	_, err = m.LoadGroup(ctx, "group1")
+	assert.Nil(t, err)
+	_, err = m.LoadGroup(ctx, "group1")
+	assert.Nil(t, err)
+	mkv.AssertNumberOfCalls(t, "Get", 2)
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 2, Size: 2}, m.CacheStats())
+
+	// Events drop the object that changed, before any other
+	// callback can load it.
+	updated, _ := proto.Marshal(&types.Entity{ID: proto.String("entity1"), Number: proto.Int32(2)})
+	mkv.On("Get", "/entities/entity1").Return(updated, nil)
+	m.FireEvent(Event{Type: EventEntityUpdate, PK: "entity1"})
+	e, err = m.LoadEntity(ctx, "entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), e.GetNumber())
+	r, _, err := m.Index.SearchEntities(SearchRequest{Expression: "Number:2"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"entity1"}, r)
+}
+
+func TestCacheRevisions(t *testing.T) {
+	RegisterKV("mock", newMockKV)
+	m, err := New("mock", WithCache(10))
+	assert.Nil(t, err)
+	mkv := m.kv.(*mockKV)
+	mkv.On("Get", "/entities/entity1").Return(goodEntityBytes1, nil)
+
+	_, err = m.LoadEntity(context.Background(), "entity1")
+	assert.Nil(t, err)
+
+	// A load from the cache still records the revision that
+	// the save is checked against.
+	ctx := WithRevisions(context.Background())
+	_, err = m.LoadEntity(ctx, "entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, Revision(goodEntityBytes1), revisionsFrom(ctx).m["/entities/entity1"])
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := newObjectCache(2)
+	for _, k := range []string{"a", "b", "a", "c"} {
+		c.add(k, nil, &types.Entity{ID: proto.String(k)}, c.start())
+	}
+	_, ok := c.get("b", &types.Entity{})
+	assert.False(t, ok, "least recently used entry was kept")
+	e := &types.Entity{}
+	_, ok = c.get("a", e)
+	assert.True(t, ok)
+	assert.Equal(t, "a", e.GetID())
+}
+
+func TestCacheInvalidateDuringLoad(t *testing.T) {
+	c := newObjectCache(2)
+	epoch := c.start()
+	c.invalidate("a")
+	c.add("a", nil, &types.Entity{}, epoch)
+	_, ok := c.get("a", &types.Entity{})
+	assert.False(t, ok, "load that raced an invalidation was cached")
+}
+
+func TestCacheDisabled(t *testing.T) {
+	RegisterKV("mock", newMockKV)
+	m, err := New("mock", WithCache(0))
+	assert.Nil(t, err)
+	mkv := m.kv.(*mockKV)
+	mkv.On("Get", "/entities/entity1").Return(goodEntityBytes1, nil)
+
+	for i := 0; i < 2; i++ {
+		_, err := m.LoadEntity(context.Background(), "entity1")
+		assert.Nil(t, err)
+	}
+	mkv.AssertNumberOfCalls(t, "Get", 2)
+	assert.Equal(t, CacheStats{}, m.CacheStats())
+}
@@ -14,13 +14,20 @@ func (db *DB) RegisterCallback(name string, c Callback) {
 		return
 	}
 	db.cbs[name] = c
+	db.cbOrder = append(db.cbOrder, name)
 	log().Info("Database callback registered", "callback", name)
 }
 
-// FireEvent fires an event to all callbacks.
+// FireEvent fires an event to all callbacks in the order they were
+// registered.  Callbacks added with Subscribe only have the event
+// queued for them here.
 func (db *DB) FireEvent(e Event) {
 	log().Debug("Processing callbacks")
-	for name, c := range db.cbs {
+	for _, name := range db.cbOrder {
+		c, ok := db.cbs[name]
+		if !ok {
+			continue
+		}
 		log().Trace("Calling callback", "callback", name)
 		c(e)
 	}
@@ -29,24 +36,74 @@ func (db *DB) FireEvent(e Event) {
 // EventUpdateAll fires an event for all entities and all groups with
 // the type set to "Update".  This is used to allow the async
 // components that are event driven to pre-load on a server startup
-// and begin monitoring changes after the load completes.
+// and begin monitoring changes after the load completes.  An on-disk
+// search index that can be brought up to date from the journal only
+// reindexes what changed while the server was down, and ignores these
+// events.  Otherwise, once the events have been handled, anything in
+// the search index that no longer exists is removed from it.
 func (db *DB) EventUpdateAll() error {
-	ids, err := db.DiscoverEntityIDs(context.Background())
+	ctx := context.Background()
+	current := false
+	if j := db.indexJournal(); j != nil {
+		var err error
+		current, err = db.Index.CatchUp(ctx, j)
+		if err != nil {
+			db.log.Warn("Search index could not be brought up to date from the journal", "error", err)
+		}
+	}
+
+	ids, err := db.DiscoverEntityIDs(ctx)
 	if err != nil {
 		return err
 	}
-	for _, i := range ids {
-		db.FireEvent(Event{Type: EventEntityUpdate, PK: path.Base(i)})
+	entities := make([]string, len(ids))
+	for i := range ids {
+		entities[i] = path.Base(ids[i])
+		db.FireEvent(Event{Type: EventEntityUpdate, PK: entities[i], Preload: true})
 	}
 
-	ids, err = db.DiscoverGroupNames(context.Background())
+	ids, err = db.DiscoverGroupNames(ctx)
 	if err != nil {
 		return err
 	}
-	for _, i := range ids {
-		db.FireEvent(Event{Type: EventGroupUpdate, PK: path.Base(i)})
+	groups := make([]string, len(ids))
+	for i := range ids {
+		groups[i] = path.Base(ids[i])
+		db.FireEvent(Event{Type: EventGroupUpdate, PK: groups[i], Preload: true})
+	}
+	db.WaitEvents()
+	if current {
+		return nil
+	}
+	if err := db.Index.Prune(entities, groups); err != nil {
+		return err
+	}
+	return db.markIndex()
+}
+
+// indexJournal returns the journal that an on-disk search index can
+// be brought up to date from, or nil if there isn't one that can be
+// trusted to hold every change.  Changes that are replicated into a
+// clustered store, or that are picked up by watching a store that is
+// read-only here, never pass through the journal.
+func (db *DB) indexJournal() *Journal {
+	if db.indexDir == "" || db.journal == nil || db.cluster != nil {
+		return nil
+	}
+	if !hasCapability(db.kv.Capabilities(), KVMutable) {
+		return nil
+	}
+	return db.journal
+}
+
+// markIndex records how far through the journal the search index is,
+// so that the next start only has to reindex what came after.
+func (db *DB) markIndex() error {
+	j := db.indexJournal()
+	if j == nil {
+		return nil
 	}
-	return nil
+	return db.Index.MarkJournal(j.Seq())
 }
 
 // IsEmpty is used to test for an empty event being returned.
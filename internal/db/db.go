@@ -18,26 +18,72 @@ var (
 )
 
 // New returns a db struct.
-func New(backend string) (*DB, error) {
+func New(backend string, opts ...Option) (*DB, error) {
 	kv, err := NewKV(backend, log())
 	if err != nil {
 		return nil, err
 	}
+	return open(kv, opts...)
+}
 
-	idx := NewIndex(log())
+// open returns a DB on top of kv.
+func open(kv KVStore, opts ...Option) (*DB, error) {
+	var err error
 	x := &DB{
-		log:   log(),
-		Index: idx,
-		kv:    kv,
-		cbs:   make(map[string]Callback),
+		log: log(),
+		kv:  kv,
+		cbs: make(map[string]Callback),
+		bus: newEventBus(),
+
+		numbers: newNumbers(),
+	}
+	for _, o := range opts {
+		o(x)
+	}
+	if x.indexDir != "" {
+		x.Index, err = OpenIndex(x.indexDir, log(), x.indexOpts...)
+		if err != nil {
+			kv.Close()
+			return nil, err
+		}
+	} else {
+		x.Index = NewIndex(log(), x.indexOpts...)
+	}
+	// The journal hides the store below it, so find out if the
+	// store is clustered first.
+	switch c := kv.(type) {
+	case KVCluster:
+		x.cluster = c
+	case *realmKV:
+		x.cluster, _ = c.rs.kv.(KVCluster)
+	}
+	if x.journal != nil {
+		x.kv = &journaledKV{KVStore: kv, j: x.journal, l: x.log.Named("journal")}
 	}
-	kv.SetEventFunc(x.FireEvent)
+	x.bus.refresh = x.currentEvent
+	x.kv.SetEventFunc(x.FireEvent)
 	x.Index.ConfigureCallback(x.LoadEntity, x.LoadGroup)
-	x.RegisterCallback("BleveSearch", x.Index.IndexCallback)
+	x.RegisterCallback("cache", x.cacheCallback)
+	x.Subscribe("BleveSearch", x.Index.IndexCallback)
+	x.RegisterCallback("numbers", x.numbersCallback)
 
 	return x, nil
 }
 
+// WithJournal records every change made through the DB in the given
+// journal.  The journal is closed when the DB is shut down.
+func WithJournal(j *Journal) Option { return func(db *DB) { db.journal = j } }
+
+// WithIndexDir keeps the search index on disk in dir rather than in
+// memory, which lets a restarted server skip reindexing everything
+// that hasn't changed.
+func WithIndexDir(dir string) Option { return func(db *DB) { db.indexDir = dir } }
+
+// WithIndexOptions configures the search index.
+func WithIndexOptions(opts ...IndexOption) Option {
+	return func(db *DB) { db.indexOpts = append(db.indexOpts, opts...) }
+}
+
 // DiscoverEntityIDs searches the keyspace for all entity IDs.  All
 // returned strings are loadable entities.
 func (db *DB) DiscoverEntityIDs(ctx context.Context) ([]string, error) {
@@ -46,31 +92,31 @@ func (db *DB) DiscoverEntityIDs(ctx context.Context) ([]string, error) {
 
 // LoadEntity retrieves a single entity from the kv store.
 func (db *DB) LoadEntity(ctx context.Context, ID string) (*types.Entity, error) {
-	b, err := db.kv.Get(ctx, path.Join("/entities", ID))
-	if err == ErrNoValue {
-		return nil, ErrUnknownEntity
-	}
-	if err != nil {
-		db.log.Debug("Error loading entity from KV store", "error", err, "ID", ID)
-		return nil, ErrInternalError
-	}
-
 	e := &types.Entity{}
-	if err := proto.Unmarshal(b, e); err != nil {
-		db.log.Warn("Error unmarshaling entity", "error", err)
-		return nil, ErrInternalError
+	switch err := db.load(ctx, path.Join("/entities", ID), e); err {
+	case nil:
+		return e, nil
+	case ErrNoValue:
+		return nil, ErrUnknownEntity
+	default:
+		return nil, err
 	}
-	return e, nil
 }
 
-// SaveEntity writes an entity to the kv store.
+// SaveEntity writes an entity to the kv store.  If the entity was
+// loaded with a context from WithRevisions and has since been
+// modified, ErrRevisionConflict is returned.
 func (db *DB) SaveEntity(ctx context.Context, e *types.Entity) error {
 	// The only way for this to error is if the proto is invalid;
 	// i.e. a missing required field.  Since there are no required
 	// fields in the Entity proto, this cannot return an error.
 	b, _ := proto.Marshal(e)
 
-	if err := db.kv.Put(ctx, path.Join("/entities", e.GetID()), b); err != nil {
+	switch err := db.put(ctx, path.Join("/entities", e.GetID()), b); err {
+	case nil:
+	case ErrRevisionConflict:
+		return err
+	default:
 		db.log.Warn("Error storing entity", "error", err)
 		return ErrInternalError
 	}
@@ -94,33 +140,75 @@ func (db *DB) DiscoverGroupNames(ctx context.Context) ([]string, error) {
 
 // LoadGroup retrieves a single group from the kv store.
 func (db *DB) LoadGroup(ctx context.Context, ID string) (*types.Group, error) {
-	b, err := db.kv.Get(ctx, path.Join("/groups", ID))
-	if err == ErrNoValue {
+	g := &types.Group{}
+	switch err := db.load(ctx, path.Join("/groups", ID), g); err {
+	case nil:
+		return g, nil
+	case ErrNoValue:
 		return nil, ErrUnknownGroup
+	default:
+		return nil, err
+	}
+}
+
+// load reads the value at k into m, from the batch that the context
+// collects or else from the cache if possible.  A missing value
+// returns ErrNoValue and any other failure returns ErrInternalError.
+func (db *DB) load(ctx context.Context, k string, m proto.Message) error {
+	if bt := batchFrom(ctx); bt != nil {
+		if b, deleted, ok := bt.pending(k); ok {
+			if deleted {
+				recordRevision(ctx, k, nil)
+				return ErrNoValue
+			}
+			if err := proto.Unmarshal(b, m); err != nil {
+				return ErrInternalError
+			}
+			recordRevision(ctx, k, b)
+			return nil
+		}
+	}
+	if b, ok := db.cache.get(k, m); ok {
+		recordRevision(ctx, k, b)
+		return nil
+	}
+
+	epoch := db.cache.start()
+	b, err := db.kv.Get(ctx, k)
+	if err == ErrNoValue {
+		recordRevision(ctx, k, nil)
+		return ErrNoValue
 	}
 	if err != nil {
-		db.log.Debug("Error loading group from KV store", "error", err, "ID", ID)
-		return nil, ErrInternalError
+		db.log.Debug("Error loading from KV store", "error", err, "key", k)
+		return ErrInternalError
 	}
 
-	g := &types.Group{}
-	if err := proto.Unmarshal(b, g); err != nil {
-		db.log.Warn("Error unmarshaling group", "error", err)
-		return nil, ErrInternalError
+	if err := proto.Unmarshal(b, m); err != nil {
+		db.log.Warn("Error unmarshaling", "error", err, "key", k)
+		return ErrInternalError
 	}
-	return g, nil
+	recordRevision(ctx, k, b)
+	db.cache.add(k, b, m, epoch)
+	return nil
 }
 
-// SaveGroup writes an group to the kv store.
+// SaveGroup writes an group to the kv store.  If the group was
+// loaded with a context from WithRevisions and has since been
+// modified, ErrRevisionConflict is returned.
 func (db *DB) SaveGroup(ctx context.Context, g *types.Group) error {
 	// The only way for this to error is if the proto is invalid;
 	// i.e. a missing required field.  Since there are no required
 	// fields in the Group proto, this cannot return an error.
 	b, _ := proto.Marshal(g)
 
-	if err := db.kv.Put(ctx, path.Join("/groups", g.GetName()), b); err != nil {
-		db.log.Warn("Error storing group", "error", err)
+	switch err := db.put(ctx, path.Join("/groups", g.GetName()), b); err {
+	case nil:
+	case ErrRevisionConflict:
 		return err
+	default:
+		db.log.Warn("Error storing group", "error", err)
+		return ErrInternalError
 	}
 	return nil
 }
@@ -136,60 +224,18 @@ func (db *DB) DeleteGroup(ctx context.Context, ID string) error {
 
 // Shutdown is called to disconnect the KV store from any other
 // systems and flush any buffers before shutting down the server.
+// Events that are still queued are handled first.
 func (db *DB) Shutdown() {
+	db.bus.close()
+	if err := db.markIndex(); err != nil {
+		db.log.Error("Error marking search index", "error", err)
+	}
 	if err := db.kv.Close(); err != nil {
 		db.log.Error("Error shutting down KV store", "error", err)
 	}
-}
-
-// NextEntityNumber computes and returns the next unnassigned number
-// in the entity space.
-func (db *DB) NextEntityNumber(ctx context.Context) (int32, error) {
-	var largest int32
-
-	// Iterate over the entities and return the largest ID found
-	// +1.  This allows them to be in any order or have IDs
-	// missing in the middle and still work.  Though an
-	// inefficient search this is worst case O(N) and happens only
-	// on provisioning a new entry in the database.
-	el, err := db.DiscoverEntityIDs(ctx)
-	if err != nil {
-		return 0, err
-	}
-
-	for _, en := range el {
-		e, err := db.LoadEntity(ctx, path.Base(en))
-		if err != nil {
-			return 0, err
-		}
-		if e.GetNumber() > largest {
-			largest = e.GetNumber()
-		}
+	if err := db.Index.Close(); err != nil {
+		db.log.Error("Error closing search index", "error", err)
 	}
-
-	return largest + 1, nil
-}
-
-// NextGroupNumber computes the next available group number and
-// returns it.
-func (db *DB) NextGroupNumber(ctx context.Context) (int32, error) {
-	var largest int32
-
-	l, err := db.DiscoverGroupNames(ctx)
-	if err != nil {
-		return 0, err
-	}
-	for _, i := range l {
-		g, err := db.LoadGroup(ctx, path.Base(i))
-		if err != nil {
-			return 0, err
-		}
-		if g.GetNumber() > largest {
-			largest = g.GetNumber()
-		}
-	}
-
-	return largest + 1, nil
 }
 
 // Capabilities returns a slice of capabilities the backing store
@@ -200,26 +246,52 @@ func (db *DB) Capabilities() []KVCapability {
 	return db.kv.Capabilities()
 }
 
+// Leader returns the address of the server that currently accepts
+// writes when the store is shared by a cluster of servers.  If the
+// store isn't clustered then false is returned.
+func (db *DB) Leader() (string, bool) {
+	if db.cluster == nil {
+		return "", false
+	}
+	return db.cluster.Leader(), true
+}
+
+// KV returns the key/value store underneath the DB.  This is for
+// subsystems such as replication that move stored values around
+// without interpreting them.  Writes made this way still fire events,
+// but bypass revision checking.
+func (db *DB) KV() KVStore {
+	return db.kv
+}
+
 // SearchEntities performs a search of all entities using the given
 // query and then batch loads the result.
-func (db *DB) SearchEntities(ctx context.Context, r SearchRequest) ([]*types.Entity, error) {
-	ids, err := db.Index.SearchEntities(r)
+func (db *DB) SearchEntities(ctx context.Context, r SearchRequest) ([]*types.Entity, SearchResult, error) {
+	ids, res, err := db.Index.SearchEntities(r)
 	if err != nil {
-		return nil, err
+		return nil, SearchResult{}, err
 	}
 
-	return db.loadEntityBatch(ctx, ids)
+	entities, err := db.loadEntityBatch(ctx, ids)
+	if err != nil {
+		return nil, SearchResult{}, err
+	}
+	return entities, res, nil
 }
 
 // SearchGroups performs a search of all groups using the given query
 // and then batch loads the result.
-func (db *DB) SearchGroups(ctx context.Context, r SearchRequest) ([]*types.Group, error) {
-	ids, err := db.Index.SearchGroups(r)
+func (db *DB) SearchGroups(ctx context.Context, r SearchRequest) ([]*types.Group, SearchResult, error) {
+	ids, res, err := db.Index.SearchGroups(r)
 	if err != nil {
-		return nil, err
+		return nil, SearchResult{}, err
 	}
 
-	return db.loadGroupBatch(ctx, ids)
+	groups, err := db.loadGroupBatch(ctx, ids)
+	if err != nil {
+		return nil, SearchResult{}, err
+	}
+	return groups, res, nil
 }
 
 func (db *DB) loadEntityBatch(ctx context.Context, ids []string) ([]*types.Entity, error) {
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"errors"
+	"path/filepath"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
@@ -148,7 +149,7 @@ func TestSaveGroup(t *testing.T) {
 	assert.Nil(t, err)
 
 	err = m.SaveGroup(ctx, &types.Group{Name: proto.String("bad")})
-	assert.NotNil(t, err)
+	assert.Equal(t, ErrInternalError, err)
 }
 
 func TestDeleteGroup(t *testing.T) {
@@ -176,77 +177,104 @@ func TestShutdown(t *testing.T) {
 func TestNextEntityNumber(t *testing.T) {
 	ctx := context.Background()
 	RegisterKV("mock", newMockKV)
-	m, err := New("mock")
-	assert.Nil(t, err)
-
-	m.kv.(*mockKV).On("Get", "/entities/load-error").Return([]byte{}, errors.New("KV Load error"))
-	m.kv.(*mockKV).On("Get", "/entities/entity1").Return(goodEntityBytes1, nil)
-	m.kv.(*mockKV).On("Get", "/entities/entity2").Return(goodEntityBytes2, nil)
-
-	m.kv.(*mockKV).On("Keys", "/entities/*").Return([]string{}, nil).Once()
-	res, err := m.NextEntityNumber(ctx)
-	assert.Nil(t, err)
-	assert.Equal(t, int32(1), res)
-
-	m.kv.(*mockKV).On("Keys", "/entities/*").Return([]string{}, errors.New("retrieval error")).Once()
-	_, err = m.NextEntityNumber(ctx)
-	assert.NotNil(t, err)
-
-	m.kv.(*mockKV).On("Keys", "/entities/*").Return([]string{}, errors.New("retrieval error")).Once()
-	_, err = m.NextEntityNumber(ctx)
-	assert.NotNil(t, err)
 
-	m.kv.(*mockKV).On("Keys", "/entities/*").Return([]string{"/entities/entity1", "/entities/load-error"}, nil).Once()
-	_, err = m.NextEntityNumber(ctx)
-	assert.NotNil(t, err)
-
-	m.kv.(*mockKV).On("Keys", "/entities/*").Return([]string{"/entities/entity1", "/entities/entity2"}, nil).Once()
-	res, err = m.NextEntityNumber(ctx)
-	assert.Nil(t, err)
-	assert.Equal(t, int32(8), res)
+	cases := []struct {
+		keys    []string
+		keysErr error
+		want    int32
+		wantErr bool
+	}{
+		{[]string{}, nil, 1, false},
+		{[]string{}, errors.New("retrieval error"), 0, true},
+		{[]string{"/entities/entity1", "/entities/load-error"}, nil, 0, true},
+		{[]string{"/entities/entity1", "/entities/entity2"}, nil, 8, false},
+	}
+	for i, c := range cases {
+		m, err := New("mock")
+		assert.Nil(t, err)
+
+		m.kv.(*mockKV).On("Get", "/entities/load-error").Return([]byte{}, errors.New("KV Load error"))
+		m.kv.(*mockKV).On("Get", "/entities/entity1").Return(goodEntityBytes1, nil)
+		m.kv.(*mockKV).On("Get", "/entities/entity2").Return(goodEntityBytes2, nil)
+		m.kv.(*mockKV).On("Keys", "/entities/*").Return(c.keys, c.keysErr)
+		m.kv.(*mockKV).On("Keys", "/groups/*").Return([]string{}, nil)
+
+		res, err := m.NextEntityNumber(ctx)
+		assert.Equal(t, c.wantErr, err != nil, i)
+		assert.Equal(t, c.want, res, i)
+	}
 }
 
 func TestNextGroupNumber(t *testing.T) {
 	ctx := context.Background()
 	RegisterKV("mock", newMockKV)
-	m, err := New("mock")
-	assert.Nil(t, err)
 
-	m.kv.(*mockKV).On("Get", "/groups/load-error").Return([]byte{}, errors.New("KV Load error"))
-	m.kv.(*mockKV).On("Get", "/groups/group1").Return(goodGroupBytes1, nil)
-	m.kv.(*mockKV).On("Get", "/groups/group2").Return(goodGroupBytes2, nil)
+	cases := []struct {
+		keys    []string
+		keysErr error
+		want    int32
+		wantErr bool
+	}{
+		{[]string{}, nil, 1, false},
+		{[]string{}, errors.New("retrieval error"), 0, true},
+		{[]string{"/groups/group1", "/groups/load-error"}, nil, 0, true},
+		{[]string{"/groups/group1", "/groups/group2"}, nil, 8, false},
+	}
+	for i, c := range cases {
+		m, err := New("mock")
+		assert.Nil(t, err)
+
+		m.kv.(*mockKV).On("Get", "/groups/load-error").Return([]byte{}, errors.New("KV Load error"))
+		m.kv.(*mockKV).On("Get", "/groups/group1").Return(goodGroupBytes1, nil)
+		m.kv.(*mockKV).On("Get", "/groups/group2").Return(goodGroupBytes2, nil)
+		m.kv.(*mockKV).On("Keys", "/entities/*").Return([]string{}, nil)
+		m.kv.(*mockKV).On("Keys", "/groups/*").Return(c.keys, c.keysErr)
+
+		res, err := m.NextGroupNumber(ctx)
+		assert.Equal(t, c.wantErr, err != nil, i)
+		assert.Equal(t, c.want, res, i)
+	}
+}
 
-	m.kv.(*mockKV).On("Keys", "/groups/*").Return([]string{}, nil).Once()
-	res, err := m.NextGroupNumber(ctx)
+func TestCapabilities(t *testing.T) {
+	RegisterKV("mock", newMockKV)
+	m, err := New("mock")
 	assert.Nil(t, err)
-	assert.Equal(t, int32(1), res)
 
-	m.kv.(*mockKV).On("Keys", "/groups/*").Return([]string{}, errors.New("retrieval error")).Once()
-	_, err = m.NextGroupNumber(ctx)
-	assert.NotNil(t, err)
-
-	m.kv.(*mockKV).On("Keys", "/groups/*").Return([]string{}, errors.New("retrieval error")).Once()
-	_, err = m.NextGroupNumber(ctx)
-	assert.NotNil(t, err)
+	m.kv.(*mockKV).On("Capabilities").Return([]KVCapability{})
 
-	m.kv.(*mockKV).On("Keys", "/groups/*").Return([]string{"/groups/group1", "/groups/load-error"}, nil).Once()
-	_, err = m.NextGroupNumber(ctx)
-	assert.NotNil(t, err)
+	assert.Equal(t, []KVCapability{}, m.Capabilities())
+}
 
-	m.kv.(*mockKV).On("Keys", "/groups/*").Return([]string{"/groups/group1", "/groups/group2"}, nil).Once()
-	res, err = m.NextGroupNumber(ctx)
-	assert.Nil(t, err)
-	assert.Equal(t, int32(8), res)
+type clusterKV struct {
+	mapKV
+	leader string
 }
 
-func TestCapabilities(t *testing.T) {
+func (kv *clusterKV) Leader() string { return kv.leader }
+
+func TestLeader(t *testing.T) {
 	RegisterKV("mock", newMockKV)
 	m, err := New("mock")
 	assert.Nil(t, err)
+	_, ok := m.Leader()
+	assert.False(t, ok)
 
-	m.kv.(*mockKV).On("Capabilities").Return([]KVCapability{})
+	kv := &clusterKV{mapKV: mapKV{m: make(map[string][]byte)}, leader: "netauth1:1729"}
+	j, err := OpenJournal(filepath.Join(t.TempDir(), "journal.log"))
+	assert.Nil(t, err)
+	m, err = open(kv, WithJournal(j))
+	assert.Nil(t, err)
+	leader, ok := m.Leader()
+	assert.True(t, ok)
+	assert.Equal(t, "netauth1:1729", leader)
 
-	assert.Equal(t, []KVCapability{}, m.Capabilities())
+	rs := &RealmStore{kv: kv, events: make(map[string]func(Event))}
+	m, err = rs.Open("lab")
+	assert.Nil(t, err)
+	leader, ok = m.Leader()
+	assert.True(t, ok)
+	assert.Equal(t, "netauth1:1729", leader)
 }
 
 func TestDBSearchEntities(t *testing.T) {
@@ -255,11 +283,11 @@ func TestDBSearchEntities(t *testing.T) {
 	m, err := New("mock")
 	assert.Nil(t, err)
 
-	res, err := m.SearchEntities(ctx, SearchRequest{})
+	res, _, err := m.SearchEntities(ctx, SearchRequest{})
 	assert.Equal(t, ErrBadSearch, err)
 	assert.Equal(t, []*types.Entity(nil), res)
 
-	res, err = m.SearchEntities(ctx, SearchRequest{Expression: "*"})
+	res, _, err = m.SearchEntities(ctx, SearchRequest{Expression: "*"})
 	assert.Nil(t, err)
 	assert.Equal(t, []*types.Entity{}, res)
 }
@@ -270,11 +298,11 @@ func TestDBSearchGroups(t *testing.T) {
 	m, err := New("mock")
 	assert.Nil(t, err)
 
-	res, err := m.SearchGroups(ctx, SearchRequest{})
+	res, _, err := m.SearchGroups(ctx, SearchRequest{})
 	assert.Equal(t, ErrBadSearch, err)
 	assert.Equal(t, []*types.Group(nil), res)
 
-	res, err = m.SearchGroups(ctx, SearchRequest{Expression: "*"})
+	res, _, err = m.SearchGroups(ctx, SearchRequest{Expression: "*"})
 	assert.Nil(t, err)
 	assert.Equal(t, []*types.Group{}, res)
 }
@@ -0,0 +1,251 @@
+// Package encrypted implements a key/value store wrapper that seals
+// every value with AES-256-GCM before handing it to another store.
+// It is selected by prefixing the name of the inner store, for
+// example "encrypted:filesystem".
+//
+// Key material is loaded from a keyprovider using the mechanism "kv"
+// and the key ID as the use case, so with the fs provider the key
+// "2022" is read from keys/kv-2022.tokenkey.  Values are always
+// sealed with the key named by db.encrypted.key, and each sealed
+// value records the ID of the key that sealed it.  To rotate keys,
+// add a new key, point db.encrypted.key at it, and leave the old key
+// in place.  Values sealed with the old key can still be read, and
+// are sealed with the new key the next time they are written.  Key
+// IDs may only contain letters, digits, dashes and underscores.
+package encrypted
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/pkg/token/keyprovider"
+)
+
+// version is the first byte of every sealed value so that the format
+// can be changed in the future.
+const version byte = 1
+
+// keyIDRegexp matches the key IDs that may be used.  Key IDs are
+// read back from stored values and passed to the key provider, which
+// may use them as part of a path, so nothing else is accepted.
+var keyIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,255}$`)
+
+var (
+	// ErrNoKey is returned if no key has been configured to seal
+	// values with.
+	ErrNoKey = errors.New("db.encrypted.key must be set")
+
+	// ErrBadKeyID is returned for a key ID that cannot be
+	// recorded in a sealed value.
+	ErrBadKeyID = errors.New("key IDs must be 1 to 255 letters, digits, dashes or underscores")
+
+	// ErrMalformed is returned when a stored value is not in the
+	// sealed format.
+	ErrMalformed = errors.New("value is not sealed")
+)
+
+// Store wraps a KVStore and seals the values stored in it.
+type Store struct {
+	db.KVStore
+
+	l     hclog.Logger
+	kp    keyprovider.KeyProvider
+	keyID string
+
+	sync.Mutex
+	aeads map[string]cipher.AEAD
+}
+
+func init() {
+	startup.RegisterCallback(cb)
+}
+
+func cb() {
+	db.RegisterKVWrapper("encrypted", New)
+}
+
+// New wraps the provided KVStore.  The key provider is taken from
+// db.encrypted.keyprovider, which defaults to "fs".
+func New(kv db.KVStore, l hclog.Logger) (db.KVStore, error) {
+	p := viper.GetString("db.encrypted.keyprovider")
+	if p == "" {
+		p = "fs"
+	}
+	kp, err := keyprovider.New(p)
+	if err != nil {
+		return nil, err
+	}
+	return newStore(kv, kp, viper.GetString("db.encrypted.key"), l)
+}
+
+func newStore(kv db.KVStore, kp keyprovider.KeyProvider, keyID string, l hclog.Logger) (*Store, error) {
+	if keyID == "" {
+		return nil, ErrNoKey
+	}
+
+	x := &Store{
+		KVStore: kv,
+		l:       l.Named("encrypted"),
+		kp:      kp,
+		keyID:   keyID,
+		aeads:   make(map[string]cipher.AEAD),
+	}
+
+	// Load the current key straight away so that a missing key
+	// stops the server at startup rather than on the first write.
+	if _, err := x.aead(keyID); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// Put seals v with the current key and stores it at k.
+func (s *Store) Put(ctx context.Context, k string, v []byte) error {
+	b, err := s.seal(k, v)
+	if err != nil {
+		return err
+	}
+	return s.KVStore.Put(ctx, k, b)
+}
+
+// Get retrieves and opens the value at k, using whichever key it was
+// sealed with.
+func (s *Store) Get(ctx context.Context, k string) ([]byte, error) {
+	b, err := s.KVStore.Get(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(k, b)
+}
+
+// Batch seals all the values in the batch and passes it through to
+// the inner store.  The wrapper advertises the capabilities of the
+// inner store, so this is only called if the inner store supports
+// batches.
+func (s *Store) Batch(ctx context.Context, ops []db.KVOp) error {
+	kvb, ok := s.KVStore.(db.KVBatcher)
+	if !ok {
+		return db.ErrInternalError
+	}
+
+	sealed := make([]db.KVOp, len(ops))
+	for i, op := range ops {
+		sealed[i] = op
+		if op.Delete {
+			continue
+		}
+		b, err := s.seal(op.Key, op.Value)
+		if err != nil {
+			return err
+		}
+		sealed[i].Value = b
+	}
+	return kvb.Batch(ctx, sealed)
+}
+
+// seal encrypts a value.  The key the value is stored under is used
+// as additional data so that sealed values can't be swapped between
+// keys.  The format is:
+//
+//	version | len(keyID) | keyID | nonce | ciphertext
+func (s *Store) seal(k string, v []byte) ([]byte, error) {
+	a, err := s.aead(s.keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, 2+len(s.keyID)+a.NonceSize()+len(v)+a.Overhead())
+	out = append(out, version, byte(len(s.keyID)))
+	out = append(out, s.keyID...)
+
+	nonce := make([]byte, a.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return a.Seal(out, nonce, v, []byte(k)), nil
+}
+
+// open decrypts a value sealed by seal.
+func (s *Store) open(k string, b []byte) ([]byte, error) {
+	if len(b) < 2 || b[0] != version || len(b) < 2+int(b[1]) {
+		s.l.Warn("Value is not sealed", "key", k)
+		return nil, ErrMalformed
+	}
+	keyID := string(b[2 : 2+int(b[1])])
+	b = b[2+int(b[1]):]
+
+	a, err := s.aead(keyID)
+	if err == ErrBadKeyID {
+		s.l.Warn("Value names an invalid key", "key", k)
+		return nil, ErrMalformed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < a.NonceSize() {
+		s.l.Warn("Value is not sealed", "key", k)
+		return nil, ErrMalformed
+	}
+	v, err := a.Open(nil, b[:a.NonceSize()], b[a.NonceSize():], []byte(k))
+	if err != nil {
+		s.l.Warn("Value could not be opened", "key", k, "keyID", keyID, "error", err)
+		return nil, err
+	}
+	return v, nil
+}
+
+// ValidKeyID reports whether id may be used as a key ID.
+func ValidKeyID(id string) bool {
+	return keyIDRegexp.MatchString(id)
+}
+
+// aead returns the cipher for a key ID, loading it from the key
+// provider if it hasn't been used yet.  The key material is passed
+// through HKDF so that keys of any length and format can be used.
+func (s *Store) aead(keyID string) (cipher.AEAD, error) {
+	if !ValidKeyID(keyID) {
+		return nil, ErrBadKeyID
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if a, ok := s.aeads[keyID]; ok {
+		return a, nil
+	}
+
+	material, err := s.kp.Provide("kv", keyID)
+	if err != nil {
+		s.l.Error("Unable to load key", "keyID", keyID, "error", err)
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, material, nil, []byte("netauth kv "+keyID)), key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	a, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s.aeads[keyID] = a
+	s.l.Debug("Loaded key", "keyID", keyID)
+	return a, nil
+}
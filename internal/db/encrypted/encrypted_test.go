@@ -0,0 +1,179 @@
+package encrypted
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/db/memory"
+	"github.com/netauth/netauth/pkg/token/keyprovider"
+)
+
+type testKeys map[string][]byte
+
+func (tk testKeys) Provide(mech, id string) ([]byte, error) {
+	if mech != "kv" {
+		return nil, keyprovider.ErrNoSuchKey
+	}
+	k, ok := tk[id]
+	if !ok {
+		return nil, keyprovider.ErrNoSuchKey
+	}
+	return k, nil
+}
+
+func newTestStore(t *testing.T, keyID string, keys testKeys) (*Store, db.KVStore) {
+	inner, err := memory.NewKV(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	inner.SetEventFunc(func(db.Event) {})
+
+	s, err := newStore(inner, keys, keyID, hclog.NewNullLogger())
+	assert.Nil(t, err)
+	return s, inner
+}
+
+func TestCB(t *testing.T) {
+	cb()
+}
+
+func TestNew(t *testing.T) {
+	keyprovider.Register("test", func(hclog.Logger) (keyprovider.KeyProvider, error) {
+		return testKeys{"1": []byte("secret")}, nil
+	})
+	inner, _ := memory.NewKV(hclog.NewNullLogger())
+	defer viper.Reset()
+
+	viper.Set("db.encrypted.keyprovider", "test")
+	_, err := New(inner, hclog.NewNullLogger())
+	assert.Equal(t, ErrNoKey, err)
+
+	viper.Set("db.encrypted.key", "1")
+	_, err = New(inner, hclog.NewNullLogger())
+	assert.Nil(t, err)
+
+	viper.Set("db.encrypted.key", "2")
+	_, err = New(inner, hclog.NewNullLogger())
+	assert.Equal(t, keyprovider.ErrNoSuchKey, err)
+
+	viper.Set("db.encrypted.keyprovider", "does-not-exist")
+	_, err = New(inner, hclog.NewNullLogger())
+	assert.Equal(t, keyprovider.ErrUnknownKeyProvider, err)
+}
+
+func TestPutGet(t *testing.T) {
+	ctx := context.Background()
+	s, inner := newTestStore(t, "1", testKeys{"1": []byte("secret")})
+
+	assert.Nil(t, s.Put(ctx, "/entities/entity1", []byte("some data")))
+
+	v, err := s.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("some data"), v)
+
+	raw, err := inner.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.NotContains(t, string(raw), "some data")
+
+	_, err = s.Get(ctx, "/entities/missing")
+	assert.Equal(t, db.ErrNoValue, err)
+}
+
+func TestTamper(t *testing.T) {
+	ctx := context.Background()
+	s, inner := newTestStore(t, "1", testKeys{"1": []byte("secret")})
+
+	assert.Nil(t, s.Put(ctx, "/entities/entity1", []byte("some data")))
+	raw, _ := inner.Get(ctx, "/entities/entity1")
+
+	// Moving a sealed value to another key must not work.
+	assert.Nil(t, inner.Put(ctx, "/entities/entity2", raw))
+	_, err := s.Get(ctx, "/entities/entity2")
+	assert.NotNil(t, err)
+
+	// Neither may the value be modified.
+	flipped := append([]byte{}, raw...)
+	flipped[len(flipped)-1] ^= 0xff
+	assert.Nil(t, inner.Put(ctx, "/entities/entity1", flipped))
+	_, err = s.Get(ctx, "/entities/entity1")
+	assert.NotNil(t, err)
+
+	// Plaintext values are rejected.
+	for _, b := range [][]byte{{}, {version}, {0x0a, 0x01, 'a'}, {version, 1, '1', 0}} {
+		assert.Nil(t, inner.Put(ctx, "/entities/plain", b))
+		_, err = s.Get(ctx, "/entities/plain")
+		assert.Equal(t, ErrMalformed, err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys{"1": []byte("old secret"), "2": []byte("new secret")}
+	old, inner := newTestStore(t, "1", keys)
+	assert.Nil(t, old.Put(ctx, "/entities/entity1", []byte("some data")))
+
+	s, err := newStore(inner, keys, "2", hclog.NewNullLogger())
+	assert.Nil(t, err)
+
+	// Values sealed with the old key are still readable.
+	v, err := s.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("some data"), v)
+
+	// And are moved to the new key when written.
+	assert.Nil(t, s.Put(ctx, "/entities/entity1", v))
+	raw, _ := inner.Get(ctx, "/entities/entity1")
+	assert.Equal(t, []byte{version, 1, '2'}, raw[:3])
+
+	// Once the old key is gone, only values that have been
+	// rewritten can be read.
+	assert.Nil(t, old.Put(ctx, "/entities/entity2", []byte("more data")))
+	delete(keys, "1")
+	s, err = newStore(inner, keys, "2", hclog.NewNullLogger())
+	assert.Nil(t, err)
+	_, err = s.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	_, err = s.Get(ctx, "/entities/entity2")
+	assert.Equal(t, keyprovider.ErrNoSuchKey, err)
+}
+
+func TestBadKeyID(t *testing.T) {
+	inner, _ := memory.NewKV(hclog.NewNullLogger())
+	long := make([]byte, 256)
+	for i := range long {
+		long[i] = 'a'
+	}
+	for _, id := range []string{string(long), "../../etc/passwd", "a b", "k\x00"} {
+		_, err := newStore(inner, testKeys{id: []byte("secret")}, id, hclog.NewNullLogger())
+		assert.Equal(t, ErrBadKeyID, err, id)
+	}
+
+	// A stored value can't name a key outside of the keyspace
+	// either.
+	s, inner := newTestStore(t, "1", testKeys{"1": []byte("secret"), "../1": []byte("secret")})
+	id := "../1"
+	assert.Nil(t, inner.Put(context.Background(), "/entities/entity1", append([]byte{version, byte(len(id))}, id...)))
+	_, err := s.Get(context.Background(), "/entities/entity1")
+	assert.Equal(t, ErrMalformed, err)
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	s, inner := newTestStore(t, "1", testKeys{"1": []byte("secret")})
+	assert.Nil(t, inner.Put(ctx, "/groups/group1", []byte("old data")))
+
+	assert.Equal(t, inner.Capabilities(), s.Capabilities())
+	assert.Nil(t, s.Batch(ctx, []db.KVOp{
+		{Key: "/entities/entity1", Value: []byte("some data")},
+		{Key: "/groups/group1", Delete: true},
+	}))
+
+	v, err := s.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("some data"), v)
+	_, err = inner.Get(ctx, "/groups/group1")
+	assert.Equal(t, db.ErrNoValue, err)
+}
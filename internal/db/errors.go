@@ -27,4 +27,31 @@ var (
 
 	// ErrNoValue is returned when no value exists for a given key.
 	ErrNoValue = errors.New("no value exists")
+
+	// ErrRevisionConflict is returned when an object is saved but
+	// the stored copy has changed since it was loaded.
+	ErrRevisionConflict = errors.New("the object has been modified since it was loaded")
+
+	// ErrJournalCorrupt is returned when the journal contains an
+	// entry that can't be decoded.
+	ErrJournalCorrupt = errors.New("the journal contains an undecodable entry")
+
+	// ErrNumberInUse is returned when a number is claimed that
+	// another object already has.
+	ErrNumberInUse = errors.New("the number is already in use")
+
+	// ErrNumbersExhausted is returned when there are no numbers
+	// left to allocate in the configured range.
+	ErrNumbersExhausted = errors.New("no numbers are left in the configured range")
+
+	// ErrObjectExists is returned when a deleted object can't be
+	// restored because another object has taken its place.
+	ErrObjectExists = errors.New("an object with that name already exists")
+
+	// ErrBadRealm is returned when a realm name is not valid.
+	ErrBadRealm = errors.New("realm names may only contain lowercase letters, digits, '-' and '_'")
+
+	// ErrRealmOpen is returned when a realm is opened a second
+	// time.
+	ErrRealmOpen = errors.New("the realm is already open")
 )
@@ -0,0 +1,389 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/netauth/netauth/internal/health"
+)
+
+// A QueuePolicy decides what happens to an event when the queue it
+// is bound for is full.
+type QueuePolicy int
+
+const (
+	// Block makes the write that fired the event wait until there
+	// is room in the queue.
+	Block QueuePolicy = iota
+
+	// DropNewest discards the event that didn't fit.
+	DropNewest
+
+	// DropOldest discards the event that has been waiting longest
+	// to make room for the new one.
+	DropOldest
+)
+
+// Subscribers keep state that is built from events, so an event that
+// is dropped isn't lost for good.  The object it was for is
+// remembered, and once there is room again the subscriber is sent an
+// event that describes the object as it is by then.
+
+// ErrUnknownPolicy is returned when a QueuePolicy can't be parsed.
+var ErrUnknownPolicy = errors.New("unknown queue policy")
+
+// ParseQueuePolicy returns the policy with the given name, which is
+// one of block, drop-newest or drop-oldest.
+func ParseQueuePolicy(s string) (QueuePolicy, error) {
+	switch strings.ToLower(s) {
+	case "block":
+		return Block, nil
+	case "drop-newest":
+		return DropNewest, nil
+	case "drop-oldest":
+		return DropOldest, nil
+	}
+	return Block, ErrUnknownPolicy
+}
+
+// Delivery configures how events reach subscribers that don't need to
+// see them before the write that fired them returns.  Each subscriber
+// gets Workers queues of QueueSize events.  Events for the same
+// primary key always go to the same queue, so they are handled in the
+// order they were fired.  A QueueSize of 0 delivers events
+// synchronously.
+type Delivery struct {
+	QueueSize int
+	Workers   int
+	Policy    QueuePolicy
+}
+
+// QueueStats describes the queues of one subscriber.  Resyncing is
+// set while events that were dropped are still to be sent again.
+type QueueStats struct {
+	Name      string
+	Depth     int
+	Capacity  int
+	Dropped   uint64
+	Resyncing bool
+}
+
+// WithDelivery sets how events reach subscribers that were added
+// with Subscribe.
+func WithDelivery(d Delivery) Option { return func(db *DB) { db.bus.d = d } }
+
+// eventBus holds the subscribers that are called from queues.
+type eventBus struct {
+	d Delivery
+
+	// refresh turns an event that was dropped into one that
+	// describes the object as it is now.
+	refresh func(Event) Event
+
+	// mu is held for reading while events are queued and for
+	// writing to close the queues.
+	mu     sync.RWMutex
+	closed bool
+	subs   []*subscriber
+
+	pmu     sync.Mutex
+	idle    *sync.Cond
+	pending int
+}
+
+type subscriber struct {
+	name   string
+	cb     Callback
+	policy QueuePolicy
+	queues []chan Event
+	bus    *eventBus
+	wg     sync.WaitGroup
+
+	dropped uint64
+
+	// dirty holds the last event dropped for each object that
+	// still has to be sent again.
+	dmu       sync.Mutex
+	dirty     map[dirtyKey]Event
+	resyncing bool
+}
+
+// dirtyKey identifies an object that an event was dropped for.
+type dirtyKey struct {
+	group bool
+	pk    string
+}
+
+func newEventBus() *eventBus {
+	b := &eventBus{}
+	b.idle = sync.NewCond(&b.pmu)
+	return b
+}
+
+// Subscribe registers a callback that is called from queues of its
+// own, so that it can't hold up writes.  If the DB has not been
+// configured with queues this is the same as RegisterCallback.
+// Subscribers should not expect to see changes the moment the write
+// that made them returns.
+func (db *DB) Subscribe(name string, cb Callback) {
+	if db.bus == nil || db.bus.d.QueueSize <= 0 {
+		db.RegisterCallback(name, cb)
+		return
+	}
+	if _, ok := db.cbs[name]; ok {
+		log().Warn("Attempted to register duplicate callback", "callback", name)
+		return
+	}
+
+	workers := db.bus.d.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	s := &subscriber{
+		name:   name,
+		cb:     cb,
+		policy: db.bus.d.Policy,
+		queues: make([]chan Event, workers),
+		bus:    db.bus,
+	}
+	for i := range s.queues {
+		s.queues[i] = make(chan Event, db.bus.d.QueueSize)
+		s.wg.Add(1)
+		go s.run(s.queues[i])
+	}
+
+	db.bus.mu.Lock()
+	db.bus.subs = append(db.bus.subs, s)
+	db.bus.mu.Unlock()
+	db.RegisterCallback(name, s.enqueue)
+}
+
+// currentEvent returns an event that describes the object that e was
+// for as it is now, which is an update if it exists and a destroy if
+// it doesn't.
+func (db *DB) currentEvent(e Event) Event {
+	ctx := context.Background()
+	switch e.Type {
+	case EventEntityCreate, EventEntityUpdate, EventEntityDestroy:
+		e.Type = EventEntityUpdate
+		if _, err := db.LoadEntity(ctx, e.PK); err == ErrUnknownEntity {
+			e.Type = EventEntityDestroy
+		}
+	case EventGroupCreate, EventGroupUpdate, EventGroupDestroy:
+		e.Type = EventGroupUpdate
+		if _, err := db.LoadGroup(ctx, e.PK); err == ErrUnknownGroup {
+			e.Type = EventGroupDestroy
+		}
+	}
+	e.Preload = false
+	return e
+}
+
+// WaitEvents blocks until every queued event has been handled.
+func (db *DB) WaitEvents() {
+	if db.bus == nil {
+		return
+	}
+	db.bus.pmu.Lock()
+	defer db.bus.pmu.Unlock()
+	for db.bus.pending > 0 {
+		db.bus.idle.Wait()
+	}
+}
+
+// EventQueueStats returns the state of the queue of every
+// subscriber added with Subscribe.
+func (db *DB) EventQueueStats() []QueueStats {
+	if db.bus == nil {
+		return nil
+	}
+	db.bus.mu.RLock()
+	defer db.bus.mu.RUnlock()
+
+	out := make([]QueueStats, len(db.bus.subs))
+	for i, s := range db.bus.subs {
+		out[i] = QueueStats{Name: s.name, Dropped: atomic.LoadUint64(&s.dropped)}
+		s.dmu.Lock()
+		out[i].Resyncing = s.resyncing
+		s.dmu.Unlock()
+		for _, q := range s.queues {
+			out[i].Depth += len(q)
+			out[i].Capacity += cap(q)
+		}
+	}
+	return out
+}
+
+// EventsHealthCheck reports the depth of each subscriber's queues.
+// A subscriber is out of date until the events that were dropped for
+// it have been sent again, so it is reported as failed until then.
+func (db *DB) EventsHealthCheck() health.SubsystemStatus {
+	s := health.SubsystemStatus{OK: true, Name: "db-events"}
+	var parts []string
+	for _, q := range db.EventQueueStats() {
+		p := fmt.Sprintf("%s %d/%d", q.Name, q.Depth, q.Capacity)
+		switch {
+		case q.Resyncing:
+			s.OK = false
+			p += fmt.Sprintf(" (%d dropped, resyncing)", q.Dropped)
+		case q.Dropped > 0:
+			p += fmt.Sprintf(" (%d dropped)", q.Dropped)
+		}
+		parts = append(parts, p)
+	}
+	s.Status = strings.Join(parts, ", ")
+	return s
+}
+
+// close stops accepting events and waits for the ones that are
+// queued to be handled.
+func (b *eventBus) close() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, s := range b.subs {
+		for _, q := range s.queues {
+			close(q)
+		}
+		s.wg.Wait()
+	}
+}
+
+func (b *eventBus) add() {
+	b.pmu.Lock()
+	b.pending++
+	b.pmu.Unlock()
+}
+
+func (b *eventBus) done() {
+	b.pmu.Lock()
+	b.pending--
+	if b.pending == 0 {
+		b.idle.Broadcast()
+	}
+	b.pmu.Unlock()
+}
+
+// enqueue is the Callback that stands in for a subscriber.
+func (s *subscriber) enqueue(e Event) {
+	s.bus.mu.RLock()
+	defer s.bus.mu.RUnlock()
+	if s.bus.closed {
+		return
+	}
+
+	q := s.queueFor(e.PK)
+	s.bus.add()
+	switch s.policy {
+	case DropNewest:
+		select {
+		case q <- e:
+		default:
+			s.drop(e)
+		}
+	case DropOldest:
+		for {
+			select {
+			case q <- e:
+				return
+			default:
+			}
+			select {
+			case old := <-q:
+				s.drop(old)
+			default:
+			}
+		}
+	default:
+		q <- e
+	}
+}
+
+// drop discards an event that didn't fit and remembers the object it
+// was for, starting a resync if one isn't running.  The caller must
+// hold bus.mu for reading.
+func (s *subscriber) drop(e Event) {
+	atomic.AddUint64(&s.dropped, 1)
+	log().Warn("Event queue is full, event dropped", "callback", s.name, "type", e.Type, "pk", e.PK)
+
+	s.dmu.Lock()
+	defer s.dmu.Unlock()
+	if s.dirty == nil {
+		s.dirty = make(map[dirtyKey]Event)
+	}
+	s.dirty[dirtyKey{group: e.Type >= EventGroupCreate, pk: e.PK}] = e
+	if s.resyncing {
+		s.bus.done()
+		return
+	}
+	// The pending count that the dropped event held is handed on
+	// to the resync, so WaitEvents waits for it.
+	s.resyncing = true
+	go s.resync()
+}
+
+// resync sends the subscriber an up to date event for every object
+// that had an event dropped, waiting for room in the queue rather
+// than dropping any more.
+func (s *subscriber) resync() {
+	defer s.bus.done()
+	for {
+		s.dmu.Lock()
+		dirty := s.dirty
+		s.dirty = nil
+		if len(dirty) == 0 {
+			s.resyncing = false
+			s.dmu.Unlock()
+			return
+		}
+		s.dmu.Unlock()
+
+		for _, e := range dirty {
+			if s.bus.refresh != nil {
+				e = s.bus.refresh(e)
+			}
+			if !s.send(e) {
+				return
+			}
+		}
+	}
+}
+
+// send queues an event, waiting for room.  It returns false if the
+// bus has been closed.
+func (s *subscriber) send(e Event) bool {
+	s.bus.mu.RLock()
+	defer s.bus.mu.RUnlock()
+	if s.bus.closed {
+		return false
+	}
+	s.bus.add()
+	s.queueFor(e.PK) <- e
+	return true
+}
+
+// queueFor returns the queue that events for pk go to.
+func (s *subscriber) queueFor(pk string) chan Event {
+	h := fnv.New32a()
+	h.Write([]byte(pk))
+	return s.queues[h.Sum32()%uint32(len(s.queues))]
+}
+
+func (s *subscriber) run(q chan Event) {
+	defer s.wg.Done()
+	for e := range q {
+		s.cb(e)
+		s.bus.done()
+	}
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+func newBusDB(d Delivery) *DB {
+	x := &DB{cbs: make(map[string]Callback), bus: newEventBus()}
+	WithDelivery(d)(x)
+	return x
+}
+
+func TestParseQueuePolicy(t *testing.T) {
+	cases := []struct {
+		s       string
+		want    QueuePolicy
+		wantErr error
+	}{
+		{"block", Block, nil},
+		{"drop-newest", DropNewest, nil},
+		{"Drop-Oldest", DropOldest, nil},
+		{"sometimes", Block, ErrUnknownPolicy},
+	}
+	for i, c := range cases {
+		p, err := ParseQueuePolicy(c.s)
+		assert.Equal(t, c.wantErr, err, "case %d", i)
+		assert.Equal(t, c.want, p, "case %d", i)
+	}
+}
+
+func TestSubscribeSynchronous(t *testing.T) {
+	x := newBusDB(Delivery{})
+	called := false
+	x.Subscribe("foo", func(Event) { called = true })
+	x.FireEvent(Event{Type: EventEntityCreate, PK: "foo"})
+	assert.True(t, called)
+	assert.Empty(t, x.EventQueueStats())
+}
+
+func TestSubscribeOrderPerKey(t *testing.T) {
+	x := newBusDB(Delivery{QueueSize: 4, Workers: 4})
+	var mu sync.Mutex
+	seen := make(map[string][]EventType)
+	x.Subscribe("foo", func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[e.PK] = append(seen[e.PK], e.Type)
+	})
+	x.Subscribe("foo", func(Event) { t.Error("Duplicate subscriber called") })
+
+	for i := 0; i < 50; i++ {
+		for j := 0; j < 5; j++ {
+			x.FireEvent(Event{Type: EventType(i), PK: fmt.Sprintf("key%d", j)})
+		}
+	}
+	x.WaitEvents()
+
+	assert.Len(t, seen, 5)
+	for pk, types := range seen {
+		assert.Len(t, types, 50, pk)
+		for i, typ := range types {
+			assert.Equal(t, EventType(i), typ, pk)
+		}
+	}
+	x.bus.close()
+}
+
+// stalledSubscriber subscribes a callback that holds on to the first
+// event until release is closed, and records every event it sees.
+func stalledSubscriber(x *DB) (release chan struct{}, got func() []string) {
+	var mu sync.Mutex
+	var seen []string
+	started := make(chan struct{})
+	release = make(chan struct{})
+	x.Subscribe("slow", func(e Event) {
+		if e.PK == "e1" {
+			close(started)
+			<-release
+		}
+		mu.Lock()
+		seen = append(seen, e.PK)
+		mu.Unlock()
+	})
+	x.FireEvent(Event{PK: "e1"})
+	<-started
+	return release, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, seen...)
+	}
+}
+
+func TestSubscribeDropPolicies(t *testing.T) {
+	cases := []struct {
+		policy QueuePolicy
+		want   []string
+	}{
+		{DropNewest, []string{"e1", "e2", "e3"}},
+		{DropOldest, []string{"e1", "e3", "e2"}},
+	}
+	for _, c := range cases {
+		x := newBusDB(Delivery{QueueSize: 1, Workers: 1, Policy: c.policy})
+		release, got := stalledSubscriber(x)
+		x.FireEvent(Event{PK: "e2"})
+		x.FireEvent(Event{PK: "e3"})
+
+		assert.Equal(t, []QueueStats{{Name: "slow", Depth: 1, Capacity: 1, Dropped: 1, Resyncing: true}}, x.EventQueueStats())
+		status := x.EventsHealthCheck()
+		assert.False(t, status.OK)
+		assert.Equal(t, "slow 1/1 (1 dropped, resyncing)", status.Status)
+
+		// The dropped event is sent again once there is room.
+		close(release)
+		x.WaitEvents()
+		assert.Equal(t, c.want, got())
+		status = x.EventsHealthCheck()
+		assert.True(t, status.OK)
+		assert.Equal(t, "slow 0/1 (1 dropped)", status.Status)
+		x.bus.close()
+	}
+}
+
+func TestCurrentEvent(t *testing.T) {
+	RegisterKV("map", newMapKV)
+	x, err := New("map")
+	assert.Nil(t, err)
+	ctx := context.Background()
+	assert.Nil(t, x.SaveEntity(ctx, &types.Entity{ID: proto.String("entity1")}))
+	assert.Nil(t, x.SaveGroup(ctx, &types.Group{Name: proto.String("group1")}))
+
+	cases := []struct {
+		in   Event
+		want EventType
+	}{
+		{Event{Type: EventEntityCreate, PK: "entity1"}, EventEntityUpdate},
+		{Event{Type: EventEntityDestroy, PK: "entity1"}, EventEntityUpdate},
+		{Event{Type: EventEntityUpdate, PK: "entity2"}, EventEntityDestroy},
+		{Event{Type: EventGroupDestroy, PK: "group1"}, EventGroupUpdate},
+		{Event{Type: EventGroupCreate, PK: "group2"}, EventGroupDestroy},
+	}
+	for i, c := range cases {
+		e := x.currentEvent(c.in)
+		assert.Equal(t, c.want, e.Type, "case %d", i)
+		assert.Equal(t, c.in.PK, e.PK, "case %d", i)
+	}
+}
+
+func TestSubscribeBlock(t *testing.T) {
+	x := newBusDB(Delivery{QueueSize: 1, Workers: 1, Policy: Block})
+	release, got := stalledSubscriber(x)
+	x.FireEvent(Event{PK: "e2"})
+
+	fired := make(chan struct{})
+	go func() {
+		x.FireEvent(Event{PK: "e3"})
+		close(fired)
+	}()
+	select {
+	case <-fired:
+		t.Fatal("FireEvent returned with a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-fired
+	x.WaitEvents()
+	assert.Equal(t, []string{"e1", "e2", "e3"}, got())
+	assert.True(t, x.EventsHealthCheck().OK)
+	x.bus.close()
+}
+
+func TestEventBusClose(t *testing.T) {
+	x := newBusDB(Delivery{QueueSize: 8, Workers: 2})
+	var mu sync.Mutex
+	n := 0
+	x.Subscribe("foo", func(Event) {
+		mu.Lock()
+		n++
+		mu.Unlock()
+	})
+	for i := 0; i < 8; i++ {
+		x.FireEvent(Event{PK: fmt.Sprintf("key%d", i)})
+	}
+
+	// Queued events are handled before close returns, and
+	// events fired afterwards are dropped.
+	x.bus.close()
+	assert.Equal(t, 8, n)
+	x.FireEvent(Event{PK: "late"})
+	x.bus.close()
+	assert.Equal(t, 8, n)
+}
@@ -1,24 +1,28 @@
 // Package filesystem implements a key/value store on top of a generic
 // filesystem.  This is the direct successor to the protodb and is
-// compatible with its storage format.  It is not compatible with some
-// of the features of the protodb, most notably noticing changes to
-// the filesystem outside of NetAuth.  It was incredibly hard to make
-// this work reliably in protodb, and if you look too closely you'll
-// realize that it doesn't satisfy a lot of integrity constraints and
-// probably could be used to corrupt data if you were really clever.
-// Additionally, the filesystem key/value store does not use the .dat
-// extension on data files as it is wholely unnecessary.  This needs
-// to be done during migration.  The recommended way to migrate from
-// one to another is to use a shell fragment that can talk to both.
+// compatible with its storage format.  By default changes made to the
+// filesystem outside of NetAuth are not noticed.  On Linux setting
+// db.filesystem.watch will watch the entities and groups with inotify
+// so that a copy which is kept up to date by some other means, such
+// as rsync to a read-only replica, keeps its indexes current.  The
+// watcher only sees changes, it doesn't check them, so anything
+// written into the tree had better be valid.  Only the default realm
+// is watched.  Additionally, the filesystem key/value store does not
+// use the .dat extension on data files as it is wholely unnecessary.
+// This needs to be done during migration.  The recommended way to
+// migrate from one to another is to use a shell fragment that can
+// talk to both.
 package filesystem
 
 import (
 	"context"
 	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	atomic "github.com/google/renameio"
 	"github.com/hashicorp/go-hclog"
@@ -35,6 +39,12 @@ type Filesystem struct {
 
 	l  hclog.Logger
 	eF func(db.Event)
+
+	readonly bool
+
+	watcher   io.Closer
+	ready     chan struct{}
+	readyOnce sync.Once
 }
 
 // event is an enum for what type of event to fire and subsequently
@@ -46,6 +56,11 @@ const (
 	eventDelete
 )
 
+// batchFile is the name of the intent record for an in-flight batch.
+// It lives at the top of the base path which keeps it out of the
+// keyspace that Keys() enumerates.
+const batchFile = ".batch"
+
 var (
 	// ErrPathEscape is returned if a key tries to climb up and
 	// out of a directory.
@@ -65,8 +80,25 @@ func newKV(l hclog.Logger) (db.KVStore, error) {
 		l: l.Named("filesystem"),
 
 		basePath: filepath.Join(viper.GetString("core.home"), "kv"),
+		readonly: viper.GetBool("db.readonly"),
+		ready:    make(chan struct{}),
+	}
+
+	// A read-only store may be opened by a tool while the server
+	// is running, so it must not touch the server's batch intent.
+	if x.readonly {
+		return x, nil
+	}
+
+	if err := x.replayBatch(); err != nil {
+		return nil, err
 	}
 
+	if viper.GetBool("db.filesystem.watch") {
+		if err := x.watch(); err != nil {
+			return nil, err
+		}
+	}
 	return x, nil
 }
 
@@ -74,6 +106,7 @@ func newKV(l hclog.Logger) (db.KVStore, error) {
 // subscribers.
 func (fs *Filesystem) SetEventFunc(ef func(db.Event)) {
 	fs.eF = ef
+	fs.readyOnce.Do(func() { close(fs.ready) })
 }
 
 // Put stores a series of bytes on the filesystem, checking to make
@@ -133,6 +166,95 @@ func (fs *Filesystem) Del(_ context.Context, k string) error {
 	return nil
 }
 
+// Batch applies all the operations as a unit.  Each file is already
+// written atomically, but the set of them is not, so the batch is
+// first written as an intent record which is removed once all the
+// operations have been applied.  If the server stops part way
+// through, the record is replayed the next time the store is opened.
+func (fs *Filesystem) Batch(_ context.Context, ops []db.KVOp) error {
+	// Validate all the paths up front so that a bad key can't
+	// leave a batch half applied.
+	for _, op := range ops {
+		if _, err := fs.cleanPath(op.Key); err != nil {
+			return err
+		}
+	}
+
+	intent, err := db.MarshalBatch(ops)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(fs.basePath, 0750); err != nil {
+		return err
+	}
+	ip := filepath.Join(fs.basePath, batchFile)
+	if err := atomic.WriteFile(ip, intent, 0640); err != nil {
+		return err
+	}
+	if err := fs.applyBatch(ops); err != nil {
+		return err
+	}
+	if err := os.Remove(ip); err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		if op.Delete {
+			fs.fireEventForKey(op.Key, eventDelete)
+			continue
+		}
+		fs.fireEventForKey(op.Key, eventUpdate)
+	}
+	return nil
+}
+
+// applyBatch performs the operations of a batch without firing any
+// events.  Deleting a key that does not exist is not an error so
+// that a batch can be safely applied more than once.
+func (fs *Filesystem) applyBatch(ops []db.KVOp) error {
+	for _, op := range ops {
+		p, err := fs.cleanPath(op.Key)
+		if err != nil {
+			return err
+		}
+		if op.Delete {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+			return err
+		}
+		if err := atomic.WriteFile(p, op.Value, 0640); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayBatch completes any batch that was interrupted before it
+// could be fully applied.
+func (fs *Filesystem) replayBatch() error {
+	ip := filepath.Join(fs.basePath, batchFile)
+	intent, err := ioutil.ReadFile(ip)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ops, err := db.UnmarshalBatch(intent)
+	if err != nil {
+		return err
+	}
+	fs.l.Info("Replaying interrupted batch", "ops", len(ops))
+	if err := fs.applyBatch(ops); err != nil {
+		return err
+	}
+	return os.Remove(ip)
+}
+
 // Keys is a way to enumerate the keys in the key/value store and to
 // optionally filter them based on a globbing expression.  This cheats
 // and uses superior knowledge that NetAuth uses only a single key
@@ -159,15 +281,22 @@ func (fs *Filesystem) Keys(_ context.Context, f string) ([]string, error) {
 	return out[:i], nil
 }
 
-// Close is required by the interface, but all operations on the
-// filesystem are atomic, so no close is required.
-func (fs *Filesystem) Close() error { return nil }
+// Close stops the watcher if one is running.  All other operations on
+// the filesystem are atomic, so there is nothing else to close.
+func (fs *Filesystem) Close() error {
+	if fs.watcher != nil {
+		return fs.watcher.Close()
+	}
+	return nil
+}
 
 // Capabilities returns the capabilities that this implementation is
 // able to satisfy.  Capabilities checks for a .writeable flag to tell
 // it that the local copy is intentionally mutable.  Calls to Put may
 // succeed even if this flag is missing, but higher level constructs
-// can use this to check of this instance is in read-only mode.
+// can use this to check of this instance is in read-only mode.  A
+// store opened with db.readonly is never mutable.  Batches are always
+// supported.
 func (fs *Filesystem) Capabilities() []db.KVCapability {
 	out := []db.KVCapability{}
 
@@ -179,9 +308,10 @@ func (fs *Filesystem) Capabilities() []db.KVCapability {
 	// them in that this file should not be replicated to
 	// elsewhere, and what it does.
 	_, err := os.Stat(filepath.Join(fs.basePath, ".mutable"))
-	if !os.IsNotExist(err) {
+	if !os.IsNotExist(err) && !fs.readonly {
 		out = append(out, db.KVMutable)
 	}
+	out = append(out, db.KVBatch)
 
 	return out
 }
@@ -203,28 +333,7 @@ func (fs *Filesystem) cleanPath(p string) (string, error) {
 // fireEventForKey maps from a key to an entity or group and fires an
 // appropriate event for the given key.
 func (fs *Filesystem) fireEventForKey(k string, t eventType) {
-	switch {
-	case t == eventUpdate && strings.HasPrefix(k, "/entities/"):
-		fs.eF(db.Event{
-			PK:   filepath.Base(k),
-			Type: db.EventEntityUpdate,
-		})
-	case t == eventDelete && strings.HasPrefix(k, "/entities/"):
-		fs.eF(db.Event{
-			PK:   filepath.Base(k),
-			Type: db.EventEntityDestroy,
-		})
-	case t == eventUpdate && strings.HasPrefix(k, "/groups/"):
-		fs.eF(db.Event{
-			PK:   filepath.Base(k),
-			Type: db.EventGroupUpdate,
-		})
-	case t == eventDelete && strings.HasPrefix(k, "/groups/"):
-		fs.eF(db.Event{
-			PK:   filepath.Base(k),
-			Type: db.EventGroupDestroy,
-		})
-	default:
-		fs.l.Warn("Event translation called with unknown key prefix", "type", t, "key", k)
+	if e, ok := db.EventForKey(k, t == eventDelete); ok {
+		fs.eF(e)
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
@@ -118,12 +119,83 @@ func TestCapabilities(t *testing.T) {
 	assert.Nil(t, err)
 	kv.(*Filesystem).basePath = t.TempDir()
 
-	assert.Equal(t, []db.KVCapability{}, kv.Capabilities())
+	assert.Equal(t, []db.KVCapability{db.KVBatch}, kv.Capabilities())
 
 	f, err := os.Create(filepath.Join(kv.(*Filesystem).basePath, ".mutable"))
 	assert.Nil(t, err)
 	f.Close()
-	assert.Equal(t, []db.KVCapability{db.KVMutable}, kv.Capabilities())
+	assert.Equal(t, []db.KVCapability{db.KVMutable, db.KVBatch}, kv.Capabilities())
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	kv, err := newKV(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	kv.(*Filesystem).basePath = t.TempDir()
+
+	events := []db.Event{}
+	kv.SetEventFunc(func(e db.Event) { events = append(events, e) })
+	assert.Nil(t, kv.Put(ctx, "/entities/entity2", []byte("old data")))
+	events = nil
+
+	ops := []db.KVOp{
+		{Key: "/entities/entity1", Value: []byte("some data")},
+		{Key: "/entities/entity2", Delete: true},
+		{Key: "/groups/missing", Delete: true},
+		{Key: "/groups/group1", Value: []byte("some more data")},
+	}
+	assert.Nil(t, kv.(db.KVBatcher).Batch(ctx, ops))
+
+	v, err := kv.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("some data"), v)
+	_, err = kv.Get(ctx, "/entities/entity2")
+	assert.Equal(t, db.ErrNoValue, err)
+	_, err = os.Stat(filepath.Join(kv.(*Filesystem).basePath, batchFile))
+	assert.True(t, os.IsNotExist(err))
+	assert.Len(t, events, 4)
+
+	// A bad key anywhere in the batch must prevent all of it from
+	// being applied.
+	events = nil
+	ops = []db.KVOp{
+		{Key: "/entities/entity3", Value: []byte("some data")},
+		{Key: "../out/of/chroot", Value: []byte("evil data")},
+	}
+	assert.Equal(t, ErrPathEscape, kv.(db.KVBatcher).Batch(ctx, ops))
+	_, err = kv.Get(ctx, "/entities/entity3")
+	assert.Equal(t, db.ErrNoValue, err)
+	assert.Len(t, events, 0)
+}
+
+func TestBatchReplay(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	viper.Set("core.home", base)
+	assert.Nil(t, os.MkdirAll(filepath.Join(base, "kv"), 0750))
+
+	// Simulate a crash after the intent was recorded but before
+	// any of the operations were applied.
+	intent, err := db.MarshalBatch([]db.KVOp{
+		{Key: "/entities/entity1", Value: []byte("some data")},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(base, "kv", batchFile), intent, 0640))
+
+	kv, err := newKV(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	v, err := kv.Get(ctx, "/entities/entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("some data"), v)
+	_, err = os.Stat(filepath.Join(base, "kv", batchFile))
+	assert.True(t, os.IsNotExist(err))
+
+	// A corrupt intent record can't be replayed, and the store
+	// refuses to open rather than guessing.
+	assert.Nil(t, os.WriteFile(filepath.Join(base, "kv", batchFile), []byte("garbage"), 0640))
+	_, err = newKV(hclog.NewNullLogger())
+	assert.NotNil(t, err)
+	viper.Reset()
 }
 
 type eventHandler struct{ mock.Mock }
@@ -164,3 +236,22 @@ func TestFireEventForKey(t *testing.T) {
 	// trigger an event.
 	ef.AssertNumberOfCalls(t, "FireEvent", 4)
 }
+
+func TestReadOnly(t *testing.T) {
+	base := t.TempDir()
+	viper.Set("core.home", base)
+	viper.Set("db.readonly", true)
+	defer viper.Reset()
+	assert.Nil(t, os.MkdirAll(filepath.Join(base, "kv"), 0750))
+	assert.Nil(t, os.WriteFile(filepath.Join(base, "kv", ".mutable"), nil, 0640))
+
+	// The intent belongs to whoever else has the store open, so
+	// a read-only store leaves it alone.
+	assert.Nil(t, os.WriteFile(filepath.Join(base, "kv", batchFile), []byte("garbage"), 0640))
+
+	kv, err := newKV(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, []db.KVCapability{db.KVBatch}, kv.Capabilities())
+	_, err = os.Stat(filepath.Join(base, "kv", batchFile))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,84 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watch starts watching the entities and groups for changes that are
+// made outside of NetAuth, such as by rsync, and fires events for
+// them.  Changes made through the store fire their own events, and
+// will also be seen by the watcher.  The duplicate events are
+// harmless since everything that consumes them only reloads the
+// changed object.
+func (fs *Filesystem) watch() error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range []string{"entities", "groups"} {
+		p := filepath.Join(fs.basePath, d)
+		if err := os.MkdirAll(p, 0750); err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Add(p); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	fs.watcher = w
+
+	go fs.watchLoop(w)
+	fs.l.Info("Watching for changes made outside of NetAuth")
+	return nil
+}
+
+// watchLoop converts the filesystem notifications into events until
+// the watcher is closed.  Nothing is delivered until the event
+// function has been set, the notifications wait in the watcher until
+// then.
+func (fs *Filesystem) watchLoop(w *fsnotify.Watcher) {
+	<-fs.ready
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			fs.handleNotification(ev)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			fs.l.Warn("Error watching filesystem", "error", err)
+		}
+	}
+}
+
+// handleNotification fires an event for a notification if it refers
+// to a key.  Temporary files are skipped since both NetAuth and rsync
+// write to a hidden file and then rename it into place, which shows
+// up as a create of the real name.
+func (fs *Filesystem) handleNotification(ev fsnotify.Event) {
+	if strings.HasPrefix(filepath.Base(ev.Name), ".") {
+		return
+	}
+	k, err := filepath.Rel(fs.basePath, ev.Name)
+	if err != nil {
+		return
+	}
+	k = "/" + k
+
+	fs.l.Trace("Filesystem notification", "key", k, "op", ev.Op)
+	switch {
+	case ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		fs.fireEventForKey(k, eventDelete)
+	case ev.Op&(fsnotify.Create|fsnotify.Write) != 0:
+		fs.fireEventForKey(k, eventUpdate)
+	}
+}
@@ -0,0 +1,80 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netauth/netauth/internal/db"
+)
+
+func TestWatch(t *testing.T) {
+	base := t.TempDir()
+	viper.Set("core.home", base)
+	viper.Set("db.filesystem.watch", true)
+	defer viper.Reset()
+
+	kv, err := newKV(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+
+	events := make(chan db.Event, 10)
+	kv.SetEventFunc(func(e db.Event) { events <- e })
+
+	next := func() db.Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for event")
+		}
+		return db.Event{}
+	}
+
+	// Temporary files are ignored, but renaming them into place
+	// shows up as an update.
+	tmp := filepath.Join(base, "kv", "entities", ".entity1.tmp")
+	assert.Nil(t, os.WriteFile(tmp, []byte("some data"), 0640))
+	assert.Nil(t, os.Rename(tmp, filepath.Join(base, "kv", "entities", "entity1")))
+	assert.Equal(t, db.Event{PK: "entity1", Type: db.EventEntityUpdate}, next())
+
+	assert.Nil(t, os.WriteFile(filepath.Join(base, "kv", "groups", "group1"), []byte("some data"), 0640))
+	assert.Equal(t, db.Event{PK: "group1", Type: db.EventGroupUpdate}, next())
+
+	assert.Nil(t, os.Remove(filepath.Join(base, "kv", "entities", "entity1")))
+	for e := next(); e.Type != db.EventEntityDestroy; e = next() {
+		// Writing the group may have produced more than one
+		// notification, these can be skipped.
+		assert.Equal(t, db.Event{PK: "group1", Type: db.EventGroupUpdate}, e)
+	}
+}
+
+func TestWatchDisabled(t *testing.T) {
+	viper.Set("core.home", t.TempDir())
+	defer viper.Reset()
+
+	kv, err := newKV(hclog.NewNullLogger())
+	assert.Nil(t, err)
+	assert.Nil(t, kv.(*Filesystem).watcher)
+	assert.Nil(t, kv.Close())
+}
+
+func TestWatchBadPath(t *testing.T) {
+	base := t.TempDir()
+	viper.Set("core.home", base)
+	viper.Set("db.filesystem.watch", true)
+	defer viper.Reset()
+
+	// Something in the way of the directories that need to be
+	// watched.
+	assert.Nil(t, os.MkdirAll(filepath.Join(base, "kv"), 0750))
+	assert.Nil(t, os.WriteFile(filepath.Join(base, "kv", "entities"), nil, 0640))
+
+	_, err := newKV(hclog.NewNullLogger())
+	assert.NotNil(t, err)
+}
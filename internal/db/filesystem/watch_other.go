@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package filesystem
+
+// watch is only supported on Linux.  Elsewhere changes made outside
+// of NetAuth continue to go unnoticed until the server restarts.
+func (fs *Filesystem) watch() error {
+	fs.l.Warn("Watching the filesystem is not supported on this platform")
+	return nil
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+// The previous revisions of each entity and group are kept in the
+// DB's own part of the keyspace.  The key of an object's history is
+// the prefix followed by the ID or name.
+const (
+	EntityHistoryPrefix = MetaPrefix + "history-entity:"
+	GroupHistoryPrefix  = MetaPrefix + "history-group:"
+)
+
+// historyEntry is a single stored revision of an object.  Entities
+// are stored without their secret.
+type historyEntry struct {
+	Rev   int
+	Time  time.Time
+	Actor string
+	Value []byte
+}
+
+// An EntityRevision is an entity as it was saved by one change.
+// Revisions are numbered from 1 for each entity, and the entity does
+// not include its secret.
+type EntityRevision struct {
+	Rev    int
+	Time   time.Time
+	Actor  string
+	Entity *types.Entity
+}
+
+// A GroupRevision is a group as it was saved by one change.
+// Revisions are numbered from 1 for each group.
+type GroupRevision struct {
+	Rev   int
+	Time  time.Time
+	Actor string
+	Group *types.Group
+}
+
+// WithHistory keeps the last depth revisions of every entity and
+// group each time one is saved.  Revisions are attributed to the
+// entity named in the context with WithActor.  A depth of 0 keeps no
+// history.
+func WithHistory(depth int) Option { return func(db *DB) { db.historyDepth = depth } }
+
+// EntityHistory returns the revisions of an entity that are still
+// kept, oldest first.  An entity that hasn't been saved since history
+// was enabled has no revisions.
+func (db *DB) EntityHistory(ctx context.Context, ID string) ([]EntityRevision, error) {
+	h, err := db.loadHistory(ctx, EntityHistoryPrefix+ID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]EntityRevision, len(h))
+	for i, r := range h {
+		e := &types.Entity{}
+		if err := proto.Unmarshal(r.Value, e); err != nil {
+			db.log.Warn("Error unmarshaling entity revision", "entity", ID, "rev", r.Rev, "error", err)
+			return nil, ErrInternalError
+		}
+		out[i] = EntityRevision{Rev: r.Rev, Time: r.Time, Actor: r.Actor, Entity: e}
+	}
+	return out, nil
+}
+
+// GroupHistory returns the revisions of a group that are still kept,
+// oldest first.  A group that hasn't been saved since history was
+// enabled has no revisions.
+func (db *DB) GroupHistory(ctx context.Context, name string) ([]GroupRevision, error) {
+	h, err := db.loadHistory(ctx, GroupHistoryPrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]GroupRevision, len(h))
+	for i, r := range h {
+		g := &types.Group{}
+		if err := proto.Unmarshal(r.Value, g); err != nil {
+			db.log.Warn("Error unmarshaling group revision", "group", name, "rev", r.Rev, "error", err)
+			return nil, ErrInternalError
+		}
+		out[i] = GroupRevision{Rev: r.Rev, Time: r.Time, Actor: r.Actor, Group: g}
+	}
+	return out, nil
+}
+
+// withHistory returns ops along with the writes needed to record the
+// entities and groups they save in the history of each.  A save that
+// doesn't change anything that is kept in the history, such as a
+// change of secret, doesn't make a new revision.  The caller must
+// hold wmu.
+func (db *DB) withHistory(ctx context.Context, ops []KVOp) ([]KVOp, error) {
+	if db.historyDepth <= 0 {
+		return ops, nil
+	}
+
+	histories := make(map[string][]historyEntry)
+	changed := make(map[string]bool)
+	var order []string
+	for _, op := range ops {
+		if op.Delete {
+			continue
+		}
+		var hk string
+		v := op.Value
+		switch {
+		case strings.HasPrefix(op.Key, "/entities/"):
+			hk = EntityHistoryPrefix + strings.TrimPrefix(op.Key, "/entities/")
+			e := &types.Entity{}
+			if err := proto.Unmarshal(v, e); err != nil {
+				return nil, ErrInternalError
+			}
+			e.Secret = nil
+			v, _ = proto.Marshal(e)
+		case strings.HasPrefix(op.Key, "/groups/"):
+			hk = GroupHistoryPrefix + strings.TrimPrefix(op.Key, "/groups/")
+		default:
+			continue
+		}
+
+		h, ok := histories[hk]
+		if !ok {
+			var err error
+			h, err = db.loadHistory(ctx, hk)
+			if err != nil {
+				return nil, err
+			}
+		}
+		rev := 1
+		if len(h) > 0 {
+			last := h[len(h)-1]
+			if bytes.Equal(last.Value, v) {
+				histories[hk] = h
+				continue
+			}
+			rev = last.Rev + 1
+		}
+		h = append(h, historyEntry{Rev: rev, Time: time.Now(), Actor: actorFrom(ctx), Value: v})
+		if len(h) > db.historyDepth {
+			h = h[len(h)-db.historyDepth:]
+		}
+		histories[hk] = h
+		if !changed[hk] {
+			changed[hk] = true
+			order = append(order, hk)
+		}
+	}
+
+	out := append([]KVOp{}, ops...)
+	for _, hk := range order {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(histories[hk]); err != nil {
+			return nil, ErrInternalError
+		}
+		out = append(out, KVOp{Key: hk, Value: buf.Bytes()})
+	}
+	return out, nil
+}
+
+func (db *DB) loadHistory(ctx context.Context, k string) ([]historyEntry, error) {
+	b, err := db.kv.Get(ctx, k)
+	if err == ErrNoValue {
+		return nil, nil
+	}
+	if err != nil {
+		db.log.Warn("Error loading history", "key", k, "error", err)
+		return nil, ErrInternalError
+	}
+	var h []historyEntry
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&h); err != nil {
+		db.log.Warn("Error decoding history", "key", k, "error", err)
+		return nil, ErrInternalError
+	}
+	return h, nil
+}
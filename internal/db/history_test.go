@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+// mapKV is just enough of a KVStore to follow values through
+// several writes.
+type mapKV struct {
+	dummyKV
+	m map[string][]byte
+}
+
+func newMapKV(hclog.Logger) (KVStore, error) { return &mapKV{m: make(map[string][]byte)}, nil }
+
+func (kv *mapKV) Put(_ context.Context, k string, v []byte) error {
+	kv.m[k] = v
+	return nil
+}
+
+func (kv *mapKV) Get(_ context.Context, k string) ([]byte, error) {
+	v, ok := kv.m[k]
+	if !ok {
+		return nil, ErrNoValue
+	}
+	return v, nil
+}
+
+func (kv *mapKV) Del(_ context.Context, k string) error {
+	if _, ok := kv.m[k]; !ok {
+		return ErrNoValue
+	}
+	delete(kv.m, k)
+	return nil
+}
+
+func (kv *mapKV) Keys(_ context.Context, f string) ([]string, error) {
+	var out []string
+	for k := range kv.m {
+		if ok, _ := path.Match(f, k); ok {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+func (kv *mapKV) Capabilities() []KVCapability { return []KVCapability{KVMutable} }
+
+func TestEntityHistory(t *testing.T) {
+	RegisterKV("map", newMapKV)
+	m, err := New("map", WithHistory(2))
+	assert.Nil(t, err)
+	ctx := WithActor(context.Background(), "admin")
+
+	e := &types.Entity{ID: proto.String("foo"), Number: proto.Int32(1), Secret: proto.String("hunter2")}
+	assert.Nil(t, m.SaveEntity(ctx, e))
+
+	// Changing only the secret doesn't make a revision.
+	e.Secret = proto.String("hunter3")
+	assert.Nil(t, m.SaveEntity(ctx, e))
+	h, err := m.EntityHistory(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Len(t, h, 1)
+	assert.Equal(t, 1, h[0].Rev)
+	assert.Equal(t, "admin", h[0].Actor)
+	assert.Nil(t, h[0].Entity.Secret, "secret was kept in history")
+
+	// Only the last two revisions are kept.
+	for i := 2; i <= 3; i++ {
+		e.Meta = &types.EntityMeta{Shell: proto.String(fmt.Sprintf("/bin/sh%d", i))}
+		assert.Nil(t, m.Batch(context.Background(), func(b *Batch) error {
+			b.SaveEntity(e)
+			return nil
+		}))
+	}
+	h, err = m.EntityHistory(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Len(t, h, 2)
+	assert.Equal(t, 2, h[0].Rev)
+	assert.Equal(t, 3, h[1].Rev)
+	assert.Equal(t, "", h[1].Actor)
+	assert.Equal(t, "/bin/sh3", h[1].Entity.GetMeta().GetShell())
+
+	h, err = m.EntityHistory(ctx, "bar")
+	assert.Nil(t, err)
+	assert.Empty(t, h)
+}
+
+func TestGroupHistory(t *testing.T) {
+	RegisterKV("map", newMapKV)
+	m, err := New("map", WithHistory(10))
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	g := &types.Group{Name: proto.String("foo"), Number: proto.Int32(1)}
+	assert.Nil(t, m.SaveGroup(ctx, g))
+	g.DisplayName = proto.String("Foo")
+	assert.Nil(t, m.SaveGroup(WithRevisions(ctx), g))
+
+	h, err := m.GroupHistory(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Len(t, h, 2)
+	assert.Equal(t, "", h[0].Group.GetDisplayName())
+	assert.Equal(t, "Foo", h[1].Group.GetDisplayName())
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	RegisterKV("map", newMapKV)
+	m, err := New("map")
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	assert.Nil(t, m.SaveGroup(ctx, &types.Group{Name: proto.String("foo")}))
+	h, err := m.GroupHistory(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Empty(t, h)
+}
+
+func TestPurgeTombstonesHistory(t *testing.T) {
+	RegisterKV("map", newMapKV)
+	m, err := New("map", WithHistory(10))
+	assert.Nil(t, err)
+	ctx := context.Background()
+	kv := m.kv.(*mapKV)
+
+	assert.Nil(t, m.SaveGroup(ctx, &types.Group{Name: proto.String("foo")}))
+	assert.Nil(t, m.TombstoneGroup(ctx, "foo"))
+	_, ok := kv.m[GroupHistoryPrefix+"foo"]
+	assert.True(t, ok, "history was removed with the group")
+
+	n, err := m.PurgeTombstones(ctx, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	_, ok = kv.m[GroupHistoryPrefix+"foo"]
+	assert.False(t, ok, "history was kept after purge")
+}
+
+func TestRestoreReleasesNumber(t *testing.T) {
+	RegisterKV("map", newMapKV)
+	m, err := New("map")
+	assert.Nil(t, err)
+	ctx := context.Background()
+	kv := m.kv.(*mapKV)
+
+	assert.Nil(t, m.SaveEntity(ctx, &types.Entity{ID: proto.String("foo"), Number: proto.Int32(7)}))
+	assert.Nil(t, m.TombstoneEntity(ctx, "foo"))
+
+	// A restore that can't be stored gives its number back.
+	m.kv = refusingKV{kv}
+	assert.NotNil(t, m.RestoreEntity(ctx, "foo"))
+	assert.False(t, m.numbers.entities.inUse(7))
+
+	m.kv = kv
+	assert.Nil(t, m.RestoreEntity(ctx, "foo"))
+	assert.True(t, m.numbers.entities.inUse(7))
+}
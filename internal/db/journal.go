@@ -0,0 +1,350 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	atomic "github.com/google/renameio"
+	"github.com/hashicorp/go-hclog"
+)
+
+type actorKey struct{}
+
+// A Journal is an append-only record of every change made to the
+// KVStore.  Entries are stored one JSON document per line so that the
+// journal can be read with ordinary tools as well as with Range.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	seq  uint64
+
+	// gen changes whenever the file is replaced, which makes
+	// earlier marks useless.
+	gen int
+}
+
+// A journalMark is the end of the journal at some point in time,
+// which it can be cut back to.
+type journalMark struct {
+	gen int
+	off int64
+	seq uint64
+}
+
+// A JournalEntry records a single Put or Del.  Values are not stored,
+// only their revision, which is enough to tell which change produced
+// the value that is currently stored.
+type JournalEntry struct {
+	Seq     uint64
+	Key     string
+	Time    time.Time
+	Actor   string `json:",omitempty"`
+	Hash    string `json:",omitempty"`
+	Deleted bool   `json:",omitempty"`
+}
+
+// journaledKV records every write to the KVStore it wraps before
+// making it.  Writes that the store refuses are cut back out of the
+// journal again.
+type journaledKV struct {
+	KVStore
+
+	mu sync.Mutex
+	j  *Journal
+	l  hclog.Logger
+}
+
+// WithActor returns a context that attributes changes made with it
+// to the named entity.
+func WithActor(ctx context.Context, ID string) context.Context {
+	return context.WithValue(ctx, actorKey{}, ID)
+}
+
+func actorFrom(ctx context.Context) string {
+	a, _ := ctx.Value(actorKey{}).(string)
+	return a
+}
+
+// OpenJournal opens the journal at the given path, creating it if it
+// doesn't exist.  An entry that was only partly written when the
+// journal was last closed is discarded.
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{path: path, f: f}
+	var good int64
+	err = j.scan(func(e JournalEntry, end int64) bool {
+		j.seq = e.Seq
+		good = end
+		return true
+	})
+	if err != nil && err != io.ErrUnexpectedEOF {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(good); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// scan reads the journal from the start, calling f with each entry
+// and the offset just after it until f returns false.  A torn entry
+// at the end of the journal is reported as io.ErrUnexpectedEOF, an
+// undecodable entry anywhere else as ErrJournalCorrupt.
+func (j *Journal) scan(f func(JournalEntry, int64) bool) error {
+	r := bufio.NewReader(io.NewSectionReader(j.f, 0, 1<<62))
+	var off int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		off += int64(len(line))
+
+		var e JournalEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &e); err != nil {
+			return ErrJournalCorrupt
+		}
+		if !f(e, off) {
+			return nil
+		}
+	}
+}
+
+// Append records a change to a key.  The entry is on disk by the time
+// Append returns.
+func (j *Journal) Append(ctx context.Context, k string, v []byte, deleted bool) error {
+	_, err := j.appendOps(ctx, []KVOp{{Key: k, Value: v, Delete: deleted}})
+	return err
+}
+
+// appendOps records several changes with a single write, so that
+// either all of them or, if the write is torn, none of them are in
+// the journal when it is next opened.  The mark that is returned is
+// where the journal ended before the write.
+func (j *Journal) appendOps(ctx context.Context, ops []KVOp) (journalMark, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	off, err := j.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return journalMark{}, err
+	}
+	mark := journalMark{gen: j.gen, off: off, seq: j.seq}
+
+	var buf bytes.Buffer
+	now := time.Now().UTC()
+	seq := j.seq
+	for _, op := range ops {
+		seq++
+		e := JournalEntry{
+			Seq:     seq,
+			Key:     op.Key,
+			Time:    now,
+			Actor:   actorFrom(ctx),
+			Deleted: op.Delete,
+		}
+		if !op.Delete {
+			e.Hash = Revision(op.Value)
+		}
+		b, err := json.Marshal(e)
+		if err != nil {
+			return journalMark{}, err
+		}
+		buf.Write(append(b, '\n'))
+	}
+
+	if _, err := j.f.Write(buf.Bytes()); err != nil {
+		j.cut(mark)
+		return journalMark{}, err
+	}
+	if err := j.f.Sync(); err != nil {
+		j.cut(mark)
+		return journalMark{}, err
+	}
+	j.seq = seq
+	return mark, nil
+}
+
+// truncate cuts the journal back to the mark, removing everything
+// that was appended after it.
+func (j *Journal) truncate(m journalMark) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if m.gen != j.gen {
+		return ErrJournalCorrupt
+	}
+	return j.cut(m)
+}
+
+// cut does the work of truncate.  The caller must hold mu.
+func (j *Journal) cut(m journalMark) error {
+	if err := j.f.Truncate(m.off); err != nil {
+		return err
+	}
+	if _, err := j.f.Seek(m.off, io.SeekStart); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.seq = m.seq
+	return nil
+}
+
+// Seq returns the sequence number of the newest entry.
+func (j *Journal) Seq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// Range returns the entries with sequence numbers from first to last
+// inclusive.  A last of 0 returns everything from first onwards.
+func (j *Journal) Range(first, last uint64) ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	out := []JournalEntry{}
+	err := j.scan(func(e JournalEntry, _ int64) bool {
+		if last != 0 && e.Seq > last {
+			return false
+		}
+		if e.Seq >= first {
+			out = append(out, e)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Prune removes entries older than the given time and returns how
+// many were removed.  The newest entry is always kept so that
+// sequence numbers carry on from where they left off when the journal
+// is next opened.
+func (j *Journal) Prune(before time.Time) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var buf bytes.Buffer
+	removed := 0
+	err := j.scan(func(e JournalEntry, _ int64) bool {
+		if e.Time.Before(before) && e.Seq != j.seq {
+			removed++
+			return true
+		}
+		// This can't fail, the entry was just decoded.
+		b, _ := json.Marshal(e)
+		buf.Write(append(b, '\n'))
+		return true
+	})
+	if err != nil || removed == 0 {
+		return 0, err
+	}
+
+	if err := atomic.WriteFile(j.path, buf.Bytes(), 0600); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(j.path, os.O_RDWR, 0600)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return 0, err
+	}
+	j.f.Close()
+	j.f = f
+	j.gen++
+	return removed, nil
+}
+
+// Close closes the journal.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+// write records the ops and then makes them with apply.  A change
+// that can't be journaled is not made, and one that the store
+// refuses is cut back out of the journal.
+func (kv *journaledKV) write(ctx context.Context, ops []KVOp, apply func() error) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	mark, err := kv.j.appendOps(ctx, ops)
+	if err != nil {
+		kv.l.Error("Error writing to journal", "ops", len(ops), "error", err)
+		return err
+	}
+	if err := apply(); err != nil {
+		if terr := kv.j.truncate(mark); terr != nil {
+			kv.l.Error("Error removing failed write from journal", "error", terr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Put records the value and then writes it.
+func (kv *journaledKV) Put(ctx context.Context, k string, v []byte) error {
+	return kv.write(ctx, []KVOp{{Key: k, Value: v}}, func() error {
+		return kv.KVStore.Put(ctx, k, v)
+	})
+}
+
+// Del records the removal and then removes the value.
+func (kv *journaledKV) Del(ctx context.Context, k string) error {
+	return kv.write(ctx, []KVOp{{Key: k, Delete: true}}, func() error {
+		return kv.KVStore.Del(ctx, k)
+	})
+}
+
+// Batch records every change in the batch with a single journal write
+// and then commits the batch.  This is only called when the wrapped
+// store advertises KVBatch.
+func (kv *journaledKV) Batch(ctx context.Context, ops []KVOp) error {
+	kvb, ok := kv.KVStore.(KVBatcher)
+	if !ok {
+		return ErrInternalError
+	}
+	return kv.write(ctx, ops, func() error {
+		return kvb.Batch(ctx, ops)
+	})
+}
+
+// Close closes the wrapped store and then the journal.
+func (kv *journaledKV) Close() error {
+	err := kv.KVStore.Close()
+	if jerr := kv.j.Close(); err == nil {
+		err = jerr
+	}
+	return err
+}
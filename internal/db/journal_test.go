@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+func newTestJournal(t *testing.T) (*Journal, string) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j, path
+}
+
+func TestJournalAppendRange(t *testing.T) {
+	j, _ := newTestJournal(t)
+	defer j.Close()
+	ctx := context.Background()
+
+	assert.Nil(t, j.Append(ctx, "/entities/foo", []byte("foo"), false))
+	assert.Nil(t, j.Append(WithActor(ctx, "admin"), "/groups/bar", []byte("bar"), false))
+	assert.Nil(t, j.Append(ctx, "/entities/foo", nil, true))
+
+	all, err := j.Range(0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, all, 3)
+
+	res, err := j.Range(2, 2)
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, uint64(2), res[0].Seq)
+	assert.Equal(t, "/groups/bar", res[0].Key)
+	assert.Equal(t, "admin", res[0].Actor)
+	assert.Equal(t, Revision([]byte("bar")), res[0].Hash)
+	assert.False(t, res[0].Deleted)
+
+	res, err = j.Range(3, 0)
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+	assert.True(t, res[0].Deleted)
+	assert.Equal(t, "", res[0].Hash)
+}
+
+func TestJournalReopen(t *testing.T) {
+	j, path := newTestJournal(t)
+	ctx := context.Background()
+	assert.Nil(t, j.Append(ctx, "/entities/foo", []byte("foo"), false))
+	assert.Nil(t, j.Append(ctx, "/entities/bar", []byte("bar"), false))
+	assert.Nil(t, j.Close())
+
+	j, err := OpenJournal(path)
+	assert.Nil(t, err)
+	defer j.Close()
+	assert.Nil(t, j.Append(ctx, "/entities/baz", []byte("baz"), false))
+
+	res, err := j.Range(3, 0)
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "/entities/baz", res[0].Key)
+}
+
+func TestJournalTornTail(t *testing.T) {
+	j, path := newTestJournal(t)
+	ctx := context.Background()
+	assert.Nil(t, j.Append(ctx, "/entities/foo", []byte("foo"), false))
+	assert.Nil(t, j.Close())
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.Nil(t, err)
+	f.Write([]byte(`{"Seq":2,"Ke`))
+	f.Close()
+
+	j, err = OpenJournal(path)
+	assert.Nil(t, err)
+	defer j.Close()
+	assert.Nil(t, j.Append(ctx, "/entities/bar", []byte("bar"), false))
+
+	res, err := j.Range(0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, uint64(2), res[1].Seq)
+	assert.Equal(t, "/entities/bar", res[1].Key)
+}
+
+func TestJournalCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	assert.Nil(t, os.WriteFile(path, []byte("garbage\n{\"Seq\":1}\n"), 0600))
+
+	_, err := OpenJournal(path)
+	assert.Equal(t, ErrJournalCorrupt, err)
+}
+
+func TestJournalPrune(t *testing.T) {
+	j, path := newTestJournal(t)
+	ctx := context.Background()
+	for _, k := range []string{"/entities/a", "/entities/b", "/entities/c"} {
+		assert.Nil(t, j.Append(ctx, k, []byte(k), false))
+	}
+
+	n, err := j.Prune(time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = j.Prune(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Nil(t, j.Append(ctx, "/entities/d", []byte("d"), false))
+	assert.Nil(t, j.Close())
+
+	j, err = OpenJournal(path)
+	assert.Nil(t, err)
+	defer j.Close()
+	res, err := j.Range(0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, uint64(3), res[0].Seq)
+	assert.Equal(t, uint64(4), res[1].Seq)
+}
+
+func TestJournaledKV(t *testing.T) {
+	ctx := WithActor(context.Background(), "admin")
+	j, _ := newTestJournal(t)
+	RegisterKV("mock", newMockKV)
+	m, err := New("mock", WithJournal(j))
+	assert.Nil(t, err)
+
+	mkv := m.kv.(*journaledKV).KVStore.(*mockKV)
+	mkv.On("Put", "/entities/entity1", goodEntityBytes1).Return(nil)
+	mkv.On("Put", "/entities/bad", []byte(nil)).Return(errors.New("disk on fire"))
+	mkv.On("Del", "/entities/entity1").Return(nil)
+	mkv.On("Del", "/entities/missing").Return(ErrNoValue)
+	mkv.On("Close").Return(nil)
+
+	assert.Nil(t, m.SaveEntity(ctx, &types.Entity{ID: proto.String("entity1"), Number: proto.Int32(1)}))
+	assert.Nil(t, m.DeleteEntity(ctx, "entity1"))
+	assert.Equal(t, ErrUnknownEntity, m.DeleteEntity(ctx, "missing"))
+	assert.NotNil(t, m.kv.Put(ctx, "/entities/bad", nil))
+
+	res, err := j.Range(0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []JournalEntry{
+		{Seq: 1, Key: "/entities/entity1", Time: res[0].Time, Actor: "admin", Hash: Revision(goodEntityBytes1)},
+		{Seq: 2, Key: "/entities/entity1", Time: res[1].Time, Actor: "admin", Deleted: true},
+	}, res)
+
+	m.Shutdown()
+	_, err = j.Range(0, 0)
+	assert.NotNil(t, err)
+}
+
+func TestJournaledKVJournalFirst(t *testing.T) {
+	ctx := context.Background()
+	j, _ := newTestJournal(t)
+	RegisterKV("mock", newMockKV)
+	m, err := New("mock", WithJournal(j))
+	assert.Nil(t, err)
+
+	// Nothing is expected of the store, so the mock panics if the
+	// write reaches it after the journal has failed.
+	j.Close()
+	assert.NotNil(t, m.kv.Put(ctx, "/entities/entity1", goodEntityBytes1))
+	assert.NotNil(t, m.kv.Del(ctx, "/entities/entity1"))
+}
+
+func TestJournaledKVBatch(t *testing.T) {
+	ctx := context.Background()
+	j, _ := newTestJournal(t)
+	defer j.Close()
+	RegisterKV("batch-mock", newBatchMockKV)
+	m, err := New("batch-mock", WithJournal(j))
+	assert.Nil(t, err)
+
+	ops := []KVOp{
+		{Key: "/entities/entity1", Value: goodEntityBytes1},
+		{Key: "/groups/group1", Delete: true},
+	}
+	bkv := m.kv.(*journaledKV).KVStore.(*batchMockKV)
+	bkv.On("Capabilities").Return([]KVCapability{KVMutable, KVBatch})
+	bkv.On("Batch", ops).Return(nil).Once()
+	bkv.On("Batch", ops).Return(errors.New("disk on fire")).Once()
+
+	f := func(b *Batch) error {
+		b.SaveEntity(&types.Entity{ID: proto.String("entity1"), Number: proto.Int32(1)})
+		b.DeleteGroup("group1")
+		return nil
+	}
+	assert.Nil(t, m.Batch(ctx, f))
+	assert.Equal(t, ErrInternalError, m.Batch(ctx, f))
+
+	res, err := j.Range(0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "/groups/group1", res[1].Key)
+	assert.True(t, res[1].Deleted)
+}
@@ -1,15 +1,19 @@
 package db
 
 import (
+	"strings"
+
 	"github.com/hashicorp/go-hclog"
 )
 
 var (
 	kvBackends map[string]KVFactory
+	kvWrappers map[string]KVWrapperFactory
 )
 
 func init() {
 	kvBackends = make(map[string]KVFactory)
+	kvWrappers = make(map[string]KVWrapperFactory)
 }
 
 // RegisterKV registers a KV factory which can be called later.
@@ -21,9 +25,25 @@ func RegisterKV(name string, factory KVFactory) {
 	kvBackends[name] = factory
 }
 
+// RegisterKVWrapper registers a factory for a KV that wraps another
+// KV, which can be called later.
+func RegisterKVWrapper(name string, factory KVWrapperFactory) {
+	if _, ok := kvWrappers[name]; ok {
+		return
+	}
+	log().Info("Registered KV Wrapper", "wrapper", name)
+	kvWrappers[name] = factory
+}
+
 // NewKV returns a KV.  This is exported to enable usage in nsutil,
-// but should generally not be imported by external consumers.
+// but should generally not be imported by external consumers.  A
+// name of the form "wrapper:backend" initializes the backend and
+// then wraps it, and wrappers may be stacked.
 func NewKV(name string, l hclog.Logger) (KVStore, error) {
+	if parts := strings.SplitN(name, ":", 2); len(parts) == 2 {
+		return newWrappedKV(parts[0], parts[1], l)
+	}
+
 	f, ok := kvBackends[name]
 	if !ok {
 		log().Debug("Requested bad backend", "backend", name, "known", kvBackends)
@@ -32,3 +52,25 @@ func NewKV(name string, l hclog.Logger) (KVStore, error) {
 	log().Debug("Initializing database with backend", "backend", name)
 	return f(log())
 }
+
+// newWrappedKV initializes the inner KV and then hands it to the
+// wrapper.
+func newWrappedKV(wrapper, inner string, l hclog.Logger) (KVStore, error) {
+	f, ok := kvWrappers[wrapper]
+	if !ok {
+		log().Debug("Requested bad wrapper", "wrapper", wrapper, "known", kvWrappers)
+		return nil, ErrUnknownDatabase
+	}
+
+	kv, err := NewKV(inner, l)
+	if err != nil {
+		return nil, err
+	}
+	log().Debug("Wrapping database", "wrapper", wrapper, "backend", inner)
+	w, err := f(kv, log())
+	if err != nil {
+		kv.Close()
+		return nil, err
+	}
+	return w, nil
+}
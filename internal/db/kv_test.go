@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
@@ -36,3 +37,34 @@ func TestNewKV(t *testing.T) {
 	_, err = NewKV("does-not-exist", hclog.NewNullLogger())
 	assert.Equal(t, err, ErrUnknownDatabase)
 }
+
+func TestRegisterKVWrapper(t *testing.T) {
+	kvWrappers = make(map[string]KVWrapperFactory)
+	RegisterKVWrapper("dummy", func(kv KVStore, _ hclog.Logger) (KVStore, error) { return kv, nil })
+	assert.Len(t, kvWrappers, 1)
+	RegisterKVWrapper("dummy", func(kv KVStore, _ hclog.Logger) (KVStore, error) { return kv, nil })
+	assert.Len(t, kvWrappers, 1)
+}
+
+func TestNewKVWrapped(t *testing.T) {
+	RegisterKV("dummy", newDummyKV)
+	RegisterKVWrapper("passthrough", func(kv KVStore, _ hclog.Logger) (KVStore, error) { return kv, nil })
+	RegisterKVWrapper("broken", func(KVStore, hclog.Logger) (KVStore, error) { return nil, errors.New("broken") })
+
+	res, err := NewKV("passthrough:dummy", hclog.NewNullLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, &dummyKV{}, res)
+
+	res, err = NewKV("passthrough:passthrough:dummy", hclog.NewNullLogger())
+	assert.Nil(t, err)
+	assert.Equal(t, &dummyKV{}, res)
+
+	_, err = NewKV("does-not-exist:dummy", hclog.NewNullLogger())
+	assert.Equal(t, ErrUnknownDatabase, err)
+
+	_, err = NewKV("passthrough:does-not-exist", hclog.NewNullLogger())
+	assert.Equal(t, ErrUnknownDatabase, err)
+
+	_, err = NewKV("broken:dummy", hclog.NewNullLogger())
+	assert.NotNil(t, err)
+}
@@ -67,3 +67,18 @@ func (mkv *mockKV) Capabilities() []KVCapability {
 func (mkv *mockKV) SetEventFunc(f func(Event)) {
 	mkv.Called(f)
 }
+
+// batchMockKV extends the mock with the ability to apply batches.
+type batchMockKV struct {
+	mockKV
+}
+
+func newBatchMockKV(hclog.Logger) (KVStore, error) {
+	x := &batchMockKV{}
+	x.On("SetEventFunc", mock.Anything).Return()
+	return x, nil
+}
+
+func (bkv *batchMockKV) Batch(_ context.Context, ops []KVOp) error {
+	return bkv.Called(ops).Error(0)
+}
@@ -5,7 +5,6 @@ package memory
 import (
 	"context"
 	"path"
-	"strings"
 	"sync"
 
 	"github.com/hashicorp/go-hclog"
@@ -59,18 +58,7 @@ func (kv *KV) Put(_ context.Context, k string, v []byte) error {
 	kv.m[k] = v
 	kv.Unlock()
 
-	switch {
-	case strings.HasPrefix(k, "/entities"):
-		kv.eF(db.Event{
-			Type: db.EventEntityUpdate,
-			PK:   path.Base(k),
-		})
-	case strings.HasPrefix(k, "/groups"):
-		kv.eF(db.Event{
-			Type: db.EventGroupUpdate,
-			PK:   path.Base(k),
-		})
-	}
+	kv.fireEventForKey(k, false)
 	return nil
 }
 
@@ -94,17 +82,27 @@ func (kv *KV) Del(_ context.Context, k string) error {
 	kv.Unlock()
 	kv.l.Trace("DEL", "key", k)
 
-	switch {
-	case strings.HasPrefix(k, "/entities"):
-		kv.eF(db.Event{
-			Type: db.EventEntityDestroy,
-			PK:   path.Base(k),
-		})
-	case strings.HasPrefix(k, "/groups"):
-		kv.eF(db.Event{
-			Type: db.EventGroupDestroy,
-			PK:   path.Base(k),
-		})
+	kv.fireEventForKey(k, true)
+	return nil
+}
+
+// Batch applies all operations while holding the lock, so no reader
+// can observe a partially applied batch.
+func (kv *KV) Batch(_ context.Context, ops []db.KVOp) error {
+	kv.Lock()
+	for _, op := range ops {
+		if op.Delete {
+			kv.l.Trace("BATCH DEL", "key", op.Key)
+			delete(kv.m, op.Key)
+			continue
+		}
+		kv.l.Trace("BATCH PUT", "key", op.Key, "value", op.Value)
+		kv.m[op.Key] = op.Value
+	}
+	kv.Unlock()
+
+	for _, op := range ops {
+		kv.fireEventForKey(op.Key, op.Delete)
 	}
 	return nil
 }
@@ -133,5 +131,13 @@ func (kv *KV) Close() error { return nil }
 
 // Capabilities is used to interrogate a KV store for capabilities.
 func (kv *KV) Capabilities() []db.KVCapability {
-	return []db.KVCapability{db.KVMutable}
+	return []db.KVCapability{db.KVMutable, db.KVBatch}
+}
+
+// fireEventForKey maps from a key to an entity or group and fires an
+// appropriate event for the given key.
+func (kv *KV) fireEventForKey(k string, deleted bool) {
+	if e, ok := db.EventForKey(k, deleted); ok {
+		kv.eF(e)
+	}
 }
@@ -99,5 +99,36 @@ func TestCapabilities(t *testing.T) {
 	kv, _ := NewKV(hclog.NewNullLogger())
 	kv.SetEventFunc(func(db.Event) {})
 
-	assert.Equal(t, []db.KVCapability{db.KVMutable}, kv.Capabilities())
+	assert.Equal(t, []db.KVCapability{db.KVMutable, db.KVBatch}, kv.Capabilities())
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	kv, _ := NewKV(hclog.NewNullLogger())
+
+	events := []db.Event{}
+	kv.SetEventFunc(func(e db.Event) {
+		// Events must not be fired until all the data is
+		// visible.
+		_, err := kv.Get(ctx, "/groups/group1")
+		assert.Nil(t, err)
+		events = append(events, e)
+	})
+	kv.(*KV).m["/entities/entity2"] = []byte("old data")
+
+	ops := []db.KVOp{
+		{Key: "/entities/entity1", Value: []byte("some data")},
+		{Key: "/entities/entity2", Delete: true},
+		{Key: "/groups/group1", Value: []byte("some more data")},
+	}
+	assert.Nil(t, kv.(db.KVBatcher).Batch(ctx, ops))
+
+	assert.Equal(t, []byte("some data"), kv.(*KV).m["/entities/entity1"])
+	_, exists := kv.(*KV).m["/entities/entity2"]
+	assert.False(t, exists)
+	assert.Equal(t, []db.Event{
+		{Type: db.EventEntityUpdate, PK: "entity1"},
+		{Type: db.EventEntityDestroy, PK: "entity2"},
+		{Type: db.EventGroupUpdate, PK: "group1"},
+	}, events)
 }
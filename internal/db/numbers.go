@@ -0,0 +1,405 @@
+package db
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"path"
+	"strconv"
+	"sync"
+)
+
+// MetaPrefix is the part of the keyspace where the DB keeps its own
+// bookkeeping.  Keys under it are not entities or groups, and KV
+// stores don't fire events for them.
+const MetaPrefix = "/meta/"
+
+// A NumberPolicy controls which numbers are handed out when an
+// entity or group is created without one.  Automatically allocated
+// numbers are kept between Min and Max inclusive, which leaves the
+// numbers outside the range free to be assigned explicitly, for
+// example to system accounts.  A Max of 0 means there is no upper
+// limit.  With NoReuse set a number is never handed out again once
+// the object that had it is removed.
+type NumberPolicy struct {
+	Min     int32
+	Max     int32
+	NoReuse bool
+}
+
+// numbers keeps track of the entity and group numbers in use so that
+// the next free number can be found without loading every object.
+// It is populated on first use and then kept up to date from events.
+type numbers struct {
+	mu     sync.Mutex
+	loaded bool
+
+	entities *numberSpace
+	groups   *numberSpace
+}
+
+// numberSpace tracks the numbers used by one kind of object.  Numbers
+// that have been handed out are reserved until the object that uses
+// them is seen, so that concurrent creates get different numbers.
+type numberSpace struct {
+	NumberPolicy
+	key string
+
+	byID     map[string]int32
+	used     map[int32]int
+	reserved map[int32]struct{}
+
+	// top is the largest number in the range that is in use or
+	// reserved, and hw is the largest that ever has been.
+	top int32
+	hw  int32
+
+	// Once top has reached the end of the range, gaps are found
+	// with gap and freed.  Every number in the range below gap is
+	// either in use or in freed, so gap only ever moves up.
+	gap   int64
+	freed numberHeap
+}
+
+// numberHeap is a min-heap of numbers.
+type numberHeap []int32
+
+func (h numberHeap) Len() int            { return len(h) }
+func (h numberHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h numberHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *numberHeap) Push(x interface{}) { *h = append(*h, x.(int32)) }
+func (h *numberHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// WithEntityNumbers sets the policy for allocating entity numbers.
+func WithEntityNumbers(p NumberPolicy) Option {
+	return func(db *DB) { db.numbers.entities.NumberPolicy = p }
+}
+
+// WithGroupNumbers sets the policy for allocating group numbers.
+func WithGroupNumbers(p NumberPolicy) Option {
+	return func(db *DB) { db.numbers.groups.NumberPolicy = p }
+}
+
+func newNumbers() *numbers {
+	return &numbers{
+		entities: newNumberSpace(path.Join(MetaPrefix, "entity-numbers")),
+		groups:   newNumberSpace(path.Join(MetaPrefix, "group-numbers")),
+	}
+}
+
+func newNumberSpace(key string) *numberSpace {
+	return &numberSpace{
+		NumberPolicy: NumberPolicy{Min: 1},
+		key:          key,
+	}
+}
+
+// reset clears everything that is learned from the data.
+func (s *numberSpace) reset() {
+	if s.Max <= 0 {
+		s.Max = math.MaxInt32
+	}
+	s.byID = make(map[string]int32)
+	s.used = make(map[int32]int)
+	s.reserved = make(map[int32]struct{})
+	s.top = s.Min - 1
+	s.hw = s.Min - 1
+	s.gap = int64(s.Min)
+	s.freed = nil
+}
+
+func (s *numberSpace) inRange(n int32) bool { return n >= s.Min && n <= s.Max }
+
+func (s *numberSpace) inUse(n int32) bool {
+	_, reserved := s.reserved[n]
+	return s.used[n] > 0 || reserved
+}
+
+// raise notes that n has been used, and reports whether the high
+// water mark moved.
+func (s *numberSpace) raise(n int32) bool {
+	if !s.inRange(n) {
+		return false
+	}
+	if n > s.top {
+		s.top = n
+	}
+	if n > s.hw {
+		s.hw = n
+		return true
+	}
+	return false
+}
+
+// set records the number of an object, replacing any number it had
+// before.
+func (s *numberSpace) set(id string, n int32) {
+	s.remove(id)
+	s.byID[id] = n
+	s.used[n]++
+	delete(s.reserved, n)
+	s.raise(n)
+}
+
+// release gives back a number that was reserved for an object that
+// was never saved.
+func (s *numberSpace) release(n int32) {
+	if _, ok := s.reserved[n]; !ok {
+		return
+	}
+	delete(s.reserved, n)
+	s.free(n)
+}
+
+// remove forgets the number of an object.
+func (s *numberSpace) remove(id string) {
+	n, ok := s.byID[id]
+	if !ok {
+		return
+	}
+	delete(s.byID, id)
+	if s.used[n]--; s.used[n] <= 0 {
+		delete(s.used, n)
+	}
+	s.free(n)
+}
+
+// free notes that n may no longer be in use.
+func (s *numberSpace) free(n int32) {
+	if s.inUse(n) {
+		return
+	}
+	if s.inRange(n) && int64(n) < s.gap {
+		heap.Push(&s.freed, n)
+	}
+	// Walk down to the next number that is still in use.  Each
+	// step is paid for by a create that moved top up.
+	for s.top >= s.Min && !s.inUse(s.top) {
+		s.top--
+	}
+}
+
+// next returns the next free number in the range without reserving
+// it.  Once the top of the range has been reached, gaps are filled
+// from the bottom unless reuse has been turned off.
+func (s *numberSpace) next() (int32, error) {
+	n := s.top
+	if s.NoReuse && s.hw > n {
+		n = s.hw
+	}
+	if n < s.Max {
+		return n + 1, nil
+	}
+	if s.NoReuse {
+		return 0, ErrNumbersExhausted
+	}
+	// Numbers in freed may have been claimed again since.
+	for len(s.freed) > 0 {
+		if n := s.freed[0]; !s.inUse(n) {
+			return n, nil
+		}
+		heap.Pop(&s.freed)
+	}
+	for ; s.gap <= int64(s.Max); s.gap++ {
+		if n := int32(s.gap); !s.inUse(n) {
+			return n, nil
+		}
+	}
+	return 0, ErrNumbersExhausted
+}
+
+// NextEntityNumber reserves and returns the next unassigned number in
+// the entity space.
+func (db *DB) NextEntityNumber(ctx context.Context) (int32, error) {
+	return db.allocate(ctx, db.numbers.entities)
+}
+
+// ClaimEntityNumber reserves a specific entity number, returning
+// ErrNumberInUse if another entity already has it.
+func (db *DB) ClaimEntityNumber(ctx context.Context, n int32) error {
+	return db.claim(ctx, db.numbers.entities, n)
+}
+
+// NextGroupNumber reserves and returns the next unassigned number in
+// the group space.
+func (db *DB) NextGroupNumber(ctx context.Context) (int32, error) {
+	return db.allocate(ctx, db.numbers.groups)
+}
+
+// ClaimGroupNumber reserves a specific group number, returning
+// ErrNumberInUse if another group already has it.
+func (db *DB) ClaimGroupNumber(ctx context.Context, n int32) error {
+	return db.claim(ctx, db.numbers.groups, n)
+}
+
+func (db *DB) allocate(ctx context.Context, s *numberSpace) (int32, error) {
+	db.numbers.mu.Lock()
+	defer db.numbers.mu.Unlock()
+
+	if err := db.loadNumbers(ctx); err != nil {
+		return 0, err
+	}
+	n, err := s.next()
+	if err != nil {
+		return 0, err
+	}
+	if err := db.reserve(ctx, s, n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (db *DB) claim(ctx context.Context, s *numberSpace, n int32) error {
+	db.numbers.mu.Lock()
+	defer db.numbers.mu.Unlock()
+
+	if err := db.loadNumbers(ctx); err != nil {
+		return err
+	}
+	if s.inUse(n) {
+		return ErrNumberInUse
+	}
+	return db.reserve(ctx, s, n)
+}
+
+type dryRunKey struct{}
+
+// WithDryRun returns a context for a change that will not be saved.
+// Numbers that are handed out with it are not reserved, since no
+// object will ever be seen to use them.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun reports whether ctx is for a change that will not be
+// saved.
+func IsDryRun(ctx context.Context) bool {
+	d, _ := ctx.Value(dryRunKey{}).(bool)
+	return d
+}
+
+// reserve marks n as taken, and saves the high water mark if numbers
+// aren't to be reused.  Nothing is reserved for a dry run.  A number
+// reserved while saves are being collected by Atomically is released
+// again if they are never committed.  The caller must hold
+// numbers.mu.
+func (db *DB) reserve(ctx context.Context, s *numberSpace, n int32) error {
+	if IsDryRun(ctx) {
+		return nil
+	}
+	s.reserved[n] = struct{}{}
+	if b := batchFrom(ctx); b != nil {
+		b.undo = append(b.undo, func() {
+			db.updateNumbers(func() { s.release(n) })
+		})
+	}
+	if !s.raise(n) || !s.NoReuse {
+		return nil
+	}
+	if err := db.kv.Put(ctx, s.key, []byte(strconv.Itoa(int(s.hw)))); err != nil {
+		db.log.Warn("Error storing number high water mark", "key", s.key, "error", err)
+		return ErrInternalError
+	}
+	return nil
+}
+
+// loadNumbers reads the number of every entity and group the first
+// time a number is needed.  If it fails it is tried again next time.
+func (db *DB) loadNumbers(ctx context.Context) error {
+	if db.numbers.loaded {
+		return nil
+	}
+	db.numbers.entities.reset()
+	db.numbers.groups.reset()
+
+	ids, err := db.DiscoverEntityIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		e, err := db.LoadEntity(ctx, path.Base(id))
+		if err != nil {
+			return err
+		}
+		db.numbers.entities.set(e.GetID(), e.GetNumber())
+	}
+
+	names, err := db.DiscoverGroupNames(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		g, err := db.LoadGroup(ctx, path.Base(name))
+		if err != nil {
+			return err
+		}
+		db.numbers.groups.set(g.GetName(), g.GetNumber())
+	}
+
+	for _, s := range []*numberSpace{db.numbers.entities, db.numbers.groups} {
+		if !s.NoReuse {
+			continue
+		}
+		b, err := db.kv.Get(ctx, s.key)
+		if err == ErrNoValue {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if hw, err := strconv.ParseInt(string(b), 10, 32); err == nil && int32(hw) > s.hw {
+			s.hw = int32(hw)
+		}
+	}
+
+	db.numbers.loaded = true
+	return nil
+}
+
+// numbersCallback keeps the numbers up to date once they have been
+// loaded.  Objects are loaded before taking the lock since loading
+// can itself fire events.
+func (db *DB) numbersCallback(e Event) {
+	db.numbers.mu.Lock()
+	loaded := db.numbers.loaded
+	db.numbers.mu.Unlock()
+	if !loaded {
+		return
+	}
+
+	ctx := context.Background()
+	switch e.Type {
+	case EventEntityCreate, EventEntityUpdate:
+		ent, err := db.LoadEntity(ctx, e.PK)
+		if err != nil {
+			db.log.Warn("Error loading entity for number tracking", "entity", e.PK, "error", err)
+			return
+		}
+		db.updateNumbers(func() { db.numbers.entities.set(e.PK, ent.GetNumber()) })
+	case EventEntityDestroy:
+		db.updateNumbers(func() { db.numbers.entities.remove(e.PK) })
+	case EventGroupCreate, EventGroupUpdate:
+		g, err := db.LoadGroup(ctx, e.PK)
+		if err != nil {
+			db.log.Warn("Error loading group for number tracking", "group", e.PK, "error", err)
+			return
+		}
+		db.updateNumbers(func() { db.numbers.groups.set(e.PK, g.GetNumber()) })
+	case EventGroupDestroy:
+		db.updateNumbers(func() { db.numbers.groups.remove(e.PK) })
+	}
+}
+
+// updateNumbers applies f if the numbers are still loaded.
+func (db *DB) updateNumbers(f func()) {
+	db.numbers.mu.Lock()
+	defer db.numbers.mu.Unlock()
+	if db.numbers.loaded {
+		f()
+	}
+}
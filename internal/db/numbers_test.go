@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+func newTestSpace(p NumberPolicy) *numberSpace {
+	s := newNumberSpace("/meta/test")
+	s.NumberPolicy = p
+	s.reset()
+	return s
+}
+
+func TestNumberSpaceNext(t *testing.T) {
+	s := newTestSpace(NumberPolicy{Min: 1000, Max: 1002})
+
+	// Numbers outside the range don't move the allocator.
+	s.set("root", 0)
+	s.set("daemon", 5)
+	s.set("overflow", 5000)
+	n, err := s.next()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1000), n)
+
+	s.set("a", 1000)
+	s.set("b", 1001)
+	s.set("c", 1002)
+	_, err = s.next()
+	assert.Equal(t, ErrNumbersExhausted, err)
+
+	// Once the range is full, gaps are reused.
+	s.remove("b")
+	n, err = s.next()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1001), n)
+
+	// Removing the top lets it be handed out again.
+	s.remove("c")
+	n, err = s.next()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1001), n)
+}
+
+func TestNumberSpaceFill(t *testing.T) {
+	s := newTestSpace(NumberPolicy{Min: 1, Max: 10})
+	for _, n := range []int32{1, 2, 4, 5, 6, 8, 9, 10} {
+		s.set(string(rune('a'+n)), n)
+	}
+
+	// Gaps are filled lowest first, and the cursor moves past
+	// numbers that are in use.
+	for _, want := range []int32{3, 7} {
+		n, err := s.next()
+		assert.Nil(t, err)
+		assert.Equal(t, want, n)
+		s.set("new"+string(rune('0'+want)), n)
+	}
+	_, err := s.next()
+	assert.Equal(t, ErrNumbersExhausted, err)
+	assert.Equal(t, int64(11), s.gap)
+
+	// Numbers freed behind the cursor are still found, even if
+	// some of them were claimed again in the meantime.
+	s.remove(string(rune('a' + 5)))
+	s.remove(string(rune('a' + 2)))
+	s.set("claimed", 2)
+	n, err := s.next()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(5), n)
+}
+
+func TestNumberSpaceNoReuse(t *testing.T) {
+	s := newTestSpace(NumberPolicy{Min: 1, Max: 3, NoReuse: true})
+	s.set("a", 1)
+	s.set("b", 2)
+	s.remove("b")
+
+	n, err := s.next()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), n)
+
+	s.set("c", 3)
+	s.remove("a")
+	_, err = s.next()
+	assert.Equal(t, ErrNumbersExhausted, err)
+}
+
+func TestNumberSpaceDuplicates(t *testing.T) {
+	s := newTestSpace(NumberPolicy{Min: 1})
+	s.set("a", 4)
+	s.set("b", 4)
+	s.remove("a")
+	assert.True(t, s.inUse(4))
+	s.remove("b")
+	assert.False(t, s.inUse(4))
+
+	// Renumbering an object frees its old number.
+	s.set("c", 9)
+	s.set("c", 2)
+	assert.False(t, s.inUse(9))
+	n, _ := s.next()
+	assert.Equal(t, int32(3), n)
+}
+
+func TestAllocateAndClaim(t *testing.T) {
+	ctx := context.Background()
+	RegisterKV("mock", newMockKV)
+	m, err := New("mock", WithEntityNumbers(NumberPolicy{Min: 1, NoReuse: true}))
+	assert.Nil(t, err)
+
+	mkv := m.kv.(*mockKV)
+	mkv.On("Keys", "/entities/*").Return([]string{"/entities/entity1"}, nil).Once()
+	mkv.On("Keys", "/groups/*").Return([]string{}, nil).Once()
+	mkv.On("Get", "/entities/entity1").Return(goodEntityBytes1, nil)
+	mkv.On("Get", "/meta/entity-numbers").Return([]byte("5"), nil).Once()
+	mkv.On("Put", "/meta/entity-numbers", []byte("6")).Return(nil).Once()
+	mkv.On("Put", "/meta/entity-numbers", []byte("9")).Return(nil).Once()
+
+	// The stored high water mark is honored, and each number
+	// handed out is reserved until the entity is saved.
+	n, err := m.NextEntityNumber(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(6), n)
+	assert.Equal(t, ErrNumberInUse, m.ClaimEntityNumber(ctx, 6))
+	assert.Equal(t, ErrNumberInUse, m.ClaimEntityNumber(ctx, 1))
+	assert.Nil(t, m.ClaimEntityNumber(ctx, 9))
+	assert.Nil(t, m.ClaimEntityNumber(ctx, 3))
+
+	// Events keep the allocator up to date without reloading.
+	b, _ := proto.Marshal(&types.Entity{ID: proto.String("entity3"), Number: proto.Int32(3)})
+	mkv.On("Get", "/entities/entity3").Return(b, nil)
+	m.FireEvent(Event{Type: EventEntityUpdate, PK: "entity3"})
+	m.FireEvent(Event{Type: EventEntityDestroy, PK: "entity1"})
+	assert.Nil(t, m.ClaimEntityNumber(ctx, 1))
+	assert.Equal(t, ErrNumberInUse, m.ClaimEntityNumber(ctx, 3))
+
+	// A dry run learns which number it would get, but nothing is
+	// reserved or stored.
+	dry := WithDryRun(ctx)
+	for i := 0; i < 2; i++ {
+		n, err = m.NextEntityNumber(dry)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(10), n)
+		assert.Nil(t, m.ClaimEntityNumber(dry, 20))
+	}
+
+	mkv.AssertExpectations(t)
+}
+
+func TestReleaseOnAbort(t *testing.T) {
+	RegisterKV("map", newMapKV)
+	m, err := New("map")
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	// A number handed out for a create that fails is given back.
+	errAbort := errors.New("abort")
+	assert.Equal(t, errAbort, m.Atomically(ctx, func(ctx context.Context) error {
+		n, err := m.NextEntityNumber(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1), n)
+		assert.Nil(t, m.ClaimEntityNumber(ctx, 7))
+		return errAbort
+	}))
+	n, err := m.NextEntityNumber(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), n)
+	assert.Nil(t, m.ClaimEntityNumber(ctx, 7))
+
+	// One that is committed stays reserved.
+	assert.Nil(t, m.Atomically(ctx, func(ctx context.Context) error {
+		return m.ClaimGroupNumber(ctx, 3)
+	}))
+	assert.Equal(t, ErrNumberInUse, m.ClaimGroupNumber(ctx, 3))
+}
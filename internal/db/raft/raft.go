@@ -0,0 +1,499 @@
+// Package raft implements a key/value store that is replicated
+// between several NetAuth servers with the raft consensus algorithm.
+// The servers form a cluster which elects one of them as its leader,
+// and only the leader accepts writes, which it commits once a
+// majority of the cluster has them.  If the leader fails the others
+// elect a new one, so the cluster keeps accepting writes for as long
+// as a majority of it is up.
+//
+// Every server holds the whole store in memory and answers reads
+// from its own copy, which may briefly lag behind the leader.  Only
+// the leader advertises KVMutable, and clients find the leader with
+// Leader.  Each server is identified by the address that clients
+// reach its NetAuth service at, so that the leader's identity is also
+// where writes should be sent.
+//
+// The cluster is formed from db.raft.peers the first time its
+// servers start, after which the membership is kept in the raft log.
+// Each peer is written as id=address, where the address is the one
+// the server listens on for raft traffic at db.raft.bind.
+//
+// Raft traffic is always carried over TLS, and a server won't start
+// without db.raft.tls.certificate, db.raft.tls.key, and db.raft.tls.ca.
+// Every server must present a certificate signed by the CA, both when
+// it dials and when it is dialed, and the certificate must be valid
+// for the host in the address that the other servers dial it at.
+// Relative paths are taken from core.conf.
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	hraft "github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"github.com/spf13/viper"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/startup"
+)
+
+var (
+	// ErrNotLeader is returned for writes to a server that isn't
+	// the leader of its cluster.
+	ErrNotLeader = errors.New("this server is not the leader of its cluster")
+
+	// ErrBadPeer is returned when a peer isn't written as
+	// id=address.
+	ErrBadPeer = errors.New("peers must be of the form id=address")
+)
+
+// applyTimeout is how long a write waits to be committed.
+const applyTimeout = 10 * time.Second
+
+// newRaftConfig returns the raft configuration that nodes start
+// from.  Tests replace it to elect leaders faster.
+var newRaftConfig = hraft.DefaultConfig
+
+// Config describes one server of a cluster.
+type Config struct {
+	// ID is the address that clients reach this server's NetAuth
+	// service at.
+	ID string
+
+	// Dir is where the raft log and snapshots are kept.  If it
+	// is empty they are kept in memory, and are lost when the
+	// server stops.
+	Dir string
+
+	// Transport carries raft traffic between the servers.
+	Transport hraft.Transport
+
+	// Peers are the servers, including this one, that form the
+	// cluster the first time it starts.
+	Peers []hraft.Server
+}
+
+// KV is one server's copy of the store.
+type KV struct {
+	l  hclog.Logger
+	r  *hraft.Raft
+	tr hraft.Transport
+
+	closers []io.Closer
+
+	mu sync.RWMutex
+	m  map[string][]byte
+
+	eF func(db.Event)
+
+	// ready is set once this server has become the leader and
+	// applied everything that was committed before it was, and
+	// done stops the goroutine that watches for that.
+	ready int32
+	done  chan struct{}
+}
+
+func init() {
+	startup.RegisterCallback(cb)
+}
+
+func cb() {
+	db.RegisterKV("raft", newFromConfig)
+}
+
+// newFromConfig starts a server of the cluster described by the
+// db.raft section of the config, listening for raft traffic over
+// TLS.
+func newFromConfig(l hclog.Logger) (db.KVStore, error) {
+	id := viper.GetString("db.raft.id")
+	if id == "" {
+		hn, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		id = fmt.Sprintf("%s:%d", hn, viper.GetInt("server.port"))
+	}
+
+	var peers []hraft.Server
+	for _, p := range viper.GetStringSlice("db.raft.peers") {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, ErrBadPeer
+		}
+		peers = append(peers, hraft.Server{
+			ID:      hraft.ServerID(parts[0]),
+			Address: hraft.ServerAddress(parts[1]),
+		})
+	}
+
+	var advertise net.Addr
+	if a := viper.GetString("db.raft.advertise"); a != "" {
+		addr, err := net.ResolveTCPAddr("tcp", a)
+		if err != nil {
+			return nil, err
+		}
+		advertise = addr
+	}
+	conf, err := tlsConfigFromViper()
+	if err != nil {
+		return nil, err
+	}
+	tr, err := NewTLSTransport(viper.GetString("db.raft.bind"), advertise, conf, l.Named("raft"))
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := New(Config{
+		ID:        id,
+		Dir:       filepath.Join(viper.GetString("core.home"), "raft"),
+		Transport: tr,
+		Peers:     peers,
+	}, l)
+	if err != nil {
+		tr.Close()
+		return nil, err
+	}
+	return kv, nil
+}
+
+// New starts a server of a cluster.  The cluster is formed from the
+// configured peers if this server has never been part of one.
+func New(c Config, l hclog.Logger) (*KV, error) {
+	kv := &KV{
+		l:    l.Named("raft"),
+		tr:   c.Transport,
+		m:    make(map[string][]byte),
+		done: make(chan struct{}),
+	}
+
+	rc := newRaftConfig()
+	rc.LocalID = hraft.ServerID(c.ID)
+	rc.Logger = kv.l
+	notify := make(chan bool, 1)
+	rc.NotifyCh = notify
+
+	var (
+		logs   hraft.LogStore
+		stable hraft.StableStore
+		snaps  hraft.SnapshotStore
+	)
+	if c.Dir == "" {
+		store := hraft.NewInmemStore()
+		logs, stable = store, store
+		snaps = hraft.NewInmemSnapshotStore()
+	} else {
+		if err := os.MkdirAll(c.Dir, 0750); err != nil {
+			return nil, err
+		}
+		store, err := raftboltdb.NewBoltStore(filepath.Join(c.Dir, "raft.db"))
+		if err != nil {
+			return nil, err
+		}
+		kv.closers = append(kv.closers, store)
+		logs, stable = store, store
+		snaps, err = hraft.NewFileSnapshotStoreWithLogger(c.Dir, 2, kv.l)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+
+	r, err := hraft.NewRaft(rc, (*fsm)(kv), logs, stable, snaps, c.Transport)
+	if err != nil {
+		kv.closeStores()
+		return nil, err
+	}
+	kv.r = r
+	go kv.watchLeadership(notify)
+
+	if len(c.Peers) > 0 {
+		// Every peer forms the cluster with the same
+		// configuration, so it doesn't matter which of them
+		// gets there first.  A server that has been part of a
+		// cluster before already knows its peers.
+		err := r.BootstrapCluster(hraft.Configuration{Servers: c.Peers}).Error()
+		switch err {
+		case nil:
+			kv.l.Info("Formed cluster", "peers", len(c.Peers))
+		case hraft.ErrCantBootstrap:
+		default:
+			kv.Close()
+			return nil, err
+		}
+	}
+	return kv, nil
+}
+
+// Put stores the value v at the key k once the cluster has committed
+// it.
+func (kv *KV) Put(ctx context.Context, k string, v []byte) error {
+	return kv.Batch(ctx, []db.KVOp{{Key: k, Value: v}})
+}
+
+// Get returns the value at k from this server's copy of the store.
+func (kv *KV) Get(_ context.Context, k string) ([]byte, error) {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
+	v, ok := kv.m[k]
+	if !ok {
+		return nil, db.ErrNoValue
+	}
+	return v, nil
+}
+
+// Del removes the value at k once the cluster has committed it.
+func (kv *KV) Del(ctx context.Context, k string) error {
+	if _, err := kv.Get(ctx, k); err != nil {
+		return err
+	}
+	return kv.Batch(ctx, []db.KVOp{{Key: k, Delete: true}})
+}
+
+// Batch commits all of the operations as a single entry in the raft
+// log, so every server applies either all of them or none.
+func (kv *KV) Batch(_ context.Context, ops []db.KVOp) error {
+	if !kv.writable() {
+		return ErrNotLeader
+	}
+	b, err := db.MarshalBatch(ops)
+	if err != nil {
+		return err
+	}
+	f := kv.r.Apply(b, applyTimeout)
+	if err := f.Error(); err != nil {
+		if err == hraft.ErrNotLeader || err == hraft.ErrLeadershipLost {
+			return ErrNotLeader
+		}
+		return err
+	}
+	if err, ok := f.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Keys returns the keys in this server's copy of the store that match
+// the filter.
+func (kv *KV) Keys(_ context.Context, f string) ([]string, error) {
+	kv.mu.RLock()
+	defer kv.mu.RUnlock()
+	out := []string{}
+	for k := range kv.m {
+		if m, _ := path.Match(f, k); m {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+// Close leaves the cluster and closes the raft log.  The rest of the
+// cluster carries on without this server.
+func (kv *KV) Close() error {
+	// Raft may still report losing leadership while it shuts
+	// down, so the watcher is stopped afterwards.
+	err := kv.r.Shutdown().Error()
+	close(kv.done)
+	if c, ok := kv.tr.(hraft.WithClose); ok {
+		c.Close()
+	}
+	if cerr := kv.closeStores(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (kv *KV) closeStores() error {
+	var err error
+	for _, c := range kv.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Capabilities returns KVMutable only while this server is the
+// leader of its cluster.  Batches are always atomic.
+func (kv *KV) Capabilities() []db.KVCapability {
+	if kv.writable() {
+		return []db.KVCapability{db.KVMutable, db.KVBatch}
+	}
+	return []db.KVCapability{db.KVBatch}
+}
+
+// writable reports whether this server is the leader and has caught
+// up with the log.
+func (kv *KV) writable() bool {
+	return kv.r.State() == hraft.Leader && atomic.LoadInt32(&kv.ready) == 1
+}
+
+// watchLeadership waits for this server to become the leader, and
+// then waits for everything committed by earlier leaders to be
+// applied here before taking writes.  Until then revision checks and
+// number allocation would work from a copy of the store that may be
+// out of date.
+func (kv *KV) watchLeadership(notify <-chan bool) {
+	for {
+		select {
+		case leader := <-notify:
+			atomic.StoreInt32(&kv.ready, 0)
+			for leader && kv.r.State() == hraft.Leader {
+				err := kv.r.Barrier(applyTimeout).Error()
+				if err == nil {
+					atomic.StoreInt32(&kv.ready, 1)
+					kv.l.Info("Became leader and caught up with the log")
+					break
+				}
+				kv.l.Warn("Error catching up after becoming leader", "error", err)
+				if err == hraft.ErrLeadershipLost || err == hraft.ErrRaftShutdown {
+					break
+				}
+			}
+		case <-kv.done:
+			return
+		}
+	}
+}
+
+// Leader returns the ID of the current leader of the cluster, which
+// is the address that clients reach its NetAuth service at.  If there
+// is no leader right now the empty string is returned.
+func (kv *KV) Leader() string {
+	addr := kv.r.Leader()
+	if addr == "" {
+		return ""
+	}
+	f := kv.r.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return ""
+	}
+	for _, s := range f.Configuration().Servers {
+		if s.Address == addr {
+			return string(s.ID)
+		}
+	}
+	return ""
+}
+
+// SetEventFunc sets up a function to call to fire events to
+// subscribers.
+func (kv *KV) SetEventFunc(f func(db.Event)) {
+	kv.mu.Lock()
+	kv.eF = f
+	kv.mu.Unlock()
+}
+
+// fireEvents fires the events for the changes to keys.  Every
+// server fires events for every change, so that each server's indexes
+// follow the store.
+func (kv *KV) fireEvents(keys []string, deleted []bool) {
+	kv.mu.RLock()
+	eF := kv.eF
+	kv.mu.RUnlock()
+	if eF == nil {
+		return
+	}
+	for i, k := range keys {
+		if e, ok := db.EventForKey(k, deleted[i]); ok {
+			eF(e)
+		}
+	}
+}
+
+// fsm applies the committed raft log to the store.
+type fsm KV
+
+// Apply applies one committed batch.
+func (f *fsm) Apply(l *hraft.Log) interface{} {
+	ops, err := db.UnmarshalBatch(l.Data)
+	if err != nil {
+		f.l.Error("Undecodable entry in raft log", "index", l.Index, "error", err)
+		return err
+	}
+
+	keys := make([]string, len(ops))
+	deleted := make([]bool, len(ops))
+	f.mu.Lock()
+	for i, op := range ops {
+		keys[i], deleted[i] = op.Key, op.Delete
+		if op.Delete {
+			delete(f.m, op.Key)
+			continue
+		}
+		f.m[op.Key] = op.Value
+	}
+	f.mu.Unlock()
+
+	(*KV)(f).fireEvents(keys, deleted)
+	return nil
+}
+
+// Snapshot captures the store so that the raft log can be
+// compacted.
+func (f *fsm) Snapshot() (hraft.FSMSnapshot, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	m := make(map[string][]byte, len(f.m))
+	for k, v := range f.m {
+		m[k] = v
+	}
+	return snapshot(m), nil
+}
+
+// Restore replaces the store with a snapshot, and fires the events
+// for every key that it changes.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	m := make(map[string][]byte)
+	if err := gob.NewDecoder(rc).Decode(&m); err != nil {
+		return err
+	}
+
+	var keys []string
+	var deleted []bool
+	f.mu.Lock()
+	for k, v := range m {
+		if old, ok := f.m[k]; !ok || !bytes.Equal(old, v) {
+			keys = append(keys, k)
+			deleted = append(deleted, false)
+		}
+	}
+	for k := range f.m {
+		if _, ok := m[k]; !ok {
+			keys = append(keys, k)
+			deleted = append(deleted, true)
+		}
+	}
+	f.m = m
+	f.mu.Unlock()
+
+	(*KV)(f).fireEvents(keys, deleted)
+	return nil
+}
+
+// snapshot is a copy of the store taken by fsm.Snapshot.
+type snapshot map[string][]byte
+
+func (s snapshot) Persist(sink hraft.SnapshotSink) error {
+	if err := gob.NewEncoder(sink).Encode(map[string][]byte(s)); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s snapshot) Release() {}
@@ -0,0 +1,278 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	hraft "github.com/hashicorp/raft"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netauth/netauth/internal/crypto/nocrypto"
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+	_ "github.com/netauth/netauth/internal/tree/hooks"
+)
+
+func init() {
+	newRaftConfig = func() *hraft.Config {
+		c := hraft.DefaultConfig()
+		c.HeartbeatTimeout = 50 * time.Millisecond
+		c.ElectionTimeout = 50 * time.Millisecond
+		c.LeaderLeaseTimeout = 50 * time.Millisecond
+		c.CommitTimeout = 5 * time.Millisecond
+		return c
+	}
+}
+
+// eventLog collects the events that a node fires.
+type eventLog struct {
+	sync.Mutex
+	events []db.Event
+}
+
+func (el *eventLog) add(e db.Event) {
+	el.Lock()
+	el.events = append(el.events, e)
+	el.Unlock()
+}
+
+func (el *eventLog) get() []db.Event {
+	el.Lock()
+	defer el.Unlock()
+	return append([]db.Event{}, el.events...)
+}
+
+// newTransports listens for raft traffic on n loopback ports, with
+// certificates from the same CA.
+func newTransports(t *testing.T, n int) ([]hraft.Transport, []hraft.Server) {
+	ca := newTestCA(t)
+	var trs []hraft.Transport
+	var peers []hraft.Server
+	for i := 0; i < n; i++ {
+		tr, err := NewTLSTransport("127.0.0.1:0", nil, ca.tlsConfig(t), hclog.NewNullLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		trs = append(trs, tr)
+		peers = append(peers, hraft.Server{
+			ID:      hraft.ServerID(fmt.Sprintf("node%d:1729", i)),
+			Address: tr.LocalAddr(),
+		})
+	}
+	return trs, peers
+}
+
+// newCluster starts a cluster of n servers on loopback.
+func newCluster(t *testing.T, n int) ([]*KV, []*eventLog) {
+	trs, peers := newTransports(t, n)
+	var nodes []*KV
+	var logs []*eventLog
+	for i := range trs {
+		kv, err := New(Config{ID: string(peers[i].ID), Transport: trs[i], Peers: peers}, hclog.NewNullLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		el := &eventLog{}
+		kv.SetEventFunc(el.add)
+		nodes = append(nodes, kv)
+		logs = append(logs, el)
+	}
+	return nodes, logs
+}
+
+// waitForLeader returns the index of the leader once one of the
+// nodes has been elected and is ready for writes.
+func waitForLeader(t *testing.T, nodes []*KV) int {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		for i, kv := range nodes {
+			if kv != nil && kv.writable() {
+				return i
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("No leader was elected")
+	return -1
+}
+
+// eventually retries f until it succeeds or a few seconds pass.
+func eventually(t *testing.T, msg string, f func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if f() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error(msg)
+}
+
+func TestCB(t *testing.T) {
+	cb()
+}
+
+func TestCluster(t *testing.T) {
+	ctx := context.Background()
+	nodes, logs := newCluster(t, 3)
+	for _, kv := range nodes {
+		defer kv.Close()
+	}
+	leader := waitForLeader(t, nodes)
+	follower := (leader + 1) % len(nodes)
+
+	for i, kv := range nodes {
+		mutable := false
+		for _, c := range kv.Capabilities() {
+			mutable = mutable || c == db.KVMutable
+		}
+		assert.Equal(t, i == leader, mutable, "node %d", i)
+		eventually(t, "leader is not known everywhere", func() bool {
+			return kv.Leader() == fmt.Sprintf("node%d:1729", leader)
+		})
+	}
+
+	assert.Equal(t, ErrNotLeader, nodes[follower].Put(ctx, "/entities/foo", []byte("foo")))
+
+	assert.Nil(t, nodes[leader].Put(ctx, "/entities/foo", []byte("foo")))
+	assert.Nil(t, nodes[leader].Batch(ctx, []db.KVOp{
+		{Key: "/groups/bar", Value: []byte("bar")},
+		{Key: "/meta/entity-numbers", Value: []byte("1")},
+	}))
+	assert.Nil(t, nodes[leader].Del(ctx, "/entities/foo"))
+	assert.Equal(t, db.ErrNoValue, nodes[leader].Del(ctx, "/entities/foo"))
+
+	want := []db.Event{
+		{Type: db.EventEntityUpdate, PK: "foo"},
+		{Type: db.EventGroupUpdate, PK: "bar"},
+		{Type: db.EventEntityDestroy, PK: "foo"},
+	}
+	for i, kv := range nodes {
+		eventually(t, fmt.Sprintf("node %d didn't apply the writes", i), func() bool {
+			// The delete is the last write.
+			_, err := kv.Get(ctx, "/entities/foo")
+			return err == db.ErrNoValue && len(logs[i].get()) == len(want)
+		})
+		v, err := kv.Get(ctx, "/groups/bar")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("bar"), v)
+		_, err = kv.Get(ctx, "/meta/entity-numbers")
+		assert.Nil(t, err)
+		keys, err := kv.Keys(ctx, "/groups/*")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"/groups/bar"}, keys)
+		assert.Equal(t, want, logs[i].get(), "node %d", i)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+	nodes, _ := newCluster(t, 3)
+	leader := waitForLeader(t, nodes)
+	assert.Nil(t, nodes[leader].Put(ctx, "/entities/foo", []byte("foo")))
+
+	assert.Nil(t, nodes[leader].Close())
+	nodes[leader] = nil
+	next := waitForLeader(t, nodes)
+	assert.NotEqual(t, leader, next)
+	assert.Nil(t, nodes[next].Put(ctx, "/entities/bar", []byte("bar")))
+	v, err := nodes[next].Get(ctx, "/entities/foo")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("foo"), v)
+
+	for _, kv := range nodes {
+		if kv != nil {
+			kv.Close()
+		}
+	}
+}
+
+func TestRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	trs, peers := newTransports(t, 1)
+	kv, err := New(Config{ID: "node0:1729", Dir: dir, Transport: trs[0], Peers: peers}, hclog.NewNullLogger())
+	assert.Nil(t, err)
+	waitForLeader(t, []*KV{kv})
+	assert.Nil(t, kv.Put(ctx, "/entities/foo", []byte("foo")))
+	assert.Nil(t, kv.Close())
+
+	// The server remembers the cluster and its contents, so the
+	// peers don't have to be given again.
+	trs, _ = newTransports(t, 1)
+	kv, err = New(Config{ID: "node0:1729", Dir: dir, Transport: trs[0]}, hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer kv.Close()
+	waitForLeader(t, []*KV{kv})
+	eventually(t, "value was lost in restart", func() bool {
+		v, err := kv.Get(ctx, "/entities/foo")
+		return err == nil && string(v) == "foo"
+	})
+}
+
+// newNodeTree returns a tree on top of one node of a cluster.
+func newNodeTree(t *testing.T, kv *KV) (*tree.Manager, *db.DB) {
+	// Backends can't be registered twice, so each node gets a
+	// name of its own.
+	name := fmt.Sprintf("raft-%p", kv)
+	db.RegisterKV(name, func(hclog.Logger) (db.KVStore, error) { return kv, nil })
+	d, err := db.New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crypt, err := nocrypto.New(hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := tree.New(tree.WithStorage(d), tree.WithCrypto(crypt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, d
+}
+
+func TestAuthOnFollower(t *testing.T) {
+	startup.DoCallbacks()
+	ctx := context.Background()
+	nodes, _ := newCluster(t, 3)
+	leader := waitForLeader(t, nodes)
+	follower := (leader + 1) % len(nodes)
+	for i, kv := range nodes {
+		if i != leader && i != follower {
+			defer kv.Close()
+		}
+	}
+
+	lm, ldb := newNodeTree(t, nodes[leader])
+	defer ldb.Shutdown()
+	fm, fdb := newNodeTree(t, nodes[follower])
+	defer fdb.Shutdown()
+
+	assert.Nil(t, lm.CreateEntity(ctx, "entity1", -1, "secret"))
+	eventually(t, "entity was not replicated", func() bool {
+		_, err := fdb.LoadEntity(ctx, "entity1")
+		return err == nil
+	})
+
+	// Authenticating doesn't change the entity, so it works
+	// without a leader to write through.
+	assert.Nil(t, fm.ValidateSecret(ctx, "entity1", "secret"))
+	assert.NotNil(t, fm.ValidateSecret(ctx, "entity1", "wrong"))
+
+	// Changes still have to go to the leader.
+	assert.NotNil(t, fm.SetSecret(ctx, "entity1", "new-secret"))
+}
+
+func TestNewFromConfigBadPeer(t *testing.T) {
+	viper.Set("db.raft.peers", []string{"node0:1729"})
+	defer viper.Set("db.raft.peers", nil)
+	_, err := newFromConfig(hclog.NewNullLogger())
+	assert.Equal(t, ErrBadPeer, err)
+}
@@ -0,0 +1,124 @@
+package raft
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	hraft "github.com/hashicorp/raft"
+	"github.com/spf13/viper"
+)
+
+var (
+	// ErrNoTLS is returned when the certificates that secure
+	// raft traffic haven't been configured.
+	ErrNoTLS = errors.New("raft traffic requires db.raft.tls.certificate, db.raft.tls.key, and db.raft.tls.ca")
+
+	// ErrBadCA is returned when the CA file for raft traffic
+	// contains no certificates.
+	ErrBadCA = errors.New("no certificates could be loaded from db.raft.tls.ca")
+
+	// ErrNotAdvertisable is returned when the raft listener is
+	// bound to an address that other servers can't dial, and no
+	// db.raft.advertise address has been given.
+	ErrNotAdvertisable = errors.New("raft bind address is not advertisable")
+)
+
+// tlsStreamLayer carries raft traffic over TLS.  Both ends of every
+// connection must present a certificate signed by the cluster's CA.
+type tlsStreamLayer struct {
+	net.Listener
+
+	advertise net.Addr
+	conf      *tls.Config
+}
+
+// NewTLSTransport listens for raft traffic at bind.  Connections in
+// either direction are refused unless the other server presents a
+// certificate that conf trusts, so conf must have both RootCAs and
+// ClientCAs set.  If advertise is nil the address of the listener is
+// given to the other servers instead.
+func NewTLSTransport(bind string, advertise net.Addr, conf *tls.Config, l hclog.Logger) (*hraft.NetworkTransport, error) {
+	conf = conf.Clone()
+	conf.ClientAuth = tls.RequireAndVerifyClientCert
+
+	ln, err := net.Listen("tcp", bind)
+	if err != nil {
+		return nil, err
+	}
+	s := &tlsStreamLayer{
+		Listener:  tls.NewListener(ln, conf),
+		advertise: advertise,
+		conf:      conf,
+	}
+
+	addr, ok := s.Addr().(*net.TCPAddr)
+	if !ok || addr.IP == nil || addr.IP.IsUnspecified() {
+		ln.Close()
+		return nil, ErrNotAdvertisable
+	}
+	return hraft.NewNetworkTransportWithLogger(s, 3, 10*time.Second, l), nil
+}
+
+// Dial connects to another server, checking that its certificate is
+// valid for the host it was dialed at.
+func (s *tlsStreamLayer) Dial(address hraft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(string(address))
+	if err != nil {
+		return nil, err
+	}
+	conf := s.conf.Clone()
+	conf.ServerName = host
+	return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", string(address), conf)
+}
+
+// Addr returns the address that other servers should dial.
+func (s *tlsStreamLayer) Addr() net.Addr {
+	if s.advertise != nil {
+		return s.advertise
+	}
+	return s.Listener.Addr()
+}
+
+// tlsConfigFromViper loads the certificate, key, and CA named in the
+// db.raft.tls section of the config.  Relative paths are taken from
+// core.conf.
+func tlsConfigFromViper() (*tls.Config, error) {
+	cFile := viper.GetString("db.raft.tls.certificate")
+	kFile := viper.GetString("db.raft.tls.key")
+	caFile := viper.GetString("db.raft.tls.ca")
+	if cFile == "" || kFile == "" || caFile == "" {
+		return nil, ErrNoTLS
+	}
+	for _, f := range []*string{&cFile, &kFile, &caFile} {
+		if !filepath.IsAbs(*f) {
+			*f = filepath.Join(viper.GetString("core.conf"), *f)
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(cFile, kFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, ErrBadCA
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
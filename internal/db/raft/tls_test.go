@@ -0,0 +1,175 @@
+package raft
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	hraft "github.com/hashicorp/raft"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCA signs certificates for the servers of a test cluster.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "raft-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a PEM encoded certificate and key for a server at
+// 127.0.0.1.
+func (ca *testCA) issue(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "raft-node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder})
+}
+
+// tlsConfig returns the config for one server signed by ca.
+func (ca *testCA) tlsConfig(t *testing.T) *tls.Config {
+	cert, err := tls.X509KeyPair(ca.issue(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+	}
+}
+
+func TestTLSTransportRejectsUntrusted(t *testing.T) {
+	good, err := NewTLSTransport("127.0.0.1:0", nil, newTestCA(t).tlsConfig(t), hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer good.Close()
+	go func() {
+		for rpc := range good.Consumer() {
+			rpc.Respond(&hraft.RequestVoteResponse{Granted: true}, nil)
+		}
+	}()
+
+	bad, err := NewTLSTransport("127.0.0.1:0", nil, newTestCA(t).tlsConfig(t), hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bad.Close()
+
+	var resp hraft.RequestVoteResponse
+	err = bad.RequestVote("good", good.LocalAddr(), &hraft.RequestVoteRequest{}, &resp)
+	assert.NotNil(t, err)
+	assert.False(t, resp.Granted)
+}
+
+func TestTLSTransportNotAdvertisable(t *testing.T) {
+	_, err := NewTLSTransport("0.0.0.0:0", nil, newTestCA(t).tlsConfig(t), hclog.NewNullLogger())
+	assert.Equal(t, ErrNotAdvertisable, err)
+}
+
+func TestTLSConfigFromViper(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	cert, key := ca.issue(t)
+	for name, b := range map[string][]byte{"raft.pem": cert, "raft.key": key, "ca.pem": ca.pem, "empty.pem": nil} {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	viper.Set("core.conf", dir)
+	defer viper.Set("core.conf", nil)
+
+	cases := []struct {
+		cert, key, ca string
+		wantErr       error
+	}{
+		{"", "", "", ErrNoTLS},
+		{"raft.pem", "raft.key", "", ErrNoTLS},
+		{"raft.pem", "raft.key", "empty.pem", ErrBadCA},
+		{"raft.pem", "raft.key", filepath.Join(dir, "ca.pem"), nil},
+	}
+
+	for i, c := range cases {
+		viper.Set("db.raft.tls.certificate", c.cert)
+		viper.Set("db.raft.tls.key", c.key)
+		viper.Set("db.raft.tls.ca", c.ca)
+
+		conf, err := tlsConfigFromViper()
+		if err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+		if err == nil && (len(conf.Certificates) != 1 || conf.ClientAuth != tls.RequireAndVerifyClientCert) {
+			t.Errorf("%d: Bad config %v", i, conf)
+		}
+	}
+	viper.Set("db.raft.tls.certificate", nil)
+	viper.Set("db.raft.tls.key", nil)
+	viper.Set("db.raft.tls.ca", nil)
+}
+
+func TestNewFromConfigNoTLS(t *testing.T) {
+	_, err := newFromConfig(hclog.NewNullLogger())
+	assert.Equal(t, ErrNoTLS, err)
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Realms are separate sets of entities and groups that share a single
+// KVStore.  The default realm, whose name is empty, uses the keys that
+// a store without realms has always used.  Every other realm puts its
+// name in front of the top level of each key, so the entity foo in the
+// realm lab is stored at /lab.entities/foo.  Since every key is still
+// two levels deep, no store needs to know about realms to hold them.
+const realmSeparator = "."
+
+var realmRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidRealm reports whether name may be used as the name of a realm.
+// The default realm is always valid.
+func ValidRealm(name string) bool {
+	return name == "" || realmRegexp.MatchString(name)
+}
+
+// RealmKey returns the key that k is stored at in the named realm.
+func RealmKey(realm, k string) string {
+	if realm == "" {
+		return k
+	}
+	return "/" + realm + realmSeparator + strings.TrimPrefix(k, "/")
+}
+
+// SplitRealmKey is the inverse of RealmKey, and returns the realm that
+// the stored key k belongs to along with the key within that realm.
+func SplitRealmKey(k string) (string, string) {
+	top := strings.SplitN(strings.TrimPrefix(k, "/"), "/", 2)[0]
+	i := strings.Index(top, realmSeparator)
+	if i < 0 {
+		return "", k
+	}
+	return top[:i], "/" + strings.TrimPrefix(k, "/"+top[:i+1])
+}
+
+// EventForKey returns the event that a change to the stored key k
+// fires.  Only entities and groups fire events, so for any other key,
+// such as those under MetaPrefix, false is returned.  KVStores use
+// this to translate their changes into events.
+func EventForKey(k string, deleted bool) (Event, bool) {
+	realm, k := SplitRealmKey(k)
+	e := Event{Realm: realm, PK: path.Base(k)}
+	switch {
+	case strings.HasPrefix(k, "/entities/") && !deleted:
+		e.Type = EventEntityUpdate
+	case strings.HasPrefix(k, "/entities/") && deleted:
+		e.Type = EventEntityDestroy
+	case strings.HasPrefix(k, "/groups/") && !deleted:
+		e.Type = EventGroupUpdate
+	case strings.HasPrefix(k, "/groups/") && deleted:
+		e.Type = EventGroupDestroy
+	default:
+		return Event{}, false
+	}
+	return e, true
+}
+
+// A RealmStore shares one KVStore between the DBs of several realms.
+// Each realm has its own DB, and so its own index, cache, numbers and
+// subscribers, and sees only its own part of the keyspace.  The store
+// is closed once every DB opened from it has been shut down.
+type RealmStore struct {
+	kv KVStore
+
+	mu     sync.Mutex
+	events map[string]func(Event)
+	open   int
+}
+
+// NewRealmStore opens the named backend to be shared between realms.
+func NewRealmStore(backend string) (*RealmStore, error) {
+	kv, err := NewKV(backend, log())
+	if err != nil {
+		return nil, err
+	}
+	rs := &RealmStore{
+		kv:     kv,
+		events: make(map[string]func(Event)),
+	}
+	kv.SetEventFunc(rs.fireEvent)
+	return rs, nil
+}
+
+// Open returns the DB of the named realm.  Each realm may only be
+// opened once.
+func (rs *RealmStore) Open(realm string, opts ...Option) (*DB, error) {
+	if !ValidRealm(realm) {
+		return nil, ErrBadRealm
+	}
+	rs.mu.Lock()
+	if _, ok := rs.events[realm]; ok {
+		rs.mu.Unlock()
+		return nil, ErrRealmOpen
+	}
+	rs.events[realm] = nil
+	rs.open++
+	rs.mu.Unlock()
+
+	db, err := open(&realmKV{rs: rs, realm: realm}, opts...)
+	if err != nil {
+		rs.mu.Lock()
+		delete(rs.events, realm)
+		rs.mu.Unlock()
+		return nil, err
+	}
+	return db, nil
+}
+
+// fireEvent passes an event on to the DB of the realm it belongs to.
+// Events for realms that aren't open are dropped.
+func (rs *RealmStore) fireEvent(e Event) {
+	rs.mu.Lock()
+	f := rs.events[e.Realm]
+	rs.mu.Unlock()
+	if f != nil {
+		f(e)
+	}
+}
+
+// realmKV is the part of a shared KVStore that belongs to one realm.
+// Keys are translated on the way in and out, so the DB above it works
+// exactly as it would on a store of its own.
+type realmKV struct {
+	rs    *RealmStore
+	realm string
+}
+
+func (kv *realmKV) Put(ctx context.Context, k string, v []byte) error {
+	return kv.rs.kv.Put(ctx, RealmKey(kv.realm, k), v)
+}
+
+func (kv *realmKV) Get(ctx context.Context, k string) ([]byte, error) {
+	return kv.rs.kv.Get(ctx, RealmKey(kv.realm, k))
+}
+
+func (kv *realmKV) Del(ctx context.Context, k string) error {
+	return kv.rs.kv.Del(ctx, RealmKey(kv.realm, k))
+}
+
+// Keys matches the filter against the keys of this realm only.
+func (kv *realmKV) Keys(ctx context.Context, f string) ([]string, error) {
+	keys, err := kv.rs.kv.Keys(ctx, RealmKey(kv.realm, f))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if realm, k := SplitRealmKey(k); realm == kv.realm {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+// Batch translates the keys of the batch and then commits it.  This
+// is only called when the shared store advertises KVBatch.
+func (kv *realmKV) Batch(ctx context.Context, ops []KVOp) error {
+	kvb, ok := kv.rs.kv.(KVBatcher)
+	if !ok {
+		return ErrInternalError
+	}
+	rops := make([]KVOp, len(ops))
+	for i, op := range ops {
+		rops[i] = op
+		rops[i].Key = RealmKey(kv.realm, op.Key)
+	}
+	return kvb.Batch(ctx, rops)
+}
+
+// Close closes the shared store once the last realm is closed.
+func (kv *realmKV) Close() error {
+	kv.rs.mu.Lock()
+	kv.rs.open--
+	last := kv.rs.open == 0
+	kv.rs.mu.Unlock()
+	if last {
+		return kv.rs.kv.Close()
+	}
+	return nil
+}
+
+func (kv *realmKV) Capabilities() []KVCapability {
+	return kv.rs.kv.Capabilities()
+}
+
+func (kv *realmKV) SetEventFunc(f func(Event)) {
+	kv.rs.mu.Lock()
+	kv.rs.events[kv.realm] = f
+	kv.rs.mu.Unlock()
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+func TestRealmKey(t *testing.T) {
+	cases := []struct {
+		realm string
+		key   string
+		want  string
+	}{
+		{"", "/entities/foo", "/entities/foo"},
+		{"lab", "/entities/foo", "/lab.entities/foo"},
+		{"lab", "/meta/entity-numbers", "/lab.meta/entity-numbers"},
+		{"lab", "/groups/*", "/lab.groups/*"},
+	}
+	for i, c := range cases {
+		k := RealmKey(c.realm, c.key)
+		assert.Equal(t, c.want, k, "case %d", i)
+		realm, key := SplitRealmKey(k)
+		assert.Equal(t, c.realm, realm, "case %d", i)
+		assert.Equal(t, c.key, key, "case %d", i)
+	}
+}
+
+func TestValidRealm(t *testing.T) {
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"", true},
+		{"lab", true},
+		{"prod-2", true},
+		{"Lab", false},
+		{"lab.test", false},
+		{"lab/test", false},
+		{"-lab", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, ValidRealm(c.name), c.name)
+	}
+}
+
+func TestEventForKey(t *testing.T) {
+	cases := []struct {
+		key     string
+		deleted bool
+		want    Event
+		wantOK  bool
+	}{
+		{"/entities/foo", false, Event{Type: EventEntityUpdate, PK: "foo"}, true},
+		{"/entities/foo", true, Event{Type: EventEntityDestroy, PK: "foo"}, true},
+		{"/groups/foo", false, Event{Type: EventGroupUpdate, PK: "foo"}, true},
+		{"/lab.groups/foo", true, Event{Type: EventGroupDestroy, PK: "foo", Realm: "lab"}, true},
+		{"/meta/entity-numbers", false, Event{}, false},
+		{"/lab.meta/entity-numbers", false, Event{}, false},
+		{"/unknown/foo", false, Event{}, false},
+	}
+	for _, c := range cases {
+		e, ok := EventForKey(c.key, c.deleted)
+		assert.Equal(t, c.wantOK, ok, c.key)
+		assert.Equal(t, c.want, e, c.key)
+	}
+}
+
+func TestRealmStore(t *testing.T) {
+	RegisterKV("map", newMapKV)
+	rs, err := NewRealmStore("map")
+	assert.Nil(t, err)
+	kv := rs.kv.(*mapKV)
+	ctx := context.Background()
+
+	prod, err := rs.Open("")
+	assert.Nil(t, err)
+	lab, err := rs.Open("lab")
+	assert.Nil(t, err)
+	_, err = rs.Open("lab")
+	assert.Equal(t, ErrRealmOpen, err)
+	_, err = rs.Open("Lab")
+	assert.Equal(t, ErrBadRealm, err)
+
+	assert.Nil(t, prod.SaveEntity(ctx, &types.Entity{ID: proto.String("foo"), Number: proto.Int32(1)}))
+	assert.Nil(t, lab.SaveEntity(ctx, &types.Entity{ID: proto.String("foo"), Number: proto.Int32(2)}))
+	assert.Nil(t, lab.SaveEntity(ctx, &types.Entity{ID: proto.String("bar"), Number: proto.Int32(3)}))
+
+	_, ok := kv.m["/entities/foo"]
+	assert.True(t, ok)
+	_, ok = kv.m["/lab.entities/foo"]
+	assert.True(t, ok)
+
+	e, err := prod.LoadEntity(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), e.GetNumber())
+	e, err = lab.LoadEntity(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), e.GetNumber())
+	_, err = prod.LoadEntity(ctx, "bar")
+	assert.Equal(t, ErrUnknownEntity, err)
+
+	ids, err := lab.DiscoverEntityIDs(ctx)
+	assert.Nil(t, err)
+	sort.Strings(ids)
+	assert.Equal(t, []string{"/entities/bar", "/entities/foo"}, ids)
+	ids, err = prod.DiscoverEntityIDs(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/entities/foo"}, ids)
+
+	// Events only reach the realm they belong to.
+	var got []Event
+	lab.RegisterCallback("test", func(e Event) { got = append(got, e) })
+	rs.fireEvent(Event{Type: EventEntityUpdate, PK: "foo"})
+	rs.fireEvent(Event{Type: EventEntityUpdate, PK: "bar", Realm: "lab"})
+	rs.fireEvent(Event{Type: EventEntityUpdate, PK: "baz", Realm: "dev"})
+	assert.Equal(t, []Event{{Type: EventEntityUpdate, PK: "bar", Realm: "lab"}}, got)
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// revisionsKey locates the revisions in a context.
+type revisionsKey struct{}
+
+// absentRevision is recorded for an object that was looked for but
+// did not exist, so that two concurrent creations of the same object
+// will also conflict.
+const absentRevision = "absent"
+
+// revisions tracks the revision of every object that has been loaded
+// with a given context, keyed by the key in the KVStore.
+type revisions struct {
+	sync.Mutex
+	m map[string]string
+}
+
+// WithRevisions returns a context that remembers the revision of
+// every entity and group that is loaded with it.  When an object is
+// saved with the same context, the save only succeeds if the stored
+// copy is still at the revision that was loaded, otherwise
+// ErrRevisionConflict is returned.  Objects that were never loaded
+// with the context are saved unconditionally.
+func WithRevisions(ctx context.Context) context.Context {
+	if revisionsFrom(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, revisionsKey{}, &revisions{m: make(map[string]string)})
+}
+
+// Revision returns the revision of a stored value.  Revisions are
+// derived from the content of the value, so writing back an
+// unchanged object does not invalidate copies that other requests
+// have loaded.
+func Revision(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// revisionsFrom returns the revisions held by the context, or nil if
+// the context is not tracking revisions.
+func revisionsFrom(ctx context.Context) *revisions {
+	r, _ := ctx.Value(revisionsKey{}).(*revisions)
+	return r
+}
+
+func (r *revisions) get(k string) (string, bool) {
+	r.Lock()
+	defer r.Unlock()
+	rev, ok := r.m[k]
+	return rev, ok
+}
+
+func (r *revisions) set(k, rev string) {
+	r.Lock()
+	defer r.Unlock()
+	r.m[k] = rev
+}
+
+// recordRevision notes the revision of a value that has been read
+// from the KVStore.  A nil value records that the key was absent.
+func recordRevision(ctx context.Context, k string, b []byte) {
+	r := revisionsFrom(ctx)
+	if r == nil {
+		return
+	}
+	if b == nil {
+		r.set(k, absentRevision)
+		return
+	}
+	r.set(k, Revision(b))
+}
+
+// put writes a value to the KVStore.  If the context holds a
+// revision for the key, the value currently stored is first checked
+// to still be at that revision.  The check and the write happen under
+// a lock so that no other save can slip in between them.  Inside
+// Atomically the value is added to the batch instead.
+func (db *DB) put(ctx context.Context, k string, b []byte) error {
+	r := revisionsFrom(ctx)
+	want, check := "", false
+	if r != nil {
+		want, check = r.get(k)
+	}
+
+	if bt := batchFrom(ctx); bt != nil {
+		if err := bt.put(k, b, want, check); err != nil {
+			return err
+		}
+	} else {
+		db.wmu.Lock()
+		defer db.wmu.Unlock()
+		if check {
+			if err := db.checkRevision(ctx, k, want); err != nil {
+				return err
+			}
+		}
+		if err := db.write(ctx, k, b); err != nil {
+			return err
+		}
+	}
+
+	// A chain may save more than once, and the second save needs
+	// to be checked against what the first one wrote.
+	if r != nil {
+		r.set(k, Revision(b))
+	}
+	return nil
+}
+
+// checkRevision returns ErrRevisionConflict if the value stored at k
+// is no longer at the revision want.  The caller must hold wmu.
+func (db *DB) checkRevision(ctx context.Context, k, want string) error {
+	have := absentRevision
+	cur, err := db.kv.Get(ctx, k)
+	switch err {
+	case nil:
+		have = Revision(cur)
+	case ErrNoValue:
+	default:
+		return err
+	}
+	if have != want {
+		db.log.Debug("Revision conflict", "key", k, "want", want, "have", have)
+		return ErrRevisionConflict
+	}
+	return nil
+}
+
+// write stores a value along with the revision it adds to the
+// history of the object and the entity's new secret, if those are
+// being kept.  The caller must hold wmu.
+func (db *DB) write(ctx context.Context, k string, b []byte) error {
+	ops, err := db.withHistory(ctx, []KVOp{{Key: k, Value: b}})
+	if err != nil {
+		return err
+	}
+	ops, err = db.withSecretHistory(ctx, ops)
+	if err != nil {
+		return err
+	}
+	if len(ops) == 1 {
+		return db.kv.Put(ctx, k, b)
+	}
+	return db.commit(ctx, ops)
+}
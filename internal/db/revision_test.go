@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+func TestWithRevisions(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, revisionsFrom(ctx))
+
+	rctx := WithRevisions(ctx)
+	assert.NotNil(t, revisionsFrom(rctx))
+
+	// Wrapping again must not discard what is being tracked.
+	recordRevision(rctx, "/entities/entity1", goodEntityBytes1)
+	rctx2 := WithRevisions(rctx)
+	rev, ok := revisionsFrom(rctx2).get("/entities/entity1")
+	assert.True(t, ok)
+	assert.Equal(t, Revision(goodEntityBytes1), rev)
+}
+
+func TestRevision(t *testing.T) {
+	assert.Equal(t, Revision(goodEntityBytes1), Revision(goodEntityBytes1))
+	assert.NotEqual(t, Revision(goodEntityBytes1), Revision(goodEntityBytes2))
+}
+
+func TestSaveEntityRevisions(t *testing.T) {
+	RegisterKV("mock", newMockKV)
+	m, err := New("mock")
+	assert.Nil(t, err)
+
+	e := &types.Entity{ID: proto.String("entity1"), Number: proto.Int32(3)}
+	eb, _ := proto.Marshal(e)
+
+	// Unchanged since it was loaded.
+	m.kv.(*mockKV).On("Get", "/entities/entity1").Return(goodEntityBytes1, nil).Twice()
+	m.kv.(*mockKV).On("Put", "/entities/entity1", eb).Return(nil).Once()
+	ctx := WithRevisions(context.Background())
+	_, err = m.LoadEntity(ctx, "entity1")
+	assert.Nil(t, err)
+	assert.Nil(t, m.SaveEntity(ctx, e))
+
+	// Saving a second time in the same context is checked against
+	// what was just written.
+	m.kv.(*mockKV).On("Get", "/entities/entity1").Return(eb, nil).Once()
+	m.kv.(*mockKV).On("Put", "/entities/entity1", eb).Return(nil).Once()
+	assert.Nil(t, m.SaveEntity(ctx, e))
+
+	// Changed by someone else after it was loaded.
+	m.kv.(*mockKV).On("Get", "/entities/entity1").Return(goodEntityBytes1, nil).Once()
+	m.kv.(*mockKV).On("Get", "/entities/entity1").Return(goodEntityBytes2, nil).Once()
+	ctx = WithRevisions(context.Background())
+	_, err = m.LoadEntity(ctx, "entity1")
+	assert.Nil(t, err)
+	assert.Equal(t, ErrRevisionConflict, m.SaveEntity(ctx, e))
+
+	// Created by someone else after it was found to be missing.
+	m.kv.(*mockKV).On("Get", "/entities/entity1").Return([]byte{}, ErrNoValue).Once()
+	m.kv.(*mockKV).On("Get", "/entities/entity1").Return(goodEntityBytes1, nil).Once()
+	ctx = WithRevisions(context.Background())
+	_, err = m.LoadEntity(ctx, "entity1")
+	assert.Equal(t, ErrUnknownEntity, err)
+	assert.Equal(t, ErrRevisionConflict, m.SaveEntity(ctx, e))
+
+	// Without revisions saves are unconditional.
+	m.kv.(*mockKV).On("Put", "/entities/entity1", eb).Return(nil).Once()
+	assert.Nil(t, m.SaveEntity(context.Background(), e))
+
+	m.kv.(*mockKV).AssertNumberOfCalls(t, "Put", 3)
+}
+
+func TestSaveGroupRevisions(t *testing.T) {
+	RegisterKV("mock", newMockKV)
+	m, err := New("mock")
+	assert.Nil(t, err)
+
+	g := &types.Group{Name: proto.String("group1"), Number: proto.Int32(3)}
+
+	m.kv.(*mockKV).On("Get", "/groups/group1").Return(goodGroupBytes1, nil).Once()
+	m.kv.(*mockKV).On("Get", "/groups/group1").Return(goodGroupBytes2, nil).Once()
+	ctx := WithRevisions(context.Background())
+	_, err = m.LoadGroup(ctx, "group1")
+	assert.Nil(t, err)
+	assert.Equal(t, ErrRevisionConflict, m.SaveGroup(ctx, g))
+	m.kv.(*mockKV).AssertNumberOfCalls(t, "Put", 0)
+}
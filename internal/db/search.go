@@ -1,10 +1,18 @@
 package db
 
 import (
+	"bytes"
 	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/mapping"
 	"github.com/hashicorp/go-hclog"
+	"google.golang.org/protobuf/proto"
 
 	pb "github.com/netauth/protocol"
 )
@@ -19,47 +27,195 @@ type Index struct {
 	eLoader loadEntityFunc
 	gLoader loadGroupFunc
 
+	// current is set once the index has been brought up to date
+	// from the journal, after which the events fired to preload
+	// everything else at startup are ignored.
+	current bool
+
+	// kvKeys are the patterns of the KV keys that are indexed.
+	// KV data is readable by anyone that can query the server,
+	// but not every key should be discoverable by searching.
+	kvKeys []string
+
 	l hclog.Logger
 }
 
+// An IndexOption configures an Index.
+type IndexOption func(*Index)
+
+// IndexKV makes the values of KV keys that match any of the patterns
+// searchable as kv.<key>.  Patterns are matched with path.Match, so
+// "*" indexes every key.  No KV data is indexed by default.
+func IndexKV(patterns ...string) IndexOption {
+	return func(s *Index) { s.kvKeys = append(s.kvKeys, patterns...) }
+}
+
+// entityDocument is what gets indexed for an entity.  The entity's
+// own fields keep their names and the indexed KV data is added with a
+// field per key.
+type entityDocument struct {
+	*pb.Entity `json:""`
+	KV         map[string][]string `json:"kv,omitempty"`
+}
+
+// groupDocument is what gets indexed for a group.
+type groupDocument struct {
+	*pb.Group `json:""`
+	KV        map[string][]string `json:"kv,omitempty"`
+}
+
+// indexVersion is stored in an on-disk index and is changed whenever
+// the mappings or the way documents are stored changes, so that an
+// index written by an older server is rebuilt rather than used.
+const indexVersion = "2"
+
+var indexVersionKey = []byte("netauth/version")
+
+// journalSeqKey holds the sequence number of the last journal entry
+// that the index is known to include.
+var journalSeqKey = []byte("netauth/journal-seq")
+
 // NewIndex returns a new SearchIndex with the mappings configured and
 // ready to use.  Mappings are statically defined for simplicity, and
 // in general new mappings shouldn't be added without a very good
 // reason.
-func NewIndex(l hclog.Logger) *Index {
-	// Setup the mapping for entities and turn off certain sub
-	// keys that shouldn't be indexed.
-	eMapping := bleve.NewIndexMapping()
-	eDocMap := bleve.NewDocumentMapping()
-	eDocMap.AddSubDocumentMapping("secret", bleve.NewDocumentDisabledMapping())
-	eDocMap.AddSubDocumentMapping("meta.Keys", bleve.NewDocumentDisabledMapping())
-	eDocMap.AddSubDocumentMapping("meta.UntypedMeta", bleve.NewDocumentDisabledMapping())
-	eMapping.AddDocumentMapping("_default", eDocMap)
-
+func NewIndex(l hclog.Logger, opts ...IndexOption) *Index {
 	// The only real way to throw an error in here is if a mapping
 	// is invalid, or if this were on disk if the backing boltdb
 	// couldn't be allocated.  Since this is fully in memory and
 	// uses a hard-coded mapping, there is no concievable way for
 	// an error to be returned here.  The same is true of the
 	// group mapping below.
-	eIndex, _ := bleve.NewMemOnly(eMapping)
+	eIndex, _ := bleve.NewMemOnly(entityMapping())
 	eIndex.SetName("EntityIndex")
 
-	// Setup the mapping for groups and turn off certain sub keys
-	// that shouldn't be indexed.
-	gMapping := bleve.NewIndexMapping()
-	gDocMap := bleve.NewDocumentMapping()
-	gDocMap.AddSubDocumentMapping("untypedmeta", bleve.NewDocumentDisabledMapping())
-	gMapping.AddDocumentMapping("_default", gDocMap)
-	gIndex, _ := bleve.NewMemOnly(gMapping)
+	gIndex, _ := bleve.NewMemOnly(groupMapping())
 	gIndex.SetName("GroupIndex")
 
 	// Return the prepared struct
-	return &Index{
+	s := &Index{
 		eIndex: eIndex,
 		gIndex: gIndex,
 		l:      l.Named("blevesearch"),
 	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// OpenIndex returns an Index that is kept on disk in dir, creating it
+// if it doesn't exist yet.  Along with each document the index stores
+// the revision of the object it was made from, so objects that
+// haven't changed since the index was last written are not indexed
+// again.  An index that can't be opened or was written with
+// different mappings is thrown away and rebuilt.
+func OpenIndex(dir string, l hclog.Logger, opts ...IndexOption) (*Index, error) {
+	l = l.Named("blevesearch")
+
+	eIndex, err := openDiskIndex(filepath.Join(dir, "entities.bleve"), entityMapping(), l)
+	if err != nil {
+		return nil, err
+	}
+	eIndex.SetName("EntityIndex")
+
+	gIndex, err := openDiskIndex(filepath.Join(dir, "groups.bleve"), groupMapping(), l)
+	if err != nil {
+		eIndex.Close()
+		return nil, err
+	}
+	gIndex.SetName("GroupIndex")
+
+	s := &Index{
+		eIndex: eIndex,
+		gIndex: gIndex,
+		l:      l,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s, nil
+}
+
+func openDiskIndex(p string, m mapping.IndexMapping, l hclog.Logger) (bleve.Index, error) {
+	idx, err := bleve.Open(p)
+	switch {
+	case err == nil:
+		v, _ := idx.GetInternal(indexVersionKey)
+		if string(v) == indexVersion {
+			return idx, nil
+		}
+		l.Info("Search index is from a different version and will be rebuilt", "path", p)
+		idx.Close()
+	case err == bleve.ErrorIndexPathDoesNotExist:
+		l.Info("Creating search index", "path", p)
+	default:
+		l.Warn("Search index could not be opened and will be rebuilt", "path", p, "error", err)
+	}
+	if err := os.RemoveAll(p); err != nil {
+		return nil, err
+	}
+
+	idx, err = bleve.New(p, m)
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.SetInternal(indexVersionKey, []byte(indexVersion)); err != nil {
+		idx.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+// entityMapping returns the mapping for entities, which turns off
+// certain sub keys that shouldn't be indexed.  KV data is only
+// indexed through the kv field so that keys that aren't meant to be
+// searched stay out of the index.
+func entityMapping() mapping.IndexMapping {
+	eMapping := bleve.NewIndexMapping()
+	eDocMap := bleve.NewDocumentMapping()
+	eDocMap.AddSubDocumentMapping("secret", bleve.NewDocumentDisabledMapping())
+	// Mappings are looked up one path element at a time, so the
+	// fields of the metadata have to be turned off in a mapping
+	// of their own.
+	eMetaMap := bleve.NewDocumentMapping()
+	eMetaMap.AddSubDocumentMapping("Keys", bleve.NewDocumentDisabledMapping())
+	eMetaMap.AddSubDocumentMapping("UntypedMeta", bleve.NewDocumentDisabledMapping())
+	eMetaMap.AddSubDocumentMapping("KV", bleve.NewDocumentDisabledMapping())
+	eDocMap.AddSubDocumentMapping("meta", eMetaMap)
+	eDocMap.AddSubDocumentMapping("kv", kvMapping())
+	eMapping.AddDocumentMapping("_default", eDocMap)
+	return eMapping
+}
+
+// groupMapping returns the mapping for groups, which turns off
+// certain sub keys that shouldn't be indexed.
+func groupMapping() mapping.IndexMapping {
+	gMapping := bleve.NewIndexMapping()
+	gDocMap := bleve.NewDocumentMapping()
+	gDocMap.AddSubDocumentMapping("untypedmeta", bleve.NewDocumentDisabledMapping())
+	gDocMap.AddSubDocumentMapping("KV", bleve.NewDocumentDisabledMapping())
+	gDocMap.AddSubDocumentMapping("kv", kvMapping())
+	gMapping.AddDocumentMapping("_default", gDocMap)
+	return gMapping
+}
+
+// kvMapping indexes each KV value as a single term, since values
+// are opaque and are searched for as a whole.
+func kvMapping() *mapping.DocumentMapping {
+	m := bleve.NewDocumentMapping()
+	m.DefaultAnalyzer = keyword.Name
+	return m
+}
+
+// Close closes both indexes.  An on-disk index must be closed before
+// another process can open it.
+func (s *Index) Close() error {
+	eErr := s.eIndex.Close()
+	if err := s.gIndex.Close(); err != nil {
+		return err
+	}
+	return eErr
 }
 
 // ConfigureCallback is used to set the references to the loaders
@@ -80,6 +236,10 @@ func (s *Index) IndexCallback(e Event) {
 		return
 	}
 
+	if e.Preload && s.current {
+		return
+	}
+
 	switch e.Type {
 	case EventEntityCreate:
 		fallthrough
@@ -91,7 +251,7 @@ func (s *Index) IndexCallback(e Event) {
 		}
 		s.IndexEntity(ent)
 	case EventEntityDestroy:
-		s.eIndex.Delete(e.PK)
+		s.remove(s.eIndex, e.PK)
 	case EventGroupCreate:
 		fallthrough
 	case EventGroupUpdate:
@@ -102,78 +262,294 @@ func (s *Index) IndexCallback(e Event) {
 		}
 		s.IndexGroup(grp)
 	case EventGroupDestroy:
-		s.gIndex.Delete(e.PK)
+		s.remove(s.gIndex, e.PK)
 	}
 }
 
 // SearchEntities searches the index for entities matching the
 // qualities specified in the request.
-func (s *Index) SearchEntities(r SearchRequest) ([]string, error) {
-	if r.Expression == "" {
-		return nil, ErrBadSearch
-	}
-
-	req := createSearchRequest(r)
-
-	// This can only fail if the query is malformed, since the
-	// worst that can happen is the query is empty, this can't
-	// return an error.
-	result, _ := s.eIndex.Search(req)
-	slice := extractDocIDs(result)
-	return slice, nil
+func (s *Index) SearchEntities(r SearchRequest) ([]string, SearchResult, error) {
+	return search(s.eIndex, r)
 }
 
 // SearchGroups searches the index for groups matching the qualities
 // specified in the request.
-func (s *Index) SearchGroups(r SearchRequest) ([]string, error) {
-	if r.Expression == "" {
-		return nil, ErrBadSearch
-	}
-
-	req := createSearchRequest(r)
-
-	// This can only fail if the query is malformed, since the
-	// worst that can happen is the query is empty, this can't
-	// return an error.
-	result, _ := s.gIndex.Search(req)
-	slice := extractDocIDs(result)
-	return slice, nil
+func (s *Index) SearchGroups(r SearchRequest) ([]string, SearchResult, error) {
+	return search(s.gIndex, r)
 }
 
 // IndexEntity adds or updates an entity in the index.
 func (s *Index) IndexEntity(e *pb.Entity) error {
 	s.l.Trace("Indexing Entity", "entity", e.GetID())
-	return s.eIndex.Index(e.GetID(), e)
+	doc := entityDocument{Entity: e, KV: s.indexedKV(e.GetMeta().GetKV())}
+	return s.index(s.eIndex, e.GetID(), e, doc)
 }
 
 // DeleteEntity removes an entity from the index
 func (s *Index) DeleteEntity(e *pb.Entity) error {
 	s.l.Trace("Removing Entity", "entity", e.GetID())
-	return s.eIndex.Delete(e.GetID())
+	return s.remove(s.eIndex, e.GetID())
 }
 
 // IndexGroup adds or updates a group in the index.
 func (s *Index) IndexGroup(g *pb.Group) error {
 	s.l.Trace("Indexing Group", "group", g.GetName())
-	return s.gIndex.Index(g.GetName(), g)
+	doc := groupDocument{Group: g, KV: s.indexedKV(g.GetKV())}
+	return s.index(s.gIndex, g.GetName(), g, doc)
 }
 
 // DeleteGroup removes a group from the index.
 func (s *Index) DeleteGroup(g *pb.Group) error {
 	s.l.Trace("Removing Group", "group", g.GetName())
-	return s.gIndex.Delete(g.GetName())
+	return s.remove(s.gIndex, g.GetName())
+}
+
+// Prune removes every entity and group from the index that isn't
+// named in entities or groups.  This catches objects that were
+// removed while an on-disk index wasn't being kept up to date.
+func (s *Index) Prune(entities, groups []string) error {
+	if err := s.prune(s.eIndex, entities); err != nil {
+		return err
+	}
+	return s.prune(s.gIndex, groups)
+}
+
+// CatchUp brings an on-disk index up to date by reindexing only the
+// entities and groups that the journal shows have changed since the
+// index was last marked with MarkJournal.  It reports false, leaving
+// the index to be rebuilt from every object, if the index was never
+// marked or the journal no longer reaches back that far.
+func (s *Index) CatchUp(ctx context.Context, j *Journal) (bool, error) {
+	b, err := s.eIndex.GetInternal(journalSeqKey)
+	if err != nil || b == nil {
+		return false, err
+	}
+	seq, err := strconv.ParseUint(string(b), 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	if g, _ := s.gIndex.GetInternal(journalSeqKey); string(g) != string(b) {
+		return false, nil
+	}
+
+	entries, err := j.Range(seq, 0)
+	if err != nil {
+		return false, err
+	}
+	// The entry the index was marked at must still be there, or
+	// changes may have been pruned away before they were seen.
+	switch {
+	case seq == 0 && (len(entries) == 0 || entries[0].Seq == 1):
+	case seq > 0 && len(entries) > 0 && entries[0].Seq == seq:
+		entries = entries[1:]
+	default:
+		return false, nil
+	}
+
+	changed := make(map[string]struct{})
+	keys := []string{}
+	for _, e := range entries {
+		if _, ok := changed[e.Key]; !ok {
+			changed[e.Key] = struct{}{}
+			keys = append(keys, e.Key)
+		}
+	}
+	for _, k := range keys {
+		if err := s.reindex(ctx, k); err != nil {
+			return false, err
+		}
+	}
+	s.l.Info("Search index brought up to date from the journal", "changes", len(entries), "objects", len(keys))
+
+	if err := s.MarkJournal(j.Seq()); err != nil {
+		return false, err
+	}
+	s.current = true
+	return true, nil
+}
+
+// MarkJournal records that the index includes every change in the
+// journal up to and including seq.
+func (s *Index) MarkJournal(seq uint64) error {
+	v := []byte(strconv.FormatUint(seq, 10))
+	if err := s.eIndex.SetInternal(journalSeqKey, v); err != nil {
+		return err
+	}
+	return s.gIndex.SetInternal(journalSeqKey, v)
+}
+
+// reindex updates the document for the object stored at the KV key
+// k, removing it if the object no longer exists.  Keys that aren't
+// entities or groups are ignored.
+func (s *Index) reindex(ctx context.Context, k string) error {
+	id := path.Base(k)
+	switch path.Dir(k) {
+	case "/entities":
+		e, err := s.eLoader(ctx, id)
+		switch err {
+		case nil:
+			return s.IndexEntity(e)
+		case ErrUnknownEntity:
+			return s.remove(s.eIndex, id)
+		default:
+			return err
+		}
+	case "/groups":
+		g, err := s.gLoader(ctx, id)
+		switch err {
+		case nil:
+			return s.IndexGroup(g)
+		case ErrUnknownGroup:
+			return s.remove(s.gIndex, id)
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// indexedKV returns the values of the KV keys that may be indexed.
+func (s *Index) indexedKV(kv []*pb.KVData) map[string][]string {
+	var out map[string][]string
+	for _, d := range kv {
+		if !s.kvIndexed(d.GetKey()) {
+			continue
+		}
+		if out == nil {
+			out = make(map[string][]string)
+		}
+		for _, v := range d.GetValues() {
+			out[d.GetKey()] = append(out[d.GetKey()], v.GetValue())
+		}
+	}
+	return out
+}
+
+func (s *Index) kvIndexed(key string) bool {
+	for _, p := range s.kvKeys {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// index stores the document made from m along with the revision of
+// m, and does nothing if the document is already at that revision.
+// The KV keys that are indexed are part of the revision so that
+// changing them reindexes everything.
+func (s *Index) index(idx bleve.Index, id string, m proto.Message, doc interface{}) error {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return err
+	}
+	for _, p := range s.kvKeys {
+		b = append(append(b, 0), p...)
+	}
+	rev := []byte(Revision(b))
+	if old, err := idx.GetInternal(revisionKey(id)); err == nil && bytes.Equal(old, rev) {
+		return nil
+	}
+
+	batch := idx.NewBatch()
+	if err := batch.Index(id, doc); err != nil {
+		return err
+	}
+	batch.SetInternal(revisionKey(id), rev)
+	return idx.Batch(batch)
+}
+
+func (s *Index) remove(idx bleve.Index, id string) error {
+	batch := idx.NewBatch()
+	batch.Delete(id)
+	batch.DeleteInternal(revisionKey(id))
+	return idx.Batch(batch)
+}
+
+func (s *Index) prune(idx bleve.Index, keep []string) error {
+	n, err := idx.DocCount()
+	if err != nil || n == 0 {
+		return err
+	}
+	res, err := idx.Search(bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), int(n), 0, false))
+	if err != nil {
+		return err
+	}
+
+	want := make(map[string]struct{}, len(keep))
+	for _, id := range keep {
+		want[id] = struct{}{}
+	}
+	for _, id := range extractDocIDs(res) {
+		if _, ok := want[id]; ok {
+			continue
+		}
+		s.l.Debug("Pruning from index", "index", idx.Name(), "id", id)
+		if err := s.remove(idx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func revisionKey(id string) []byte {
+	return []byte("netauth/revision/" + id)
+}
+
+func search(idx bleve.Index, r SearchRequest) ([]string, SearchResult, error) {
+	if r.Expression == "" || r.PageSize < 0 {
+		return nil, SearchResult{}, ErrBadSearch
+	}
+	req, err := createSearchRequest(idx, r)
+	if err != nil {
+		return nil, SearchResult{}, err
+	}
+
+	// This can only fail if the query is malformed, since the
+	// worst that can happen is the query is empty, this can't
+	// return an error.
+	result, _ := idx.Search(req)
+	ids := extractDocIDs(result)
+	if result == nil {
+		return ids, SearchResult{}, nil
+	}
+
+	res := SearchResult{Total: result.Total}
+	if next := req.From + len(ids); len(ids) > 0 && uint64(next) < result.Total {
+		res.NextPageToken = strconv.Itoa(next)
+	}
+	return ids, res, nil
 }
 
 // createSearchRequest is a helper function which converts between a
-// db.SearchRequest and a bleve.SearchRequest.
-func createSearchRequest(r SearchRequest) *bleve.SearchRequest {
-	q := bleve.NewQueryStringQuery(r.Expression)
-
-	// This will bite someone someday, by creating a near
-	// impossible to reason about bug where the entities returned
-	// in a search keep changing, but today is not that day.
-	sr := bleve.NewSearchRequestOptions(q, 16000, 0, false)
-	return sr
+// db.SearchRequest and a bleve.SearchRequest.  The page token is the
+// offset of the first result in the page.
+func createSearchRequest(idx bleve.Index, r SearchRequest) (*bleve.SearchRequest, error) {
+	from := 0
+	if r.PageToken != "" {
+		var err error
+		from, err = strconv.Atoi(r.PageToken)
+		if err != nil || from < 0 {
+			return nil, ErrBadSearch
+		}
+	}
+
+	size := r.PageSize
+	if size == 0 {
+		n, err := idx.DocCount()
+		if err != nil {
+			return nil, err
+		}
+		size = int(n)
+	}
+
+	sr := bleve.NewSearchRequestOptions(bleve.NewQueryStringQuery(r.Expression), size, from, false)
+	order := append([]string{}, r.Sort...)
+	if len(order) == 0 || (order[len(order)-1] != "_id" && order[len(order)-1] != "-_id") {
+		order = append(order, "_id")
+	}
+	sr.SortBy(order)
+	return sr, nil
 }
 
 // extractDocIDs converts between a bleve.SearchResult and a []string
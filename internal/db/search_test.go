@@ -2,9 +2,11 @@ package db
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
 	"google.golang.org/protobuf/proto"
 
 	pb "github.com/netauth/protocol"
@@ -54,7 +56,7 @@ func TestIndexCallbackEntity(t *testing.T) {
 	si.ConfigureCallback(dummyEntityLoader, dummyGroupLoader)
 
 	// Check that the entity isn't present
-	r, err := si.SearchEntities(SearchRequest{Expression: "ID:entity1"})
+	r, _, err := si.SearchEntities(SearchRequest{Expression: "ID:entity1"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -66,7 +68,7 @@ func TestIndexCallbackEntity(t *testing.T) {
 	si.IndexCallback(Event{Type: EventEntityCreate, PK: "entity1"})
 
 	// Check for entity being present in results
-	r, err = si.SearchEntities(SearchRequest{Expression: "ID:entity1"})
+	r, _, err = si.SearchEntities(SearchRequest{Expression: "ID:entity1"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -81,7 +83,7 @@ func TestIndexCallbackEntity(t *testing.T) {
 
 	// Fire a "delete" and make sure the entity drops out of the search results
 	si.IndexCallback(Event{Type: EventEntityDestroy, PK: "entity1"})
-	r, err = si.SearchEntities(SearchRequest{Expression: "ID:entity1"})
+	r, _, err = si.SearchEntities(SearchRequest{Expression: "ID:entity1"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -95,7 +97,7 @@ func TestIndexCallbackGroup(t *testing.T) {
 	si.ConfigureCallback(dummyEntityLoader, dummyGroupLoader)
 
 	// Check that the group isn't present
-	r, err := si.SearchGroups(SearchRequest{Expression: "Name:group1"})
+	r, _, err := si.SearchGroups(SearchRequest{Expression: "Name:group1"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -107,7 +109,7 @@ func TestIndexCallbackGroup(t *testing.T) {
 	si.IndexCallback(Event{Type: EventGroupCreate, PK: "group1"})
 
 	// Check for group being present in results
-	r, err = si.SearchGroups(SearchRequest{Expression: "Name:group1"})
+	r, _, err = si.SearchGroups(SearchRequest{Expression: "Name:group1"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -122,7 +124,7 @@ func TestIndexCallbackGroup(t *testing.T) {
 
 	// Fire a "delete" and make sure the group drops out of the search results
 	si.IndexCallback(Event{Type: EventGroupDestroy, PK: "group1"})
-	r, err = si.SearchGroups(SearchRequest{Expression: "Name:group1"})
+	r, _, err = si.SearchGroups(SearchRequest{Expression: "Name:group1"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -168,7 +170,7 @@ func TestSearchEntities(t *testing.T) {
 	}
 
 	// Check to make sure secrets didn't get indexed
-	r, err := si.SearchEntities(SearchRequest{Expression: "secret"})
+	r, _, err := si.SearchEntities(SearchRequest{Expression: "secret"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -178,7 +180,7 @@ func TestSearchEntities(t *testing.T) {
 
 	// Run a test search and make sure there are the right number
 	// of answers in it
-	r, err = si.SearchEntities(SearchRequest{Expression: "meta.Shell:korn"})
+	r, _, err = si.SearchEntities(SearchRequest{Expression: "meta.Shell:korn"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -192,7 +194,7 @@ func TestSearchEntities(t *testing.T) {
 	if err := si.DeleteEntity(&entities[1]); err != nil {
 		t.Error(err)
 	}
-	r, err = si.SearchEntities(SearchRequest{Expression: "meta.Shell:fish"})
+	r, _, err = si.SearchEntities(SearchRequest{Expression: "meta.Shell:fish"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -206,7 +208,7 @@ func TestSearchEntities(t *testing.T) {
 func TestSearchEntitiesBadRequest(t *testing.T) {
 	si := NewIndex(hclog.NewNullLogger())
 
-	r, err := si.SearchEntities(SearchRequest{})
+	r, _, err := si.SearchEntities(SearchRequest{})
 	if err != ErrBadSearch || r != nil {
 		t.Error(err)
 	}
@@ -239,7 +241,7 @@ func TestSearchGroups(t *testing.T) {
 		}
 	}
 	// Check to make sure UEM wasn't indexed
-	r, err := si.SearchGroups(SearchRequest{Expression: "UEM"})
+	r, _, err := si.SearchGroups(SearchRequest{Expression: "UEM"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -249,7 +251,7 @@ func TestSearchGroups(t *testing.T) {
 
 	// Check a search to make sure its got the right amount of
 	// stuff in it.
-	r, err = si.SearchGroups(SearchRequest{Expression: "DisplayName:Group"})
+	r, _, err = si.SearchGroups(SearchRequest{Expression: "DisplayName:Group"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -263,7 +265,7 @@ func TestSearchGroups(t *testing.T) {
 	if err := si.DeleteGroup(&groups[2]); err != nil {
 		t.Fatal(err)
 	}
-	r, err = si.SearchGroups(SearchRequest{Expression: "DisplayName:match"})
+	r, _, err = si.SearchGroups(SearchRequest{Expression: "DisplayName:match"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -276,7 +278,7 @@ func TestSearchGroups(t *testing.T) {
 func TestSearchGroupsBadRequest(t *testing.T) {
 	si := NewIndex(hclog.NewNullLogger())
 
-	r, err := si.SearchGroups(SearchRequest{})
+	r, _, err := si.SearchGroups(SearchRequest{})
 	if err != ErrBadSearch || r != nil {
 		t.Error(err)
 	}
@@ -287,3 +289,225 @@ func TestExtractDocIDsNullResult(t *testing.T) {
 		t.Error("Got a non-nil response from a nil result")
 	}
 }
+
+func TestOpenIndexPersists(t *testing.T) {
+	dir := t.TempDir()
+	si, err := OpenIndex(dir, hclog.NewNullLogger())
+	assert.Nil(t, err)
+	assert.Nil(t, si.IndexEntity(&pb.Entity{ID: proto.String("entity1")}))
+	assert.Nil(t, si.IndexGroup(&pb.Group{Name: proto.String("group1")}))
+	assert.Nil(t, si.Close())
+
+	si, err = OpenIndex(dir, hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer si.Close()
+	r, _, err := si.SearchEntities(SearchRequest{Expression: "ID:entity1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"entity1"}, r)
+	r, _, err = si.SearchGroups(SearchRequest{Expression: "Name:group1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"group1"}, r)
+}
+
+func TestOpenIndexVersion(t *testing.T) {
+	dir := t.TempDir()
+	si, err := OpenIndex(dir, hclog.NewNullLogger())
+	assert.Nil(t, err)
+	assert.Nil(t, si.IndexEntity(&pb.Entity{ID: proto.String("entity1")}))
+	assert.Nil(t, si.eIndex.SetInternal(indexVersionKey, []byte("0")))
+	assert.Nil(t, si.Close())
+
+	// An index from another version is rebuilt from scratch.
+	si, err = OpenIndex(dir, hclog.NewNullLogger())
+	assert.Nil(t, err)
+	defer si.Close()
+	r, _, err := si.SearchEntities(SearchRequest{Expression: "ID:entity1"})
+	assert.Nil(t, err)
+	assert.Empty(t, r)
+}
+
+func TestIndexSkipsUnchanged(t *testing.T) {
+	si := NewIndex(hclog.NewNullLogger())
+
+	e := &pb.Entity{ID: proto.String("entity1"), Meta: &pb.EntityMeta{Shell: proto.String("/bin/korn")}}
+	assert.Nil(t, si.IndexEntity(e))
+
+	// Pretend that the index already has the changed entity, in
+	// which case it is not indexed again.
+	changed := &pb.Entity{ID: proto.String("entity1"), Meta: &pb.EntityMeta{Shell: proto.String("/bin/fish")}}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(changed)
+	assert.Nil(t, err)
+	assert.Nil(t, si.eIndex.SetInternal(revisionKey("entity1"), []byte(Revision(b))))
+	assert.Nil(t, si.IndexEntity(changed))
+	r, _, err := si.SearchEntities(SearchRequest{Expression: "meta.Shell:fish"})
+	assert.Nil(t, err)
+	assert.Empty(t, r)
+
+	// Removing the entity forgets its revision.
+	assert.Nil(t, si.DeleteEntity(e))
+	assert.Nil(t, si.IndexEntity(changed))
+	r, _, err = si.SearchEntities(SearchRequest{Expression: "meta.Shell:fish"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"entity1"}, r)
+}
+
+func TestPrune(t *testing.T) {
+	si := NewIndex(hclog.NewNullLogger())
+	for _, id := range []string{"entity1", "entity2"} {
+		assert.Nil(t, si.IndexEntity(&pb.Entity{ID: proto.String(id)}))
+	}
+	for _, name := range []string{"group1", "group2"} {
+		assert.Nil(t, si.IndexGroup(&pb.Group{Name: proto.String(name)}))
+	}
+
+	assert.Nil(t, si.Prune([]string{"entity2"}, nil))
+
+	r, _, err := si.SearchEntities(SearchRequest{Expression: "ID:entity1 ID:entity2"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"entity2"}, r)
+	r, _, err = si.SearchGroups(SearchRequest{Expression: "Name:group1 Name:group2"})
+	assert.Nil(t, err)
+	assert.Empty(t, r)
+	v, err := si.gIndex.GetInternal(revisionKey("group1"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
+
+func TestSearchPaging(t *testing.T) {
+	si := NewIndex(hclog.NewNullLogger())
+	for i, id := range []string{"entity3", "entity1", "entity5", "entity2", "entity4"} {
+		assert.Nil(t, si.IndexEntity(&pb.Entity{ID: proto.String(id), Number: proto.Int32(int32(10 - i))}))
+	}
+
+	var all []string
+	req := SearchRequest{Expression: "ID:entity*", PageSize: 2}
+	for pages := 0; ; pages++ {
+		r, res, err := si.SearchEntities(req)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(5), res.Total)
+		all = append(all, r...)
+		if res.NextPageToken == "" {
+			assert.Equal(t, 2, pages)
+			break
+		}
+		req.PageToken = res.NextPageToken
+	}
+	assert.Equal(t, []string{"entity1", "entity2", "entity3", "entity4", "entity5"}, all)
+
+	r, res, err := si.SearchEntities(SearchRequest{Expression: "ID:entity*", Sort: []string{"-Number"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"entity3", "entity1", "entity5", "entity2", "entity4"}, r)
+	assert.Equal(t, "", res.NextPageToken)
+
+	_, _, err = si.SearchEntities(SearchRequest{Expression: "ID:entity*", PageToken: "bogus"})
+	assert.Equal(t, ErrBadSearch, err)
+	_, _, err = si.SearchGroups(SearchRequest{Expression: "Name:group*", PageSize: -1})
+	assert.Equal(t, ErrBadSearch, err)
+}
+
+func TestSearchKV(t *testing.T) {
+	si := NewIndex(hclog.NewNullLogger(), IndexKV("department", "site-*"))
+
+	kv := func(k, v string) *pb.KVData {
+		return &pb.KVData{Key: proto.String(k), Values: []*pb.KVValue{{Value: proto.String(v)}}}
+	}
+	assert.Nil(t, si.IndexEntity(&pb.Entity{ID: proto.String("entity1"), Meta: &pb.EntityMeta{
+		KV: []*pb.KVData{kv("department", "infra"), kv("recovery", "hunter2")},
+	}}))
+	assert.Nil(t, si.IndexEntity(&pb.Entity{ID: proto.String("entity2"), Meta: &pb.EntityMeta{
+		KV: []*pb.KVData{kv("department", "infra-ops"), kv("site-code", "ams1")},
+	}}))
+	assert.Nil(t, si.IndexGroup(&pb.Group{Name: proto.String("group1"), KV: []*pb.KVData{kv("department", "infra")}}))
+
+	cases := []struct {
+		expr string
+		want []string
+	}{
+		{"kv.department:infra", []string{"entity1"}},
+		{"kv.department:infra*", []string{"entity1", "entity2"}},
+		{"kv.site-code:ams1", []string{"entity2"}},
+		{"kv.recovery:hunter2", []string{}},
+		{"hunter2", []string{}},
+		{"meta.KV.Values.Value:infra", []string{}},
+	}
+	for _, c := range cases {
+		r, _, err := si.SearchEntities(SearchRequest{Expression: c.expr})
+		assert.Nil(t, err)
+		assert.Equal(t, c.want, r, c.expr)
+	}
+
+	r, _, err := si.SearchGroups(SearchRequest{Expression: "kv.department:infra"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"group1"}, r)
+}
+
+func TestSearchKVReindex(t *testing.T) {
+	dir := t.TempDir()
+	e := &pb.Entity{ID: proto.String("entity1"), Meta: &pb.EntityMeta{
+		KV: []*pb.KVData{{Key: proto.String("department"), Values: []*pb.KVValue{{Value: proto.String("infra")}}}},
+	}}
+
+	si, err := OpenIndex(dir, hclog.NewNullLogger())
+	assert.Nil(t, err)
+	assert.Nil(t, si.IndexEntity(e))
+	assert.Nil(t, si.Close())
+
+	// Indexing more keys reindexes objects that are otherwise
+	// unchanged.
+	si, err = OpenIndex(dir, hclog.NewNullLogger(), IndexKV("*"))
+	assert.Nil(t, err)
+	defer si.Close()
+	assert.Nil(t, si.IndexEntity(e))
+	r, _, err := si.SearchEntities(SearchRequest{Expression: "kv.department:infra"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"entity1"}, r)
+}
+
+func TestIndexCatchUp(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	jpath := filepath.Join(dir, "journal.log")
+	kv := &mapKV{m: make(map[string][]byte)}
+	reopen := func(opts ...Option) *DB {
+		j, err := OpenJournal(jpath)
+		assert.Nil(t, err)
+		m, err := open(kv, append(opts, WithJournal(j))...)
+		assert.Nil(t, err)
+		return m
+	}
+
+	// The first start indexes everything and marks the index.
+	m := reopen(WithIndexDir(dir))
+	assert.Nil(t, m.SaveEntity(ctx, &pb.Entity{ID: proto.String("entity1"), Meta: &pb.EntityMeta{Shell: proto.String("/bin/korn")}}))
+	assert.Nil(t, m.SaveGroup(ctx, &pb.Group{Name: proto.String("group1")}))
+	assert.Nil(t, m.EventUpdateAll())
+	m.Shutdown()
+
+	// Changes are made without the index, and one is made behind
+	// the journal's back so that a full reindex would show it.
+	m = reopen()
+	assert.Nil(t, m.SaveEntity(ctx, &pb.Entity{ID: proto.String("entity2")}))
+	assert.Nil(t, m.DeleteGroup(ctx, "group1"))
+	m.Shutdown()
+	kv.m["/entities/entity1"], _ = proto.Marshal(&pb.Entity{ID: proto.String("entity1"), Meta: &pb.EntityMeta{Shell: proto.String("/bin/fish")}})
+
+	m = reopen(WithIndexDir(dir))
+	assert.Nil(t, m.EventUpdateAll())
+	r, _, err := m.Index.SearchEntities(SearchRequest{Expression: "ID:entity*"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"entity1", "entity2"}, r)
+	r, _, err = m.Index.SearchEntities(SearchRequest{Expression: "meta.Shell:korn"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"entity1"}, r)
+	r, _, err = m.Index.SearchGroups(SearchRequest{Expression: "Name:group1"})
+	assert.Nil(t, err)
+	assert.Empty(t, r)
+
+	// A mark that the journal doesn't reach back to means the
+	// index has to be rebuilt.
+	assert.Nil(t, m.Index.MarkJournal(99))
+	ok, err := m.Index.CatchUp(ctx, m.journal)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	m.Shutdown()
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+// The secured secrets that each entity has had are kept in the DB's
+// own part of the keyspace so that old secrets can be refused when a
+// new one is set.  The key of an entity's secrets is the prefix
+// followed by its ID.
+const SecretHistoryPrefix = MetaPrefix + "secrets-entity:"
+
+// WithSecretHistory keeps the last depth secrets of every entity,
+// including the one it has now.  A depth of 0 keeps none.
+func WithSecretHistory(depth int) Option { return func(db *DB) { db.secretDepth = depth } }
+
+// SecretHistory returns the secured secrets that an entity has had,
+// most recent first.  Only secrets that were set since the history
+// was enabled are known.
+func (db *DB) SecretHistory(ctx context.Context, ID string) ([]string, error) {
+	return db.loadSecrets(ctx, SecretHistoryPrefix+ID)
+}
+
+// withSecretHistory returns ops along with the writes needed to
+// record the new secrets of the entities that they save.  The caller
+// must hold wmu.
+func (db *DB) withSecretHistory(ctx context.Context, ops []KVOp) ([]KVOp, error) {
+	if db.secretDepth <= 0 {
+		return ops, nil
+	}
+
+	out := append([]KVOp{}, ops...)
+	for _, op := range ops {
+		if op.Delete || !strings.HasPrefix(op.Key, "/entities/") {
+			continue
+		}
+		e := &types.Entity{}
+		if err := proto.Unmarshal(op.Value, e); err != nil {
+			return nil, ErrInternalError
+		}
+		if e.GetSecret() == "" {
+			continue
+		}
+		sk := SecretHistoryPrefix + strings.TrimPrefix(op.Key, "/entities/")
+		s, err := db.loadSecrets(ctx, sk)
+		if err != nil {
+			return nil, err
+		}
+		if len(s) > 0 && s[0] == e.GetSecret() {
+			continue
+		}
+		s = append([]string{e.GetSecret()}, s...)
+		if len(s) > db.secretDepth {
+			s = s[:db.secretDepth]
+		}
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+			return nil, ErrInternalError
+		}
+		out = append(out, KVOp{Key: sk, Value: buf.Bytes()})
+	}
+	return out, nil
+}
+
+func (db *DB) loadSecrets(ctx context.Context, k string) ([]string, error) {
+	b, err := db.kv.Get(ctx, k)
+	if err == ErrNoValue {
+		return nil, nil
+	}
+	if err != nil {
+		db.log.Warn("Error loading secret history", "key", k, "error", err)
+		return nil, ErrInternalError
+	}
+	var s []string
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&s); err != nil {
+		db.log.Warn("Error decoding secret history", "key", k, "error", err)
+		return nil, ErrInternalError
+	}
+	return s, nil
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+func TestSecretHistory(t *testing.T) {
+	RegisterKV("map", newMapKV)
+	m, err := New("map", WithSecretHistory(2))
+	assert.Nil(t, err)
+	ctx := context.Background()
+	kv := m.kv.(*mapKV)
+
+	e := &types.Entity{ID: proto.String("foo"), Number: proto.Int32(1)}
+	assert.Nil(t, m.SaveEntity(ctx, e))
+	s, err := m.SecretHistory(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Empty(t, s)
+
+	e.Secret = proto.String("one")
+	assert.Nil(t, m.SaveEntity(ctx, e))
+	// Saving the entity without changing the secret doesn't
+	// record it again.
+	e.Meta = &types.EntityMeta{Shell: proto.String("/bin/sh")}
+	assert.Nil(t, m.SaveEntity(ctx, e))
+	s, err = m.SecretHistory(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one"}, s)
+
+	for _, secret := range []string{"two", "three"} {
+		e.Secret = proto.String(secret)
+		assert.Nil(t, m.Batch(ctx, func(b *Batch) error {
+			b.SaveEntity(e)
+			return nil
+		}))
+	}
+	s, err = m.SecretHistory(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"three", "two"}, s)
+
+	assert.Nil(t, m.TombstoneEntity(ctx, "foo"))
+	n, err := m.PurgeTombstones(ctx, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	_, ok := kv.m[SecretHistoryPrefix+"foo"]
+	assert.False(t, ok, "secrets were kept after purge")
+}
@@ -0,0 +1,276 @@
+// Package snapshot reads and writes portable backups of a KVStore.
+// A snapshot is a single file holding every entity and group along
+// with a checksum, so that a backup can be verified before it is
+// restored, and restored into any backend regardless of the one it
+// was taken from.
+//
+// The format is:
+//
+//	magic | version | created | entries... | end | sha256
+//
+// The magic is the 16 bytes "NETAUTH SNAPSHOT", the version is a
+// big-endian uint32 and created is a big-endian int64 of Unix
+// seconds.  Each entry is a uvarint length and the key, followed by a
+// uvarint length and the value.  The entries end with a zero length
+// key, and the sha256 covers everything that comes before it.
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/netauth/netauth/internal/db"
+)
+
+const (
+	magic = "NETAUTH SNAPSHOT"
+
+	// Version is the version of the format written by Write.
+	Version = 1
+
+	// maxLength bounds the length of keys and values so that a
+	// damaged length can't exhaust memory before the checksum is
+	// checked.
+	maxLength = 64 << 20
+)
+
+var (
+	// ErrBadMagic is returned when the file is not a snapshot.
+	ErrBadMagic = errors.New("not a snapshot")
+
+	// ErrBadVersion is returned for snapshots written by a newer
+	// version of NetAuth.
+	ErrBadVersion = errors.New("unsupported snapshot version")
+
+	// ErrBadChecksum is returned when the contents of the
+	// snapshot don't match its checksum.
+	ErrBadChecksum = errors.New("snapshot checksum does not match")
+
+	// ErrTruncated is returned when the snapshot ends early.
+	ErrTruncated = errors.New("snapshot is truncated")
+
+	// ErrMalformed is returned when the snapshot matches its
+	// checksum but its entries can't be decoded.
+	ErrMalformed = errors.New("snapshot is malformed")
+)
+
+// prefixes are the parts of the keyspace that are included in a
+// snapshot.
+var prefixes = []string{"/entities/*", "/groups/*"}
+
+// An Entry is a single key and its value.
+type Entry struct {
+	Key   string
+	Value []byte
+}
+
+// A Snapshot is the decoded contents of a snapshot file.
+type Snapshot struct {
+	Version int
+	Created time.Time
+	Entries []Entry
+}
+
+// Write writes a snapshot of every entity and group in kv to w, and
+// returns the number of entries written.  Keys that are removed while
+// the snapshot is being taken are skipped.
+func Write(ctx context.Context, w io.Writer, kv db.KVStore) (int, error) {
+	var keys []string
+	for _, p := range prefixes {
+		k, err := kv.Keys(ctx, p)
+		if err != nil {
+			return 0, err
+		}
+		keys = append(keys, k...)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	bw := bufio.NewWriter(io.MultiWriter(w, h))
+
+	hdr := make([]byte, 12)
+	binary.BigEndian.PutUint32(hdr[0:], Version)
+	binary.BigEndian.PutUint64(hdr[4:], uint64(time.Now().Unix()))
+	bw.WriteString(magic)
+	bw.Write(hdr)
+
+	n := 0
+	for _, k := range keys {
+		v, err := kv.Get(ctx, k)
+		if err == db.ErrNoValue {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		writeBytes(bw, []byte(k))
+		writeBytes(bw, v)
+		n++
+	}
+	writeBytes(bw, nil)
+
+	if err := bw.Flush(); err != nil {
+		return n, err
+	}
+	_, err := w.Write(h.Sum(nil))
+	return n, err
+}
+
+func writeBytes(w *bufio.Writer, b []byte) {
+	l := make([]byte, binary.MaxVarintLen64)
+	w.Write(l[:binary.PutUvarint(l, uint64(len(b)))])
+	w.Write(b)
+}
+
+// Read decodes a snapshot and checks its checksum.  Nothing is
+// returned unless the whole snapshot is intact.
+func Read(r io.Reader) (*Snapshot, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < len(magic) || string(b[:len(magic)]) != magic {
+		return nil, ErrBadMagic
+	}
+	if len(b) < len(magic)+12+1+sha256.Size {
+		return nil, ErrTruncated
+	}
+
+	body, sum := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	s := &Snapshot{
+		Version: int(binary.BigEndian.Uint32(body[len(magic):])),
+		Created: time.Unix(int64(binary.BigEndian.Uint64(body[len(magic)+4:])), 0),
+	}
+	if s.Version != Version {
+		return nil, ErrBadVersion
+	}
+	if got := sha256.Sum256(body); !bytes.Equal(got[:], sum) {
+		return nil, ErrBadChecksum
+	}
+
+	br := bytes.NewReader(body[len(magic)+12:])
+	for {
+		k, err := readBytes(br)
+		if err != nil {
+			return nil, err
+		}
+		if len(k) == 0 {
+			break
+		}
+		v, err := readBytes(br)
+		if err != nil {
+			return nil, err
+		}
+		s.Entries = append(s.Entries, Entry{Key: string(k), Value: v})
+	}
+	if br.Len() != 0 {
+		return nil, ErrMalformed
+	}
+	return s, nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil || l > maxLength || l > uint64(r.Len()) {
+		return nil, ErrMalformed
+	}
+	b := make([]byte, l)
+	r.Read(b)
+	return b, nil
+}
+
+// A Diff describes what restoring a snapshot would change.
+type Diff struct {
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+// Compare works out what restoring the snapshot into kv would change.
+// Removed lists the keys that only exist in kv, which are only
+// removed by a truncating restore.
+func Compare(ctx context.Context, s *Snapshot, kv db.KVStore) (Diff, error) {
+	d := Diff{}
+	have := make(map[string]struct{})
+	for _, e := range s.Entries {
+		have[e.Key] = struct{}{}
+		v, err := kv.Get(ctx, e.Key)
+		switch {
+		case err == db.ErrNoValue:
+			d.Added = append(d.Added, e.Key)
+		case err != nil:
+			return Diff{}, err
+		case !bytes.Equal(v, e.Value):
+			d.Changed = append(d.Changed, e.Key)
+		}
+	}
+
+	for _, p := range prefixes {
+		keys, err := kv.Keys(ctx, p)
+		if err != nil {
+			return Diff{}, err
+		}
+		for _, k := range keys {
+			if _, ok := have[k]; !ok {
+				d.Removed = append(d.Removed, k)
+			}
+		}
+	}
+	sort.Strings(d.Removed)
+	return d, nil
+}
+
+// Restore applies a Diff from Compare to kv, taking the values from
+// the snapshot.  Removed keys are only deleted if truncate is set.
+// When kv supports batches the restore is all-or-nothing.
+func Restore(ctx context.Context, s *Snapshot, kv db.KVStore, d Diff, truncate bool) error {
+	values := make(map[string][]byte, len(s.Entries))
+	for _, e := range s.Entries {
+		values[e.Key] = e.Value
+	}
+
+	var ops []db.KVOp
+	for _, k := range append(d.Added, d.Changed...) {
+		ops = append(ops, db.KVOp{Key: k, Value: values[k]})
+	}
+	if truncate {
+		for _, k := range d.Removed {
+			ops = append(ops, db.KVOp{Key: k, Delete: true})
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	if kvb, ok := kv.(db.KVBatcher); ok && hasBatch(kv.Capabilities()) {
+		return kvb.Batch(ctx, ops)
+	}
+	for _, op := range ops {
+		var err error
+		if op.Delete {
+			err = kv.Del(ctx, op.Key)
+		} else {
+			err = kv.Put(ctx, op.Key, op.Value)
+		}
+		if err != nil && err != db.ErrNoValue {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasBatch(caps []db.KVCapability) bool {
+	for _, c := range caps {
+		if c == db.KVBatch {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/db/memory"
+)
+
+func newKV(t *testing.T, data map[string]string) db.KVStore {
+	kv, err := memory.NewKV(hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.SetEventFunc(func(db.Event) {})
+	for k, v := range data {
+		kv.Put(context.Background(), k, []byte(v))
+	}
+	return kv
+}
+
+func newSnapshot(t *testing.T, data map[string]string) []byte {
+	var buf bytes.Buffer
+	if _, err := Write(context.Background(), &buf, newKV(t, data)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	kv := newKV(t, map[string]string{
+		"/entities/foo": "foo",
+		"/groups/bar":   "bar",
+		"/other/baz":    "baz",
+	})
+
+	var buf bytes.Buffer
+	n, err := Write(context.Background(), &buf, kv)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	s, err := Read(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, Version, s.Version)
+	assert.False(t, s.Created.IsZero())
+	assert.Equal(t, []Entry{
+		{Key: "/entities/foo", Value: []byte("foo")},
+		{Key: "/groups/bar", Value: []byte("bar")},
+	}, s.Entries)
+}
+
+func TestRoundTripEmpty(t *testing.T) {
+	s, err := Read(bytes.NewReader(newSnapshot(t, nil)))
+	assert.Nil(t, err)
+	assert.Len(t, s.Entries, 0)
+}
+
+func TestReadDamaged(t *testing.T) {
+	good := newSnapshot(t, map[string]string{"/entities/foo": "foo"})
+
+	flipped := append([]byte{}, good...)
+	flipped[len(flipped)-40] ^= 0xff
+
+	version := append([]byte{}, good...)
+	version[len(magic)+3] = 2
+
+	cases := []struct {
+		b       []byte
+		wantErr error
+	}{
+		{[]byte("not a snapshot at all"), ErrBadMagic},
+		{good[:len(magic)+4], ErrTruncated},
+		{good[:len(good)-1], ErrBadChecksum},
+		{flipped, ErrBadChecksum},
+		{version, ErrBadVersion},
+	}
+	for i, c := range cases {
+		_, err := Read(bytes.NewReader(c.b))
+		assert.Equal(t, c.wantErr, err, i)
+	}
+}
+
+type failingKV struct {
+	db.KVStore
+}
+
+func (failingKV) Keys(context.Context, string) ([]string, error) {
+	return nil, errors.New("disk on fire")
+}
+
+func TestWriteError(t *testing.T) {
+	_, err := Write(context.Background(), &bytes.Buffer{}, failingKV{newKV(t, nil)})
+	assert.NotNil(t, err)
+}
+
+func TestCompareRestore(t *testing.T) {
+	ctx := context.Background()
+	s, err := Read(bytes.NewReader(newSnapshot(t, map[string]string{
+		"/entities/foo": "foo",
+		"/entities/bar": "bar",
+		"/groups/baz":   "baz",
+	})))
+	assert.Nil(t, err)
+
+	cases := []struct {
+		truncate bool
+		wantKeys []string
+	}{
+		{false, []string{"/entities/bar", "/entities/extra", "/entities/foo", "/groups/baz"}},
+		{true, []string{"/entities/bar", "/entities/foo", "/groups/baz"}},
+	}
+	for _, c := range cases {
+		kv := newKV(t, map[string]string{
+			"/entities/foo":   "old",
+			"/groups/baz":     "baz",
+			"/entities/extra": "extra",
+		})
+
+		d, err := Compare(ctx, s, kv)
+		assert.Nil(t, err)
+		assert.Equal(t, Diff{
+			Added:   []string{"/entities/bar"},
+			Changed: []string{"/entities/foo"},
+			Removed: []string{"/entities/extra"},
+		}, d)
+
+		assert.Nil(t, Restore(ctx, s, kv, d, c.truncate))
+		v, err := kv.Get(ctx, "/entities/foo")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("foo"), v)
+
+		keys := []string{}
+		for _, p := range prefixes {
+			k, _ := kv.Keys(ctx, p)
+			keys = append(keys, k...)
+		}
+		assert.ElementsMatch(t, c.wantKeys, keys)
+
+		d, err = Compare(ctx, s, kv)
+		assert.Nil(t, err)
+		assert.Empty(t, d.Added)
+		assert.Empty(t, d.Changed)
+	}
+}
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+)
+
+// Deleted entities and groups are kept as tombstones in the DB's own
+// part of the keyspace, where they are invisible to everything that
+// looks for entities and groups, until they are restored or purged.
+// The key of a tombstone is the prefix followed by the ID or name.
+const (
+	EntityTombstonePrefix = MetaPrefix + "deleted-entity:"
+	GroupTombstonePrefix  = MetaPrefix + "deleted-group:"
+)
+
+// tombstone is what is stored in place of a deleted object.
+type tombstone struct {
+	Deleted time.Time
+	Value   []byte
+}
+
+// TombstoneEntity deletes an entity but keeps a copy of it that
+// RestoreEntity can bring back.  If the entity had been deleted
+// before, the older copy is replaced.
+func (db *DB) TombstoneEntity(ctx context.Context, ID string) error {
+	return db.bury(ctx, path.Join("/entities", ID), EntityTombstonePrefix+ID, ErrUnknownEntity)
+}
+
+// RestoreEntity brings back an entity that was deleted with
+// TombstoneEntity, exactly as it was when it was deleted.  Since group
+// memberships are stored on the entity, these come back with it.
+// ErrObjectExists is returned if an entity with the same ID has been
+// created in the meantime, and ErrNumberInUse if its number has.
+func (db *DB) RestoreEntity(ctx context.Context, ID string) error {
+	return db.unbury(ctx, path.Join("/entities", ID), EntityTombstonePrefix+ID, ErrUnknownEntity, db.numbers.entities, func(b []byte) (int32, error) {
+		e := &types.Entity{}
+		if err := proto.Unmarshal(b, e); err != nil {
+			db.log.Warn("Error unmarshaling deleted entity", "entity", ID, "error", err)
+			return 0, ErrInternalError
+		}
+		return e.GetNumber(), nil
+	})
+}
+
+// TombstoneGroup deletes a group but keeps a copy of it that
+// RestoreGroup can bring back.  If the group had been deleted before,
+// the older copy is replaced.
+func (db *DB) TombstoneGroup(ctx context.Context, name string) error {
+	return db.bury(ctx, path.Join("/groups", name), GroupTombstonePrefix+name, ErrUnknownGroup)
+}
+
+// RestoreGroup brings back a group that was deleted with
+// TombstoneGroup.  Entities still list the groups they are members of
+// while a group is deleted, so the group's members come back with it.
+// ErrObjectExists is returned if a group with the same name has been
+// created in the meantime, and ErrNumberInUse if its number has.
+func (db *DB) RestoreGroup(ctx context.Context, name string) error {
+	return db.unbury(ctx, path.Join("/groups", name), GroupTombstonePrefix+name, ErrUnknownGroup, db.numbers.groups, func(b []byte) (int32, error) {
+		g := &types.Group{}
+		if err := proto.Unmarshal(b, g); err != nil {
+			db.log.Warn("Error unmarshaling deleted group", "group", name, "error", err)
+			return 0, ErrInternalError
+		}
+		return g.GetNumber(), nil
+	})
+}
+
+// PurgeTombstones permanently removes every entity and group that was
+// deleted before the given time, along with its history and the
+// secrets it had, and returns how many were removed.
+func (db *DB) PurgeTombstones(ctx context.Context, before time.Time) (int, error) {
+	var purge []KVOp
+	n := 0
+	for _, p := range []struct{ tombstone, history, secrets string }{
+		{EntityTombstonePrefix, EntityHistoryPrefix, SecretHistoryPrefix},
+		{GroupTombstonePrefix, GroupHistoryPrefix, ""},
+	} {
+		keys, err := db.kv.Keys(ctx, p.tombstone+"*")
+		if err != nil {
+			return 0, err
+		}
+		for _, k := range keys {
+			t, err := db.loadTombstone(ctx, k)
+			if err != nil {
+				return 0, err
+			}
+			if t.Deleted.Before(before) {
+				db.log.Debug("Purging deleted object", "key", k, "deleted", t.Deleted)
+				id := strings.TrimPrefix(k, p.tombstone)
+				purge = append(purge,
+					KVOp{Key: k, Delete: true},
+					KVOp{Key: p.history + id, Delete: true},
+				)
+				if p.secrets != "" {
+					purge = append(purge, KVOp{Key: p.secrets + id, Delete: true})
+				}
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	db.wmu.Lock()
+	defer db.wmu.Unlock()
+	if err := db.commit(ctx, purge); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// bury moves the value at k into a tombstone at tk.
+func (db *DB) bury(ctx context.Context, k, tk string, notFound error) error {
+	db.wmu.Lock()
+	defer db.wmu.Unlock()
+
+	b, err := db.kv.Get(ctx, k)
+	if err == ErrNoValue {
+		return notFound
+	}
+	if err != nil {
+		db.log.Warn("Error loading object to delete", "key", k, "error", err)
+		return ErrInternalError
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(tombstone{Deleted: time.Now(), Value: b}); err != nil {
+		return ErrInternalError
+	}
+	return db.commit(ctx, []KVOp{
+		{Key: tk, Value: buf.Bytes()},
+		{Key: k, Delete: true},
+	})
+}
+
+// unbury moves the object in the tombstone at tk back to k, provided
+// nothing exists at k and the number that number finds in the object
+// is free in s.  The number is claimed until the object is seen, or
+// released again if the object can't be stored.
+func (db *DB) unbury(ctx context.Context, k, tk string, notFound error, s *numberSpace, number func([]byte) (int32, error)) error {
+	db.wmu.Lock()
+	defer db.wmu.Unlock()
+
+	t, err := db.loadTombstone(ctx, tk)
+	if err == ErrNoValue {
+		return notFound
+	}
+	if err != nil {
+		return err
+	}
+	switch _, err := db.kv.Get(ctx, k); err {
+	case ErrNoValue:
+	case nil:
+		return ErrObjectExists
+	default:
+		db.log.Warn("Error checking for existing object", "key", k, "error", err)
+		return ErrInternalError
+	}
+	n, err := number(t.Value)
+	if err != nil {
+		return err
+	}
+	if err := db.claim(ctx, s, n); err != nil {
+		return err
+	}
+
+	if err := db.commit(ctx, []KVOp{
+		{Key: k, Value: t.Value},
+		{Key: tk, Delete: true},
+	}); err != nil {
+		db.updateNumbers(func() { s.release(n) })
+		return err
+	}
+	return nil
+}
+
+func (db *DB) loadTombstone(ctx context.Context, k string) (tombstone, error) {
+	var t tombstone
+	b, err := db.kv.Get(ctx, k)
+	if err == ErrNoValue {
+		return t, err
+	}
+	if err != nil {
+		db.log.Warn("Error loading deleted object", "key", k, "error", err)
+		return t, ErrInternalError
+	}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&t); err != nil {
+		db.log.Warn("Error decoding deleted object", "key", k, "error", err)
+		return t, ErrInternalError
+	}
+	return t, nil
+}
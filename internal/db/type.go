@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"sync"
 
 	"github.com/hashicorp/go-hclog"
 
@@ -12,6 +13,11 @@ import (
 // init to be called later.
 type KVFactory func(hclog.Logger) (KVStore, error)
 
+// KVWrapperFactory returns a KVStore that adds some behavior on top
+// of another KVStore.  Wrappers are selected by prefixing the name of
+// the backend, for example "encrypted:filesystem".
+type KVWrapperFactory func(KVStore, hclog.Logger) (KVStore, error)
+
 // A KVStore is the backing mechanism that deals with persisting data
 // to somewhere that won't lose it.  This can be the disk, a remote
 // blob store, the desk of a particularly trusted employee, etc.
@@ -34,9 +40,31 @@ type DB struct {
 	kv  KVStore
 	cbs map[string]Callback
 
+	// cbOrder is the order callbacks were registered in.
+	cbOrder []string
+	bus     *eventBus
+
+	// wmu serializes writes so that revision checks are atomic
+	// with the write that follows them.
+	wmu sync.Mutex
+
+	journal *Journal
+	cluster KVCluster
+	numbers *numbers
+	cache   *objectCache
+
+	historyDepth int
+	secretDepth  int
+
+	indexDir  string
+	indexOpts []IndexOption
+
 	*Index
 }
 
+// An Option configures the DB.
+type Option func(*DB)
+
 // A KVCapability is a specific property that a KV Store might have.
 // It allows stores to express things like supporting HA access.
 type KVCapability int
@@ -48,8 +76,39 @@ const (
 	// necessarily mean that the KV isn't mutable, only that it
 	// would prefer you not.
 	KVMutable KVCapability = iota
+
+	// KVBatch signifies that the key/value store implements
+	// KVBatcher and can apply a set of mutations such that
+	// either all of them or none of them are persisted, even in
+	// the face of a crash part way through.
+	KVBatch
 )
 
+// A KVOp is a single mutation that is part of a batch.  If Delete is
+// set then the key is removed and Value is ignored.
+type KVOp struct {
+	Key    string
+	Value  []byte
+	Delete bool
+}
+
+// A KVBatcher is a KVStore that can apply multiple mutations
+// atomically.  Stores that implement this interface should advertise
+// the KVBatch capability.  Events for the mutations in a batch must
+// only be fired once the entire batch has been committed.  Deleting
+// a key that does not exist is not an error within a batch.
+type KVBatcher interface {
+	Batch(context.Context, []KVOp) error
+}
+
+// A KVCluster is a KVStore that is shared between several servers,
+// only one of which accepts writes at a time.  Leader returns the
+// address of the NetAuth server that currently does, or the empty
+// string while the cluster has no leader.
+type KVCluster interface {
+	Leader() string
+}
+
 // Callback is a function type registered by an external customer that
 // is interested in some change that might happen in the storage
 // system.  These are returned with a DBEvent populated of whether or
@@ -59,9 +118,15 @@ type Callback func(Event)
 
 // Event is a type of message that can be fed to callbacks
 // describing the event and the key of the thing that happened.
+// Realm is the realm that the entity or group belongs to.
 type Event struct {
-	Type EventType
-	PK   string
+	Type  EventType
+	PK    string
+	Realm string
+
+	// Preload is set on the events that EventUpdateAll fires,
+	// which don't mean that the object has changed.
+	Preload bool
 }
 
 // An EventType is used to specify what kind of event has happened and
@@ -88,6 +153,32 @@ const (
 // provide a more optimized searching experience.
 type SearchRequest struct {
 	Expression string
+
+	// PageSize is the most results to return.  If it is zero
+	// every result is returned.
+	PageSize int
+
+	// PageToken continues a search where an earlier page ended,
+	// and comes from the NextPageToken of that page.
+	PageToken string
+
+	// Sort lists the fields to order results by, each prefixed
+	// with '-' to sort it in descending order.  Results are
+	// always ordered by ID or name last so that pages are
+	// stable.
+	Sort []string
+}
+
+// SearchResult describes the page of results returned for a
+// SearchRequest.
+type SearchResult struct {
+	// Total is the number of objects that matched, including
+	// those on other pages.
+	Total uint64
+
+	// NextPageToken requests the following page, and is empty
+	// if this is the last one.
+	NextPageToken string
 }
 
 // These allow the index to get limited access to the db itself.  You
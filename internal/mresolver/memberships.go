@@ -55,6 +55,12 @@ func (mr *MResolver) SyncGroup(group string, include, exclude []string) {
 		mr.atom.ga[affectee][affector] = struct{}{}
 	}
 	mr.gMutex.Lock()
+	// Expansions that the group no longer has must not cascade
+	// back to it, otherwise a later expansion in the other
+	// direction would look like a cycle.
+	for _, ga := range mr.atom.ga {
+		delete(ga, group)
+	}
 	for _, g := range include {
 		addAffector(g, group)
 	}
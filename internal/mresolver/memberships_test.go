@@ -91,6 +91,20 @@ func TestSyncGroup(t *testing.T) {
 	assert.Equal(t, "(group6&!(group5|(group4|(group3|group2))))", x.atom.gr["group6"].String())
 }
 
+func TestSyncGroupReversed(t *testing.T) {
+	x := New()
+
+	// Reversing an expansion used to leave the old one behind as
+	// an affector, and resolving changes would then loop forever.
+	x.SyncGroup("group1", []string{}, []string{})
+	x.SyncGroup("group2", []string{"group1"}, []string{})
+	x.SyncGroup("group2", []string{}, []string{})
+	x.SyncGroup("group1", []string{"group2"}, []string{})
+
+	assert.Empty(t, x.atom.ga["group1"])
+	assert.Equal(t, "(group1|group2)", x.atom.gr["group1"].String())
+}
+
 func TestRemoveGroup(t *testing.T) {
 	x := New()
 	testAtom(x)
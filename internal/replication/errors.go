@@ -0,0 +1,26 @@
+package replication
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrUnauthenticated is returned to replicas that don't
+	// present the shared secret.
+	ErrUnauthenticated = status.Errorf(codes.Unauthenticated, "Replication secret is missing or incorrect")
+
+	// ErrInternal is returned when the primary cannot read a value
+	// that it needs to send.
+	ErrInternal = status.Errorf(codes.Internal, "An internal error has occurred and the stream could not continue")
+
+	// ErrBadKey is returned by the replica when the primary sends
+	// a key outside of the replicated keyspace.
+	ErrBadKey = errors.New("key is outside of the replicated keyspace")
+
+	// ErrOutOfOrder is returned by the replica when the primary
+	// sends a change that doesn't follow the previous one.
+	ErrOutOfOrder = errors.New("change received out of order")
+)
@@ -0,0 +1,35 @@
+package replication
+
+import (
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func defaultOptions() options {
+	return options{
+		log:     hclog.NewNullLogger(),
+		logSize: 10000,
+		retry:   time.Second * 5,
+	}
+}
+
+// WithLogger sets the logger.
+func WithLogger(l hclog.Logger) Option { return func(o *options) { o.log = l.Named("replication") } }
+
+// WithSecret sets the shared secret that replicas present to the
+// primary.  A primary without a secret refuses all replicas.
+func WithSecret(s []byte) Option { return func(o *options) { o.secret = s } }
+
+// WithLogSize sets how many changes the primary remembers for
+// replicas to resume from.
+func WithLogSize(n int) Option { return func(o *options) { o.logSize = n } }
+
+// WithPositionFile sets where the replica stores its position.
+// Without a position file the replica does a full resync every time
+// it starts.
+func WithPositionFile(p string) Option { return func(o *options) { o.posFile = p } }
+
+// WithRetryInterval sets how long the replica waits before
+// reconnecting to the primary.
+func WithRetryInterval(d time.Duration) Option { return func(o *options) { o.retry = d } }
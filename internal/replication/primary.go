@@ -0,0 +1,220 @@
+package replication
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"path"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/replication/replpb"
+)
+
+const (
+	// secretKey is the metadata key that carries the shared
+	// secret.  The -bin suffix has gRPC encode the value, so the
+	// secret may be arbitrary bytes.
+	secretKey = "netauth-replication-secret-bin"
+
+	// generationKey is the header that the primary sends once a
+	// replica has been accepted.
+	generationKey = "netauth-replication-generation"
+)
+
+// prefixes are the parts of the keyspace that are replicated.
+var prefixes = []string{"/entities/", "/groups/"}
+
+// NewPrimary returns a primary that records changes from the given
+// db.  Changes made before the primary is created are only sent to
+// replicas as part of a resync.
+func NewPrimary(d DB, opts ...Option) (*Primary, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.logSize < 1 {
+		o.logSize = 1
+	}
+
+	g := make([]byte, 16)
+	if _, err := rand.Read(g); err != nil {
+		return nil, err
+	}
+
+	p := &Primary{
+		kv:         d.KV(),
+		log:        o.log,
+		secret:     o.secret,
+		generation: hex.EncodeToString(g),
+		ring:       make([]string, o.logSize),
+		notify:     make(chan struct{}),
+	}
+	d.RegisterCallback("replication", p.record)
+	p.log.Info("Replication primary initialized", "generation", p.generation)
+	return p, nil
+}
+
+// record is the db callback that appends changes to the ring.
+// Preload events don't mean that anything has changed, and recording
+// them would push the real changes out of the ring.
+func (p *Primary) record(e db.Event) {
+	if e.IsEmpty() || e.Preload {
+		return
+	}
+	k := path.Join("/entities", e.PK)
+	if e.Type >= db.EventGroupCreate {
+		k = path.Join("/groups", e.PK)
+	}
+
+	p.mu.Lock()
+	p.seq++
+	p.ring[p.seq%uint64(len(p.ring))] = k
+	close(p.notify)
+	p.notify = make(chan struct{})
+	p.mu.Unlock()
+}
+
+// changesAfter returns the keys changed after the given sequence
+// number, and a channel that will be closed on the next change.  If
+// the ring no longer holds every change after seq then ok is false.
+func (p *Primary) changesAfter(seq uint64) (keys []string, wait <-chan struct{}, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if seq > p.seq || p.seq-seq > uint64(len(p.ring)) {
+		return nil, nil, false
+	}
+	for s := seq + 1; s <= p.seq; s++ {
+		keys = append(keys, p.ring[s%uint64(len(p.ring))])
+	}
+	return keys, p.notify, true
+}
+
+// Stream sends changes to a replica.  A replica that asks for a
+// position from a different generation, or one that is no longer
+// held in the ring, first receives a full resync.  The stream
+// continues until the replica goes away.
+func (p *Primary) Stream(r *replpb.StreamRequest, s replpb.Replication_StreamServer) error {
+	ctx := s.Context()
+	if !p.authorized(ctx) {
+		p.log.Warn("Rejected replica with bad secret")
+		return ErrUnauthenticated
+	}
+	if err := s.SendHeader(metadata.Pairs(generationKey, p.generation)); err != nil {
+		return err
+	}
+
+	cursor := r.GetSeq()
+	if r.GetGeneration() != p.generation {
+		cursor = 0
+		if err := p.resync(ctx, s, &cursor); err != nil {
+			return err
+		}
+	}
+
+	for {
+		keys, wait, ok := p.changesAfter(cursor)
+		if !ok {
+			p.log.Info("Replica is too far behind, resyncing", "seq", cursor)
+			if err := p.resync(ctx, s, &cursor); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, k := range keys {
+			cursor++
+			if err := p.send(ctx, s, k, cursor); err != nil {
+				return err
+			}
+		}
+
+		if len(keys) > 0 {
+			continue
+		}
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// authorized checks the shared secret presented by the replica.
+func (p *Primary) authorized(ctx context.Context) bool {
+	if len(p.secret) == 0 {
+		return false
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, s := range md.Get(secretKey) {
+		if subtle.ConstantTimeCompare([]byte(s), p.secret) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends the current value of a single key.  If the key no
+// longer exists then a delete is sent in its place, regardless of
+// what the original change was.
+func (p *Primary) send(ctx context.Context, s replpb.Replication_StreamServer, k string, seq uint64) error {
+	c := &replpb.Change{
+		Type:       replpb.Change_PUT,
+		Generation: p.generation,
+		Seq:        seq,
+		Key:        k,
+	}
+
+	v, err := p.kv.Get(ctx, k)
+	switch err {
+	case nil:
+		c.Value = v
+	case db.ErrNoValue:
+		c.Type = replpb.Change_DELETE
+	default:
+		p.log.Error("Error reading value for replication", "key", k, "error", err)
+		return ErrInternal
+	}
+	return s.Send(c)
+}
+
+// resync sends every key in the replicated keyspace.  Changes that
+// happen while the resync is in progress may be sent twice, once
+// during the resync and once after, which is harmless as every change
+// carries the whole value.
+func (p *Primary) resync(ctx context.Context, s replpb.Replication_StreamServer, cursor *uint64) error {
+	p.mu.Lock()
+	start := p.seq
+	p.mu.Unlock()
+
+	if err := s.Send(&replpb.Change{Type: replpb.Change_RESYNC_BEGIN, Generation: p.generation}); err != nil {
+		return err
+	}
+
+	for _, prefix := range prefixes {
+		keys, err := p.kv.Keys(ctx, prefix+"*")
+		if err != nil {
+			p.log.Error("Error listing keys for replication", "prefix", prefix, "error", err)
+			return ErrInternal
+		}
+		for _, k := range keys {
+			v, err := p.kv.Get(ctx, k)
+			if err == db.ErrNoValue {
+				continue
+			}
+			if err != nil {
+				p.log.Error("Error reading value for replication", "key", k, "error", err)
+				return ErrInternal
+			}
+			if err := s.Send(&replpb.Change{Type: replpb.Change_PUT, Key: k, Value: v}); err != nil {
+				return err
+			}
+		}
+	}
+
+	*cursor = start
+	return s.Send(&replpb.Change{Type: replpb.Change_RESYNC_END, Generation: p.generation, Seq: start})
+}
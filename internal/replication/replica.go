@@ -0,0 +1,230 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	atomic "github.com/google/renameio"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/health"
+	"github.com/netauth/netauth/internal/replication/replpb"
+)
+
+// NewReplica returns a replica that applies changes from the primary
+// behind c into kv.  A position file that can't be read is logged and
+// otherwise ignored, the replica will resync from the beginning.
+func NewReplica(kv db.KVStore, c replpb.ReplicationClient, opts ...Option) *Replica {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	r := &Replica{
+		kv:      kv,
+		c:       c,
+		log:     o.log,
+		secret:  o.secret,
+		posFile: o.posFile,
+		retry:   o.retry,
+	}
+	if err := r.loadPosition(); err != nil {
+		r.log.Warn("Could not load replication position, will resync", "error", err)
+	}
+	return r
+}
+
+// Run follows the primary until the context is cancelled,
+// reconnecting whenever the stream is interrupted.
+func (r *Replica) Run(ctx context.Context) {
+	for {
+		err := r.follow(ctx)
+		r.mu.Lock()
+		r.streaming = false
+		r.lastErr = err
+		r.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+		r.log.Warn("Replication stream interrupted", "error", err, "retry", r.retry)
+		select {
+		case <-time.After(r.retry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// HealthCheck reports whether the replica is currently following the
+// primary.
+func (r *Replica) HealthCheck() health.SubsystemStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := health.SubsystemStatus{
+		OK:   r.streaming,
+		Name: "replication",
+	}
+	if r.streaming {
+		s.Status = fmt.Sprintf("Following generation %s at %d", r.pos.Generation, r.pos.Seq)
+	} else {
+		s.Status = fmt.Sprintf("Not following primary: %v", r.lastErr)
+	}
+	return s
+}
+
+// follow opens a single stream and applies changes until it fails.
+func (r *Replica) follow(ctx context.Context) error {
+	r.mu.Lock()
+	req := &replpb.StreamRequest{Generation: r.pos.Generation, Seq: r.pos.Seq}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(ctx, secretKey, string(r.secret)))
+	defer cancel()
+
+	s, err := r.c.Stream(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	// The primary only sends headers once the replica has been
+	// accepted, so this is the earliest point that the replica
+	// knows it is following.
+	md, err := s.Header()
+	if err != nil {
+		return err
+	}
+	if len(md.Get(generationKey)) > 0 {
+		r.mu.Lock()
+		r.streaming = true
+		r.mu.Unlock()
+	}
+
+	var seen map[string]struct{}
+	for {
+		c, err := s.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch c.GetType() {
+		case replpb.Change_RESYNC_BEGIN:
+			r.log.Info("Resyncing from primary", "generation", c.GetGeneration())
+			seen = make(map[string]struct{})
+			continue
+		case replpb.Change_RESYNC_END:
+			if seen == nil {
+				return ErrOutOfOrder
+			}
+			if err := r.prune(ctx, seen); err != nil {
+				return err
+			}
+			seen = nil
+			r.log.Info("Resync complete", "generation", c.GetGeneration(), "seq", c.GetSeq())
+		default:
+			if err := r.apply(ctx, c); err != nil {
+				return err
+			}
+			if seen != nil {
+				seen[c.GetKey()] = struct{}{}
+				continue
+			}
+			r.mu.Lock()
+			p := r.pos
+			r.mu.Unlock()
+			if c.GetGeneration() != p.Generation || c.GetSeq() != p.Seq+1 {
+				return ErrOutOfOrder
+			}
+		}
+
+		if err := r.setPosition(position{Generation: c.GetGeneration(), Seq: c.GetSeq()}); err != nil {
+			return err
+		}
+	}
+}
+
+// apply writes a single change into the local store.
+func (r *Replica) apply(ctx context.Context, c *replpb.Change) error {
+	if !replicated(c.GetKey()) {
+		return ErrBadKey
+	}
+
+	if c.GetType() == replpb.Change_DELETE {
+		if err := r.kv.Del(ctx, c.GetKey()); err != nil && err != db.ErrNoValue {
+			return err
+		}
+		return nil
+	}
+	return r.kv.Put(ctx, c.GetKey(), c.GetValue())
+}
+
+// prune removes every local key that was not sent during a resync.
+func (r *Replica) prune(ctx context.Context, seen map[string]struct{}) error {
+	for _, prefix := range prefixes {
+		keys, err := r.kv.Keys(ctx, prefix+"*")
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			if err := r.kv.Del(ctx, k); err != nil && err != db.ErrNoValue {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setPosition records the last applied change, and persists it if a
+// position file is configured.
+func (r *Replica) setPosition(p position) error {
+	r.mu.Lock()
+	r.pos = p
+	r.mu.Unlock()
+
+	if r.posFile == "" {
+		return nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return atomic.WriteFile(r.posFile, b, 0644)
+}
+
+func (r *Replica) loadPosition() error {
+	if r.posFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(r.posFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var p position
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	r.pos = p
+	return nil
+}
+
+// replicated checks that a key is one that replication may write.
+func replicated(k string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(k, prefix) && !strings.Contains(k[len(prefix):], "/") && len(k) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+package replication
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/memory"
+	"github.com/netauth/netauth/internal/replication/replpb"
+	"github.com/netauth/netauth/internal/startup"
+)
+
+var secret = []byte("replication-secret")
+
+func newDB(t *testing.T) *db.DB {
+	startup.DoCallbacks()
+	d, err := db.New("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// newPrimary starts a primary on an in-memory listener and returns
+// the db behind it and a client connected to it.
+func newPrimary(t *testing.T, opts ...Option) (*db.DB, replpb.ReplicationClient) {
+	d := newDB(t)
+	p, err := NewPrimary(d, append([]Option{WithSecret(secret)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	replpb.RegisterReplicationServer(srv, p)
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return l.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return d, replpb.NewReplicationClient(conn)
+}
+
+// runReplica runs the replica until the returned function is called.
+func runReplica(r *Replica) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		r.Run(ctx)
+		wg.Done()
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func hasValue(kv db.KVStore, k string, v []byte) func() bool {
+	return func() bool {
+		b, err := kv.Get(context.Background(), k)
+		return err == nil && string(b) == string(v)
+	}
+}
+
+func hasNoValue(kv db.KVStore, k string) func() bool {
+	return func() bool {
+		_, err := kv.Get(context.Background(), k)
+		return err == db.ErrNoValue
+	}
+}
+
+func TestReplicateResync(t *testing.T) {
+	ctx := context.Background()
+	pdb, c := newPrimary(t)
+	pdb.KV().Put(ctx, "/entities/foo", []byte("foo"))
+	pdb.KV().Put(ctx, "/groups/bar", []byte("bar"))
+
+	rdb := newDB(t)
+	rdb.KV().Put(ctx, "/entities/stale", []byte("stale"))
+	var mu sync.Mutex
+	events := []db.Event{}
+	rdb.RegisterCallback("test", func(e db.Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})
+
+	r := NewReplica(rdb.KV(), c, WithSecret(secret))
+	stop := runReplica(r)
+	defer stop()
+
+	assert.Eventually(t, hasValue(rdb.KV(), "/entities/foo", []byte("foo")), time.Second*5, time.Millisecond*10)
+	assert.Eventually(t, hasValue(rdb.KV(), "/groups/bar", []byte("bar")), time.Second*5, time.Millisecond*10)
+	assert.Eventually(t, hasNoValue(rdb.KV(), "/entities/stale"), time.Second*5, time.Millisecond*10)
+	assert.True(t, r.HealthCheck().OK)
+
+	mu.Lock()
+	assert.Contains(t, events, db.Event{Type: db.EventEntityUpdate, PK: "foo"})
+	assert.Contains(t, events, db.Event{Type: db.EventGroupUpdate, PK: "bar"})
+	assert.Contains(t, events, db.Event{Type: db.EventEntityDestroy, PK: "stale"})
+	mu.Unlock()
+}
+
+func TestReplicateLive(t *testing.T) {
+	ctx := context.Background()
+	pdb, c := newPrimary(t)
+	pdb.KV().Put(ctx, "/entities/foo", []byte("foo"))
+
+	rdb := newDB(t)
+	posFile := filepath.Join(t.TempDir(), "replication.pos")
+	r := NewReplica(rdb.KV(), c, WithSecret(secret), WithPositionFile(posFile))
+	stop := runReplica(r)
+	defer stop()
+
+	assert.Eventually(t, hasValue(rdb.KV(), "/entities/foo", []byte("foo")), time.Second*5, time.Millisecond*10)
+
+	pdb.KV().Put(ctx, "/entities/foo", []byte("foo2"))
+	pdb.KV().Put(ctx, "/groups/bar", []byte("bar"))
+	pdb.KV().Del(ctx, "/entities/foo")
+
+	assert.Eventually(t, hasValue(rdb.KV(), "/groups/bar", []byte("bar")), time.Second*5, time.Millisecond*10)
+	assert.Eventually(t, hasNoValue(rdb.KV(), "/entities/foo"), time.Second*5, time.Millisecond*10)
+	assert.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.pos.Seq == 4
+	}, time.Second*5, time.Millisecond*10)
+
+	stop()
+	r2 := NewReplica(rdb.KV(), c, WithPositionFile(posFile))
+	assert.Equal(t, r.pos, r2.pos)
+	assert.Equal(t, uint64(4), r2.pos.Seq)
+}
+
+func TestReplicateResume(t *testing.T) {
+	ctx := context.Background()
+	pdb, c := newPrimary(t)
+	pdb.KV().Put(ctx, "/entities/foo", []byte("foo"))
+
+	rdb := newDB(t)
+	posFile := filepath.Join(t.TempDir(), "replication.pos")
+	stop := runReplica(NewReplica(rdb.KV(), c, WithSecret(secret), WithPositionFile(posFile)))
+	pdb.KV().Put(ctx, "/entities/bar", []byte("bar"))
+	assert.Eventually(t, hasValue(rdb.KV(), "/entities/bar", []byte("bar")), time.Second*5, time.Millisecond*10)
+	stop()
+
+	// A key that only exists on the replica survives a resume,
+	// but would be removed by a resync.
+	rdb.KV().Put(ctx, "/entities/local", []byte("local"))
+	pdb.KV().Put(ctx, "/entities/baz", []byte("baz"))
+
+	stop = runReplica(NewReplica(rdb.KV(), c, WithSecret(secret), WithPositionFile(posFile)))
+	defer stop()
+	assert.Eventually(t, hasValue(rdb.KV(), "/entities/baz", []byte("baz")), time.Second*5, time.Millisecond*10)
+	assert.True(t, hasValue(rdb.KV(), "/entities/local", []byte("local"))())
+}
+
+func TestReplicateTooFarBehind(t *testing.T) {
+	ctx := context.Background()
+	pdb, c := newPrimary(t, WithLogSize(2))
+
+	rdb := newDB(t)
+	posFile := filepath.Join(t.TempDir(), "replication.pos")
+	stop := runReplica(NewReplica(rdb.KV(), c, WithSecret(secret), WithPositionFile(posFile)))
+	pdb.KV().Put(ctx, "/entities/foo", []byte("foo"))
+	assert.Eventually(t, hasValue(rdb.KV(), "/entities/foo", []byte("foo")), time.Second*5, time.Millisecond*10)
+	stop()
+
+	rdb.KV().Put(ctx, "/entities/local", []byte("local"))
+	pdb.KV().Put(ctx, "/entities/a", []byte("a"))
+	pdb.KV().Put(ctx, "/entities/b", []byte("b"))
+	pdb.KV().Put(ctx, "/entities/c", []byte("c"))
+
+	stop = runReplica(NewReplica(rdb.KV(), c, WithSecret(secret), WithPositionFile(posFile)))
+	defer stop()
+	assert.Eventually(t, hasNoValue(rdb.KV(), "/entities/local"), time.Second*5, time.Millisecond*10)
+	assert.True(t, hasValue(rdb.KV(), "/entities/a", []byte("a"))())
+	assert.True(t, hasValue(rdb.KV(), "/entities/c", []byte("c"))())
+}
+
+func TestReplicateBadSecret(t *testing.T) {
+	_, c := newPrimary(t)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), secretKey, "wrong")
+	s, err := c.Stream(ctx, &replpb.StreamRequest{})
+	assert.Nil(t, err)
+	_, err = s.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	rdb := newDB(t)
+	r := NewReplica(rdb.KV(), c)
+	err = r.follow(context.Background())
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.False(t, r.HealthCheck().OK)
+}
+
+func TestReplicateNoSecret(t *testing.T) {
+	d := newDB(t)
+	p, err := NewPrimary(d)
+	assert.Nil(t, err)
+	assert.False(t, p.authorized(context.Background()))
+}
+
+func TestNewReplicaBadPosition(t *testing.T) {
+	posFile := filepath.Join(t.TempDir(), "replication.pos")
+	assert.Nil(t, os.WriteFile(posFile, []byte("garbage"), 0644))
+
+	r := NewReplica(newDB(t).KV(), nil, WithPositionFile(posFile))
+	assert.Equal(t, position{}, r.pos)
+}
+
+func TestReplicated(t *testing.T) {
+	cases := []struct {
+		key  string
+		want bool
+	}{
+		{"/entities/foo", true},
+		{"/groups/foo", true},
+		{"/entities/", false},
+		{"/entities/foo/bar", false},
+		{"/other/foo", false},
+		{"foo", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, replicated(c.key), c.key)
+	}
+}
+
+func TestRecordSkipsPreload(t *testing.T) {
+	p, err := NewPrimary(newDB(t), WithSecret(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.record(db.Event{Type: db.EventEntityUpdate, PK: "entity1", Preload: true})
+	assert.Equal(t, uint64(0), p.seq)
+	p.record(db.Event{Type: db.EventEntityUpdate, PK: "entity1"})
+	assert.Equal(t, uint64(1), p.seq)
+}
@@ -0,0 +1,78 @@
+// Package replication keeps read-only servers in sync with a primary.
+// The primary records every change reported by the db event feed and
+// streams the changes, along with the current value of each changed
+// key, to its replicas.  Replicas apply the changes to their own
+// KVStore, which fires their own events, and remember the last change
+// they applied so that they can resume after a disconnect.
+package replication
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/replication/replpb"
+)
+
+// DB is the part of the database that the primary needs access to.
+type DB interface {
+	KV() db.KVStore
+	RegisterCallback(string, db.Callback)
+}
+
+// Primary serves the change stream to replicas.  Changes are kept in
+// a fixed size ring, a replica that falls further behind than the
+// ring can hold is sent a full resync instead.
+type Primary struct {
+	replpb.UnimplementedReplicationServer
+
+	kv     db.KVStore
+	log    hclog.Logger
+	secret []byte
+
+	// generation identifies this run of the primary.  Sequence
+	// numbers are only meaningful within a generation.
+	generation string
+
+	mu     sync.Mutex
+	seq    uint64
+	ring   []string
+	notify chan struct{}
+}
+
+// Replica follows the change stream from a primary and applies it to
+// a local KVStore.
+type Replica struct {
+	kv     db.KVStore
+	c      replpb.ReplicationClient
+	log    hclog.Logger
+	secret []byte
+
+	posFile string
+	retry   time.Duration
+
+	mu        sync.Mutex
+	pos       position
+	streaming bool
+	lastErr   error
+}
+
+// position is the last change that a replica has applied.
+type position struct {
+	Generation string
+	Seq        uint64
+}
+
+// Option configures the primary or the replica.  Options that don't
+// apply to the thing being configured are ignored.
+type Option func(*options)
+
+type options struct {
+	log     hclog.Logger
+	secret  []byte
+	logSize int
+	posFile string
+	retry   time.Duration
+}
@@ -0,0 +1,373 @@
+package rpc2
+
+import (
+	"context"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/rpc2/adminpb"
+	"github.com/netauth/netauth/internal/tree"
+
+	types "github.com/netauth/protocol"
+	pb "github.com/netauth/protocol/v2"
+)
+
+// EntityRestore brings back an entity that has been destroyed but not
+// yet purged.  Since this makes an entity exist again, it requires
+// the same CREATE_ENTITY or GLOBAL_ROOT permissions as creating one.
+func (s *Server) EntityRestore(ctx context.Context, r *pb.EntityRequest) (*pb.Empty, error) {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_CREATE_ENTITY)
+	if err != nil {
+		return &pb.Empty{}, err
+	}
+
+	e := r.GetEntity()
+	switch err := s.RestoreEntity(ctx, e.GetID()); err {
+	case db.ErrUnknownEntity:
+		s.log.Warn("No deleted entity to restore",
+			"method", "EntityRestore",
+			"entity", e.GetID(),
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+		)
+		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrDuplicateEntityID, tree.ErrDuplicateNumber:
+		s.log.Warn("Restored entity would be a duplicate",
+			"entity", e.GetID(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"error", err,
+		)
+		return &pb.Empty{}, ErrExists
+	case nil:
+		s.log.Info("Entity Restored",
+			"entity", e.GetID(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+		)
+		return &pb.Empty{}, nil
+	default:
+		s.log.Warn("Error Restoring Entity",
+			"entity", e.GetID(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"error", err,
+		)
+		return &pb.Empty{}, ErrInternal
+	}
+}
+
+// GroupRestore brings back a group that has been destroyed but not
+// yet purged.  This requires CREATE_GROUP or GLOBAL_ROOT permissions.
+func (s *Server) GroupRestore(ctx context.Context, r *pb.GroupRequest) (*pb.Empty, error) {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_CREATE_GROUP)
+	if err != nil {
+		return &pb.Empty{}, err
+	}
+
+	g := r.GetGroup()
+	switch err := s.RestoreGroup(ctx, g.GetName()); err {
+	case db.ErrUnknownGroup:
+		s.log.Warn("No deleted group to restore",
+			"method", "GroupRestore",
+			"group", g.GetName(),
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+		)
+		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrDuplicateGroupName, tree.ErrDuplicateNumber:
+		s.log.Warn("Restored group would be a duplicate",
+			"group", g.GetName(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"error", err,
+		)
+		return &pb.Empty{}, ErrExists
+	case nil:
+		s.log.Info("Group Restored",
+			"group", g.GetName(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+		)
+		return &pb.Empty{}, nil
+	default:
+		s.log.Warn("Error Restoring Group",
+			"group", g.GetName(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"error", err,
+		)
+		return &pb.Empty{}, ErrInternal
+	}
+}
+
+// EntityExpireSecret marks the secret of an entity as needing to be
+// changed.  The entity will only be able to authenticate to change its
+// secret until it does.  This requires CHANGE_ENTITY_SECRET or
+// GLOBAL_ROOT permissions.
+func (s *Server) EntityExpireSecret(ctx context.Context, r *pb.EntityRequest) (*pb.Empty, error) {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_CHANGE_ENTITY_SECRET)
+	if err != nil {
+		return &pb.Empty{}, err
+	}
+
+	e := r.GetEntity()
+	switch err := s.ExpireSecret(ctx, e.GetID()); err {
+	case db.ErrUnknownEntity:
+		s.log.Warn("Entity does not exist!",
+			"method", "EntityExpireSecret",
+			"entity", e.GetID(),
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+		)
+		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "entity", e.GetID())
+	case nil:
+		s.log.Info("Entity Secret Expired",
+			"entity", e.GetID(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+		)
+		return &pb.Empty{}, nil
+	default:
+		s.log.Warn("Error Expiring Entity Secret",
+			"entity", e.GetID(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"error", err,
+		)
+		return &pb.Empty{}, ErrInternal
+	}
+}
+
+// EntityHistory returns the revisions of an entity that are still
+// kept.  Since the history shows who made each change, this requires
+// MODIFY_ENTITY_META or GLOBAL_ROOT permissions, but it can be served
+// by a read-only server.
+func (s *Server) EntityHistory(ctx context.Context, r *pb.EntityRequest) (*adminpb.EntityHistoryResult, error) {
+	ctx, err := s.checkToken(ctx)
+	if err != nil {
+		return &adminpb.EntityHistoryResult{}, err
+	}
+	if err := s.isAuthorized(ctx, types.Capability_MODIFY_ENTITY_META); err != nil {
+		return &adminpb.EntityHistoryResult{}, err
+	}
+
+	e := r.GetEntity()
+	h, err := s.Manager.EntityHistory(ctx, e.GetID())
+	if err != nil {
+		s.log.Warn("Error Loading Entity History",
+			"entity", e.GetID(),
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"error", err,
+		)
+		return &adminpb.EntityHistoryResult{}, ErrInternal
+	}
+
+	out := &adminpb.EntityHistoryResult{Revisions: make([]*adminpb.EntityRevision, len(h))}
+	for i, rev := range h {
+		out.Revisions[i] = &adminpb.EntityRevision{
+			Rev:    proto.Int32(int32(rev.Rev)),
+			Time:   proto.Int64(rev.Time.Unix()),
+			Actor:  proto.String(rev.Actor),
+			Entity: rev.Entity,
+		}
+	}
+	return out, nil
+}
+
+// EntityRollback returns an entity to an earlier revision from its
+// history.  Only the metadata that MODIFY_ENTITY_META can change is
+// restored; capabilities, groups, keys, and the lock are left as they
+// are.  This requires MODIFY_ENTITY_META or GLOBAL_ROOT permissions.
+func (s *Server) EntityRollback(ctx context.Context, r *adminpb.RollbackRequest) (*pb.Empty, error) {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_ENTITY_META)
+	if err != nil {
+		return &pb.Empty{}, err
+	}
+
+	switch err := s.RollbackEntity(ctx, r.GetTarget(), int(r.GetRev())); err {
+	case db.ErrUnknownEntity, tree.ErrUnknownRevision:
+		s.log.Warn("No such entity revision",
+			"method", "EntityRollback",
+			"entity", r.GetTarget(),
+			"rev", r.GetRev(),
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"error", err,
+		)
+		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "entity", r.GetTarget())
+	case nil:
+		s.log.Info("Entity Rolled Back",
+			"entity", r.GetTarget(),
+			"rev", r.GetRev(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+		)
+		return &pb.Empty{}, nil
+	default:
+		s.log.Warn("Error Rolling Back Entity",
+			"entity", r.GetTarget(),
+			"rev", r.GetRev(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"error", err,
+		)
+		return &pb.Empty{}, ErrInternal
+	}
+}
+
+// GroupHistory returns the revisions of a group that are still kept.
+// This requires MODIFY_GROUP_META or GLOBAL_ROOT permissions, but it
+// can be served by a read-only server.
+func (s *Server) GroupHistory(ctx context.Context, r *pb.GroupRequest) (*adminpb.GroupHistoryResult, error) {
+	ctx, err := s.checkToken(ctx)
+	if err != nil {
+		return &adminpb.GroupHistoryResult{}, err
+	}
+	if err := s.isAuthorized(ctx, types.Capability_MODIFY_GROUP_META); err != nil {
+		return &adminpb.GroupHistoryResult{}, err
+	}
+
+	g := r.GetGroup()
+	h, err := s.Manager.GroupHistory(ctx, g.GetName())
+	if err != nil {
+		s.log.Warn("Error Loading Group History",
+			"group", g.GetName(),
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"error", err,
+		)
+		return &adminpb.GroupHistoryResult{}, ErrInternal
+	}
+
+	out := &adminpb.GroupHistoryResult{Revisions: make([]*adminpb.GroupRevision, len(h))}
+	for i, rev := range h {
+		out.Revisions[i] = &adminpb.GroupRevision{
+			Rev:   proto.Int32(int32(rev.Rev)),
+			Time:  proto.Int64(rev.Time.Unix()),
+			Actor: proto.String(rev.Actor),
+			Group: rev.Group,
+		}
+	}
+	return out, nil
+}
+
+// GroupRollback returns a group to an earlier revision from its
+// history.  Expansions that the old revision has are checked as
+// though they were being added.  The capabilities and managing group
+// are left as they are.  This requires MODIFY_GROUP_META or
+// GLOBAL_ROOT permissions.
+func (s *Server) GroupRollback(ctx context.Context, r *adminpb.RollbackRequest) (*pb.Empty, error) {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META)
+	if err != nil {
+		return &pb.Empty{}, err
+	}
+
+	switch err := s.RollbackGroup(ctx, r.GetTarget(), int(r.GetRev())); err {
+	case db.ErrUnknownGroup, tree.ErrUnknownRevision:
+		s.log.Warn("No such group revision",
+			"method", "GroupRollback",
+			"group", r.GetTarget(),
+			"rev", r.GetRev(),
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"error", err,
+		)
+		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrExistingExpansion:
+		s.log.Warn("Rollback would create an expansion cycle",
+			"group", r.GetTarget(),
+			"rev", r.GetRev(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+		)
+		return &pb.Empty{}, ErrExists
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "group", r.GetTarget())
+	case nil:
+		s.log.Info("Group Rolled Back",
+			"group", r.GetTarget(),
+			"rev", r.GetRev(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+		)
+		return &pb.Empty{}, nil
+	default:
+		s.log.Warn("Error Rolling Back Group",
+			"group", r.GetTarget(),
+			"rev", r.GetRev(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"error", err,
+		)
+		return &pb.Empty{}, ErrInternal
+	}
+}
+
+// Leader tells clients which server to send writes to when this
+// server's store is shared by a cluster.  Clients may ask this before
+// they have a token, so no authorization is required.
+func (s *Server) Leader(ctx context.Context, r *pb.Empty) (*adminpb.LeaderResult, error) {
+	if s.cluster == nil {
+		return &adminpb.LeaderResult{Clustered: proto.Bool(false)}, nil
+	}
+	leader, ok := s.cluster.Leader()
+	return &adminpb.LeaderResult{
+		Address:   proto.String(leader),
+		Clustered: proto.Bool(ok),
+	}, nil
+}
+
+// Chains lists the entity and group chains of the server along with
+// the hooks in each, in the order that they run.  Since this shows
+// how the server checks requests, it requires GLOBAL_ROOT.
+func (s *Server) Chains(ctx context.Context, r *pb.Empty) (*adminpb.ChainsResult, error) {
+	ctx, err := s.checkToken(ctx)
+	if err != nil {
+		return &adminpb.ChainsResult{}, err
+	}
+	if err := s.isAuthorized(ctx, types.Capability_GLOBAL_ROOT); err != nil {
+		return &adminpb.ChainsResult{}, err
+	}
+
+	return &adminpb.ChainsResult{
+		Entity: chainsToProto(s.EntityChains()),
+		Group:  chainsToProto(s.GroupChains()),
+	}, nil
+}
+
+func chainsToProto(c map[string][]tree.HookInfo) []*adminpb.Chain {
+	out := make([]*adminpb.Chain, 0, len(c))
+	for name, hooks := range c {
+		ch := &adminpb.Chain{Name: proto.String(name)}
+		for _, h := range hooks {
+			ch.Hooks = append(ch.Hooks, &adminpb.Hook{
+				Name:     proto.String(h.Name),
+				Priority: proto.Int32(int32(h.Priority)),
+			})
+		}
+		out = append(out, ch)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetName() < out[j].GetName() })
+	return out
+}
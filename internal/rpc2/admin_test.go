@@ -0,0 +1,452 @@
+package rpc2
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/rpc2/adminpb"
+
+	types "github.com/netauth/protocol"
+	pb "github.com/netauth/protocol/v2"
+)
+
+func TestEntityRestore(t *testing.T) {
+	cases := []struct {
+		ctx      context.Context
+		req      pb.EntityRequest
+		recreate bool
+		wantErr  error
+		readonly bool
+	}{
+		{
+			// Works, entity is restored
+			ctx: PrivilegedContext,
+			req: pb.EntityRequest{
+				Entity: &types.Entity{
+					ID: proto.String("entity1"),
+				},
+			},
+			wantErr:  nil,
+			readonly: false,
+		},
+		{
+			// Fails, server is in read-only mode
+			ctx: PrivilegedContext,
+			req: pb.EntityRequest{
+				Entity: &types.Entity{
+					ID: proto.String("entity1"),
+				},
+			},
+			wantErr:  ErrReadOnly,
+			readonly: true,
+		},
+		{
+			// Fails, token is invalid
+			ctx: InvalidAuthContext,
+			req: pb.EntityRequest{
+				Entity: &types.Entity{
+					ID: proto.String("entity1"),
+				},
+			},
+			wantErr:  ErrUnauthenticated,
+			readonly: false,
+		},
+		{
+			// Fails, token lacks capabilities
+			ctx: UnprivilegedContext,
+			req: pb.EntityRequest{
+				Entity: &types.Entity{
+					ID: proto.String("entity1"),
+				},
+			},
+			wantErr:  ErrRequestorUnqualified,
+			readonly: false,
+		},
+		{
+			// Fails, entity was never destroyed
+			ctx: PrivilegedContext,
+			req: pb.EntityRequest{
+				Entity: &types.Entity{
+					ID: proto.String("admin"),
+				},
+			},
+			wantErr:  ErrDoesNotExist,
+			readonly: false,
+		},
+		{
+			// Fails, the ID has been reused
+			ctx: PrivilegedContext,
+			req: pb.EntityRequest{
+				Entity: &types.Entity{
+					ID: proto.String("entity1"),
+				},
+			},
+			recreate: true,
+			wantErr:  ErrExists,
+			readonly: false,
+		},
+	}
+
+	for i, c := range cases {
+		s := newServer(t)
+		initTree(t, s.Manager)
+		if err := s.DestroyEntity(context.Background(), "entity1"); err != nil {
+			t.Fatal(err)
+		}
+		if c.recreate {
+			s.CreateEntity(context.Background(), "entity1", -1, "secret")
+		}
+		s.readonly = c.readonly
+		if _, err := s.EntityRestore(c.ctx, &c.req); err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestGroupRestore(t *testing.T) {
+	cases := []struct {
+		ctx      context.Context
+		req      pb.GroupRequest
+		recreate bool
+		wantErr  error
+		readonly bool
+	}{
+		{
+			// Works, group is restored
+			ctx: PrivilegedContext,
+			req: pb.GroupRequest{
+				Group: &types.Group{
+					Name: proto.String("group1"),
+				},
+			},
+			wantErr:  nil,
+			readonly: false,
+		},
+		{
+			// Fails, server is in read-only mode
+			ctx: PrivilegedContext,
+			req: pb.GroupRequest{
+				Group: &types.Group{
+					Name: proto.String("group1"),
+				},
+			},
+			wantErr:  ErrReadOnly,
+			readonly: true,
+		},
+		{
+			// Fails, token is invalid
+			ctx: InvalidAuthContext,
+			req: pb.GroupRequest{
+				Group: &types.Group{
+					Name: proto.String("group1"),
+				},
+			},
+			wantErr:  ErrUnauthenticated,
+			readonly: false,
+		},
+		{
+			// Fails, token lacks capabilities
+			ctx: UnprivilegedContext,
+			req: pb.GroupRequest{
+				Group: &types.Group{
+					Name: proto.String("group1"),
+				},
+			},
+			wantErr:  ErrRequestorUnqualified,
+			readonly: false,
+		},
+		{
+			// Fails, group was never destroyed
+			ctx: PrivilegedContext,
+			req: pb.GroupRequest{
+				Group: &types.Group{
+					Name: proto.String("group2"),
+				},
+			},
+			wantErr:  ErrDoesNotExist,
+			readonly: false,
+		},
+		{
+			// Fails, the name has been reused
+			ctx: PrivilegedContext,
+			req: pb.GroupRequest{
+				Group: &types.Group{
+					Name: proto.String("group1"),
+				},
+			},
+			recreate: true,
+			wantErr:  ErrExists,
+			readonly: false,
+		},
+	}
+
+	for i, c := range cases {
+		s := newServer(t)
+		initTree(t, s.Manager)
+		if err := s.DestroyGroup(context.Background(), "group1"); err != nil {
+			t.Fatal(err)
+		}
+		if c.recreate {
+			s.CreateGroup(context.Background(), "group1", "", "", -1)
+		}
+		s.readonly = c.readonly
+		if _, err := s.GroupRestore(c.ctx, &c.req); err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestEntityExpireSecret(t *testing.T) {
+	cases := []struct {
+		ctx      context.Context
+		ID       string
+		wantErr  error
+		readonly bool
+	}{
+		{PrivilegedContext, "entity1", nil, false},
+		{PrivilegedContext, "entity1", ErrReadOnly, true},
+		{InvalidAuthContext, "entity1", ErrUnauthenticated, false},
+		{UnprivilegedContext, "entity1", ErrRequestorUnqualified, false},
+		{PrivilegedContext, "does-not-exist", ErrDoesNotExist, false},
+		{PrivilegedContext, "load-error", ErrInternal, false},
+	}
+
+	for i, c := range cases {
+		s := newServer(t)
+		initTree(t, s.Manager)
+		s.readonly = c.readonly
+		req := &pb.EntityRequest{Entity: &types.Entity{ID: proto.String(c.ID)}}
+		if _, err := s.EntityExpireSecret(c.ctx, req); err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestEntityHistory(t *testing.T) {
+	cases := []struct {
+		ctx      context.Context
+		id       string
+		wantLen  int
+		wantErr  error
+		readonly bool
+	}{
+		{PrivilegedContext, "entity1", 3, nil, false},
+		{PrivilegedContext, "entity1", 3, nil, true},
+		{PrivilegedContext, "does-not-exist", 0, nil, false},
+		{InvalidAuthContext, "entity1", 0, ErrUnauthenticated, false},
+		{UnprivilegedContext, "entity1", 0, ErrRequestorUnqualified, false},
+	}
+
+	for i, c := range cases {
+		s := newServer(t)
+		initTree(t, s.Manager)
+		s.readonly = c.readonly
+
+		res, err := s.EntityHistory(c.ctx, &pb.EntityRequest{Entity: &types.Entity{ID: proto.String(c.id)}})
+		if err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+		if len(res.GetRevisions()) != c.wantLen {
+			t.Errorf("%d: Got %d revisions; Want %d", i, len(res.GetRevisions()), c.wantLen)
+		}
+		for _, r := range res.GetRevisions() {
+			if r.GetEntity().Secret != nil {
+				t.Errorf("%d: History includes the secret", i)
+			}
+		}
+	}
+}
+
+func TestEntityRollback(t *testing.T) {
+	cases := []struct {
+		ctx      context.Context
+		req      adminpb.RollbackRequest
+		wantErr  error
+		readonly bool
+	}{
+		{
+			// Works, KV data is removed again but
+			// entity1 stays in group1
+			ctx:     PrivilegedContext,
+			req:     adminpb.RollbackRequest{Target: proto.String("entity1"), Rev: proto.Int32(1)},
+			wantErr: nil,
+		},
+		{
+			// Fails, server is in read-only mode
+			ctx:      PrivilegedContext,
+			req:      adminpb.RollbackRequest{Target: proto.String("entity1"), Rev: proto.Int32(1)},
+			wantErr:  ErrReadOnly,
+			readonly: true,
+		},
+		{
+			// Fails, token is invalid
+			ctx:     InvalidAuthContext,
+			req:     adminpb.RollbackRequest{Target: proto.String("entity1"), Rev: proto.Int32(1)},
+			wantErr: ErrUnauthenticated,
+		},
+		{
+			// Fails, token lacks capabilities
+			ctx:     UnprivilegedContext,
+			req:     adminpb.RollbackRequest{Target: proto.String("entity1"), Rev: proto.Int32(1)},
+			wantErr: ErrRequestorUnqualified,
+		},
+		{
+			// Fails, no such revision
+			ctx:     PrivilegedContext,
+			req:     adminpb.RollbackRequest{Target: proto.String("entity1"), Rev: proto.Int32(42)},
+			wantErr: ErrDoesNotExist,
+		},
+	}
+
+	for i, c := range cases {
+		s := newServer(t)
+		initTree(t, s.Manager)
+		s.readonly = c.readonly
+
+		if _, err := s.EntityRollback(c.ctx, &c.req); err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+		if c.wantErr != nil {
+			continue
+		}
+
+		e, err := s.FetchEntity(context.Background(), "entity1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(e.GetMeta().GetKV()) != 0 || len(e.GetMeta().GetGroups()) != 1 || e.GetSecret() == "" {
+			t.Errorf("%d: Entity was not rolled back: %v", i, e)
+		}
+		h, err := s.Manager.EntityHistory(context.Background(), "entity1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last := h[len(h)-1]; last.Rev != 4 || last.Actor != "valid" {
+			t.Errorf("%d: Rollback was recorded as %d by %q", i, last.Rev, last.Actor)
+		}
+	}
+}
+
+func TestGroupHistory(t *testing.T) {
+	cases := []struct {
+		ctx     context.Context
+		name    string
+		wantLen int
+		wantErr error
+	}{
+		{PrivilegedContext, "group1", 2, nil},
+		{PrivilegedContext, "group2", 1, nil},
+		{InvalidAuthContext, "group1", 0, ErrUnauthenticated},
+		{UnprivilegedContext, "group1", 0, ErrRequestorUnqualified},
+	}
+
+	for i, c := range cases {
+		s := newServer(t)
+		initTree(t, s.Manager)
+
+		res, err := s.GroupHistory(c.ctx, &pb.GroupRequest{Group: &types.Group{Name: proto.String(c.name)}})
+		if err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+		if len(res.GetRevisions()) != c.wantLen {
+			t.Errorf("%d: Got %d revisions; Want %d", i, len(res.GetRevisions()), c.wantLen)
+		}
+	}
+}
+
+func TestGroupRollback(t *testing.T) {
+	cases := []struct {
+		ctx      context.Context
+		req      adminpb.RollbackRequest
+		wantErr  error
+		readonly bool
+	}{
+		{
+			// Works, KV data is removed again
+			ctx:     PrivilegedContext,
+			req:     adminpb.RollbackRequest{Target: proto.String("group1"), Rev: proto.Int32(1)},
+			wantErr: nil,
+		},
+		{
+			// Fails, server is in read-only mode
+			ctx:      PrivilegedContext,
+			req:      adminpb.RollbackRequest{Target: proto.String("group1"), Rev: proto.Int32(1)},
+			wantErr:  ErrReadOnly,
+			readonly: true,
+		},
+		{
+			// Fails, token lacks capabilities
+			ctx:     UnprivilegedContext,
+			req:     adminpb.RollbackRequest{Target: proto.String("group1"), Rev: proto.Int32(1)},
+			wantErr: ErrRequestorUnqualified,
+		},
+		{
+			// Fails, no such group
+			ctx:     PrivilegedContext,
+			req:     adminpb.RollbackRequest{Target: proto.String("does-not-exist"), Rev: proto.Int32(1)},
+			wantErr: ErrDoesNotExist,
+		},
+	}
+
+	for i, c := range cases {
+		s := newServer(t)
+		initTree(t, s.Manager)
+		s.readonly = c.readonly
+
+		if _, err := s.GroupRollback(c.ctx, &c.req); err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+		if c.wantErr != nil {
+			continue
+		}
+
+		g, err := s.FetchGroup(context.Background(), "group1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(g.GetKV()) != 0 {
+			t.Errorf("%d: Group was not rolled back: %v", i, g)
+		}
+	}
+}
+
+func TestLeader(t *testing.T) {
+	s := newServer(t)
+	res, err := s.Leader(context.Background(), &pb.Empty{})
+	assert.Nil(t, err)
+	assert.False(t, res.GetClustered())
+	assert.Equal(t, "", res.GetAddress())
+
+	s.cluster = fakeCluster{leader: "netauth1:1729"}
+	res, err = s.Leader(context.Background(), &pb.Empty{})
+	assert.Nil(t, err)
+	assert.True(t, res.GetClustered())
+	assert.Equal(t, "netauth1:1729", res.GetAddress())
+}
+
+func TestChains(t *testing.T) {
+	s := newServer(t)
+	_, err := s.Chains(UnprivilegedContext, &pb.Empty{})
+	assert.Equal(t, ErrRequestorUnqualified, err)
+	_, err = s.Chains(context.Background(), &pb.Empty{})
+	assert.NotNil(t, err)
+
+	res, err := s.Chains(PrivilegedContext, &pb.Empty{})
+	assert.Nil(t, err)
+
+	var fetch *adminpb.Chain
+	for i, c := range res.GetEntity() {
+		if i > 0 {
+			assert.Less(t, res.GetEntity()[i-1].GetName(), c.GetName())
+		}
+		if c.GetName() == "FETCH" {
+			fetch = c
+		}
+	}
+	assert.NotNil(t, fetch)
+	assert.Equal(t, "load-entity", fetch.GetHooks()[0].GetName())
+	assert.NotEmpty(t, res.GetGroup())
+}
@@ -0,0 +1,432 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package adminpb
+
+import (
+	context "context"
+	v2 "github.com/netauth/protocol/v2"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	// EntityRestore brings back an entity that was destroyed and has
+	// not yet been purged.  This requires CREATE_ENTITY.
+	EntityRestore(ctx context.Context, in *v2.EntityRequest, opts ...grpc.CallOption) (*v2.Empty, error)
+	// GroupRestore brings back a group that was destroyed and has not
+	// yet been purged.  This requires CREATE_GROUP.
+	GroupRestore(ctx context.Context, in *v2.GroupRequest, opts ...grpc.CallOption) (*v2.Empty, error)
+	// EntityExpireSecret marks the secret of an entity as needing to
+	// be changed.  Until it is, the entity can authenticate only to
+	// change it.  This requires CHANGE_ENTITY_SECRET.
+	EntityExpireSecret(ctx context.Context, in *v2.EntityRequest, opts ...grpc.CallOption) (*v2.Empty, error)
+	// EntityHistory returns the revisions of an entity that the server
+	// still keeps, oldest first.  This requires MODIFY_ENTITY_META.
+	EntityHistory(ctx context.Context, in *v2.EntityRequest, opts ...grpc.CallOption) (*EntityHistoryResult, error)
+	// EntityRollback returns an entity to an earlier revision.  This
+	// requires MODIFY_ENTITY_META.
+	EntityRollback(ctx context.Context, in *RollbackRequest, opts ...grpc.CallOption) (*v2.Empty, error)
+	// GroupHistory returns the revisions of a group that the server
+	// still keeps, oldest first.  This requires MODIFY_GROUP_META.
+	GroupHistory(ctx context.Context, in *v2.GroupRequest, opts ...grpc.CallOption) (*GroupHistoryResult, error)
+	// GroupRollback returns a group to an earlier revision.  This
+	// requires MODIFY_GROUP_META.
+	GroupRollback(ctx context.Context, in *RollbackRequest, opts ...grpc.CallOption) (*v2.Empty, error)
+	// Leader returns the address of the server that accepts writes
+	// when the server's store is shared by a cluster.  This requires no
+	// authorization.
+	Leader(ctx context.Context, in *v2.Empty, opts ...grpc.CallOption) (*LeaderResult, error)
+	// Chains lists every entity and group chain with its hooks in the
+	// order that they run, including the hooks of plugins.  This
+	// requires GLOBAL_ROOT.
+	Chains(ctx context.Context, in *v2.Empty, opts ...grpc.CallOption) (*ChainsResult, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) EntityRestore(ctx context.Context, in *v2.EntityRequest, opts ...grpc.CallOption) (*v2.Empty, error) {
+	out := new(v2.Empty)
+	err := c.cc.Invoke(ctx, "/netauth.admin.Admin/EntityRestore", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GroupRestore(ctx context.Context, in *v2.GroupRequest, opts ...grpc.CallOption) (*v2.Empty, error) {
+	out := new(v2.Empty)
+	err := c.cc.Invoke(ctx, "/netauth.admin.Admin/GroupRestore", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) EntityExpireSecret(ctx context.Context, in *v2.EntityRequest, opts ...grpc.CallOption) (*v2.Empty, error) {
+	out := new(v2.Empty)
+	err := c.cc.Invoke(ctx, "/netauth.admin.Admin/EntityExpireSecret", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) EntityHistory(ctx context.Context, in *v2.EntityRequest, opts ...grpc.CallOption) (*EntityHistoryResult, error) {
+	out := new(EntityHistoryResult)
+	err := c.cc.Invoke(ctx, "/netauth.admin.Admin/EntityHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) EntityRollback(ctx context.Context, in *RollbackRequest, opts ...grpc.CallOption) (*v2.Empty, error) {
+	out := new(v2.Empty)
+	err := c.cc.Invoke(ctx, "/netauth.admin.Admin/EntityRollback", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GroupHistory(ctx context.Context, in *v2.GroupRequest, opts ...grpc.CallOption) (*GroupHistoryResult, error) {
+	out := new(GroupHistoryResult)
+	err := c.cc.Invoke(ctx, "/netauth.admin.Admin/GroupHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GroupRollback(ctx context.Context, in *RollbackRequest, opts ...grpc.CallOption) (*v2.Empty, error) {
+	out := new(v2.Empty)
+	err := c.cc.Invoke(ctx, "/netauth.admin.Admin/GroupRollback", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Leader(ctx context.Context, in *v2.Empty, opts ...grpc.CallOption) (*LeaderResult, error) {
+	out := new(LeaderResult)
+	err := c.cc.Invoke(ctx, "/netauth.admin.Admin/Leader", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Chains(ctx context.Context, in *v2.Empty, opts ...grpc.CallOption) (*ChainsResult, error) {
+	out := new(ChainsResult)
+	err := c.cc.Invoke(ctx, "/netauth.admin.Admin/Chains", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	// EntityRestore brings back an entity that was destroyed and has
+	// not yet been purged.  This requires CREATE_ENTITY.
+	EntityRestore(context.Context, *v2.EntityRequest) (*v2.Empty, error)
+	// GroupRestore brings back a group that was destroyed and has not
+	// yet been purged.  This requires CREATE_GROUP.
+	GroupRestore(context.Context, *v2.GroupRequest) (*v2.Empty, error)
+	// EntityExpireSecret marks the secret of an entity as needing to
+	// be changed.  Until it is, the entity can authenticate only to
+	// change it.  This requires CHANGE_ENTITY_SECRET.
+	EntityExpireSecret(context.Context, *v2.EntityRequest) (*v2.Empty, error)
+	// EntityHistory returns the revisions of an entity that the server
+	// still keeps, oldest first.  This requires MODIFY_ENTITY_META.
+	EntityHistory(context.Context, *v2.EntityRequest) (*EntityHistoryResult, error)
+	// EntityRollback returns an entity to an earlier revision.  This
+	// requires MODIFY_ENTITY_META.
+	EntityRollback(context.Context, *RollbackRequest) (*v2.Empty, error)
+	// GroupHistory returns the revisions of a group that the server
+	// still keeps, oldest first.  This requires MODIFY_GROUP_META.
+	GroupHistory(context.Context, *v2.GroupRequest) (*GroupHistoryResult, error)
+	// GroupRollback returns a group to an earlier revision.  This
+	// requires MODIFY_GROUP_META.
+	GroupRollback(context.Context, *RollbackRequest) (*v2.Empty, error)
+	// Leader returns the address of the server that accepts writes
+	// when the server's store is shared by a cluster.  This requires no
+	// authorization.
+	Leader(context.Context, *v2.Empty) (*LeaderResult, error)
+	// Chains lists every entity and group chain with its hooks in the
+	// order that they run, including the hooks of plugins.  This
+	// requires GLOBAL_ROOT.
+	Chains(context.Context, *v2.Empty) (*ChainsResult, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) EntityRestore(context.Context, *v2.EntityRequest) (*v2.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EntityRestore not implemented")
+}
+func (UnimplementedAdminServer) GroupRestore(context.Context, *v2.GroupRequest) (*v2.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GroupRestore not implemented")
+}
+func (UnimplementedAdminServer) EntityExpireSecret(context.Context, *v2.EntityRequest) (*v2.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EntityExpireSecret not implemented")
+}
+func (UnimplementedAdminServer) EntityHistory(context.Context, *v2.EntityRequest) (*EntityHistoryResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EntityHistory not implemented")
+}
+func (UnimplementedAdminServer) EntityRollback(context.Context, *RollbackRequest) (*v2.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EntityRollback not implemented")
+}
+func (UnimplementedAdminServer) GroupHistory(context.Context, *v2.GroupRequest) (*GroupHistoryResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GroupHistory not implemented")
+}
+func (UnimplementedAdminServer) GroupRollback(context.Context, *RollbackRequest) (*v2.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GroupRollback not implemented")
+}
+func (UnimplementedAdminServer) Leader(context.Context, *v2.Empty) (*LeaderResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Leader not implemented")
+}
+func (UnimplementedAdminServer) Chains(context.Context, *v2.Empty) (*ChainsResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Chains not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_EntityRestore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(v2.EntityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).EntityRestore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netauth.admin.Admin/EntityRestore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).EntityRestore(ctx, req.(*v2.EntityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GroupRestore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(v2.GroupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GroupRestore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netauth.admin.Admin/GroupRestore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GroupRestore(ctx, req.(*v2.GroupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_EntityExpireSecret_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(v2.EntityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).EntityExpireSecret(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netauth.admin.Admin/EntityExpireSecret",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).EntityExpireSecret(ctx, req.(*v2.EntityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_EntityHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(v2.EntityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).EntityHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netauth.admin.Admin/EntityHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).EntityHistory(ctx, req.(*v2.EntityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_EntityRollback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollbackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).EntityRollback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netauth.admin.Admin/EntityRollback",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).EntityRollback(ctx, req.(*RollbackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GroupHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(v2.GroupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GroupHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netauth.admin.Admin/GroupHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GroupHistory(ctx, req.(*v2.GroupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GroupRollback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollbackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GroupRollback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netauth.admin.Admin/GroupRollback",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GroupRollback(ctx, req.(*RollbackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Leader_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(v2.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Leader(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netauth.admin.Admin/Leader",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Leader(ctx, req.(*v2.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Chains_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(v2.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Chains(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/netauth.admin.Admin/Chains",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Chains(ctx, req.(*v2.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "netauth.admin.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "EntityRestore",
+			Handler:    _Admin_EntityRestore_Handler,
+		},
+		{
+			MethodName: "GroupRestore",
+			Handler:    _Admin_GroupRestore_Handler,
+		},
+		{
+			MethodName: "EntityExpireSecret",
+			Handler:    _Admin_EntityExpireSecret_Handler,
+		},
+		{
+			MethodName: "EntityHistory",
+			Handler:    _Admin_EntityHistory_Handler,
+		},
+		{
+			MethodName: "EntityRollback",
+			Handler:    _Admin_EntityRollback_Handler,
+		},
+		{
+			MethodName: "GroupHistory",
+			Handler:    _Admin_GroupHistory_Handler,
+		},
+		{
+			MethodName: "GroupRollback",
+			Handler:    _Admin_GroupRollback_Handler,
+		},
+		{
+			MethodName: "Leader",
+			Handler:    _Admin_Leader_Handler,
+		},
+		{
+			MethodName: "Chains",
+			Handler:    _Admin_Chains_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
@@ -3,6 +3,7 @@ package rpc2
 import (
 	"context"
 
+	"github.com/netauth/netauth/internal/tree"
 	"github.com/netauth/netauth/pkg/token"
 
 	types "github.com/netauth/protocol"
@@ -14,7 +15,15 @@ import (
 func (s *Server) AuthEntity(ctx context.Context, r *pb.AuthRequest) (*pb.Empty, error) {
 	e := r.GetEntity()
 
-	if err := s.ValidateSecret(ctx, e.GetID(), r.GetSecret()); err != nil {
+	err := s.ValidateSecret(ctx, e.GetID(), r.GetSecret())
+	if err == tree.ErrSecretExpired {
+		s.log.Info("Authentication Refused, Secret Expired",
+			"entity", e.GetID(),
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx))
+		return &pb.Empty{}, ErrSecretExpired
+	}
+	if err != nil {
 		s.log.Info("Authentication Failed",
 			"entity", e.GetID(),
 			"service", getServiceName(ctx),
@@ -91,7 +100,7 @@ func (s *Server) AuthChangeSecret(ctx context.Context, r *pb.AuthRequest) (*pb.E
 	// While technically a non-local secret database would allow
 	// this to proceed, we instead require that mutating requests
 	// always hit a fully writeable server.
-	if s.readonly {
+	if s.isReadOnly() {
 		s.log.Warn("Mutable request in read-only mode!",
 			"method", "AuthChangeSecret",
 			"client", getClientName(ctx),
@@ -100,21 +109,25 @@ func (s *Server) AuthChangeSecret(ctx context.Context, r *pb.AuthRequest) (*pb.E
 		return &pb.Empty{}, ErrReadOnly
 	}
 
-	// Token validation and authorization
+	// Token validation and authorization.  An entity whose secret
+	// has expired can't get a token, so it may change its own
+	// secret with the expired secret alone.  Either way the secret
+	// is only checked once.
 	var err error
 	ctx, err = s.checkToken(ctx)
 	if err != nil {
-		s.log.Warn("Permissions Denied for AuthChangeSecret",
-			"entity", e.GetID(),
-			"service", getServiceName(ctx),
-			"client", getClientName(ctx),
-			"error", err)
-		return &pb.Empty{}, err
-	}
-
-	// Changing for self, must have the original secret
-	if getTokenClaims(ctx).EntityID == e.GetID() {
-		if err := s.ValidateSecret(ctx, e.GetID(), e.GetSecret()); err != nil {
+		if s.ValidateSecret(ctx, e.GetID(), e.GetSecret()) != tree.ErrSecretExpired {
+			s.log.Warn("Permissions Denied for AuthChangeSecret",
+				"entity", e.GetID(),
+				"service", getServiceName(ctx),
+				"client", getClientName(ctx),
+				"error", err)
+			return &pb.Empty{}, err
+		}
+	} else if getTokenClaims(ctx).EntityID == e.GetID() {
+		// Changing for self, must have the original secret,
+		// which may have expired.
+		if err := s.ValidateSecret(ctx, e.GetID(), e.GetSecret()); err != nil && err != tree.ErrSecretExpired {
 			s.log.Info("Permission Denied for AuthChangeSecret",
 				"modself", true,
 				"entity", e.GetID(),
@@ -139,12 +152,24 @@ func (s *Server) AuthChangeSecret(ctx context.Context, r *pb.AuthRequest) (*pb.E
 
 	// Set the secret
 	if err := s.SetSecret(ctx, e.GetID(), r.GetSecret()); err != nil {
+		if perr, ok := err.(*tree.SecretPolicyError); ok {
+			s.log.Info("Secret refused by policy",
+				"entity", e.GetID(),
+				"service", getServiceName(ctx),
+				"client", getClientName(ctx),
+				"reason", perr.Reason,
+			)
+			return &pb.Empty{}, secretPolicyError(perr)
+		}
 		s.log.Warn("Secret Manipulation Error",
 			"entity", e.GetID(),
 			"service", getServiceName(ctx),
 			"client", getClientName(ctx),
 			"error", err,
 		)
+		if err == tree.ErrConflict {
+			return &pb.Empty{}, ErrConflict
+		}
 		return &pb.Empty{}, ErrInternal
 	}
 	s.log.Info("Secret Changed",
@@ -223,3 +223,49 @@ func TestAuthChangeSecret(t *testing.T) {
 		}
 	}
 }
+
+func TestAuthSecretExpired(t *testing.T) {
+	s := newServer(t)
+	initTree(t, s.Manager)
+	if err := s.ExpireSecret(context.Background(), "entity1"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &pb.AuthRequest{
+		Entity: &types.Entity{ID: proto.String("entity1")},
+		Secret: proto.String("secret"),
+	}
+	if _, err := s.AuthEntity(context.Background(), req); err != ErrSecretExpired {
+		t.Errorf("AuthEntity: Got %v; Want %v", err, ErrSecretExpired)
+	}
+	if _, err := s.AuthGetToken(context.Background(), req); err != ErrSecretExpired {
+		t.Errorf("AuthGetToken: Got %v; Want %v", err, ErrSecretExpired)
+	}
+
+	// The wrong secret doesn't reveal that the secret has expired,
+	// and isn't enough to change it.
+	req.Secret = proto.String("wrong")
+	if _, err := s.AuthEntity(context.Background(), req); err != ErrUnauthenticated {
+		t.Errorf("AuthEntity: Got %v; Want %v", err, ErrUnauthenticated)
+	}
+	_, err := s.AuthChangeSecret(UnauthenticatedContext, &pb.AuthRequest{
+		Entity: &types.Entity{ID: proto.String("entity1"), Secret: proto.String("wrong")},
+		Secret: proto.String("secret1"),
+	})
+	if err == nil {
+		t.Error("AuthChangeSecret: Secret was changed without the old secret")
+	}
+
+	// The expired secret is enough to change it without a token.
+	_, err = s.AuthChangeSecret(UnauthenticatedContext, &pb.AuthRequest{
+		Entity: &types.Entity{ID: proto.String("entity1"), Secret: proto.String("secret")},
+		Secret: proto.String("secret1"),
+	})
+	if err != nil {
+		t.Fatalf("AuthChangeSecret: Got %v; Want nil", err)
+	}
+	req.Secret = proto.String("secret1")
+	if _, err := s.AuthGetToken(context.Background(), req); err != nil {
+		t.Errorf("AuthGetToken: Got %v; Want nil", err)
+	}
+}
@@ -13,4 +13,8 @@ var (
 	UnprivilegedContext    = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", null.ValidEmptyToken))
 	UnauthenticatedContext = metadata.NewIncomingContext(context.Background(), nil)
 	InvalidAuthContext     = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", null.InvalidToken))
+
+	// Entity1Context has no capabilities, but entity1 is a member
+	// of group1, which manages group2.
+	Entity1Context = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", `{"EntityID":"entity1","Capabilities":[]}`))
 )
@@ -0,0 +1,70 @@
+package rpc2
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/tree"
+)
+
+// mdDryRun is the request metadata that asks for a change to be
+// checked but not saved.  Every hook runs except those that would
+// save the change, and the entities and groups that would have been
+// saved are returned in the response trailer as serialized protos,
+// one per value of mdDryRunEntity or mdDryRunGroup.  Secrets are
+// never returned.  Requests that would run hooks from plugins are
+// refused, since there is no telling what those hooks save.
+const (
+	mdDryRun       = "dry-run"
+	mdDryRunEntity = "dry-run-entity-bin"
+	mdDryRunGroup  = "dry-run-group-bin"
+)
+
+// withDryRun starts a dry run if the request asks for one.  The
+// function that is returned sends the would-be results to the client
+// and must be called with the error of the request once it has been
+// handled.  It returns the error that should be sent to the client,
+// which is ErrDryRunUnsupported if the request could not be dry run.
+func (s *Server) withDryRun(ctx context.Context, method string) (context.Context, func(error) error) {
+	if getSingleStringFromMetadata(ctx, mdDryRun) != "true" {
+		return ctx, func(err error) error { return err }
+	}
+	ctx, d := tree.WithDryRun(ctx)
+	return ctx, func(err error) error {
+		if d.Refused() {
+			s.log.Info("Request could not be dry run",
+				"method", method,
+				"client", getClientName(ctx),
+				"service", getServiceName(ctx),
+			)
+			return ErrDryRunUnsupported
+		}
+		md := metadata.MD{}
+		for _, e := range d.Entities() {
+			b, err := proto.Marshal(e)
+			if err != nil {
+				s.log.Warn("Error marshaling dry run result", "error", err)
+				continue
+			}
+			md.Append(mdDryRunEntity, string(b))
+		}
+		for _, g := range d.Groups() {
+			b, err := proto.Marshal(g)
+			if err != nil {
+				s.log.Warn("Error marshaling dry run result", "error", err)
+				continue
+			}
+			md.Append(mdDryRunGroup, string(b))
+		}
+		s.log.Info("Request was a dry run, nothing was saved",
+			"method", method,
+			"client", getClientName(ctx),
+			"service", getServiceName(ctx),
+		)
+		grpc.SetTrailer(ctx, md)
+		return err
+	}
+}
@@ -0,0 +1,64 @@
+package rpc2
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/pkg/token/null"
+
+	types "github.com/netauth/protocol"
+	pb "github.com/netauth/protocol/v2"
+)
+
+func TestWithDryRun(t *testing.T) {
+	s := newServer(t)
+	initTree(t, s.Manager)
+
+	cases := []struct {
+		id        string
+		dryRun    string
+		wantErr   error
+		want      []string
+		wantSaved bool
+	}{
+		{"entity2", "false", nil, nil, true},
+		{"entity3", "true", nil, []string{"entity3"}, false},
+		{"entity1", "true", ErrExists, nil, true},
+	}
+	for i, c := range cases {
+		st := &trailerStream{}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			"authorization", null.ValidToken,
+			mdDryRun, c.dryRun,
+		))
+		ctx = grpc.NewContextWithServerTransportStream(ctx, st)
+		req := &pb.EntityRequest{Entity: &types.Entity{ID: proto.String(c.id), Number: proto.Int32(-1), Secret: proto.String("secret")}}
+
+		ctx, done := s.withDryRun(ctx, "EntityCreate")
+		_, err := s.EntityCreate(ctx, req)
+		if err = done(err); err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+
+		var got []string
+		for _, b := range st.trailer.Get(mdDryRunEntity) {
+			e := new(types.Entity)
+			if err := proto.Unmarshal([]byte(b), e); err != nil {
+				t.Fatal(err)
+			}
+			if e.Secret != nil {
+				t.Errorf("%d: Secret was returned", i)
+			}
+			got = append(got, e.GetID())
+		}
+		assert.Equal(t, c.want, got, "Test Number %d", i)
+
+		_, err = s.FetchEntity(context.Background(), c.id)
+		assert.Equal(t, c.wantSaved, err == nil, "Test Number %d", i)
+	}
+}
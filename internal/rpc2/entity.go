@@ -14,12 +14,24 @@ import (
 // correct token is held, which must contain either CREATE_ENTITY or
 // GLOBAL_ROOT permissions.
 func (s *Server) EntityCreate(ctx context.Context, r *pb.EntityRequest) (*pb.Empty, error) {
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_CREATE_ENTITY); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_CREATE_ENTITY)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
 	e := r.GetEntity()
-	switch err := s.CreateEntity(ctx, e.GetID(), e.GetNumber(), e.GetSecret()); err {
+	err = s.CreateEntity(ctx, e.GetID(), e.GetNumber(), e.GetSecret())
+	if perr, ok := err.(*tree.SecretPolicyError); ok {
+		s.log.Info("Entity secret refused by policy",
+			"entity", e.GetID(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+			"reason", perr.Reason,
+		)
+		return &pb.Empty{}, secretPolicyError(perr)
+	}
+	switch err {
 	case tree.ErrDuplicateEntityID, tree.ErrDuplicateNumber:
 		s.log.Warn("Attempt to create duplicate entity",
 			"entity", e.GetID(),
@@ -29,6 +41,8 @@ func (s *Server) EntityCreate(ctx context.Context, r *pb.EntityRequest) (*pb.Emp
 			"error", err,
 		)
 		return &pb.Empty{}, ErrExists
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "entity", e.GetID())
 	case nil:
 		s.log.Info("Entity Created",
 			"entity", e.GetID(),
@@ -56,7 +70,8 @@ func (s *Server) EntityCreate(ctx context.Context, r *pb.EntityRequest) (*pb.Emp
 // must be in possession of a token with MODIFY_ENTITY_META
 // capabilities.
 func (s *Server) EntityUpdate(ctx context.Context, r *pb.EntityRequest) (*pb.Empty, error) {
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_ENTITY_META); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_ENTITY_META)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
@@ -71,6 +86,8 @@ func (s *Server) EntityUpdate(ctx context.Context, r *pb.EntityRequest) (*pb.Emp
 		)
 		return &pb.Empty{}, ErrDoesNotExist
 
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "entity", de.GetID())
 	case nil:
 		s.log.Info("Entity Updated",
 			"entity", de.GetID(),
@@ -129,8 +146,17 @@ func (s *Server) EntityInfo(ctx context.Context, r *pb.EntityRequest) (*pb.ListO
 func (s *Server) EntitySearch(ctx context.Context, r *pb.SearchRequest) (*pb.ListOfEntities, error) {
 	expr := r.GetExpression()
 
-	res, err := s.SearchEntities(ctx, db.SearchRequest{Expression: expr})
+	req, err := getSearchRequest(ctx, expr)
 	if err != nil {
+		return &pb.ListOfEntities{}, err
+	}
+
+	res, page, err := s.SearchEntities(ctx, req)
+	switch err {
+	case nil:
+	case db.ErrBadSearch:
+		return &pb.ListOfEntities{}, ErrMalformedRequest
+	default:
 		s.log.Warn("Search Error",
 			"expr", expr,
 			"service", getServiceName(ctx),
@@ -140,6 +166,7 @@ func (s *Server) EntitySearch(ctx context.Context, r *pb.SearchRequest) (*pb.Lis
 		return &pb.ListOfEntities{}, ErrInternal
 	}
 
+	setSearchHeader(ctx, page)
 	return &pb.ListOfEntities{Entities: res}, nil
 }
 
@@ -154,7 +181,7 @@ func (s *Server) EntityUM(ctx context.Context, r *pb.KVRequest) (*pb.ListOfStrin
 	}
 
 	if r.GetAction() != pb.Action_READ {
-		if s.readonly {
+		if s.isReadOnly() {
 			s.log.Warn("Mutable request in read-only mode!",
 				"method", "EntityUM",
 				"client", getClientName(ctx),
@@ -186,6 +213,18 @@ func (s *Server) EntityUM(ctx context.Context, r *pb.KVRequest) (*pb.ListOfStrin
 			"client", getClientName(ctx),
 		)
 		return &pb.ListOfStrings{}, ErrDoesNotExist
+	case tree.ErrReservedKey:
+		s.log.Warn("Reserved key can't be changed",
+			"method", "EntityUM",
+			"entity", r.GetTarget(),
+			"key", r.GetKey(),
+			"authority", getTokenClaims(ctx).EntityID,
+			"service", getServiceName(ctx),
+			"client", getClientName(ctx),
+		)
+		return &pb.ListOfStrings{}, ErrMalformedRequest
+	case tree.ErrConflict:
+		return &pb.ListOfStrings{}, s.conflict(ctx, "entity", r.GetTarget())
 	case nil:
 		s.log.Info("Entity Updated",
 			"entity", r.GetTarget(),
@@ -248,11 +287,12 @@ func (s *Server) EntityKVGet(ctx context.Context, r *pb.KV2Request) (*pb.ListOfK
 // EntityKVAdd takes the input KV2 data and adds it to an entity if an
 // only if it does not conflict with an existing key.
 func (s *Server) EntityKVAdd(ctx context.Context, r *pb.KV2Request) (*pb.Empty, error) {
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_ENTITY_META); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_ENTITY_META)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
-	err := s.Manager.EntityKVAdd(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
+	err = s.Manager.EntityKVAdd(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
 	switch err {
 	case db.ErrUnknownEntity:
 		s.log.Warn("Entity does not exist!",
@@ -271,6 +311,8 @@ func (s *Server) EntityKVAdd(ctx context.Context, r *pb.KV2Request) (*pb.Empty,
 			"error", err,
 		)
 		return &pb.Empty{}, ErrExists
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "entity", r.GetTarget())
 	case nil:
 		s.log.Info("Entity KV Updated",
 			"entity", r.GetTarget(),
@@ -294,11 +336,12 @@ func (s *Server) EntityKVAdd(ctx context.Context, r *pb.KV2Request) (*pb.Empty,
 // EntityKVDel removes an existing key from an entity.  If the key is
 // not present an error will be returned.
 func (s *Server) EntityKVDel(ctx context.Context, r *pb.KV2Request) (*pb.Empty, error) {
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_ENTITY_META); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_ENTITY_META)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
-	err := s.Manager.EntityKVDel(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
+	err = s.Manager.EntityKVDel(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
 	switch err {
 	case db.ErrUnknownEntity:
 		s.log.Warn("Entity does not exist!",
@@ -316,6 +359,8 @@ func (s *Server) EntityKVDel(ctx context.Context, r *pb.KV2Request) (*pb.Empty,
 			"client", getClientName(ctx),
 		)
 		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "entity", r.GetTarget())
 	case nil:
 		s.log.Info("Entity KV Data Dumped",
 			"entity", r.GetTarget(),
@@ -340,11 +385,12 @@ func (s *Server) EntityKVDel(ctx context.Context, r *pb.KV2Request) (*pb.Empty,
 // The key must already exist on the entity or an error will be
 // returned.
 func (s *Server) EntityKVReplace(ctx context.Context, r *pb.KV2Request) (*pb.Empty, error) {
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_ENTITY_META); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_ENTITY_META)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
-	err := s.Manager.EntityKVReplace(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
+	err = s.Manager.EntityKVReplace(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
 	switch err {
 	case db.ErrUnknownEntity:
 		s.log.Warn("Entity does not exist!",
@@ -362,6 +408,8 @@ func (s *Server) EntityKVReplace(ctx context.Context, r *pb.KV2Request) (*pb.Emp
 			"client", getClientName(ctx),
 		)
 		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "entity", r.GetTarget())
 	case nil:
 		s.log.Info("Entity KV Data Updated",
 			"entity", r.GetTarget(),
@@ -391,7 +439,7 @@ func (s *Server) EntityKeys(ctx context.Context, r *pb.KVRequest) (*pb.ListOfStr
 	}
 
 	if r.GetAction() != pb.Action_READ {
-		if s.readonly {
+		if s.isReadOnly() {
 			s.log.Warn("Mutable request in read-only mode!",
 				"method", "EntityUM",
 				"client", getClientName(ctx),
@@ -424,6 +472,8 @@ func (s *Server) EntityKeys(ctx context.Context, r *pb.KVRequest) (*pb.ListOfStr
 			"client", getClientName(ctx),
 		)
 		return &pb.ListOfStrings{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.ListOfStrings{}, s.conflict(ctx, "entity", r.GetTarget())
 	case nil:
 		s.log.Info("Entity Updated",
 			"entity", r.GetTarget(),
@@ -448,7 +498,8 @@ func (s *Server) EntityKeys(ctx context.Context, r *pb.KVRequest) (*pb.ListOfStr
 // generally discouraged, but if you must then this function will do
 // it.
 func (s *Server) EntityDestroy(ctx context.Context, r *pb.EntityRequest) (*pb.Empty, error) {
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_DESTROY_ENTITY); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_DESTROY_ENTITY)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
@@ -462,6 +513,8 @@ func (s *Server) EntityDestroy(ctx context.Context, r *pb.EntityRequest) (*pb.Em
 			"client", getClientName(ctx),
 		)
 		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "entity", e.GetID())
 	case nil:
 		s.log.Info("Entity Updated",
 			"entity", e.GetID(),
@@ -485,7 +538,8 @@ func (s *Server) EntityDestroy(ctx context.Context, r *pb.EntityRequest) (*pb.Em
 
 // EntityLock sets the lock flag on an entity.
 func (s *Server) EntityLock(ctx context.Context, r *pb.EntityRequest) (*pb.Empty, error) {
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_LOCK_ENTITY); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_LOCK_ENTITY)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
@@ -499,6 +553,8 @@ func (s *Server) EntityLock(ctx context.Context, r *pb.EntityRequest) (*pb.Empty
 			"client", getClientName(ctx),
 		)
 		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "entity", e.GetID())
 	case nil:
 		s.log.Info("Entity Locked",
 			"entity", e.GetID(),
@@ -522,7 +578,8 @@ func (s *Server) EntityLock(ctx context.Context, r *pb.EntityRequest) (*pb.Empty
 
 // EntityUnlock clears the lock flag on an entity.
 func (s *Server) EntityUnlock(ctx context.Context, r *pb.EntityRequest) (*pb.Empty, error) {
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_UNLOCK_ENTITY); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_UNLOCK_ENTITY)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
@@ -536,6 +593,8 @@ func (s *Server) EntityUnlock(ctx context.Context, r *pb.EntityRequest) (*pb.Emp
 			"client", getClientName(ctx),
 		)
 		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "entity", e.GetID())
 	case nil:
 		s.log.Info("Entity Unlocked",
 			"entity", e.GetID(),
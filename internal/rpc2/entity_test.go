@@ -7,6 +7,8 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/tree"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/proto"
 
 	types "github.com/netauth/protocol"
@@ -253,11 +255,13 @@ func TestEntityInfo(t *testing.T) {
 
 func TestEntitySearch(t *testing.T) {
 	cases := []struct {
+		ctx     context.Context
 		req     pb.SearchRequest
 		wantErr error
 	}{
 		{
 			// Works, entity1 can be loaded
+			ctx: context.Background(),
 			req: pb.SearchRequest{
 				Expression: proto.String("ID:entity1"),
 			},
@@ -265,18 +269,43 @@ func TestEntitySearch(t *testing.T) {
 		},
 		{
 			// Fails, load-error is included in the set of all
+			ctx: context.Background(),
 			req: pb.SearchRequest{
 				Expression: proto.String("*"),
 			},
 			wantErr: ErrInternal,
 		},
+		{
+			// Works, the first page stops before load-error
+			ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("page-size", "1")),
+			req: pb.SearchRequest{
+				Expression: proto.String("*"),
+			},
+			wantErr: nil,
+		},
+		{
+			// Fails, page size isn't a number
+			ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("page-size", "many")),
+			req: pb.SearchRequest{
+				Expression: proto.String("*"),
+			},
+			wantErr: ErrMalformedRequest,
+		},
+		{
+			// Fails, page token wasn't issued by the server
+			ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("page-token", "bogus")),
+			req: pb.SearchRequest{
+				Expression: proto.String("*"),
+			},
+			wantErr: ErrMalformedRequest,
+		},
 	}
 
 	for i, c := range cases {
 		s, d, _ := newServerWithRefs(t)
 		initTree(t, s.Manager)
 		d.(*db.DB).IndexEntity(&types.Entity{ID: proto.String("load-error")})
-		if _, err := s.EntitySearch(context.Background(), &c.req); err != c.wantErr {
+		if _, err := s.EntitySearch(c.ctx, &c.req); err != c.wantErr {
 			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
 		}
 	}
@@ -380,6 +409,18 @@ func TestEntityUM(t *testing.T) {
 			readonly: false,
 			wantRes:  "",
 		},
+		{
+			// Fails, the age of secrets can't be changed
+			ctx: PrivilegedContext,
+			req: pb.KVRequest{
+				Target: proto.String("entity1"),
+				Action: pb.Action_CLEAREXACT.Enum(),
+				Key:    proto.String(tree.SecretMustChangeKey),
+			},
+			wantErr:  ErrMalformedRequest,
+			readonly: false,
+			wantRes:  "",
+		},
 		{
 			// Fails, bad request
 			ctx: PrivilegedContext,
@@ -513,6 +554,17 @@ func TestEntityKVAdd(t *testing.T) {
 			req:     &pb.KV2Request{Target: proto.String("load-error")},
 			wantErr: ErrInternal,
 		},
+		{
+			ro:  false,
+			ctx: PrivilegedContext,
+			req: &pb.KV2Request{
+				Target: proto.String("conflict"),
+				Data: &types.KVData{
+					Key: proto.String("key2"),
+				},
+			},
+			wantErr: ErrConflict,
+		},
 		{
 			ro:      true,
 			ctx:     PrivilegedContext,
@@ -524,6 +576,7 @@ func TestEntityKVAdd(t *testing.T) {
 	for i, c := range cases {
 		s := newServer(t)
 		initTree(t, s.Manager)
+		s.CreateEntity(context.Background(), "conflict", -1, "")
 		s.readonly = c.ro
 
 		_, err := s.EntityKVAdd(c.ctx, c.req)
@@ -3,6 +3,8 @@ package rpc2
 import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+
+	"github.com/netauth/netauth/internal/tree"
 )
 
 var (
@@ -49,4 +51,32 @@ var (
 	// entity or group that does not exist, or when an expansion
 	// that doesn't exist is modified.
 	ErrDoesNotExist = status.Errorf(codes.NotFound, "The requested resource does not exist")
+
+	// ErrConflict is returned when the request lost a race with
+	// another request modifying the same entity or group.  Nothing
+	// was changed, and the request can be retried as is.
+	ErrConflict = status.Errorf(codes.Aborted, "The resource was modified concurrently, retry the request")
+
+	// ErrSecretExpired is returned when an entity authenticates
+	// with a secret that is correct but has expired.  No token is
+	// issued, and the entity may only change its secret.  This is
+	// the only error that is sent with FailedPrecondition, so
+	// clients can tell it apart by its code.
+	ErrSecretExpired = status.Errorf(codes.FailedPrecondition, "The secret has expired and must be changed")
+
+	// ErrUnknownRealm is returned when a request names a realm
+	// that the server doesn't serve.
+	ErrUnknownRealm = status.Errorf(codes.InvalidArgument, "The requested realm does not exist")
+
+	// ErrDryRunUnsupported is returned when a dry run is asked of
+	// a request that would run hooks from plugins.  The server
+	// can't tell what those hooks would save, so nothing is run.
+	ErrDryRunUnsupported = status.Errorf(codes.Unimplemented, "The request runs plugins and can't be dry run")
 )
+
+// secretPolicyError is returned when a new secret is refused by the
+// secret policy.  Unlike the other errors its message differs from
+// one request to the next, since it says why the secret was refused.
+func secretPolicyError(err *tree.SecretPolicyError) error {
+	return status.Errorf(codes.InvalidArgument, "The secret does not meet the secret policy: %s", err.Reason)
+}
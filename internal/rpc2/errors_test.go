@@ -0,0 +1,68 @@
+package rpc2
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/crypto/nocrypto"
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/memory"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+	"github.com/netauth/netauth/pkg/token/null"
+
+	types "github.com/netauth/protocol"
+	pb "github.com/netauth/protocol/v2"
+)
+
+func TestSecretPolicyError(t *testing.T) {
+	startup.DoCallbacks()
+	mdb, err := db.New("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crypto, err := nocrypto.New(hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := tree.New(
+		tree.WithStorage(mdb),
+		tree.WithCrypto(crypto),
+		tree.WithSecretPolicy(tree.SecretPolicy{MinLength: 8}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(WithEntityTree(m), WithTokenService(null.New(hclog.NewNullLogger(), null.NewKeyProvider())))
+	if err := m.CreateEntity(context.Background(), "entity1", -1, "long-enough"); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(what string, err error) {
+		st, _ := status.FromError(err)
+		if st.Code() != codes.InvalidArgument || !strings.Contains(st.Message(), "at least 8 characters") {
+			t.Errorf("%s: Got %v; Want a secret policy error", what, err)
+		}
+	}
+
+	_, err = s.EntityCreate(PrivilegedContext, &pb.EntityRequest{
+		Entity: &types.Entity{ID: proto.String("test1"), Secret: proto.String("short")},
+	})
+	check("EntityCreate", err)
+
+	_, err = s.AuthChangeSecret(PrivilegedContext, &pb.AuthRequest{
+		Entity: &types.Entity{ID: proto.String("entity1")},
+		Secret: proto.String("short"),
+	})
+	check("AuthChangeSecret", err)
+
+	if _, err := m.FetchEntity(context.Background(), "test1"); err == nil {
+		t.Error("Entity was created with a refused secret")
+	}
+}
@@ -16,7 +16,8 @@ import (
 func (s *Server) GroupCreate(ctx context.Context, r *pb.GroupRequest) (*pb.Empty, error) {
 	g := r.GetGroup()
 
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_CREATE_GROUP); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_CREATE_GROUP)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
@@ -30,6 +31,8 @@ func (s *Server) GroupCreate(ctx context.Context, r *pb.GroupRequest) (*pb.Empty
 			"error", err,
 		)
 		return &pb.Empty{}, ErrExists
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "group", g.GetName())
 	case nil:
 		s.log.Info("Group Created",
 			"group", g.GetName(),
@@ -55,7 +58,7 @@ func (s *Server) GroupCreate(ctx context.Context, r *pb.GroupRequest) (*pb.Empty
 // untyped metadata.
 func (s *Server) GroupUpdate(ctx context.Context, r *pb.GroupRequest) (*pb.Empty, error) {
 	g := r.GetGroup()
-	err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META)
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META)
 	if err != nil && !s.manageByMembership(ctx, getTokenClaims(ctx).EntityID, g) {
 		return &pb.Empty{}, err
 	}
@@ -70,6 +73,8 @@ func (s *Server) GroupUpdate(ctx context.Context, r *pb.GroupRequest) (*pb.Empty
 			"error", err,
 		)
 		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "group", g.GetName())
 	case nil:
 		s.log.Info("Group Updated",
 			"group", g.GetName(),
@@ -134,7 +139,8 @@ func (s *Server) GroupUM(ctx context.Context, r *pb.KVRequest) (*pb.ListOfString
 	}
 
 	if r.GetAction() != pb.Action_READ {
-		err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META)
+		var err error
+		ctx, err = s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META)
 		g := types.Group{Name: proto.String(r.GetTarget())}
 		if err != nil && !s.manageByMembership(ctx, getTokenClaims(ctx).EntityID, &g) {
 			return &pb.ListOfStrings{}, err
@@ -153,6 +159,8 @@ func (s *Server) GroupUM(ctx context.Context, r *pb.KVRequest) (*pb.ListOfString
 			"client", getClientName(ctx),
 		)
 		return &pb.ListOfStrings{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.ListOfStrings{}, s.conflict(ctx, "group", r.GetTarget())
 	case nil:
 		s.log.Info("Group Updated",
 			"group", r.GetTarget(),
@@ -217,11 +225,12 @@ func (s *Server) GroupKVGet(ctx context.Context, r *pb.KV2Request) (*pb.ListOfKV
 // GroupKVAdd takes the input KV2 data and adds it to an group if an
 // only if it does not conflict with an existing key.
 func (s *Server) GroupKVAdd(ctx context.Context, r *pb.KV2Request) (*pb.Empty, error) {
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
-	err := s.Manager.GroupKVAdd(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
+	err = s.Manager.GroupKVAdd(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
 	switch err {
 	case db.ErrUnknownGroup:
 		s.log.Warn("Group does not exist!",
@@ -231,6 +240,8 @@ func (s *Server) GroupKVAdd(ctx context.Context, r *pb.KV2Request) (*pb.Empty, e
 			"client", getClientName(ctx),
 		)
 		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "group", r.GetTarget())
 	case nil:
 		s.log.Info("Group KV Updated Dumped",
 			"group", r.GetTarget(),
@@ -254,11 +265,12 @@ func (s *Server) GroupKVAdd(ctx context.Context, r *pb.KV2Request) (*pb.Empty, e
 // GroupKVDel removes an existing key from an group.  If the key is
 // not present an error will be returned.
 func (s *Server) GroupKVDel(ctx context.Context, r *pb.KV2Request) (*pb.Empty, error) {
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
-	err := s.Manager.GroupKVDel(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
+	err = s.Manager.GroupKVDel(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
 	switch err {
 	case db.ErrUnknownGroup:
 		s.log.Warn("Group does not exist!",
@@ -268,6 +280,8 @@ func (s *Server) GroupKVDel(ctx context.Context, r *pb.KV2Request) (*pb.Empty, e
 			"client", getClientName(ctx),
 		)
 		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "group", r.GetTarget())
 	case nil:
 		s.log.Info("Group KV Data Dumped",
 			"group", r.GetTarget(),
@@ -292,11 +306,12 @@ func (s *Server) GroupKVDel(ctx context.Context, r *pb.KV2Request) (*pb.Empty, e
 // The key must already exist on the group or an error will be
 // returned.
 func (s *Server) GroupKVReplace(ctx context.Context, r *pb.KV2Request) (*pb.Empty, error) {
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
-	err := s.Manager.GroupKVReplace(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
+	err = s.Manager.GroupKVReplace(ctx, r.GetTarget(), []*types.KVData{r.GetData()})
 	switch err {
 	case db.ErrUnknownGroup:
 		s.log.Warn("Group does not exist!",
@@ -306,6 +321,8 @@ func (s *Server) GroupKVReplace(ctx context.Context, r *pb.KV2Request) (*pb.Empt
 			"client", getClientName(ctx),
 		)
 		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "group", r.GetTarget())
 	case nil:
 		s.log.Info("Group KV Data Updated",
 			"group", r.GetTarget(),
@@ -330,7 +347,7 @@ func (s *Server) GroupKVReplace(ctx context.Context, r *pb.KV2Request) (*pb.Empt
 func (s *Server) GroupUpdateRules(ctx context.Context, r *pb.GroupRulesRequest) (*pb.Empty, error) {
 	g := r.GetGroup()
 
-	err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META)
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_META)
 	if err != nil && !s.manageByMembership(ctx, getTokenClaims(ctx).EntityID, g) {
 		return &pb.Empty{}, err
 	}
@@ -344,6 +361,8 @@ func (s *Server) GroupUpdateRules(ctx context.Context, r *pb.GroupRulesRequest)
 			"client", getClientName(ctx),
 		)
 		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "group", g.GetName())
 	case nil:
 		s.log.Info("Group Updated",
 			"group", g.GetName(),
@@ -369,7 +388,7 @@ func (s *Server) GroupUpdateRules(ctx context.Context, r *pb.GroupRulesRequest)
 func (s *Server) GroupAddMember(ctx context.Context, r *pb.EntityRequest) (*pb.Empty, error) {
 	e := r.GetEntity()
 
-	preErr := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_MEMBERS)
+	ctx, preErr := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_MEMBERS)
 	for _, g := range e.GetMeta().GetGroups() {
 		grp := types.Group{Name: proto.String(g)}
 		if preErr != nil && !s.manageByMembership(ctx, getTokenClaims(ctx).EntityID, &grp) {
@@ -389,6 +408,9 @@ func (s *Server) GroupAddMember(ctx context.Context, r *pb.EntityRequest) (*pb.E
 				"client", getClientName(ctx),
 				"error", err,
 			)
+			if err == tree.ErrConflict {
+				return &pb.Empty{}, ErrConflict
+			}
 			return &pb.Empty{}, ErrInternal
 		}
 	}
@@ -399,7 +421,7 @@ func (s *Server) GroupAddMember(ctx context.Context, r *pb.EntityRequest) (*pb.E
 func (s *Server) GroupDelMember(ctx context.Context, r *pb.EntityRequest) (*pb.Empty, error) {
 	e := r.GetEntity()
 
-	preErr := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_MEMBERS)
+	ctx, preErr := s.mutablePrequisitesMet(ctx, types.Capability_MODIFY_GROUP_MEMBERS)
 	for _, g := range e.GetMeta().GetGroups() {
 		grp := types.Group{Name: proto.String(g)}
 		if preErr != nil && !s.manageByMembership(ctx, getTokenClaims(ctx).EntityID, &grp) {
@@ -419,6 +441,9 @@ func (s *Server) GroupDelMember(ctx context.Context, r *pb.EntityRequest) (*pb.E
 				"client", getClientName(ctx),
 				"error", err,
 			)
+			if err == tree.ErrConflict {
+				return &pb.Empty{}, ErrConflict
+			}
 			return &pb.Empty{}, ErrInternal
 		}
 	}
@@ -431,7 +456,8 @@ func (s *Server) GroupDelMember(ctx context.Context, r *pb.EntityRequest) (*pb.E
 func (s *Server) GroupDestroy(ctx context.Context, r *pb.GroupRequest) (*pb.Empty, error) {
 	g := r.GetGroup()
 
-	if err := s.mutablePrequisitesMet(ctx, types.Capability_DESTROY_GROUP); err != nil {
+	ctx, err := s.mutablePrequisitesMet(ctx, types.Capability_DESTROY_GROUP)
+	if err != nil {
 		return &pb.Empty{}, err
 	}
 
@@ -444,6 +470,8 @@ func (s *Server) GroupDestroy(ctx context.Context, r *pb.GroupRequest) (*pb.Empt
 			"client", getClientName(ctx),
 		)
 		return &pb.Empty{}, ErrDoesNotExist
+	case tree.ErrConflict:
+		return &pb.Empty{}, s.conflict(ctx, "group", g.GetName())
 	case nil:
 		s.log.Info("Group Updated",
 			"group", g.GetName(),
@@ -498,8 +526,17 @@ func (s *Server) GroupMembers(ctx context.Context, r *pb.GroupRequest) (*pb.List
 func (s *Server) GroupSearch(ctx context.Context, r *pb.SearchRequest) (*pb.ListOfGroups, error) {
 	expr := r.GetExpression()
 
-	res, err := s.SearchGroups(ctx, db.SearchRequest{Expression: expr})
+	req, err := getSearchRequest(ctx, expr)
 	if err != nil {
+		return &pb.ListOfGroups{}, err
+	}
+
+	res, page, err := s.SearchGroups(ctx, req)
+	switch err {
+	case nil:
+	case db.ErrBadSearch:
+		return &pb.ListOfGroups{}, ErrMalformedRequest
+	default:
 		s.log.Warn("Search Error",
 			"expr", expr,
 			"service", getServiceName(ctx),
@@ -507,7 +544,8 @@ func (s *Server) GroupSearch(ctx context.Context, r *pb.SearchRequest) (*pb.List
 			"error", err,
 		)
 		return &pb.ListOfGroups{}, ErrInternal
-
 	}
+
+	setSearchHeader(ctx, page)
 	return &pb.ListOfGroups{Groups: res}, nil
 }
@@ -817,6 +817,23 @@ func TestGroupAddMember(t *testing.T) {
 			wantErr:  ErrInternal,
 			readonly: false,
 		},
+		{
+			// Fails, membership in the managing group
+			// doesn't allow changing members
+			ctx: Entity1Context,
+			req: pb.EntityRequest{
+				Entity: &types.Entity{
+					ID: proto.String("unprivileged"),
+					Meta: &types.EntityMeta{
+						Groups: []string{
+							"group2",
+						},
+					},
+				},
+			},
+			wantErr:  ErrRequestorUnqualified,
+			readonly: false,
+		},
 	}
 	for i, c := range cases {
 		s := newServer(t)
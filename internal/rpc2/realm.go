@@ -0,0 +1,55 @@
+package rpc2
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/netauth/netauth/internal/rpc2/adminpb"
+
+	rpc "github.com/netauth/protocol/v2"
+)
+
+// mdRealm is the request metadata that names the realm a request is
+// for.  Requests that don't name one are for the default realm.
+const mdRealm = "realm"
+
+// Realms serves several independent realms from one gRPC server.
+// Each realm has a Server of its own, with its own tree and token
+// service, and the default realm's Server is the one stored under the
+// empty name.
+type Realms map[string]*Server
+
+// Register registers the NetAuth and admin services with r so that
+// each request is handled by the Server of the realm it names.
+func (rs Realms) Register(r grpc.ServiceRegistrar) {
+	r.RegisterService(rs.route(rpc.NetAuth2_ServiceDesc), rs[""])
+	r.RegisterService(rs.route(adminpb.Admin_ServiceDesc), rs[""])
+}
+
+// route returns a copy of sd whose methods hand each request to the
+// Server of its realm rather than to the server the service was
+// registered with.  This is also where requests that ask to be traced
+// or to be a dry run have that set up.
+func (rs Realms) route(sd grpc.ServiceDesc) *grpc.ServiceDesc {
+	methods := make([]grpc.MethodDesc, len(sd.Methods))
+	for i, m := range sd.Methods {
+		h := m.Handler
+		methods[i] = grpc.MethodDesc{
+			MethodName: m.MethodName,
+			Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, ic grpc.UnaryServerInterceptor) (interface{}, error) {
+				s, ok := rs[getSingleStringFromMetadata(ctx, mdRealm)]
+				if !ok {
+					return nil, ErrUnknownRealm
+				}
+				ctx, traced := s.withTrace(ctx, m.MethodName)
+				defer traced()
+				ctx, dryRun := s.withDryRun(ctx, m.MethodName)
+				res, err := h(s, ctx, dec, ic)
+				return res, dryRun(err)
+			},
+		}
+	}
+	sd.Methods = methods
+	return &sd
+}
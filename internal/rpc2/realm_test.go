@@ -0,0 +1,59 @@
+package rpc2
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	types "github.com/netauth/protocol"
+	pb "github.com/netauth/protocol/v2"
+)
+
+type recordingRegistrar map[string]*grpc.ServiceDesc
+
+func (r recordingRegistrar) RegisterService(sd *grpc.ServiceDesc, _ interface{}) {
+	r[sd.ServiceName] = sd
+}
+
+func TestRealms(t *testing.T) {
+	prod := newServer(t)
+	initTree(t, prod.Manager)
+	lab := newServer(t)
+
+	r := make(recordingRegistrar)
+	Realms{"": prod, "lab": lab}.Register(r)
+	if _, ok := r["netauth.admin.Admin"]; !ok {
+		t.Fatal("Admin service was not registered")
+	}
+
+	var info grpc.MethodDesc
+	for _, m := range r["netauth.v2.NetAuth2"].Methods {
+		if m.MethodName == "EntityInfo" {
+			info = m
+		}
+	}
+	req := &pb.EntityRequest{Entity: &types.Entity{ID: proto.String("entity1")}}
+	dec := func(v interface{}) error {
+		proto.Merge(v.(proto.Message), req)
+		return nil
+	}
+
+	cases := []struct {
+		realm   []string
+		wantErr error
+	}{
+		{nil, nil},
+		{[]string{"realm", ""}, nil},
+		{[]string{"realm", "lab"}, ErrDoesNotExist},
+		{[]string{"realm", "dev"}, ErrUnknownRealm},
+	}
+	for i, c := range cases {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(c.realm...))
+		if _, err := info.Handler(nil, ctx, dec, nil); err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+	}
+}
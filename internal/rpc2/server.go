@@ -26,3 +26,8 @@ func WithTokenService(t token.Service) Option { return func(s *Server) { s.Servi
 func WithEntityTree(t Manager) Option { return func(s *Server) { s.Manager = t } }
 
 func WithDisabledWrites(r bool) Option { return func(s *Server) { s.readonly = r } }
+
+// WithCluster refuses writes whenever the store that the server uses
+// isn't writeable from this server, and tells clients which server
+// they should send them to instead.
+func WithCluster(c Cluster) Option { return func(s *Server) { s.cluster = c } }
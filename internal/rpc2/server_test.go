@@ -21,6 +21,8 @@ import (
 
 type errorableKV struct {
 	db.KVStore
+
+	racing bool
 }
 
 func (e *errorableKV) Put(ctx context.Context, k string, v []byte) error {
@@ -34,7 +36,17 @@ func (e *errorableKV) Get(ctx context.Context, k string) ([]byte, error) {
 	if path.Base(k) == "load-error" {
 		return nil, db.ErrInternalError
 	}
-	return e.KVStore.Get(ctx, k)
+	v, err := e.KVStore.Get(ctx, k)
+	if path.Base(k) == "conflict" && err == nil && !e.racing {
+		// Simulate another request changing the value after
+		// every read by appending an unknown field to it.  The
+		// flag stops the reads made by the event callbacks from
+		// recursing back into here.
+		e.racing = true
+		e.KVStore.Put(ctx, k, append(v, 0xf8, 0x07, 0x01))
+		e.racing = false
+	}
+	return v, err
 }
 
 func newServer(t *testing.T) *Server {
@@ -42,10 +54,10 @@ func newServer(t *testing.T) *Server {
 
 	db.RegisterKV("errorable", func(l hclog.Logger) (db.KVStore, error) {
 		mkv, _ := memory.NewKV(l)
-		return &errorableKV{mkv}, nil
+		return &errorableKV{KVStore: mkv}, nil
 	})
 
-	db, err := db.New("errorable")
+	db, err := db.New("errorable", db.WithHistory(10))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -70,7 +82,7 @@ func newServerWithRefs(t *testing.T) (*Server, tree.DB, Manager) {
 
 	db.RegisterKV("errorable", func(l hclog.Logger) (db.KVStore, error) {
 		mkv, _ := memory.NewKV(l)
-		return &errorableKV{mkv}, nil
+		return &errorableKV{KVStore: mkv}, nil
 	})
 
 	db, err := db.New("errorable")
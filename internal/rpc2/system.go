@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/netauth/netauth/internal/health"
+	"github.com/netauth/netauth/internal/tree"
 
 	types "github.com/netauth/protocol"
 	pb "github.com/netauth/protocol/v2"
@@ -13,7 +14,7 @@ import (
 // default, or if specified directly on an entity.  These capabilities
 // only have meaning within NetAuth.
 func (s *Server) SystemCapabilities(ctx context.Context, r *pb.CapabilityRequest) (*pb.Empty, error) {
-	if s.readonly {
+	if s.isReadOnly() {
 		s.log.Warn("Mutable request in read-only mode!",
 			"method", "SystemCapabilities",
 			"client", getClientName(ctx),
@@ -63,6 +64,9 @@ func (s *Server) SystemCapabilities(ctx context.Context, r *pb.CapabilityRequest
 			"service", getServiceName(ctx),
 			"error", err,
 		)
+		if err == tree.ErrConflict {
+			return &pb.Empty{}, ErrConflict
+		}
 		return &pb.Empty{}, ErrInternal
 	}
 
@@ -0,0 +1,74 @@
+package rpc2
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/netauth/netauth/internal/tree"
+
+	types "github.com/netauth/protocol"
+)
+
+// mdTrace is the request metadata that asks for the hooks that run on
+// behalf of a request to be traced.  The trace is returned in the
+// response trailer with one value of mdTrace per hook, whether or not
+// the request succeeded.  Traces carry the errors of hooks, which can
+// say more than the response does, such as why an authentication
+// failed, so they are only returned to a caller with a valid
+// GLOBAL_ROOT token.  Every trace is logged.
+const mdTrace = "trace"
+
+// withTrace starts a trace of the request if it asks for one.  The
+// function that is returned sends the trace to the client if it may
+// see it and must be called once the request has been handled.
+func (s *Server) withTrace(ctx context.Context, method string) (context.Context, func()) {
+	if getSingleStringFromMetadata(ctx, mdTrace) != "true" {
+		return ctx, func() {}
+	}
+	send := s.isGlobalRoot(ctx)
+	ctx, t := tree.WithTrace(ctx)
+	return ctx, func() {
+		hooks := t.Hooks()
+		md := metadata.MD{}
+		lines := make([]string, len(hooks))
+		for i, h := range hooks {
+			lines[i] = formatHookTrace(h)
+			md.Append(mdTrace, lines[i])
+		}
+		s.log.Info("Request traced",
+			"method", method,
+			"hooks", lines,
+			"returned", send,
+			"client", getClientName(ctx),
+			"service", getServiceName(ctx),
+		)
+		if send {
+			grpc.SetTrailer(ctx, md)
+		}
+	}
+}
+
+// isGlobalRoot reports whether the request carries a valid token with
+// GLOBAL_ROOT.  Unlike checkToken nothing is logged, since the
+// request may not need a token at all.
+func (s *Server) isGlobalRoot(ctx context.Context) bool {
+	tkn := getSingleStringFromMetadata(ctx, "authorization")
+	if tkn == "" {
+		return false
+	}
+	c, err := s.Validate(tkn)
+	return err == nil && c.HasCapability(types.Capability_GLOBAL_ROOT)
+}
+
+// formatHookTrace renders a hook's run as the chain and hook names,
+// how long the hook took, and the error it returned if there was one.
+func formatHookTrace(h tree.HookTrace) string {
+	s := fmt.Sprintf("%s %s %s", h.Chain, h.Hook, h.Duration)
+	if h.Err != nil {
+		s += ": " + h.Err.Error()
+	}
+	return s
+}
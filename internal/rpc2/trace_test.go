@@ -0,0 +1,87 @@
+package rpc2
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/tree"
+	"github.com/netauth/netauth/pkg/token/null"
+
+	types "github.com/netauth/protocol"
+	pb "github.com/netauth/protocol/v2"
+)
+
+// trailerStream records the trailer that a handler sets.
+type trailerStream struct {
+	grpc.ServerTransportStream
+	trailer metadata.MD
+}
+
+func (s *trailerStream) Method() string { return "test" }
+
+func (s *trailerStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+func TestWithTrace(t *testing.T) {
+	s := newServer(t)
+	initTree(t, s.Manager)
+	req := &pb.EntityRequest{Entity: &types.Entity{ID: proto.String("entity1")}}
+
+	cases := []struct {
+		md       metadata.MD
+		wantHook string
+	}{
+		{metadata.MD{}, ""},
+		{metadata.Pairs(mdTrace, "false", "authorization", null.ValidToken), ""},
+		{metadata.Pairs(mdTrace, "true", "authorization", null.ValidToken), "FETCH load-entity "},
+		{metadata.Pairs(mdTrace, "true"), ""},
+		{metadata.Pairs(mdTrace, "true", "authorization", null.ValidEmptyToken), ""},
+		{metadata.Pairs(mdTrace, "true", "authorization", null.InvalidToken), ""},
+	}
+	for i, c := range cases {
+		st := &trailerStream{}
+		ctx := metadata.NewIncomingContext(context.Background(), c.md)
+		ctx = grpc.NewContextWithServerTransportStream(ctx, st)
+
+		ctx, done := s.withTrace(ctx, "EntityInfo")
+		if _, err := s.EntityInfo(ctx, req); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		done()
+
+		trace := st.trailer.Get(mdTrace)
+		if c.wantHook == "" {
+			if len(trace) != 0 {
+				t.Errorf("%d: Trace was returned: %v", i, trace)
+			}
+			continue
+		}
+		if len(trace) != 1 || !strings.HasPrefix(trace[0], c.wantHook) {
+			t.Errorf("%d: Got %v; Want %q", i, trace, c.wantHook)
+		}
+	}
+}
+
+func TestFormatHookTrace(t *testing.T) {
+	cases := []struct {
+		h    tree.HookTrace
+		want string
+	}{
+		{tree.HookTrace{Chain: "CREATE", Hook: "save-entity", Duration: time.Millisecond}, "CREATE save-entity 1ms"},
+		{tree.HookTrace{Chain: "CREATE", Hook: "check-policy", Duration: 2 * time.Second, Err: errors.New("denied")}, "CREATE check-policy 2s: denied"},
+	}
+	for i, c := range cases {
+		if got := formatHookTrace(c.h); got != c.want {
+			t.Errorf("%d: Got %q; Want %q", i, got, c.want)
+		}
+	}
+}
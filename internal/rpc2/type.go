@@ -6,6 +6,8 @@ import (
 	"github.com/hashicorp/go-hclog"
 
 	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/rpc2/adminpb"
+	"github.com/netauth/netauth/internal/tree"
 	"github.com/netauth/netauth/pkg/token"
 
 	pb "github.com/netauth/protocol"
@@ -17,8 +19,10 @@ import (
 type Server struct {
 	token.Service
 	Manager
+	adminpb.UnimplementedAdminServer
 
 	readonly bool
+	cluster  Cluster
 	log      hclog.Logger
 }
 
@@ -33,9 +37,10 @@ type Refs struct {
 type Manager interface {
 	CreateEntity(context.Context, string, int32, string) error
 	FetchEntity(context.Context, string) (*pb.Entity, error)
-	SearchEntities(context.Context, db.SearchRequest) ([]*pb.Entity, error)
+	SearchEntities(context.Context, db.SearchRequest) ([]*pb.Entity, db.SearchResult, error)
 	ValidateSecret(context.Context, string, string) error
 	SetSecret(context.Context, string, string) error
+	ExpireSecret(context.Context, string) error
 	LockEntity(context.Context, string) error
 	UnlockEntity(context.Context, string) error
 	UpdateEntityMeta(context.Context, string, *pb.EntityMeta) error
@@ -46,10 +51,13 @@ type Manager interface {
 	UpdateEntityKeys(context.Context, string, string, string, string) ([]string, error)
 	ManageUntypedEntityMeta(context.Context, string, string, string, string) ([]string, error)
 	DestroyEntity(context.Context, string) error
+	RestoreEntity(context.Context, string) error
+	EntityHistory(context.Context, string) ([]db.EntityRevision, error)
+	RollbackEntity(context.Context, string, int) error
 
 	CreateGroup(context.Context, string, string, string, int32) error
 	FetchGroup(context.Context, string) (*pb.Group, error)
-	SearchGroups(context.Context, db.SearchRequest) ([]*pb.Group, error)
+	SearchGroups(context.Context, db.SearchRequest) ([]*pb.Group, db.SearchResult, error)
 	UpdateGroupMeta(context.Context, string, *pb.Group) error
 	ManageUntypedGroupMeta(context.Context, string, string, string, string) ([]string, error)
 	GroupKVGet(context.Context, string, []*pb.KVData) ([]*pb.KVData, error)
@@ -57,6 +65,9 @@ type Manager interface {
 	GroupKVDel(context.Context, string, []*pb.KVData) error
 	GroupKVReplace(context.Context, string, []*pb.KVData) error
 	DestroyGroup(context.Context, string) error
+	RestoreGroup(context.Context, string) error
+	GroupHistory(context.Context, string) ([]db.GroupRevision, error)
+	RollbackGroup(context.Context, string, int) error
 
 	AddEntityToGroup(context.Context, string, string) error
 	RemoveEntityFromGroup(context.Context, string, string) error
@@ -68,6 +79,16 @@ type Manager interface {
 	DropEntityCapability2(context.Context, string, *pb.Capability) error
 	SetGroupCapability2(context.Context, string, *pb.Capability) error
 	DropGroupCapability2(context.Context, string, *pb.Capability) error
+
+	EntityChains() map[string][]tree.HookInfo
+	GroupChains() map[string][]tree.HookInfo
+}
+
+// A Cluster is a store that is shared by several servers, only one
+// of which accepts writes at a time.
+type Cluster interface {
+	Leader() (string, bool)
+	Capabilities() []db.KVCapability
 }
 
 // Options configure the server
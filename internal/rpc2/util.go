@@ -2,10 +2,12 @@ package rpc2
 
 import (
 	"context"
+	"strconv"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 
+	"github.com/netauth/netauth/internal/db"
 	"github.com/netauth/netauth/pkg/token"
 
 	types "github.com/netauth/protocol"
@@ -13,6 +15,17 @@ import (
 
 type claimsContextKey struct{}
 
+// Searches are paged and sorted using request metadata, and report
+// the total number of results and the token for the next page in the
+// response header.
+const (
+	mdPageSize      = "page-size"
+	mdPageToken     = "page-token"
+	mdSort          = "sort"
+	mdTotal         = "total"
+	mdNextPageToken = "next-page-token"
+)
+
 func (s *Server) getCapabilitiesForEntity(ctx context.Context, id string) []types.Capability {
 	// Get the full fledged entity; we can assert no error here
 	// since the entity was just loaded to perform an
@@ -60,8 +73,9 @@ func (s *Server) getCapabilitiesForEntity(ctx context.Context, id string) []type
 // This authorization is present in the form of a token in the
 // "authorization" field of the request metadata which is extracted
 // and used here.  The end result is that claims are added to a
-// returned context.  Actually using these claims should be done by
-// isAuthorized.
+// returned context, along with the entity ID so that changes made
+// with the context are attributed to it.  Actually using these claims
+// should be done by isAuthorized.
 func (s *Server) checkToken(ctx context.Context) (context.Context, error) {
 	tkn := getSingleStringFromMetadata(ctx, "authorization")
 	method, ok := grpc.Method(ctx)
@@ -87,6 +101,7 @@ func (s *Server) checkToken(ctx context.Context) (context.Context, error) {
 		return ctx, ErrUnauthenticated
 	}
 	ctx = context.WithValue(ctx, claimsContextKey{}, c)
+	ctx = db.WithActor(ctx, c.EntityID)
 	return ctx, nil
 }
 
@@ -127,6 +142,37 @@ func getSingleStringFromMetadata(ctx context.Context, key string) string {
 	return sl[0]
 }
 
+// getSearchRequest builds a search for the expression using the
+// paging and sorting options in the request metadata.
+func getSearchRequest(ctx context.Context, expr string) (db.SearchRequest, error) {
+	r := db.SearchRequest{
+		Expression: expr,
+		PageToken:  getSingleStringFromMetadata(ctx, mdPageToken),
+	}
+	if ps := getSingleStringFromMetadata(ctx, mdPageSize); ps != "" {
+		n, err := strconv.Atoi(ps)
+		if err != nil || n < 0 {
+			return r, ErrMalformedRequest
+		}
+		r.PageSize = n
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		r.Sort = md.Get(mdSort)
+	}
+	return r, nil
+}
+
+// setSearchHeader tells the client how many results there are in
+// total and how to fetch the next page.  Clients that don't page
+// ignore the header.
+func setSearchHeader(ctx context.Context, res db.SearchResult) {
+	md := metadata.Pairs(mdTotal, strconv.FormatUint(res.Total, 10))
+	if res.NextPageToken != "" {
+		md.Append(mdNextPageToken, res.NextPageToken)
+	}
+	grpc.SetHeader(ctx, md)
+}
+
 // getClientName returns the client name.  If no name was set, the
 // string "BOGUS_CLIENT" is returned.
 func getClientName(ctx context.Context) string {
@@ -189,27 +235,59 @@ func (s *Server) manageByMembership(ctx context.Context, entityID string, g *typ
 	return false
 }
 
+// isReadOnly returns true if writes must not be made through this
+// server, either because they were disabled or because another server
+// in the cluster is the one that accepts them.
+func (s *Server) isReadOnly() bool {
+	if s.readonly {
+		return true
+	}
+	if s.cluster == nil {
+		return false
+	}
+	for _, c := range s.cluster.Capabilities() {
+		if c == db.KVMutable {
+			return false
+		}
+	}
+	return true
+}
+
 // mutablePrequisitesAreMet checks for common mutable prerequisites
 // such as the server being in a writeable mode, and the correct
-// capability being present in a valid token.
-func (s *Server) mutablePrequisitesMet(ctx context.Context, c types.Capability) error {
-	if s.readonly {
+// capability being present in a valid token.  If they are, the
+// context that is returned carries the token's claims, which
+// attribute any changes made with it to the requesting entity.
+// Otherwise the context is returned as it was passed in.
+func (s *Server) mutablePrequisitesMet(ctx context.Context, c types.Capability) (context.Context, error) {
+	if s.isReadOnly() {
 		s.log.Warn("Mutable request in read-only mode!",
 			"method", "EntityUM",
 			"client", getClientName(ctx),
 			"service", getServiceName(ctx),
 		)
-		return ErrReadOnly
+		return ctx, ErrReadOnly
 	}
 
 	// Token validation and authorization
-	var err error
-	ctx, err = s.checkToken(ctx)
+	cctx, err := s.checkToken(ctx)
 	if err != nil {
-		return err
+		return ctx, err
 	}
-	if err := s.isAuthorized(ctx, c); err != nil {
-		return err
+	if err := s.isAuthorized(cctx, c); err != nil {
+		return ctx, err
 	}
-	return nil
+	return cctx, nil
+}
+
+// conflict logs a request that lost a race with a concurrent update
+// to the named entity or group, and returns the error for the client.
+func (s *Server) conflict(ctx context.Context, kind, name string) error {
+	s.log.Warn("Conflicting concurrent update",
+		kind, name,
+		"authority", getTokenClaims(ctx).EntityID,
+		"service", getServiceName(ctx),
+		"client", getClientName(ctx),
+	)
+	return ErrConflict
 }
@@ -8,6 +8,7 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/netauth/netauth/internal/db"
 	"github.com/netauth/netauth/pkg/token"
 
 	types "github.com/netauth/protocol"
@@ -203,6 +204,40 @@ func TestMutablePrequisitesMet(t *testing.T) {
 		initTree(t, s.Manager)
 		s.readonly = c.ro
 
-		assert.Equalf(t, c.wantErr, s.mutablePrequisitesMet(c.ctx, c.cap), "Test Number %d", i)
+		_, err := s.mutablePrequisitesMet(c.ctx, c.cap)
+		assert.Equalf(t, c.wantErr, err, "Test Number %d", i)
+	}
+}
+
+type fakeCluster struct {
+	leader  string
+	mutable bool
+}
+
+func (c fakeCluster) Leader() (string, bool) { return c.leader, true }
+
+func (c fakeCluster) Capabilities() []db.KVCapability {
+	if c.mutable {
+		return []db.KVCapability{db.KVMutable}
+	}
+	return nil
+}
+
+func TestIsReadOnly(t *testing.T) {
+	cases := []struct {
+		ro      bool
+		cluster Cluster
+		want    bool
+	}{
+		{false, nil, false},
+		{true, nil, true},
+		{false, fakeCluster{mutable: true}, false},
+		{false, fakeCluster{mutable: false}, true},
+		{true, fakeCluster{mutable: true}, true},
+	}
+
+	for i, c := range cases {
+		s := &Server{readonly: c.ro, cluster: c.cluster}
+		assert.Equal(t, c.want, s.isReadOnly(), "Test Number %d", i)
 	}
 }
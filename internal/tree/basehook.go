@@ -14,6 +14,8 @@ type BaseHook struct {
 	log      hclog.Logger
 	storage  DB
 	crypto   crypto.EMCrypto
+	policy   SecretPolicy
+	persists bool
 }
 
 // Name returns the name of a hook.  Names should be kabob case.
@@ -40,6 +42,12 @@ func (h *BaseHook) Storage() DB { return h.storage }
 
 func (h *BaseHook) Crypto() crypto.EMCrypto { return h.crypto }
 
+func (h *BaseHook) SecretPolicy() SecretPolicy { return h.policy }
+
+// Persists reports whether a hook writes the changes of its chain to
+// storage.  Such hooks are skipped during a dry run.
+func (h *BaseHook) Persists() bool { return h.persists }
+
 // NewBaseHook returns a BaseHook struct for compact initialization
 // during callback constructors.
 func NewBaseHook(opts ...HookOption) BaseHook {
@@ -65,3 +73,7 @@ func WithHookPriority(p int) HookOption { return func(b *BaseHook) { b.priority
 func WithHookStorage(d DB) HookOption { return func(b *BaseHook) { b.storage = d } }
 
 func WithHookCrypto(c crypto.EMCrypto) HookOption { return func(b *BaseHook) { b.crypto = c } }
+
+func WithHookSecretPolicy(p SecretPolicy) HookOption { return func(b *BaseHook) { b.policy = p } }
+
+func WithHookPersists(p bool) HookOption { return func(b *BaseHook) { b.persists = p } }
@@ -6,21 +6,42 @@ var (
 			"fail-on-existing-entity",
 			"set-entity-id",
 			"set-entity-number",
+			"validate-secret-policy",
 			"set-entity-secret",
 			"save-entity",
 		},
 		"DESTROY": {
 			"load-entity",
-			"destroy-entity",
+			"tombstone-entity",
+		},
+		"RESTORE": {
+			"restore-entity",
+		},
+		"ROLLBACK": {
+			"load-entity",
+			"rollback-entity",
+			"save-entity",
 		},
 		"FETCH": {
 			"load-entity",
 		},
 		"SET-SECRET": {
 			"load-entity",
+			"validate-secret-policy",
 			"set-entity-secret",
 			"save-entity",
 		},
+		"EXPIRE-SECRET": {
+			"load-entity",
+			"ensure-entity-meta",
+			"expire-entity-secret",
+			"save-entity",
+		},
+		"IMPORT-SECRET": {
+			"load-entity",
+			"import-entity-secret",
+			"save-entity",
+		},
 		"SET-CAPABILITY": {
 			"load-entity",
 			"ensure-entity-meta",
@@ -49,6 +70,7 @@ var (
 			"load-entity",
 			"validate-entity-unlocked",
 			"validate-entity-secret",
+			"validate-secret-age",
 			"save-entity",
 		},
 		"MERGE-METADATA": {
@@ -130,7 +152,17 @@ var (
 		},
 		"DESTROY": {
 			"load-group",
-			"destroy-group",
+			"tombstone-group",
+		},
+		"RESTORE": {
+			"restore-group",
+		},
+		"ROLLBACK": {
+			"load-group",
+			"check-expansion-targets",
+			"check-expansion-cycles",
+			"rollback-group",
+			"save-group",
 		},
 		"FETCH": {
 			"load-group",
@@ -0,0 +1,110 @@
+package tree
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/db"
+
+	pb "github.com/netauth/protocol"
+)
+
+// A persister is a hook that says whether it writes the changes of
+// its chain to storage.  Hooks that persist are skipped during a dry
+// run, and every other hook runs as usual so that the checks they
+// make still apply.  Every hook built on a BaseHook is a persister.
+type persister interface {
+	Persists() bool
+}
+
+// A DryRun collects the entities and groups that chains would have
+// saved, had the request not been a dry run.  Secrets are removed
+// from entities before they are collected.
+type DryRun struct {
+	mu       sync.Mutex
+	entities []*pb.Entity
+	groups   []*pb.Group
+	refused  bool
+}
+
+type dryRunKey struct{}
+
+// WithDryRun returns a context that runs chains without saving
+// anything, and the DryRun that the would-be results are collected
+// in.
+func WithDryRun(ctx context.Context) (context.Context, *DryRun) {
+	d := new(DryRun)
+	ctx = db.WithDryRun(ctx)
+	return context.WithValue(ctx, dryRunKey{}, d), d
+}
+
+// Entities returns the entities that would have been saved.
+func (d *DryRun) Entities() []*pb.Entity {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*pb.Entity{}, d.entities...)
+}
+
+// Groups returns the groups that would have been saved.
+func (d *DryRun) Groups() []*pb.Group {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*pb.Group{}, d.groups...)
+}
+
+func dryRunFrom(ctx context.Context) *DryRun {
+	d, _ := ctx.Value(dryRunKey{}).(*DryRun)
+	return d
+}
+
+// Refused reports whether a chain refused to run because it couldn't
+// be dry run.
+func (d *DryRun) Refused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.refused
+}
+
+// refuse reports whether the hook keeps its chain from being dry run,
+// which is the case for hooks that don't say whether they persist,
+// such as those of plugins.  It is safe to call on a nil DryRun,
+// which refuses nothing.
+func (d *DryRun) refuse(h interface{}) bool {
+	if d == nil {
+		return false
+	}
+	if _, ok := h.(persister); ok {
+		return false
+	}
+	d.mu.Lock()
+	d.refused = true
+	d.mu.Unlock()
+	return true
+}
+
+// skip reports whether the hook must not run.  It is safe to call on
+// a nil DryRun, which skips nothing.
+func (d *DryRun) skip(h interface{}) bool {
+	if d == nil {
+		return false
+	}
+	p, ok := h.(persister)
+	return ok && p.Persists()
+}
+
+func (d *DryRun) addEntity(e *pb.Entity) {
+	e = proto.Clone(e).(*pb.Entity)
+	e.Secret = nil
+	d.mu.Lock()
+	d.entities = append(d.entities, e)
+	d.mu.Unlock()
+}
+
+func (d *DryRun) addGroup(g *pb.Group) {
+	g = proto.Clone(g).(*pb.Group)
+	d.mu.Lock()
+	d.groups = append(d.groups, g)
+	d.mu.Unlock()
+}
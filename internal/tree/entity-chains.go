@@ -2,7 +2,11 @@ package tree
 
 import (
 	"context"
+	"fmt"
 	"sort"
+	"time"
+
+	"github.com/netauth/netauth/internal/db"
 
 	pb "github.com/netauth/protocol"
 )
@@ -44,22 +48,26 @@ func RegisterEntityHookConstructor(name string, c EntityHookConstructor) {
 
 // InitializeEntityHooks runs all the EntityHookConstructors and
 // registers the resulting hooks by name into m.entityProcessorHooks
-func (m *Manager) InitializeEntityHooks() {
+// An error is returned if any of the constructors fails, since a
+// server without all of its hooks can't be trusted to check requests.
+func (m *Manager) InitializeEntityHooks() error {
 	m.log.Debug("Executing EntityHookConstructor callbacks")
 	hOpts := []HookOption{
 		WithHookStorage(m.db),
 		WithHookCrypto(m.crypto),
+		WithHookSecretPolicy(m.secretPolicy),
 	}
 
-	for _, v := range eHookConstructors {
+	for name, v := range eHookConstructors {
 		hook, err := v(hOpts...)
 		if err != nil {
-			m.log.Warn("Error initializing hook", "hook", hook, "error", err)
-			continue
+			m.log.Error("Error initializing hook", "hook", name, "error", err)
+			return fmt.Errorf("hook %s: %w", name, err)
 		}
 		m.entityHooks[hook.Name()] = hook
 		m.log.Trace("EntityHook registered", "hook", hook.Name())
 	}
+	return nil
 }
 
 // InitializeEntityChains initializes the map of chains stored on the
@@ -112,16 +120,74 @@ func (m *Manager) CheckRequiredEntityChains() error {
 }
 
 // RunEntityChain runs the specified chain with de specifying values
-// to be consumed by the chain.
+// to be consumed by the chain.  Everything that the chain saves is
+// committed together once the last hook has run, so a chain that
+// fails part way through leaves nothing behind.  During a dry run the
+// hooks that save changes are skipped, and the result is collected in
+// the DryRun.
 func (m *Manager) RunEntityChain(ctx context.Context, chain string, de *pb.Entity) (*pb.Entity, error) {
+	var e *pb.Entity
+	err := m.db.Atomically(ctx, func(ctx context.Context) error {
+		var err error
+		e, err = m.runEntityHooks(ctx, chain, de)
+		return err
+	})
+	if err == db.ErrRevisionConflict {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// runEntityHooks runs the hooks of the chain in order.
+func (m *Manager) runEntityHooks(ctx context.Context, chain string, de *pb.Entity) (*pb.Entity, error) {
 	e := new(pb.Entity)
+	// Each run of a chain tracks the revisions of what it loads so
+	// that it can't overwrite changes made by a concurrent run.
+	ctx = db.WithRevisions(ctx)
 	hookChain := m.entityProcesses[chain]
+	t := traceFrom(ctx)
+	dr := dryRunFrom(ctx)
+	skipped := false
 	for _, h := range hookChain {
+		if dr.refuse(h) {
+			m.log.Debug("Chain can't be dry run", "chain", chain, "hook", h.Name())
+			return nil, ErrDryRunUnsupported
+		}
+	}
+	for _, h := range hookChain {
+		if dr.skip(h) {
+			m.log.Trace("Skipping entity hook for dry run", "chain", chain, "hook", h.Name())
+			skipped = true
+			continue
+		}
 		m.log.Trace("Executing entity hook", "chain", chain, "hook", h.Name())
-		if err := h.Run(ctx, e, de); err != nil {
+		start := time.Now()
+		err := h.Run(ctx, e, de)
+		t.add(chain, h.Name(), time.Since(start), err)
+		if err != nil {
 			m.log.Trace("Error during chain execution", "chain", chain, "hook", h.Name(), "error", err)
 			return nil, err
 		}
 	}
+	if skipped {
+		// Only chains that would have saved something have a
+		// result worth reporting.
+		dr.addEntity(e)
+	}
 	return e, nil
 }
+
+// EntityChains returns the hooks of every entity chain in the order that
+// they run, including those that plugins have added.
+func (m *Manager) EntityChains() map[string][]HookInfo {
+	out := make(map[string][]HookInfo, len(m.entityProcesses))
+	for chain, hooks := range m.entityProcesses {
+		for _, h := range hooks {
+			out[chain] = append(out[chain], HookInfo{Name: h.Name(), Priority: h.Priority()})
+		}
+	}
+	return out
+}
@@ -3,10 +3,16 @@ package tree
 import (
 	"context"
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
 
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/memory"
+	"github.com/netauth/netauth/internal/startup"
+
 	pb "github.com/netauth/protocol"
 )
 
@@ -36,8 +42,10 @@ func TestECRegisterAndInitialize(t *testing.T) {
 		log:         hclog.NewNullLogger(),
 	}
 
-	em.InitializeEntityHooks()
-	if len(em.entityHooks) != 1 {
+	if err := em.InitializeEntityHooks(); err == nil || !strings.Contains(err.Error(), "bad-hook") {
+		t.Errorf("Got %v; Want the error of bad-hook", err)
+	}
+	if _, ok := em.entityHooks["bad-hook"]; ok {
 		t.Error("bad-hook was initialized")
 	}
 }
@@ -125,6 +133,70 @@ func TestECCheckRequiredEmpty(t *testing.T) {
 	}
 }
 
+func TestECChainsAndTrace(t *testing.T) {
+	resetEntityConstructorMap()
+	defer resetEntityConstructorMap()
+
+	RegisterEntityHookConstructor("null-hook", goodEntityConstructor)
+	RegisterEntityHookConstructor("null-hook2", goodEntityConstructor2)
+	RegisterEntityHookConstructor("fail-hook", failEntityConstructor)
+	startup.DoCallbacks()
+	mdb, err := db.New("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	em := Manager{
+		db:              mdb,
+		entityHooks:     make(map[string]EntityHook),
+		entityProcesses: make(map[string][]EntityHook),
+		log:             hclog.NewNullLogger(),
+	}
+	em.InitializeEntityHooks()
+	if err := em.InitializeEntityChains(ChainConfig{"TEST": {"fail-hook", "null-hook", "null-hook2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]HookInfo{
+		"TEST": {{"null-hook2", 40}, {"null-hook", 50}, {"fail-hook", 60}},
+	}
+	if got := em.EntityChains(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v; Want %v", got, want)
+	}
+
+	// Untraced runs record nothing, and traced runs record every
+	// hook up to the one that failed.
+	if _, err := em.RunEntityChain(context.Background(), "TEST", &pb.Entity{}); err != errFailHook {
+		t.Errorf("Got %v; Want %v", err, errFailHook)
+	}
+	ctx, trace := WithTrace(context.Background())
+	if _, err := em.RunEntityChain(ctx, "TEST", &pb.Entity{}); err != errFailHook {
+		t.Errorf("Got %v; Want %v", err, errFailHook)
+	}
+	hooks := trace.Hooks()
+	if len(hooks) != 3 {
+		t.Fatalf("Wrong number of hooks traced: %v", hooks)
+	}
+	for i, name := range []string{"null-hook2", "null-hook", "fail-hook"} {
+		if hooks[i].Chain != "TEST" || hooks[i].Hook != name {
+			t.Errorf("%d: Got %v; Want TEST/%s", i, hooks[i], name)
+		}
+	}
+	if hooks[1].Err != nil || hooks[2].Err != errFailHook {
+		t.Errorf("Errors were not traced: %v", hooks)
+	}
+
+	// None of these hooks say whether they persist, so the chain
+	// can't be dry run and nothing runs.
+	ctx, trace = WithTrace(context.Background())
+	ctx, dr := WithDryRun(ctx)
+	if _, err := em.RunEntityChain(ctx, "TEST", &pb.Entity{}); err != ErrDryRunUnsupported {
+		t.Errorf("Got %v; Want %v", err, ErrDryRunUnsupported)
+	}
+	if !dr.Refused() || len(trace.Hooks()) != 0 {
+		t.Errorf("Dry run was not refused: %v", trace.Hooks())
+	}
+}
+
 type nullEntityHook struct{}
 
 func (*nullEntityHook) Name() string                                 { return "null-hook" }
@@ -147,3 +219,15 @@ func goodEntityConstructor2(_ ...HookOption) (EntityHook, error) {
 func badEntityConstructor(_ ...HookOption) (EntityHook, error) {
 	return nil, errors.New("initialization error")
 }
+
+var errFailHook = errors.New("hook failed")
+
+type failEntityHook struct{}
+
+func (*failEntityHook) Name() string                                 { return "fail-hook" }
+func (*failEntityHook) Priority() int                                { return 60 }
+func (*failEntityHook) Run(_ context.Context, _, _ *pb.Entity) error { return errFailHook }
+
+func failEntityConstructor(_ ...HookOption) (EntityHook, error) {
+	return &failEntityHook{}, nil
+}
@@ -34,7 +34,8 @@ func (m *Manager) CreateEntity(ctx context.Context, ID string, number int32, sec
 // delete the entity in a non-atomic way, but will ensure that the
 // entity cannot be authenticated with before returning.  If the named
 // ID does not exist the function will return tree.E_NO_ENTITY, in
-// all other cases nil is returned.
+// all other cases nil is returned.  With the default chains the
+// entity can be brought back with RestoreEntity until it is purged.
 func (m *Manager) DestroyEntity(ctx context.Context, ID string) error {
 	de := &pb.Entity{
 		ID: &ID,
@@ -44,6 +45,44 @@ func (m *Manager) DestroyEntity(ctx context.Context, ID string) error {
 	return err
 }
 
+// RestoreEntity brings back an entity that was destroyed, along with
+// its group memberships.  This is only possible until the deleted
+// entity is purged.
+func (m *Manager) RestoreEntity(ctx context.Context, ID string) error {
+	de := &pb.Entity{
+		ID: &ID,
+	}
+
+	_, err := m.RunEntityChain(ctx, "RESTORE", de)
+	return err
+}
+
+// EntityHistory returns the revisions of an entity that are still
+// kept, oldest first.  Revisions don't include the entity's secret.
+func (m *Manager) EntityHistory(ctx context.Context, ID string) ([]db.EntityRevision, error) {
+	return m.db.EntityHistory(ctx, ID)
+}
+
+// RollbackEntity returns an entity to the way it was at the given
+// revision of its history.  The entity keeps its current secret, and
+// the rollback is itself recorded as a new revision.
+func (m *Manager) RollbackEntity(ctx context.Context, ID string, rev int) error {
+	h, err := m.db.EntityHistory(ctx, ID)
+	if err != nil {
+		return err
+	}
+	for _, r := range h {
+		if r.Rev != rev {
+			continue
+		}
+		de := r.Entity
+		de.ID = &ID
+		_, err := m.RunEntityChain(ctx, "ROLLBACK", de)
+		return err
+	}
+	return ErrUnknownRevision
+}
+
 // SetEntityCapability2 adds a capability to an entity directly, and
 // does so with a strongly typed capability pointer.
 func (m *Manager) SetEntityCapability2(ctx context.Context, ID string, c *pb.Capability) error {
@@ -92,8 +131,20 @@ func (m *Manager) SetSecret(ctx context.Context, ID string, secret string) error
 	return err
 }
 
+// ExpireSecret marks the secret of an entity as needing to be
+// changed.  The entity can't authenticate until it does so.
+func (m *Manager) ExpireSecret(ctx context.Context, ID string) error {
+	de := &pb.Entity{
+		ID: &ID,
+	}
+
+	_, err := m.RunEntityChain(ctx, "EXPIRE-SECRET", de)
+	return err
+}
+
 // ValidateSecret validates the identity of an entity by
-// validating the authenticating entity with the secret.
+// validating the authenticating entity with the secret.  If the
+// secret is correct but has expired, ErrSecretExpired is returned.
 func (m *Manager) ValidateSecret(ctx context.Context, ID string, secret string) error {
 	de := &pb.Entity{
 		ID:     &ID,
@@ -59,4 +59,29 @@ var (
 	// certain criteria to be successfully procesed, and these
 	// criteria are not met.
 	ErrFailedPrecondition = errors.New("precondition failed")
+
+	// ErrConflict is returned when a chain tries to save an
+	// object that was changed by another request after the chain
+	// loaded it.  The request can be safely retried.
+	ErrConflict = errors.New("the object was modified concurrently")
+
+	// ErrSecretExpired is returned when an entity presents the
+	// correct secret, but the secret is too old or has been marked
+	// as needing to be changed.  The only thing such an entity may
+	// do is change its secret.
+	ErrSecretExpired = errors.New("the secret has expired")
+
+	// ErrUnknownRevision is returned when a rollback names a
+	// revision that isn't in the object's history.
+	ErrUnknownRevision = errors.New("no revision with that number is kept")
+
+	// ErrDryRunUnsupported is returned when a dry run is asked of
+	// a chain with hooks that can't say whether they persist, such
+	// as those of plugins.  Nothing is run.
+	ErrDryRunUnsupported = errors.New("the chain can't be dry run")
+
+	// ErrReservedKey is returned when untyped metadata would
+	// change a key that only the server may write, such as those
+	// that record the age of secrets.
+	ErrReservedKey = errors.New("the key is reserved")
 )
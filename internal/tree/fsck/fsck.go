@@ -0,0 +1,241 @@
+// Package fsck checks the tree for references that can't be followed
+// and for data that can't be read.  Most problems can be repaired,
+// which is done through the tree's chains so that a repair is no
+// different from the change an administrator would make by hand.
+package fsck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/db"
+
+	pb "github.com/netauth/protocol"
+)
+
+// A Kind is a type of problem.
+type Kind string
+
+// The kinds of problem that Check looks for.
+const (
+	// Unreadable values could not be unmarshaled.
+	Unreadable Kind = "unreadable"
+
+	// DanglingMembership is an entity that is a direct member of
+	// a group that doesn't exist.
+	DanglingMembership Kind = "dangling-membership"
+
+	// DanglingPrimaryGroup is an entity whose primary group
+	// doesn't exist.
+	DanglingPrimaryGroup Kind = "dangling-primary-group"
+
+	// DanglingExpansion is a group that includes or excludes a
+	// group that doesn't exist.
+	DanglingExpansion Kind = "dangling-expansion"
+
+	// DanglingManager is a group managed by a group that doesn't
+	// exist.
+	DanglingManager Kind = "dangling-manager"
+
+	// DuplicateNumber is an entity or group that has the same
+	// number as another.
+	DuplicateNumber Kind = "duplicate-number"
+)
+
+// ErrNotRepairable is returned by Repair for problems that need a
+// person to decide what the right answer is.
+var ErrNotRepairable = errors.New("problem cannot be repaired automatically")
+
+// A Problem is a single thing wrong with the tree.  Key is the key of
+// the object with the problem.  Ref is the missing group for the
+// dangling kinds, the full expansion for DanglingExpansion, and the
+// key of the object that already has the number for DuplicateNumber.
+type Problem struct {
+	Kind Kind
+	Key  string
+	Ref  string
+}
+
+func (p Problem) String() string {
+	switch p.Kind {
+	case Unreadable:
+		return fmt.Sprintf("%s: cannot be unmarshaled", p.Key)
+	case DanglingMembership:
+		return fmt.Sprintf("%s: member of missing group %s", p.Key, p.Ref)
+	case DanglingPrimaryGroup:
+		return fmt.Sprintf("%s: primary group %s is missing", p.Key, p.Ref)
+	case DanglingExpansion:
+		return fmt.Sprintf("%s: expansion %s names a missing group", p.Key, p.Ref)
+	case DanglingManager:
+		return fmt.Sprintf("%s: managing group %s is missing", p.Key, p.Ref)
+	case DuplicateNumber:
+		return fmt.Sprintf("%s: number is already used by %s", p.Key, p.Ref)
+	}
+	return fmt.Sprintf("%s: %s %s", p.Key, p.Kind, p.Ref)
+}
+
+// Tree is the part of the tree.Manager that Repair needs.
+type Tree interface {
+	RunEntityChain(context.Context, string, *pb.Entity) (*pb.Entity, error)
+	RunGroupChain(context.Context, string, *pb.Group) (*pb.Group, error)
+}
+
+// Check reads every entity and group directly from kv and returns
+// the problems it finds, ordered by key.
+func Check(ctx context.Context, kv db.KVStore) ([]Problem, error) {
+	var out []Problem
+
+	groups := make(map[string]*pb.Group)
+	groupKeys, err := sortedKeys(ctx, kv, "/groups/*")
+	if err != nil {
+		return nil, err
+	}
+	numbers := make(map[int32]string)
+	for _, k := range groupKeys {
+		g := &pb.Group{}
+		if ok, err := load(ctx, kv, k, g); err != nil {
+			return nil, err
+		} else if !ok {
+			out = append(out, Problem{Kind: Unreadable, Key: k})
+			continue
+		}
+		groups[path.Base(k)] = g
+		if other, ok := numbers[g.GetNumber()]; ok {
+			out = append(out, Problem{Kind: DuplicateNumber, Key: k, Ref: other})
+		} else {
+			numbers[g.GetNumber()] = k
+		}
+	}
+	// An unreadable group still exists, so references to it are
+	// not reported as dangling as well.  Neither are references to
+	// a deleted group that can still be restored, since restoring
+	// it relies on its members still naming it.
+	deleted, err := sortedKeys(ctx, kv, db.GroupTombstonePrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	exists := func(name string) bool {
+		_, ok := groups[name]
+		return ok || contains(groupKeys, path.Join("/groups", name)) || contains(deleted, db.GroupTombstonePrefix+name)
+	}
+
+	for _, k := range groupKeys {
+		g, ok := groups[path.Base(k)]
+		if !ok {
+			continue
+		}
+		if g.GetManagedBy() != "" && !exists(g.GetManagedBy()) {
+			out = append(out, Problem{Kind: DanglingManager, Key: k, Ref: g.GetManagedBy()})
+		}
+		for _, exp := range g.GetExpansions() {
+			parts := strings.SplitN(exp, ":", 2)
+			if len(parts) == 2 && !exists(parts[1]) {
+				out = append(out, Problem{Kind: DanglingExpansion, Key: k, Ref: exp})
+			}
+		}
+	}
+
+	entityKeys, err := sortedKeys(ctx, kv, "/entities/*")
+	if err != nil {
+		return nil, err
+	}
+	numbers = make(map[int32]string)
+	for _, k := range entityKeys {
+		e := &pb.Entity{}
+		if ok, err := load(ctx, kv, k, e); err != nil {
+			return nil, err
+		} else if !ok {
+			out = append(out, Problem{Kind: Unreadable, Key: k})
+			continue
+		}
+		if other, ok := numbers[e.GetNumber()]; ok {
+			out = append(out, Problem{Kind: DuplicateNumber, Key: k, Ref: other})
+		} else {
+			numbers[e.GetNumber()] = k
+		}
+		if pg := e.GetMeta().GetPrimaryGroup(); pg != "" && !exists(pg) {
+			out = append(out, Problem{Kind: DanglingPrimaryGroup, Key: k, Ref: pg})
+		}
+		for _, name := range e.GetMeta().GetGroups() {
+			if !exists(name) {
+				out = append(out, Problem{Kind: DanglingMembership, Key: k, Ref: name})
+			}
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// Repair fixes a problem found by Check by removing the reference
+// that can't be followed.  Unreadable objects and duplicate numbers
+// return ErrNotRepairable.
+func Repair(ctx context.Context, t Tree, p Problem) error {
+	name := path.Base(p.Key)
+	var err error
+	switch p.Kind {
+	case DanglingMembership:
+		de := &pb.Entity{ID: &name, Meta: &pb.EntityMeta{Groups: []string{p.Ref}}}
+		_, err = t.RunEntityChain(ctx, "GROUP-DEL", de)
+	case DanglingPrimaryGroup:
+		de := &pb.Entity{ID: &name, Meta: &pb.EntityMeta{PrimaryGroup: proto.String("")}}
+		_, err = t.RunEntityChain(ctx, "MERGE-METADATA", de)
+	case DanglingManager:
+		dg := &pb.Group{Name: &name, ManagedBy: proto.String("")}
+		_, err = t.RunGroupChain(ctx, "MERGE-METADATA", dg)
+	case DanglingExpansion:
+		err = dropExpansion(ctx, t, name, p.Ref)
+	default:
+		err = ErrNotRepairable
+	}
+	return err
+}
+
+// dropExpansion removes an expansion from a group.  DROP removes
+// every expansion that contains the one named, so the repair is
+// refused if that would take out another expansion as well.
+func dropExpansion(ctx context.Context, t Tree, name, exp string) error {
+	g, err := t.RunGroupChain(ctx, "FETCH", &pb.Group{Name: &name})
+	if err != nil {
+		return err
+	}
+	for _, other := range g.GetExpansions() {
+		if other != exp && strings.Contains(other, exp) {
+			return ErrNotRepairable
+		}
+	}
+	dg := &pb.Group{Name: &name, Expansions: []string{"DROP:" + exp}}
+	_, err = t.RunGroupChain(ctx, "MODIFY-EXPANSIONS", dg)
+	return err
+}
+
+func sortedKeys(ctx context.Context, kv db.KVStore, pattern string) ([]string, error) {
+	keys, err := kv.Keys(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// load reads and unmarshals a single value.  A value that can't be
+// unmarshaled is reported by returning false rather than an error so
+// that the check can carry on.
+func load(ctx context.Context, kv db.KVStore, k string, m proto.Message) (bool, error) {
+	b, err := kv.Get(ctx, k)
+	if err != nil {
+		return false, err
+	}
+	return proto.Unmarshal(b, m) == nil, nil
+}
+
+func contains(s []string, v string) bool {
+	i := sort.SearchStrings(s, v)
+	return i < len(s) && s[i] == v
+}
@@ -0,0 +1,146 @@
+package fsck
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/crypto/nocrypto"
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/memory"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+	_ "github.com/netauth/netauth/internal/tree/hooks"
+
+	pb "github.com/netauth/protocol"
+)
+
+// brokenTree returns a tree with one of every problem, written
+// straight to storage since the chains wouldn't allow most of them.
+func brokenTree(t *testing.T) (*tree.Manager, *db.DB) {
+	startup.DoCallbacks()
+	ctx := context.Background()
+
+	mdb, err := db.New("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crypt, err := nocrypto.New(hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := tree.New(tree.WithStorage(mdb), tree.WithCrypto(crypt))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := []*pb.Group{
+		{Name: proto.String("ok"), Number: proto.Int32(1), ManagedBy: proto.String("ok")},
+		{Name: proto.String("managed"), Number: proto.Int32(2), ManagedBy: proto.String("gone")},
+		{Name: proto.String("expands"), Number: proto.Int32(3), Expansions: []string{"EXCLUDE:ok", "INCLUDE:gone"}},
+		{Name: proto.String("same"), Number: proto.Int32(1)},
+	}
+	for _, g := range groups {
+		assert.Nil(t, mdb.SaveGroup(ctx, g))
+	}
+	entities := []*pb.Entity{
+		{ID: proto.String("alice"), Number: proto.Int32(1), Meta: &pb.EntityMeta{
+			PrimaryGroup: proto.String("gone"),
+			Groups:       []string{"ok", "gone"},
+		}},
+		{ID: proto.String("bob"), Number: proto.Int32(1)},
+	}
+	for _, e := range entities {
+		assert.Nil(t, mdb.SaveEntity(ctx, e))
+	}
+	assert.Nil(t, mdb.KV().Put(ctx, "/entities/junk", []byte{0xff}))
+	return m, mdb
+}
+
+func TestCheck(t *testing.T) {
+	_, mdb := brokenTree(t)
+
+	res, err := Check(context.Background(), mdb.KV())
+	assert.Nil(t, err)
+	assert.Equal(t, []Problem{
+		{Kind: DanglingPrimaryGroup, Key: "/entities/alice", Ref: "gone"},
+		{Kind: DanglingMembership, Key: "/entities/alice", Ref: "gone"},
+		{Kind: DuplicateNumber, Key: "/entities/bob", Ref: "/entities/alice"},
+		{Kind: Unreadable, Key: "/entities/junk"},
+		{Kind: DanglingExpansion, Key: "/groups/expands", Ref: "INCLUDE:gone"},
+		{Kind: DanglingManager, Key: "/groups/managed", Ref: "gone"},
+		{Kind: DuplicateNumber, Key: "/groups/same", Ref: "/groups/ok"},
+	}, res)
+
+	for _, p := range res {
+		assert.NotEmpty(t, p.String())
+	}
+}
+
+func TestRepair(t *testing.T) {
+	ctx := context.Background()
+	m, mdb := brokenTree(t)
+
+	res, err := Check(ctx, mdb.KV())
+	assert.Nil(t, err)
+	for _, p := range res {
+		err := Repair(ctx, m, p)
+		switch p.Kind {
+		case Unreadable, DuplicateNumber:
+			assert.Equal(t, ErrNotRepairable, err, p)
+		default:
+			assert.Nil(t, err, p)
+		}
+	}
+
+	res, err = Check(ctx, mdb.KV())
+	assert.Nil(t, err)
+	for _, p := range res {
+		assert.Contains(t, []Kind{Unreadable, DuplicateNumber}, p.Kind)
+	}
+
+	e, err := mdb.LoadEntity(ctx, "alice")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ok"}, e.GetMeta().GetGroups())
+	assert.Equal(t, "", e.GetMeta().GetPrimaryGroup())
+
+	g, err := mdb.LoadGroup(ctx, "expands")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"EXCLUDE:ok"}, g.GetExpansions())
+}
+
+func TestRepairDropOverlap(t *testing.T) {
+	ctx := context.Background()
+	m, mdb := brokenTree(t)
+	assert.Nil(t, mdb.SaveGroup(ctx, &pb.Group{Name: proto.String("gone-too"), Number: proto.Int32(9)}))
+	assert.Nil(t, mdb.SaveGroup(ctx, &pb.Group{
+		Name:       proto.String("expands"),
+		Number:     proto.Int32(3),
+		Expansions: []string{"INCLUDE:gone", "INCLUDE:gone-too"},
+	}))
+
+	p := Problem{Kind: DanglingExpansion, Key: "/groups/expands", Ref: "INCLUDE:gone"}
+	assert.Equal(t, ErrNotRepairable, Repair(ctx, m, p))
+}
+
+func TestCheckDeletedGroup(t *testing.T) {
+	ctx := context.Background()
+	m, mdb := brokenTree(t)
+
+	// Members of a deleted group keep naming it so that it can be
+	// restored, which isn't a problem until it is purged.
+	assert.Nil(t, m.DestroyGroup(ctx, "ok"))
+	res, err := Check(ctx, mdb.KV())
+	assert.Nil(t, err)
+	assert.NotContains(t, res, Problem{Kind: DanglingMembership, Key: "/entities/alice", Ref: "ok"})
+
+	_, err = mdb.PurgeTombstones(ctx, time.Now())
+	assert.Nil(t, err)
+	res, err = Check(ctx, mdb.KV())
+	assert.Nil(t, err)
+	assert.Contains(t, res, Problem{Kind: DanglingMembership, Key: "/entities/alice", Ref: "ok"})
+}
@@ -2,7 +2,11 @@ package tree
 
 import (
 	"context"
+	"fmt"
 	"sort"
+	"time"
+
+	"github.com/netauth/netauth/internal/db"
 
 	pb "github.com/netauth/protocol"
 )
@@ -44,22 +48,25 @@ func RegisterGroupHookConstructor(name string, c GroupHookConstructor) {
 
 // InitializeGroupHooks runs all the GroupHookConstructors and
 // registers the resulting hooks by name into m.groupProcessorHooks
-func (m *Manager) InitializeGroupHooks() {
+// An error is returned if any of the constructors fails, since a
+// server without all of its hooks can't be trusted to check requests.
+func (m *Manager) InitializeGroupHooks() error {
 	m.log.Debug("Executing GroupHookConstructor callbacks")
 	hOpts := []HookOption{
 		WithHookStorage(m.db),
 		WithHookCrypto(m.crypto),
 	}
 
-	for _, v := range gHookConstructors {
+	for name, v := range gHookConstructors {
 		hook, err := v(hOpts...)
 		if err != nil {
-			m.log.Warn("Error initializing hook", "hook", hook, "error", err)
-			continue
+			m.log.Error("Error initializing hook", "hook", name, "error", err)
+			return fmt.Errorf("hook %s: %w", name, err)
 		}
 		m.groupHooks[hook.Name()] = hook
 		m.log.Trace("GroupHook registered", "hook", hook.Name())
 	}
+	return nil
 }
 
 // InitializeGroupChains initializes the map of chains stored on the
@@ -112,16 +119,74 @@ func (m *Manager) CheckRequiredGroupChains() error {
 }
 
 // RunGroupChain runs the specified chain with de specifying values
-// to be consumed by the chain.
+// to be consumed by the chain.  Everything that the chain saves is
+// committed together once the last hook has run, so a chain that
+// fails part way through leaves nothing behind.  During a dry run the
+// hooks that save changes are skipped, and the result is collected in
+// the DryRun.
 func (m *Manager) RunGroupChain(ctx context.Context, chain string, de *pb.Group) (*pb.Group, error) {
+	var e *pb.Group
+	err := m.db.Atomically(ctx, func(ctx context.Context) error {
+		var err error
+		e, err = m.runGroupHooks(ctx, chain, de)
+		return err
+	})
+	if err == db.ErrRevisionConflict {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// runGroupHooks runs the hooks of the chain in order.
+func (m *Manager) runGroupHooks(ctx context.Context, chain string, de *pb.Group) (*pb.Group, error) {
 	e := new(pb.Group)
+	// Each run of a chain tracks the revisions of what it loads so
+	// that it can't overwrite changes made by a concurrent run.
+	ctx = db.WithRevisions(ctx)
 	hookChain := m.groupProcesses[chain]
+	t := traceFrom(ctx)
+	dr := dryRunFrom(ctx)
+	skipped := false
 	for _, h := range hookChain {
+		if dr.refuse(h) {
+			m.log.Debug("Chain can't be dry run", "chain", chain, "hook", h.Name())
+			return nil, ErrDryRunUnsupported
+		}
+	}
+	for _, h := range hookChain {
+		if dr.skip(h) {
+			m.log.Trace("Skipping group hook for dry run", "chain", chain, "hook", h.Name())
+			skipped = true
+			continue
+		}
 		m.log.Trace("Executing group hook", "chain", chain, "hook", h.Name())
-		if err := h.Run(ctx, e, de); err != nil {
+		start := time.Now()
+		err := h.Run(ctx, e, de)
+		t.add(chain, h.Name(), time.Since(start), err)
+		if err != nil {
 			m.log.Trace("Error during chain execution", "chain", chain, "hook", h.Name(), "error", err)
 			return nil, err
 		}
 	}
+	if skipped {
+		// Only chains that would have saved something have a
+		// result worth reporting.
+		dr.addGroup(e)
+	}
 	return e, nil
 }
+
+// GroupChains returns the hooks of every group chain in the order that
+// they run, including those that plugins have added.
+func (m *Manager) GroupChains() map[string][]HookInfo {
+	out := make(map[string][]HookInfo, len(m.groupProcesses))
+	for chain, hooks := range m.groupProcesses {
+		for _, h := range hooks {
+			out[chain] = append(out[chain], HookInfo{Name: h.Name(), Priority: h.Priority()})
+		}
+	}
+	return out
+}
@@ -3,10 +3,16 @@ package tree
 import (
 	"context"
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
 
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/memory"
+	"github.com/netauth/netauth/internal/startup"
+
 	pb "github.com/netauth/protocol"
 )
 
@@ -36,8 +42,10 @@ func TestGCRegisterAndInitialize(t *testing.T) {
 		log:        hclog.NewNullLogger(),
 	}
 
-	em.InitializeGroupHooks()
-	if len(em.groupHooks) != 1 {
+	if err := em.InitializeGroupHooks(); err == nil || !strings.Contains(err.Error(), "bad-hook") {
+		t.Errorf("Got %v; Want the error of bad-hook", err)
+	}
+	if _, ok := em.groupHooks["bad-hook"]; ok {
 		t.Error("bad-hook was initialized")
 	}
 }
@@ -125,6 +133,45 @@ func TestGCCheckRequiredEmpty(t *testing.T) {
 	}
 }
 
+func TestGCChainsAndTrace(t *testing.T) {
+	resetGroupConstructorMap()
+	defer resetGroupConstructorMap()
+
+	RegisterGroupHookConstructor("null-hook", goodGroupConstructor)
+	RegisterGroupHookConstructor("null-hook2", goodGroupConstructor2)
+	startup.DoCallbacks()
+	mdb, err := db.New("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	em := Manager{
+		db:             mdb,
+		groupHooks:     make(map[string]GroupHook),
+		groupProcesses: make(map[string][]GroupHook),
+		log:            hclog.NewNullLogger(),
+	}
+	em.InitializeGroupHooks()
+	if err := em.InitializeGroupChains(ChainConfig{"TEST": {"null-hook", "null-hook2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]HookInfo{
+		"TEST": {{"null-hook2", 40}, {"null-hook", 50}},
+	}
+	if got := em.GroupChains(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v; Want %v", got, want)
+	}
+
+	ctx, trace := WithTrace(context.Background())
+	if _, err := em.RunGroupChain(ctx, "TEST", &pb.Group{}); err != nil {
+		t.Error(err)
+	}
+	hooks := trace.Hooks()
+	if len(hooks) != 2 || hooks[0].Hook != "null-hook2" || hooks[1].Hook != "null-hook" {
+		t.Errorf("Wrong hooks traced: %v", hooks)
+	}
+}
+
 type nullGroupHook struct{}
 
 func (*nullGroupHook) Name() string                                { return "null-hook" }
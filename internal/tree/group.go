@@ -40,6 +40,8 @@ func (m *Manager) FetchGroup(ctx context.Context, name string) (*pb.Group, error
 
 // DestroyGroup unsurprisingly deletes a group.  There's no real logic
 // here, it just passes the delete call through to the storage layer.
+// With the default chains the group can be brought back with
+// RestoreGroup until it is purged.
 func (m *Manager) DestroyGroup(ctx context.Context, name string) error {
 	rg := &pb.Group{
 		Name: &name,
@@ -49,6 +51,46 @@ func (m *Manager) DestroyGroup(ctx context.Context, name string) error {
 	return err
 }
 
+// RestoreGroup brings back a group that was destroyed.  Entities that
+// were members of the group when it was destroyed are members again
+// once it is restored.  This is only possible until the deleted group
+// is purged.
+func (m *Manager) RestoreGroup(ctx context.Context, name string) error {
+	rg := &pb.Group{
+		Name: &name,
+	}
+
+	_, err := m.RunGroupChain(ctx, "RESTORE", rg)
+	return err
+}
+
+// GroupHistory returns the revisions of a group that are still kept,
+// oldest first.
+func (m *Manager) GroupHistory(ctx context.Context, name string) ([]db.GroupRevision, error) {
+	return m.db.GroupHistory(ctx, name)
+}
+
+// RollbackGroup returns a group to the way it was at the given
+// revision of its history.  Expansions in the old revision are
+// checked as if they were being added again, and the rollback is
+// itself recorded as a new revision.
+func (m *Manager) RollbackGroup(ctx context.Context, name string, rev int) error {
+	h, err := m.db.GroupHistory(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, r := range h {
+		if r.Rev != rev {
+			continue
+		}
+		dg := r.Group
+		dg.Name = &name
+		_, err := m.RunGroupChain(ctx, "ROLLBACK", dg)
+		return err
+	}
+	return ErrUnknownRevision
+}
+
 // UpdateGroupMeta updates metadata within the group.  Certain
 // information is not mutable and so that information is not merged
 // in.
@@ -39,6 +39,7 @@ func NewDestroyEntity(opts ...tree.HookOption) (tree.EntityHook, error) {
 	opts = append([]tree.HookOption{
 		tree.WithHookName("destroy-entity"),
 		tree.WithHookPriority(99),
+		tree.WithHookPersists(true),
 	}, opts...)
 	return &DestroyEntity{tree.NewBaseHook(opts...)}, nil
 }
@@ -39,6 +39,7 @@ func NewDestroyGroup(opts ...tree.HookOption) (tree.GroupHook, error) {
 	opts = append([]tree.HookOption{
 		tree.WithHookName("destroy-group"),
 		tree.WithHookPriority(99),
+		tree.WithHookPersists(true),
 	}, opts...)
 	return &DestroyGroup{tree.NewBaseHook(opts...)}, nil
 }
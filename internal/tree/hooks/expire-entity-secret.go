@@ -0,0 +1,42 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+	"github.com/netauth/netauth/internal/tree/util"
+
+	pb "github.com/netauth/protocol"
+)
+
+// ExpireEntitySecret marks the secret of an entity as needing to be
+// changed.
+type ExpireEntitySecret struct {
+	tree.BaseHook
+}
+
+// Run sets the flag in the untyped metadata that demands a new
+// secret.  The flag is cleared when the secret is next set.
+func (*ExpireEntitySecret) Run(_ context.Context, e, de *pb.Entity) error {
+	e.Meta.UntypedMeta = util.PatchKeyValueSlice(e.Meta.UntypedMeta, "UPSERT", tree.SecretMustChangeKey, "true")
+	return nil
+}
+
+func init() {
+	startup.RegisterCallback(expireEntitySecretCB)
+}
+
+func expireEntitySecretCB() {
+	tree.RegisterEntityHookConstructor("expire-entity-secret", NewExpireEntitySecret)
+}
+
+// NewExpireEntitySecret returns an initialized hook ready for use.
+func NewExpireEntitySecret(opts ...tree.HookOption) (tree.EntityHook, error) {
+	opts = append([]tree.HookOption{
+		tree.WithHookName("expire-entity-secret"),
+		tree.WithHookPriority(50),
+	}, opts...)
+
+	return &ExpireEntitySecret{tree.NewBaseHook(opts...)}, nil
+}
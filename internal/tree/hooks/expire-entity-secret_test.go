@@ -0,0 +1,29 @@
+package hooks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestExpireEntitySecret(t *testing.T) {
+	hook, err := NewExpireEntitySecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &pb.Entity{Meta: &pb.EntityMeta{}}
+	if err := hook.Run(context.Background(), e, &pb.Entity{}); err != nil {
+		t.Fatal(err)
+	}
+	if um := e.GetMeta().GetUntypedMeta(); len(um) != 1 || um[0] != tree.SecretMustChangeKey+":true" {
+		t.Errorf("Secret wasn't marked: %v", um)
+	}
+}
+
+func TestExpireEntitySecretCB(t *testing.T) {
+	expireEntitySecretCB()
+}
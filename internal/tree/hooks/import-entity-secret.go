@@ -0,0 +1,58 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+	"github.com/netauth/netauth/internal/tree/util"
+
+	pb "github.com/netauth/protocol"
+)
+
+// ImportEntitySecret stores a secret that has already been secured,
+// such as one carried over from an export of another server.
+type ImportEntitySecret struct {
+	tree.BaseHook
+}
+
+// Run copies the secured secret from de.Secret to e.Secret without
+// passing it through the crypto engine.  An empty secret is refused
+// since it would otherwise replace a usable one.  The untyped metadata
+// that records the age of the secret is carried over with it, and
+// any other untyped metadata is ignored.
+func (*ImportEntitySecret) Run(_ context.Context, e, de *pb.Entity) error {
+	if de.GetSecret() == "" {
+		return tree.ErrFailedPrecondition
+	}
+	e.Secret = de.Secret
+	for _, m := range de.GetMeta().GetUntypedMeta() {
+		key, value := splitKeyValue(m)
+		if !tree.IsSecretKey(key) {
+			continue
+		}
+		if e.Meta == nil {
+			e.Meta = &pb.EntityMeta{}
+		}
+		e.Meta.UntypedMeta = util.PatchKeyValueSlice(e.Meta.UntypedMeta, "UPSERT", key, value)
+	}
+	return nil
+}
+
+func init() {
+	startup.RegisterCallback(importEntitySecretCB)
+}
+
+func importEntitySecretCB() {
+	tree.RegisterEntityHookConstructor("import-entity-secret", NewImportEntitySecret)
+}
+
+// NewImportEntitySecret returns an initialized hook for use.
+func NewImportEntitySecret(opts ...tree.HookOption) (tree.EntityHook, error) {
+	opts = append([]tree.HookOption{
+		tree.WithHookName("import-entity-secret"),
+		tree.WithHookPriority(50),
+	}, opts...)
+
+	return &ImportEntitySecret{tree.NewBaseHook(opts...)}, nil
+}
@@ -0,0 +1,40 @@
+package hooks
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestImportEntitySecret(t *testing.T) {
+	hook, err := NewImportEntitySecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &pb.Entity{Secret: proto.String("old")}
+	if err := hook.Run(context.Background(), e, &pb.Entity{}); err != tree.ErrFailedPrecondition {
+		t.Fatal(err)
+	}
+	if e.GetSecret() != "old" {
+		t.Fatal("Empty secret was imported")
+	}
+
+	de := &pb.Entity{Secret: proto.String("$2a$10$secured")}
+	if err := hook.Run(context.Background(), e, de); err != nil {
+		t.Fatal(err)
+	}
+	if e.GetSecret() != "$2a$10$secured" {
+		t.Log(e)
+		t.Fatal("Spec error - please trace hook")
+	}
+}
+
+func TestImportEntitySecretCB(t *testing.T) {
+	importEntitySecretCB()
+}
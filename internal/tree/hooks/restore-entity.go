@@ -0,0 +1,49 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+// RestoreEntity brings back an entity that was removed by
+// tombstone-entity.
+type RestoreEntity struct {
+	tree.BaseHook
+}
+
+// Run will request the underlying datastore to restore the entity
+// named in de.  The entity can't be restored if its ID or number has
+// been taken by another entity since it was removed.
+func (r *RestoreEntity) Run(ctx context.Context, e, de *pb.Entity) error {
+	switch err := r.Storage().RestoreEntity(ctx, de.GetID()); err {
+	case db.ErrObjectExists:
+		return tree.ErrDuplicateEntityID
+	case db.ErrNumberInUse:
+		return tree.ErrDuplicateNumber
+	default:
+		return err
+	}
+}
+
+func init() {
+	startup.RegisterCallback(restoreEntityCB)
+}
+
+func restoreEntityCB() {
+	tree.RegisterEntityHookConstructor("restore-entity", NewRestoreEntity)
+}
+
+// NewRestoreEntity returns an initialized RestoreEntity hook for use.
+func NewRestoreEntity(opts ...tree.HookOption) (tree.EntityHook, error) {
+	opts = append([]tree.HookOption{
+		tree.WithHookName("restore-entity"),
+		tree.WithHookPriority(50),
+		tree.WithHookPersists(true),
+	}, opts...)
+	return &RestoreEntity{tree.NewBaseHook(opts...)}, nil
+}
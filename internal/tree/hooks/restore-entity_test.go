@@ -0,0 +1,62 @@
+package hooks
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/memory"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestRestoreEntity(t *testing.T) {
+	startup.DoCallbacks()
+	ctx := context.Background()
+
+	mdb, err := db.New("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hook, err := NewRestoreEntity(tree.WithHookStorage(mdb))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hook.Run(ctx, &pb.Entity{}, &pb.Entity{ID: proto.String("foo")}); err != db.ErrUnknownEntity {
+		t.Fatal(err)
+	}
+
+	foo := &pb.Entity{ID: proto.String("foo"), Number: proto.Int32(1)}
+	if err := mdb.SaveEntity(ctx, foo); err != nil {
+		t.Fatal(err)
+	}
+	if err := mdb.TombstoneEntity(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mdb.SaveEntity(ctx, foo); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.Run(ctx, &pb.Entity{}, &pb.Entity{ID: proto.String("foo")}); err != tree.ErrDuplicateEntityID {
+		t.Fatal(err)
+	}
+
+	if err := mdb.DeleteEntity(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.Run(ctx, &pb.Entity{}, &pb.Entity{ID: proto.String("foo")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mdb.LoadEntity(ctx, "foo"); err != nil {
+		t.Error("Entity was not restored", err)
+	}
+}
+
+func TestRestoreEntityCB(t *testing.T) {
+	restoreEntityCB()
+}
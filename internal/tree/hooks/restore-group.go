@@ -0,0 +1,49 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+// RestoreGroup brings back a group that was removed by
+// tombstone-group.
+type RestoreGroup struct {
+	tree.BaseHook
+}
+
+// Run will request the underlying datastore to restore the group
+// named in dg.  The group can't be restored if its name or number has
+// been taken by another group since it was removed.
+func (r *RestoreGroup) Run(ctx context.Context, g, dg *pb.Group) error {
+	switch err := r.Storage().RestoreGroup(ctx, dg.GetName()); err {
+	case db.ErrObjectExists:
+		return tree.ErrDuplicateGroupName
+	case db.ErrNumberInUse:
+		return tree.ErrDuplicateNumber
+	default:
+		return err
+	}
+}
+
+func init() {
+	startup.RegisterCallback(restoreGroupCB)
+}
+
+func restoreGroupCB() {
+	tree.RegisterGroupHookConstructor("restore-group", NewRestoreGroup)
+}
+
+// NewRestoreGroup returns an initialized RestoreGroup hook for use.
+func NewRestoreGroup(opts ...tree.HookOption) (tree.GroupHook, error) {
+	opts = append([]tree.HookOption{
+		tree.WithHookName("restore-group"),
+		tree.WithHookPriority(50),
+		tree.WithHookPersists(true),
+	}, opts...)
+	return &RestoreGroup{tree.NewBaseHook(opts...)}, nil
+}
@@ -0,0 +1,62 @@
+package hooks
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/memory"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestRestoreGroup(t *testing.T) {
+	startup.DoCallbacks()
+	ctx := context.Background()
+
+	mdb, err := db.New("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hook, err := NewRestoreGroup(tree.WithHookStorage(mdb))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hook.Run(ctx, &pb.Group{}, &pb.Group{Name: proto.String("foo")}); err != db.ErrUnknownGroup {
+		t.Fatal(err)
+	}
+
+	foo := &pb.Group{Name: proto.String("foo"), Number: proto.Int32(1)}
+	if err := mdb.SaveGroup(ctx, foo); err != nil {
+		t.Fatal(err)
+	}
+	if err := mdb.TombstoneGroup(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mdb.SaveGroup(ctx, foo); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.Run(ctx, &pb.Group{}, &pb.Group{Name: proto.String("foo")}); err != tree.ErrDuplicateGroupName {
+		t.Fatal(err)
+	}
+
+	if err := mdb.DeleteGroup(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.Run(ctx, &pb.Group{}, &pb.Group{Name: proto.String("foo")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mdb.LoadGroup(ctx, "foo"); err != nil {
+		t.Error("Group was not restored", err)
+	}
+}
+
+func TestRestoreGroupCB(t *testing.T) {
+	restoreGroupCB()
+}
@@ -0,0 +1,71 @@
+package hooks
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+// RollbackEntity replaces the metadata of an entity with that of an
+// earlier revision.
+type RollbackEntity struct {
+	tree.BaseHook
+}
+
+// Run replaces the metadata on e with the metadata from de, which is
+// an earlier revision of the same entity.  Only the fields that can
+// be changed with MODIFY_ENTITY_META are restored: capabilities,
+// groups, keys, the lock, and the secret aging keys are kept from the
+// current entity, as are its ID, number, and secret.
+func (*RollbackEntity) Run(_ context.Context, e, de *pb.Entity) error {
+	cur := e.GetMeta()
+	meta, ok := proto.Clone(de.GetMeta()).(*pb.EntityMeta)
+	if !ok || meta == nil {
+		meta = &pb.EntityMeta{}
+	}
+
+	meta.Capabilities = cur.GetCapabilities()
+	meta.Groups = cur.GetGroups()
+	meta.Keys = cur.GetKeys()
+	meta.Locked = cur.Locked
+
+	var um []string
+	for _, m := range meta.GetUntypedMeta() {
+		if k, _ := splitKeyValue(m); !tree.IsSecretKey(k) {
+			um = append(um, m)
+		}
+	}
+	for _, m := range cur.GetUntypedMeta() {
+		if k, _ := splitKeyValue(m); tree.IsSecretKey(k) {
+			um = append(um, m)
+		}
+	}
+	meta.UntypedMeta = um
+
+	e.Meta = meta
+	return nil
+}
+
+func init() {
+	startup.RegisterCallback(rollbackEntityCB)
+}
+
+func rollbackEntityCB() {
+	tree.RegisterEntityHookConstructor("rollback-entity", NewRollbackEntity)
+}
+
+// NewRollbackEntity returns a RollbackEntity hook configured and
+// ready for use.
+func NewRollbackEntity(opts ...tree.HookOption) (tree.EntityHook, error) {
+	opts = append([]tree.HookOption{
+		tree.WithHookName("rollback-entity"),
+		tree.WithHookPriority(50),
+	}, opts...)
+
+	return &RollbackEntity{tree.NewBaseHook(opts...)}, nil
+}
@@ -0,0 +1,89 @@
+package hooks
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestRollbackEntity(t *testing.T) {
+	hook, err := NewRollbackEntity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &pb.Entity{
+		ID:     proto.String("foo"),
+		Secret: proto.String("current"),
+		Meta: &pb.EntityMeta{
+			Shell:  proto.String("/bin/zsh"),
+			Groups: []string{"users"},
+		},
+	}
+	de := &pb.Entity{
+		ID: proto.String("foo"),
+		Meta: &pb.EntityMeta{
+			Groups: []string{"users", "sudoers"},
+		},
+	}
+
+	if err := hook.Run(context.Background(), e, de); err != nil {
+		t.Fatal(err)
+	}
+
+	if e.GetSecret() != "current" || e.GetMeta().GetShell() != "" || len(e.GetMeta().GetGroups()) != 1 {
+		t.Fatal("Spec error - please trace hook")
+	}
+}
+
+func TestRollbackEntityKeepsPrivileges(t *testing.T) {
+	hook, err := NewRollbackEntity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &pb.Entity{
+		ID: proto.String("foo"),
+		Meta: &pb.EntityMeta{
+			Locked:      proto.Bool(true),
+			Keys:        []string{"SSH:new"},
+			UntypedMeta: []string{"secret-changed:200", "phone:123"},
+		},
+	}
+	de := &pb.Entity{
+		ID: proto.String("foo"),
+		Meta: &pb.EntityMeta{
+			Shell:        proto.String("/bin/sh"),
+			Locked:       proto.Bool(false),
+			Capabilities: []pb.Capability{pb.Capability_GLOBAL_ROOT},
+			Keys:         []string{"SSH:old"},
+			UntypedMeta:  []string{"secret-changed:100", "secret-must-change:true", "phone:456"},
+		},
+	}
+
+	if err := hook.Run(context.Background(), e, de); err != nil {
+		t.Fatal(err)
+	}
+
+	m := e.GetMeta()
+	if m.GetShell() != "/bin/sh" || !m.GetLocked() || len(m.GetCapabilities()) != 0 {
+		t.Fatal("Spec error - please trace hook")
+	}
+	if len(m.GetKeys()) != 1 || m.GetKeys()[0] != "SSH:new" {
+		t.Errorf("Keys were rolled back: %v", m.GetKeys())
+	}
+	want := []string{"phone:456", "secret-changed:200"}
+	if !proto.Equal(&pb.EntityMeta{UntypedMeta: m.GetUntypedMeta()}, &pb.EntityMeta{UntypedMeta: want}) {
+		t.Errorf("Untyped meta is %v; want %v", m.GetUntypedMeta(), want)
+	}
+	if len(de.GetMeta().GetUntypedMeta()) != 3 {
+		t.Error("Old revision was modified")
+	}
+}
+
+func TestRollbackEntityCB(t *testing.T) {
+	rollbackEntityCB()
+}
@@ -0,0 +1,50 @@
+package hooks
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+// RollbackGroup replaces a group with an earlier revision of itself.
+type RollbackGroup struct {
+	tree.BaseHook
+}
+
+// Run replaces everything on g with the contents of dg, which is an
+// earlier revision of the same group.  The name, number,
+// capabilities, and managing group are left alone, since these can't
+// be changed with MODIFY_GROUP_META.
+func (*RollbackGroup) Run(_ context.Context, g, dg *pb.Group) error {
+	name, number := g.Name, g.Number
+	caps, managedBy := g.GetCapabilities(), g.ManagedBy
+	proto.Reset(g)
+	proto.Merge(g, dg)
+	g.Name, g.Number = name, number
+	g.Capabilities, g.ManagedBy = caps, managedBy
+	return nil
+}
+
+func init() {
+	startup.RegisterCallback(rollbackGroupCB)
+}
+
+func rollbackGroupCB() {
+	tree.RegisterGroupHookConstructor("rollback-group", NewRollbackGroup)
+}
+
+// NewRollbackGroup returns a RollbackGroup hook configured and ready
+// for use.
+func NewRollbackGroup(opts ...tree.HookOption) (tree.GroupHook, error) {
+	opts = append([]tree.HookOption{
+		tree.WithHookName("rollback-group"),
+		tree.WithHookPriority(50),
+	}, opts...)
+
+	return &RollbackGroup{tree.NewBaseHook(opts...)}, nil
+}
@@ -0,0 +1,47 @@
+package hooks
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestRollbackGroup(t *testing.T) {
+	hook, err := NewRollbackGroup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &pb.Group{
+		Name:        proto.String("foo"),
+		Number:      proto.Int32(2),
+		DisplayName: proto.String("Foo"),
+		Expansions:  []string{"INCLUDE:bar"},
+		ManagedBy:   proto.String("owners"),
+	}
+	dg := &pb.Group{
+		Name:         proto.String("foo"),
+		Number:       proto.Int32(1),
+		ManagedBy:    proto.String("admins"),
+		Capabilities: []pb.Capability{pb.Capability_GLOBAL_ROOT},
+		UntypedMeta:  []string{"room:101"},
+	}
+
+	if err := hook.Run(context.Background(), g, dg); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.GetNumber() != 2 || g.GetDisplayName() != "" || len(g.GetExpansions()) != 0 || len(g.GetUntypedMeta()) != 1 {
+		t.Fatal("Spec error - please trace hook")
+	}
+	if g.GetManagedBy() != "owners" || len(g.GetCapabilities()) != 0 {
+		t.Fatal("Spec error - please trace hook")
+	}
+}
+
+func TestRollbackGroupCB(t *testing.T) {
+	rollbackGroupCB()
+}
@@ -34,6 +34,7 @@ func NewSaveEntity(opts ...tree.HookOption) (tree.EntityHook, error) {
 	opts = append([]tree.HookOption{
 		tree.WithHookName("save-entity"),
 		tree.WithHookPriority(99),
+		tree.WithHookPersists(true),
 	}, opts...)
 
 	return &SaveEntity{tree.NewBaseHook(opts...)}, nil
@@ -34,6 +34,7 @@ func NewSaveGroup(opts ...tree.HookOption) (tree.GroupHook, error) {
 	opts = append([]tree.HookOption{
 		tree.WithHookName("save-group"),
 		tree.WithHookPriority(99),
+		tree.WithHookPersists(true),
 	}, opts...)
 
 	return &SaveGroup{tree.NewBaseHook(opts...)}, nil
@@ -41,6 +41,13 @@ func TestSetEntityNumber(t *testing.T) {
 		t.Log(e)
 		t.Fatal(err)
 	}
+
+	for _, n := range []int32{1, 27} {
+		de.Number = proto.Int32(n)
+		if err := hook.Run(ctx, e, de); err != tree.ErrDuplicateNumber {
+			t.Fatal(n, err)
+		}
+	}
 }
 
 func TestSetEntityNumberCB(t *testing.T) {
@@ -2,9 +2,11 @@ package hooks
 
 import (
 	"context"
+	"time"
 
 	"github.com/netauth/netauth/internal/startup"
 	"github.com/netauth/netauth/internal/tree"
+	"github.com/netauth/netauth/internal/tree/util"
 
 	pb "github.com/netauth/protocol"
 )
@@ -16,13 +18,21 @@ type SetEntitySecret struct {
 }
 
 // Run takes a plaintext secret from de.Secret and secures it using a
-// crypto engine.  The secured secret will be written to e.Secret.
+// crypto engine.  The secured secret will be written to e.Secret, and
+// the time of the change is recorded in the untyped metadata, which
+// also clears any demand that the secret be changed.
 func (s *SetEntitySecret) Run(_ context.Context, e, de *pb.Entity) error {
 	ssecret, err := s.Crypto().SecureSecret(de.GetSecret())
 	if err != nil {
 		return err
 	}
 	e.Secret = &ssecret
+
+	if e.Meta == nil {
+		e.Meta = &pb.EntityMeta{}
+	}
+	um := util.PatchKeyValueSlice(e.Meta.UntypedMeta, "UPSERT", tree.SecretChangedKey, time.Now().UTC().Format(time.RFC3339))
+	e.Meta.UntypedMeta = util.PatchKeyValueSlice(um, "CLEAREXACT", tree.SecretMustChangeKey, "")
 	return nil
 }
 
@@ -2,6 +2,7 @@ package hooks
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
@@ -35,6 +36,35 @@ func TestSetEntitySecret(t *testing.T) {
 		t.Log(e)
 		t.Fatal("Spec error - please trace hook")
 	}
+
+	um := e.GetMeta().GetUntypedMeta()
+	if len(um) != 1 || !strings.HasPrefix(um[0], tree.SecretChangedKey+":") {
+		t.Errorf("Change time wasn't recorded: %v", um)
+	}
+}
+
+func TestSetEntitySecretClearsMustChange(t *testing.T) {
+	crypt, err := nocrypto.New(hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hook, err := NewSetEntitySecret(tree.WithHookCrypto(crypt))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &pb.Entity{Meta: &pb.EntityMeta{UntypedMeta: []string{tree.SecretMustChangeKey + ":true"}}}
+	de := &pb.Entity{Secret: proto.String("security")}
+	if err := hook.Run(context.Background(), e, de); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range e.GetMeta().GetUntypedMeta() {
+		if strings.HasPrefix(m, tree.SecretMustChangeKey+":") {
+			t.Error("Secret is still marked as needing a change")
+		}
+	}
 }
 
 func TestSetEntitySecretCB(t *testing.T) {
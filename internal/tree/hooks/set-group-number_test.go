@@ -43,10 +43,16 @@ func TestSetGroupNumber(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if g.GetNumber() != 1 {
+	// 27 is reserved by the first run, so allocation carries on
+	// from there.
+	if g.GetNumber() != 28 {
 		t.Log(g)
 		t.Error("Spec failure = please trace hook")
 	}
+
+	if err := hook.Run(ctx, g, &pb.Group{Number: proto.Int32(27)}); err != tree.ErrDuplicateNumber {
+		t.Fatal(err)
+	}
 }
 
 func TestSetGroupNumberCB(t *testing.T) {
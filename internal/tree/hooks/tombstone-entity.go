@@ -0,0 +1,45 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+// TombstoneEntity removes an entity from the system in a way that
+// can be undone with restore-entity.
+type TombstoneEntity struct {
+	tree.BaseHook
+}
+
+// Run will request the underlying datastore to move the entity into
+// a tombstone, returning any status provided.  If the entity ID is
+// not specified in e, it will be obtained from de.
+func (t *TombstoneEntity) Run(ctx context.Context, e, de *pb.Entity) error {
+	if e.GetID() == "" {
+		e.ID = de.ID
+	}
+	return t.Storage().TombstoneEntity(ctx, e.GetID())
+}
+
+func init() {
+	startup.RegisterCallback(tombstoneEntityCB)
+}
+
+func tombstoneEntityCB() {
+	tree.RegisterEntityHookConstructor("tombstone-entity", NewTombstoneEntity)
+}
+
+// NewTombstoneEntity returns an initialized TombstoneEntity hook for
+// use.
+func NewTombstoneEntity(opts ...tree.HookOption) (tree.EntityHook, error) {
+	opts = append([]tree.HookOption{
+		tree.WithHookName("tombstone-entity"),
+		tree.WithHookPriority(99),
+		tree.WithHookPersists(true),
+	}, opts...)
+	return &TombstoneEntity{tree.NewBaseHook(opts...)}, nil
+}
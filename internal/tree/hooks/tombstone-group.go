@@ -0,0 +1,45 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+// TombstoneGroup removes a group from the system in a way that
+// can be undone with restore-group.
+type TombstoneGroup struct {
+	tree.BaseHook
+}
+
+// Run will request the underlying datastore to move the group into
+// a tombstone, returning any status provided.  If the group name is
+// not specified in g, it will be obtained from dg.
+func (t *TombstoneGroup) Run(ctx context.Context, g, dg *pb.Group) error {
+	if g.GetName() == "" {
+		g.Name = dg.Name
+	}
+	return t.Storage().TombstoneGroup(ctx, g.GetName())
+}
+
+func init() {
+	startup.RegisterCallback(tombstoneGroupCB)
+}
+
+func tombstoneGroupCB() {
+	tree.RegisterGroupHookConstructor("tombstone-group", NewTombstoneGroup)
+}
+
+// NewTombstoneGroup returns an initialized TombstoneGroup hook for
+// use.
+func NewTombstoneGroup(opts ...tree.HookOption) (tree.GroupHook, error) {
+	opts = append([]tree.HookOption{
+		tree.WithHookName("tombstone-group"),
+		tree.WithHookPriority(99),
+		tree.WithHookPersists(true),
+	}, opts...)
+	return &TombstoneGroup{tree.NewBaseHook(opts...)}, nil
+}
@@ -21,9 +21,14 @@ type ManageEntityUM struct {
 // mode the plugin is configured for.  "UPSERT" will add or update
 // fields as appropriate.  "CLEARFUZZY" will ignore Z-Indexing
 // annotations.  "CLEAREXACT" will require exact key specifications.
+// The keys that record the age of secrets are refused in every mode,
+// since changing them would keep a secret from expiring.
 func (mm *ManageEntityUM) Run(_ context.Context, e, de *pb.Entity) error {
 	for _, m := range de.Meta.UntypedMeta {
 		key, value := splitKeyValue(m)
+		if tree.IsSecretKey(key) {
+			return tree.ErrReservedKey
+		}
 		e.Meta.UntypedMeta = util.PatchKeyValueSlice(e.Meta.UntypedMeta, mm.mode, key, value)
 	}
 	return nil
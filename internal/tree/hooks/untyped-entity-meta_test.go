@@ -4,6 +4,8 @@ import (
 	"context"
 	"testing"
 
+	"github.com/netauth/netauth/internal/tree"
+
 	pb "github.com/netauth/protocol"
 )
 
@@ -29,6 +31,24 @@ func TestAddEntityUM(t *testing.T) {
 	}
 }
 
+func TestEntityUMSecretKeys(t *testing.T) {
+	hook, err := NewDelFuzzyEntityUM()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{tree.SecretChangedKey, tree.SecretMustChangeKey + "{1}"} {
+		e := &pb.Entity{Meta: &pb.EntityMeta{UntypedMeta: []string{tree.SecretMustChangeKey + ":true"}}}
+		de := &pb.Entity{Meta: &pb.EntityMeta{UntypedMeta: []string{key + ":"}}}
+		if err := hook.Run(context.Background(), e, de); err != tree.ErrReservedKey {
+			t.Errorf("%s: Got %v; Want %v", key, err, tree.ErrReservedKey)
+		}
+		if len(e.GetMeta().GetUntypedMeta()) != 1 {
+			t.Errorf("%s: Metadata was changed: %v", key, e.GetMeta().GetUntypedMeta())
+		}
+	}
+}
+
 func TestDelFuzzyEntityUM(t *testing.T) {
 	hook, err := NewDelFuzzyEntityUM()
 	if err != nil {
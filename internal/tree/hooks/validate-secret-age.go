@@ -0,0 +1,78 @@
+package hooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+// maxSecretClockSkew is how far in the future the change time of a
+// secret may be before it is distrusted.  Servers that share a store
+// won't have quite the same time.
+const maxSecretClockSkew = time.Minute
+
+// ValidateSecretAge returns an error if the secret of an entity has
+// expired.
+type ValidateSecretAge struct {
+	tree.BaseHook
+}
+
+// Run returns tree.ErrSecretExpired if the entity has been marked as
+// needing to change its secret, or if its secret is older than the
+// MaxAge of the SecretPolicy.  A change time in the future would keep
+// the secret from ever expiring, so beyond maxSecretClockSkew such a
+// secret is treated as expired.  This hook must run after the secret
+// has been verified, so that only the holder of the secret learns
+// that it has expired.
+func (v *ValidateSecretAge) Run(_ context.Context, e, de *pb.Entity) error {
+	var changed string
+	for _, m := range e.GetMeta().GetUntypedMeta() {
+		key, value := splitKeyValue(m)
+		switch key {
+		case tree.SecretMustChangeKey:
+			return tree.ErrSecretExpired
+		case tree.SecretChangedKey:
+			changed = value
+		}
+	}
+
+	maxAge := v.SecretPolicy().MaxAge
+	if maxAge <= 0 || changed == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, changed)
+	if err != nil {
+		v.Log().Warn("Secret change time is malformed", "entity", e.GetID(), "value", changed)
+		return nil
+	}
+	if time.Until(t) > maxSecretClockSkew {
+		v.Log().Warn("Secret change time is in the future", "entity", e.GetID(), "value", changed)
+		return tree.ErrSecretExpired
+	}
+	if time.Since(t) > maxAge {
+		return tree.ErrSecretExpired
+	}
+	return nil
+}
+
+func init() {
+	startup.RegisterCallback(validateSecretAgeCB)
+}
+
+func validateSecretAgeCB() {
+	tree.RegisterEntityHookConstructor("validate-secret-age", NewValidateSecretAge)
+}
+
+// NewValidateSecretAge returns an initialized hook ready for use.
+func NewValidateSecretAge(opts ...tree.HookOption) (tree.EntityHook, error) {
+	opts = append([]tree.HookOption{
+		tree.WithHookName("validate-secret-age"),
+		tree.WithHookPriority(51),
+	}, opts...)
+
+	return &ValidateSecretAge{tree.NewBaseHook(opts...)}, nil
+}
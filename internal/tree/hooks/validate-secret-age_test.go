@@ -0,0 +1,55 @@
+package hooks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestValidateSecretAge(t *testing.T) {
+	hook, err := NewValidateSecretAge(tree.WithHookSecretPolicy(tree.SecretPolicy{MaxAge: 24 * time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := func(d time.Duration) string {
+		return tree.SecretChangedKey + ":" + time.Now().Add(-d).UTC().Format(time.RFC3339)
+	}
+
+	cases := []struct {
+		um      []string
+		wantErr error
+	}{
+		{nil, nil},
+		{[]string{changed(time.Hour)}, nil},
+		{[]string{changed(48 * time.Hour)}, tree.ErrSecretExpired},
+		{[]string{changed(time.Hour), tree.SecretMustChangeKey + ":true"}, tree.ErrSecretExpired},
+		{[]string{tree.SecretChangedKey + ":yesterday"}, nil},
+		{[]string{changed(-30 * time.Second)}, nil},
+		{[]string{changed(-365 * 24 * time.Hour)}, tree.ErrSecretExpired},
+	}
+	for i, c := range cases {
+		e := &pb.Entity{Meta: &pb.EntityMeta{UntypedMeta: c.um}}
+		if err := hook.Run(context.Background(), e, &pb.Entity{}); err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+	}
+
+	// Without a maximum age only the flag matters.
+	hook, err = NewValidateSecretAge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &pb.Entity{Meta: &pb.EntityMeta{UntypedMeta: []string{changed(48 * time.Hour)}}}
+	if err := hook.Run(context.Background(), e, &pb.Entity{}); err != nil {
+		t.Errorf("Got %v; Want nil", err)
+	}
+}
+
+func TestValidateSecretAgeCB(t *testing.T) {
+	validateSecretAgeCB()
+}
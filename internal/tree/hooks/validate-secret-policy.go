@@ -0,0 +1,143 @@
+package hooks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+// ValidateSecretPolicy checks that a new secret meets the
+// SecretPolicy of the tree.
+type ValidateSecretPolicy struct {
+	tree.BaseHook
+
+	compromised map[string]struct{}
+}
+
+// Run checks the plaintext secret in de.Secret against the policy,
+// and returns a *tree.SecretPolicyError that says why if it doesn't
+// meet it.  An empty secret is only accepted for an entity that has
+// none yet, which is how entities are created without a secret.
+func (v *ValidateSecretPolicy) Run(ctx context.Context, e, de *pb.Entity) error {
+	secret := de.GetSecret()
+	if secret == "" && e.GetSecret() == "" {
+		return nil
+	}
+	p := v.SecretPolicy()
+
+	if len([]rune(secret)) < p.MinLength {
+		return &tree.SecretPolicyError{Reason: fmt.Sprintf("the secret must be at least %d characters long", p.MinLength)}
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range secret {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireUpper && !upper:
+		return &tree.SecretPolicyError{Reason: "the secret must contain an upper case letter"}
+	case p.RequireLower && !lower:
+		return &tree.SecretPolicyError{Reason: "the secret must contain a lower case letter"}
+	case p.RequireDigit && !digit:
+		return &tree.SecretPolicyError{Reason: "the secret must contain a digit"}
+	case p.RequireSymbol && !symbol:
+		return &tree.SecretPolicyError{Reason: "the secret must contain a symbol"}
+	}
+
+	if p.RejectIdentity {
+		for _, s := range []string{
+			e.GetID(),
+			de.GetID(),
+			e.GetMeta().GetGECOS(),
+			de.GetMeta().GetGECOS(),
+		} {
+			if s != "" && strings.EqualFold(secret, s) {
+				return &tree.SecretPolicyError{Reason: "the secret must not be the entity's ID or name"}
+			}
+		}
+	}
+
+	if _, ok := v.compromised[secret]; ok {
+		return &tree.SecretPolicyError{Reason: "the secret is known to be compromised"}
+	}
+
+	// The history is only kept when the storage is configured to
+	// keep it, and it includes the secret the entity has now.
+	if v.Storage() != nil && e.GetID() != "" {
+		old, err := v.Storage().SecretHistory(ctx, e.GetID())
+		if err != nil {
+			return err
+		}
+		for _, s := range old {
+			if v.Crypto().VerifySecret(secret, s) == nil {
+				return &tree.SecretPolicyError{Reason: "the secret has been used recently"}
+			}
+		}
+	}
+	return nil
+}
+
+// loadCompromised reads the file of compromised secrets, ignoring
+// blank lines.
+func loadCompromised(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	out := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if l := strings.TrimRight(scanner.Text(), "\r"); l != "" {
+			out[l] = struct{}{}
+		}
+	}
+	return out, scanner.Err()
+}
+
+func init() {
+	startup.RegisterCallback(validateSecretPolicyCB)
+}
+
+func validateSecretPolicyCB() {
+	tree.RegisterEntityHookConstructor("validate-secret-policy", NewValidateSecretPolicy)
+}
+
+// NewValidateSecretPolicy returns an initialized hook ready for use.
+// The list of compromised secrets is read once, when the hook is
+// created.
+func NewValidateSecretPolicy(opts ...tree.HookOption) (tree.EntityHook, error) {
+	opts = append([]tree.HookOption{
+		tree.WithHookName("validate-secret-policy"),
+		tree.WithHookPriority(40),
+	}, opts...)
+
+	v := &ValidateSecretPolicy{BaseHook: tree.NewBaseHook(opts...)}
+	if path := v.SecretPolicy().CompromisedList; path != "" {
+		c, err := loadCompromised(path)
+		if err != nil {
+			v.Log().Error("Unable to load compromised secrets", "file", path, "error", err)
+			return nil, err
+		}
+		v.compromised = c
+	}
+	return v, nil
+}
@@ -0,0 +1,98 @@
+package hooks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/crypto/nocrypto"
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/memory"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestValidateSecretPolicy(t *testing.T) {
+	ctx := context.Background()
+	crypt, err := nocrypto.New(hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdb, err := db.New("memory", db.WithSecretHistory(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Old-Secret1", "Current-Secret1"} {
+		e := &pb.Entity{ID: proto.String("foo"), Secret: proto.String(s)}
+		if err := mdb.SaveEntity(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := filepath.Join(t.TempDir(), "compromised")
+	if err := os.WriteFile(list, []byte("Password-123\n\nLetMeIn!99\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hook, err := NewValidateSecretPolicy(
+		tree.WithHookCrypto(crypt),
+		tree.WithHookStorage(mdb),
+		tree.WithHookSecretPolicy(tree.SecretPolicy{
+			MinLength:       8,
+			RequireUpper:    true,
+			RequireLower:    true,
+			RequireDigit:    true,
+			RequireSymbol:   true,
+			RejectIdentity:  true,
+			CompromisedList: list,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		e       *pb.Entity
+		secret  string
+		wantErr bool
+	}{
+		{&pb.Entity{}, "", false},
+		{&pb.Entity{}, "Good-Secret1", false},
+		{&pb.Entity{}, "Sh0rt!", true},
+		{&pb.Entity{}, "no-upper-1", true},
+		{&pb.Entity{}, "NO-LOWER-1", true},
+		{&pb.Entity{}, "No-Digits!", true},
+		{&pb.Entity{}, "NoSymbols1", true},
+		{&pb.Entity{}, "Password-123", true},
+		{&pb.Entity{ID: proto.String("Fred-Foo99")}, "fred-foo99", true},
+		{&pb.Entity{ID: proto.String("bar"), Meta: &pb.EntityMeta{GECOS: proto.String("Fred Foo-1")}}, "FRED FOO-1", true},
+		{&pb.Entity{ID: proto.String("foo"), Secret: proto.String("Current-Secret1")}, "", true},
+		{&pb.Entity{ID: proto.String("foo"), Secret: proto.String("Current-Secret1")}, "Current-Secret1", true},
+		{&pb.Entity{ID: proto.String("foo"), Secret: proto.String("Current-Secret1")}, "Old-Secret1", true},
+		{&pb.Entity{ID: proto.String("foo"), Secret: proto.String("Current-Secret1")}, "New-Secret1", false},
+	}
+	for i, c := range cases {
+		err := hook.Run(ctx, c.e, &pb.Entity{Secret: proto.String(c.secret)})
+		if _, ok := err.(*tree.SecretPolicyError); ok != c.wantErr {
+			t.Errorf("%d: Got %v; Want error: %v", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestValidateSecretPolicyBadList(t *testing.T) {
+	_, err := NewValidateSecretPolicy(tree.WithHookSecretPolicy(tree.SecretPolicy{
+		CompromisedList: filepath.Join(t.TempDir(), "missing"),
+	}))
+	if err == nil {
+		t.Error("Hook was created without its list")
+	}
+}
+
+func TestValidateSecretPolicyCB(t *testing.T) {
+	validateSecretPolicyCB()
+}
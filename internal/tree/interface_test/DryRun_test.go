@@ -0,0 +1,66 @@
+package interface_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/tree"
+)
+
+func TestDryRunCreateEntity(t *testing.T) {
+	em, mdb := newTreeManager(t)
+	addEntity(t, mdb)
+
+	ctx, dr := tree.WithDryRun(context.Background())
+	if err := em.CreateEntity(ctx, "foo", -1, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mdb.LoadEntity(context.Background(), "foo"); err != db.ErrUnknownEntity {
+		t.Errorf("Entity was saved during a dry run: %v", err)
+	}
+
+	ents := dr.Entities()
+	if len(ents) != 1 || ents[0].GetID() != "foo" || ents[0].GetNumber() != 2 {
+		t.Fatalf("Wrong would-be entities: %v", ents)
+	}
+	if ents[0].Secret != nil {
+		t.Error("Secret was not redacted")
+	}
+
+	// Checks still happen, and the number is still free.
+	if err := em.CreateEntity(ctx, "entity1", -1, "secret"); err != tree.ErrDuplicateEntityID {
+		t.Errorf("Got %v; Want %v", err, tree.ErrDuplicateEntityID)
+	}
+	if err := em.CreateEntity(context.Background(), "foo", -1, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := mdb.LoadEntity(context.Background(), "foo"); e.GetNumber() != 2 {
+		t.Errorf("Dry run reserved a number: %v", e)
+	}
+}
+
+func TestDryRunDestroyGroup(t *testing.T) {
+	em, mdb := newTreeManager(t)
+	addGroup(t, mdb)
+
+	ctx, dr := tree.WithDryRun(context.Background())
+	if err := em.DestroyGroup(ctx, "group1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mdb.LoadGroup(context.Background(), "group1"); err != nil {
+		t.Errorf("Group was destroyed during a dry run: %v", err)
+	}
+	if g := dr.Groups(); len(g) != 1 || g[0].GetName() != "group1" {
+		t.Errorf("Wrong would-be groups: %v", g)
+	}
+
+	// Reads don't report anything.
+	ctx, dr = tree.WithDryRun(context.Background())
+	if _, err := em.FetchGroup(ctx, "group1"); err != nil {
+		t.Fatal(err)
+	}
+	if g := dr.Groups(); len(g) != 0 {
+		t.Errorf("Fetch was reported: %v", g)
+	}
+}
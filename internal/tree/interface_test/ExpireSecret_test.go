@@ -0,0 +1,36 @@
+package interface_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/netauth/netauth/internal/crypto"
+	"github.com/netauth/netauth/internal/tree"
+)
+
+func TestExpireSecret(t *testing.T) {
+	ctxt := context.Background()
+	m, mdb := newTreeManager(t)
+
+	addEntity(t, mdb)
+
+	if err := m.ExpireSecret(ctxt, "entity1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the right secret reveals that it has expired.
+	if err := m.ValidateSecret(ctxt, "entity1", "password"); err != crypto.ErrAuthorizationFailure {
+		t.Error(err)
+	}
+	if err := m.ValidateSecret(ctxt, "entity1", "entity1"); err != tree.ErrSecretExpired {
+		t.Error(err)
+	}
+
+	// Changing the secret clears the expiry.
+	if err := m.SetSecret(ctxt, "entity1", "entity2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ValidateSecret(ctxt, "entity1", "entity2"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,60 @@
+package interface_test
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/netauth/netauth/internal/crypto/nocrypto"
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+)
+
+func TestNewChainConfig(t *testing.T) {
+	startup.DoCallbacks()
+
+	cases := []struct {
+		opts    []tree.Option
+		wantErr error
+	}{
+		{
+			opts: []tree.Option{
+				tree.WithEntityChains(tree.ChainConfig{"FETCH": {"load-entity"}, "CUSTOM": {"load-entity"}}),
+				tree.WithEntityChainExtensions(tree.ChainConfig{"SET-SECRET": {"lock-entity"}}),
+				tree.WithGroupChains(tree.ChainConfig{"FETCH": {"load-group"}}),
+				tree.WithGroupChainExtensions(tree.ChainConfig{"CUSTOM": {"load-group"}}),
+			},
+			wantErr: nil,
+		},
+		{
+			opts:    []tree.Option{tree.WithEntityChains(tree.ChainConfig{"FETCH": {"no-such-hook"}})},
+			wantErr: tree.ErrUnknownHook,
+		},
+		{
+			opts:    []tree.Option{tree.WithGroupChainExtensions(tree.ChainConfig{"CREATE": {"no-such-hook"}})},
+			wantErr: tree.ErrUnknownHook,
+		},
+		{
+			// Required chains can be replaced, but not emptied.
+			opts:    []tree.Option{tree.WithEntityChains(tree.ChainConfig{"FETCH": {}})},
+			wantErr: tree.ErrUnknownHookChain,
+		},
+	}
+
+	for i, c := range cases {
+		mdb, err := db.New("memory")
+		if err != nil {
+			t.Fatal(err)
+		}
+		crypto, err := nocrypto.New(hclog.NewNullLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts := append([]tree.Option{tree.WithStorage(mdb), tree.WithCrypto(crypto)}, c.opts...)
+		if _, err := tree.New(opts...); err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+	}
+}
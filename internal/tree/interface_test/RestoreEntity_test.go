@@ -0,0 +1,105 @@
+package interface_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestRestoreEntity(t *testing.T) {
+	ctx := context.Background()
+	m, mdb := newTreeManager(t)
+
+	addGroup(t, mdb)
+	if err := m.CreateEntity(ctx, "entity1", 1, "entity1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddEntityToGroup(ctx, "entity1", "group1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.DestroyEntity(ctx, "entity1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ValidateSecret(ctx, "entity1", "entity1"); err == nil {
+		t.Error("Destroyed entity can authenticate")
+	}
+	res, _, err := m.SearchEntities(ctx, db.SearchRequest{Expression: "ID:entity1"})
+	if err != nil || len(res) != 0 {
+		t.Errorf("Destroyed entity is searchable: %v %v", res, err)
+	}
+	if members, _ := m.ListMembers(ctx, "group1"); len(members) != 0 {
+		t.Error("Destroyed entity is still a member")
+	}
+
+	if err := m.RestoreEntity(ctx, "entity1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ValidateSecret(ctx, "entity1", "entity1"); err != nil {
+		t.Error("Restored entity can't authenticate", err)
+	}
+	if members, _ := m.ListMembers(ctx, "group1"); len(members) != 1 || members[0].GetID() != "entity1" {
+		t.Error("Restored entity lost its membership", members)
+	}
+	if err := m.RestoreEntity(ctx, "entity1"); err != db.ErrUnknownEntity {
+		t.Errorf("Restored twice: %v", err)
+	}
+}
+
+func TestRestoreEntityTaken(t *testing.T) {
+	ctx := context.Background()
+	m, mdb := newTreeManager(t)
+
+	addEntity(t, mdb)
+	if err := m.DestroyEntity(ctx, "entity1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateEntity(ctx, "entity2", 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RestoreEntity(ctx, "entity1"); err != tree.ErrDuplicateNumber {
+		t.Errorf("Got %v; Want %v", err, tree.ErrDuplicateNumber)
+	}
+
+	if err := mdb.SaveEntity(ctx, &pb.Entity{ID: proto.String("entity1"), Number: proto.Int32(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RestoreEntity(ctx, "entity1"); err != tree.ErrDuplicateEntityID {
+		t.Errorf("Got %v; Want %v", err, tree.ErrDuplicateEntityID)
+	}
+}
+
+func TestPurgeTombstones(t *testing.T) {
+	ctx := context.Background()
+	m, mdb := newTreeManager(t)
+
+	addEntity(t, mdb)
+	addGroup(t, mdb)
+	if err := m.DestroyEntity(ctx, "entity1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DestroyGroup(ctx, "group1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing was deleted before the server started.
+	if n, err := mdb.(*db.DB).PurgeTombstones(ctx, time.Now().Add(-time.Hour)); n != 0 || err != nil {
+		t.Errorf("Purged %d: %v", n, err)
+	}
+	if n, err := mdb.(*db.DB).PurgeTombstones(ctx, time.Now()); n != 2 || err != nil {
+		t.Errorf("Purged %d: %v", n, err)
+	}
+	if err := m.RestoreEntity(ctx, "entity1"); err != db.ErrUnknownEntity {
+		t.Errorf("Restored a purged entity: %v", err)
+	}
+	if err := m.RestoreGroup(ctx, "group1"); err != db.ErrUnknownGroup {
+		t.Errorf("Restored a purged group: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package interface_test
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestRestoreGroup(t *testing.T) {
+	ctx := context.Background()
+	m, mdb := newTreeManager(t)
+
+	addGroup(t, mdb)
+	if err := m.CreateEntity(ctx, "entity1", 1, "entity1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddEntityToGroup(ctx, "entity1", "group1"); err != nil {
+		t.Fatal(err)
+	}
+	e, err := mdb.LoadEntity(ctx, "entity1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.DestroyGroup(ctx, "group1"); err != nil {
+		t.Fatal(err)
+	}
+	if groups := m.GetMemberships(ctx, e); len(groups) != 0 {
+		t.Error("Destroyed group still has members", groups)
+	}
+	res, _, err := m.SearchGroups(ctx, db.SearchRequest{Expression: "Name:group1"})
+	if err != nil || len(res) != 0 {
+		t.Errorf("Destroyed group is searchable: %v %v", res, err)
+	}
+
+	if err := m.RestoreGroup(ctx, "group1"); err != nil {
+		t.Fatal(err)
+	}
+	if groups := m.GetMemberships(ctx, e); len(groups) != 1 || groups[0] != "group1" {
+		t.Error("Restored group lost its members", groups)
+	}
+	if err := m.RestoreGroup(ctx, "group1"); err != db.ErrUnknownGroup {
+		t.Errorf("Restored twice: %v", err)
+	}
+}
+
+func TestRestoreGroupTaken(t *testing.T) {
+	ctx := context.Background()
+	m, mdb := newTreeManager(t)
+
+	addGroup(t, mdb)
+	if err := m.DestroyGroup(ctx, "group1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateGroup(ctx, "group2", "", "", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RestoreGroup(ctx, "group1"); err != tree.ErrDuplicateNumber {
+		t.Errorf("Got %v; Want %v", err, tree.ErrDuplicateNumber)
+	}
+
+	if err := mdb.SaveGroup(ctx, &pb.Group{Name: proto.String("group1"), Number: proto.Int32(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RestoreGroup(ctx, "group1"); err != tree.ErrDuplicateGroupName {
+		t.Errorf("Got %v; Want %v", err, tree.ErrDuplicateGroupName)
+	}
+}
@@ -0,0 +1,99 @@
+package interface_test
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestRollbackEntity(t *testing.T) {
+	ctx := context.Background()
+	m, mdb := newTreeManager(t, db.WithHistory(10))
+
+	addGroup(t, mdb)
+	if err := m.CreateEntity(ctx, "entity1", 1, "entity1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpdateEntityMeta(db.WithActor(ctx, "admin"), "entity1", &pb.EntityMeta{Shell: proto.String("/bin/sh")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpdateEntityMeta(db.WithActor(ctx, "mallory"), "entity1", &pb.EntityMeta{Shell: proto.String("/bin/false")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetSecret(ctx, "entity1", "changed"); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := m.EntityHistory(ctx, "entity1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 3 {
+		t.Fatalf("Got %d revisions; Want 3", len(h))
+	}
+	if h[2].Actor != "mallory" || h[2].Entity.GetMeta().GetShell() != "/bin/false" {
+		t.Errorf("Update was recorded as %v", h[2])
+	}
+
+	// Capabilities, memberships, and the lock are not restored, since
+	// they can't be set with the capability that a rollback needs.
+	if err := m.SetEntityCapability2(ctx, "entity1", pb.Capability_GLOBAL_ROOT.Enum()); err != nil {
+		t.Fatal(err)
+	}
+	h, _ = m.EntityHistory(ctx, "entity1")
+	withCap := h[len(h)-1].Rev
+	if err := m.DropEntityCapability2(ctx, "entity1", pb.Capability_GLOBAL_ROOT.Enum()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddEntityToGroup(ctx, "entity1", "group1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LockEntity(ctx, "entity1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RollbackEntity(db.WithActor(ctx, "admin"), "entity1", withCap); err != nil {
+		t.Fatal(err)
+	}
+	e, err := m.FetchEntity(ctx, "entity1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.GetMeta().GetCapabilities()) != 0 || !e.GetMeta().GetLocked() {
+		t.Errorf("Rollback restored privileges: %v", e)
+	}
+	if members, _ := m.ListMembers(ctx, "group1"); len(members) != 1 {
+		t.Error("Rollback changed membership", members)
+	}
+
+	if err := m.RollbackEntity(db.WithActor(ctx, "admin"), "entity1", h[1].Rev); err != nil {
+		t.Fatal(err)
+	}
+	e, err = m.FetchEntity(ctx, "entity1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.GetMeta().GetShell() != "/bin/sh" {
+		t.Errorf("Entity was not rolled back: %v", e)
+	}
+	h, _ = m.EntityHistory(ctx, "entity1")
+	if last := h[len(h)-1]; last.Actor != "admin" {
+		t.Errorf("Rollback was recorded as %v", last)
+	}
+	if err := m.UnlockEntity(ctx, "entity1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ValidateSecret(ctx, "entity1", "changed"); err != nil {
+		t.Error("Rollback changed the secret", err)
+	}
+
+	if err := m.RollbackEntity(ctx, "entity1", 42); err != tree.ErrUnknownRevision {
+		t.Errorf("Rolled back to an unknown revision: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package interface_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+	rpc "github.com/netauth/protocol/v2"
+)
+
+func TestRollbackGroup(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTreeManager(t, db.WithHistory(10))
+
+	if err := m.CreateGroup(ctx, "group1", "Group One", "", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateGroup(ctx, "group2", "", "", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ModifyGroupRule(ctx, "group1", "group2", rpc.RuleAction_INCLUDE); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ModifyGroupRule(ctx, "group1", "group2", rpc.RuleAction_REMOVE_RULE); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := m.GroupHistory(ctx, "group1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 3 {
+		t.Fatalf("Got %d revisions; Want 3", len(h))
+	}
+
+	// Going back to the expansion would make a cycle once group2
+	// includes group1.
+	if err := m.ModifyGroupRule(ctx, "group2", "group1", rpc.RuleAction_INCLUDE); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RollbackGroup(ctx, "group1", h[1].Rev); err != tree.ErrExistingExpansion {
+		t.Errorf("Rollback made a cycle: %v", err)
+	}
+	if err := m.ModifyGroupRule(ctx, "group2", "group1", rpc.RuleAction_REMOVE_RULE); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RollbackGroup(ctx, "group1", h[1].Rev); err != nil {
+		t.Fatal(err)
+	}
+	g, err := m.FetchGroup(ctx, "group1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.GetExpansions()) != 1 || g.GetDisplayName() != "Group One" {
+		t.Errorf("Group was not rolled back: %v", g)
+	}
+
+	// Capabilities are not restored, since they can't be set with
+	// the capability that a rollback needs.
+	if err := m.SetGroupCapability2(ctx, "group1", pb.Capability_GLOBAL_ROOT.Enum()); err != nil {
+		t.Fatal(err)
+	}
+	h, _ = m.GroupHistory(ctx, "group1")
+	withCap := h[len(h)-1].Rev
+	if err := m.DropGroupCapability2(ctx, "group1", pb.Capability_GLOBAL_ROOT.Enum()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RollbackGroup(ctx, "group1", withCap); err != nil {
+		t.Fatal(err)
+	}
+	g, err = m.FetchGroup(ctx, "group1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.GetCapabilities()) != 0 {
+		t.Errorf("Rollback restored capabilities: %v", g)
+	}
+
+	if err := m.RollbackGroup(ctx, "does-not-exist", 1); err != tree.ErrUnknownRevision {
+		t.Errorf("Rolled back a group that doesn't exist: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package interface_test
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+// racingEntityHook writes a changed copy of the entity straight to
+// storage, as though a second request had completed while the chain
+// was running.
+type racingEntityHook struct {
+	tree.BaseHook
+}
+
+func (h *racingEntityHook) Run(ctx context.Context, e, de *pb.Entity) error {
+	le, err := h.Storage().LoadEntity(context.Background(), e.GetID())
+	if err != nil {
+		return err
+	}
+	le.Meta = &pb.EntityMeta{DisplayName: proto.String("Changed Elsewhere")}
+	return h.Storage().SaveEntity(context.Background(), le)
+}
+
+func newRacingEntityHook(opts ...tree.HookOption) (tree.EntityHook, error) {
+	opts = append([]tree.HookOption{
+		tree.WithHookName("test-racing-entity"),
+		tree.WithHookPriority(50),
+	}, opts...)
+	return &racingEntityHook{tree.NewBaseHook(opts...)}, nil
+}
+
+func TestRunEntityChainConflict(t *testing.T) {
+	ctxt := context.Background()
+	m, ctx := newTreeManager(t)
+
+	addEntity(t, ctx)
+
+	tree.RegisterEntityHookConstructor("test-racing-entity", newRacingEntityHook)
+	m.InitializeEntityHooks()
+	if err := m.RegisterEntityHookToChain("test-racing-entity", "KV-ADD"); err != nil {
+		t.Fatal(err)
+	}
+
+	kv1 := []*pb.KVData{{
+		Key: proto.String("key1"),
+		Values: []*pb.KVValue{{
+			Value: proto.String("value1"),
+		}},
+	}}
+	if err := m.EntityKVAdd(ctxt, "entity1", kv1); err != tree.ErrConflict {
+		t.Fatalf("Got %v; Want %v", err, tree.ErrConflict)
+	}
+
+	// The concurrent change must have survived.
+	e, err := m.FetchEntity(ctxt, "entity1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.GetMeta().GetDisplayName() != "Changed Elsewhere" {
+		t.Error("Concurrent update was lost")
+	}
+	if len(e.GetMeta().GetKV()) != 0 {
+		t.Error("Conflicting update was saved")
+	}
+
+	// Chains that don't race are unaffected.
+	if err := m.LockEntity(ctxt, "entity1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateSecretDuringChange(t *testing.T) {
+	m, ctx := newTreeManager(t)
+
+	addEntity(t, ctx)
+
+	tree.RegisterEntityHookConstructor("test-racing-entity", newRacingEntityHook)
+	m.InitializeEntityHooks()
+	if err := m.RegisterEntityHookToChain("test-racing-entity", "VALIDATE-IDENTITY"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Authentication writes nothing, so a change made while it
+	// runs can't make it fail.
+	if err := m.ValidateSecret(context.Background(), "entity1", "entity1"); err != nil {
+		t.Fatalf("Got %v; Want nil", err)
+	}
+}
@@ -17,10 +17,10 @@ import (
 	pb "github.com/netauth/protocol"
 )
 
-func newTreeManager(t *testing.T) (*tree.Manager, tree.DB) {
+func newTreeManager(t *testing.T, opts ...db.Option) (*tree.Manager, tree.DB) {
 	startup.DoCallbacks()
 
-	mdb, err := db.New("memory")
+	mdb, err := db.New("memory", opts...)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1,8 +1,11 @@
 package tree
 
 import (
+	"context"
+
 	"github.com/hashicorp/go-hclog"
 
+	"github.com/netauth/netauth/internal/db"
 	"github.com/netauth/netauth/internal/mresolver"
 )
 
@@ -26,16 +29,21 @@ func New(opts ...Option) (*Manager, error) {
 	x.resolver = mresolver.New()
 	x.resolver.SetParentLogger(x.log)
 
-	x.db.RegisterCallback("entity-resolver", x.entityResolverCallback)
-	x.db.RegisterCallback("group-resolver", x.groupResolverCallback)
+	x.db.Subscribe("entity-resolver", x.entityResolverCallback)
+	x.db.Subscribe("group-resolver", x.groupResolverCallback)
 
 	// Initialize all entity hooks and bind to names.
 	x.entityHooks = make(map[string]EntityHook)
-	x.InitializeEntityHooks()
+	if err := x.InitializeEntityHooks(); err != nil {
+		return nil, err
+	}
 
 	// Construct entity chains out of the bound plugins.
 	x.entityProcesses = make(map[string][]EntityHook)
-	x.InitializeEntityChains(defaultEntityChains)
+	ec := mergeChains(defaultEntityChains, x.entityChains, x.entityChainsExt)
+	if err := x.InitializeEntityChains(ec); err != nil {
+		return nil, err
+	}
 
 	// Check that required chains are loaded, bailing out if they
 	// aren't.
@@ -45,11 +53,16 @@ func New(opts ...Option) (*Manager, error) {
 
 	// Initialize all group hooks and bind to names.
 	x.groupHooks = make(map[string]GroupHook)
-	x.InitializeGroupHooks()
+	if err := x.InitializeGroupHooks(); err != nil {
+		return nil, err
+	}
 
 	// Construct group chains out of the bound plugins.
 	x.groupProcesses = make(map[string][]GroupHook)
-	x.InitializeGroupChains(defaultGroupChains)
+	gc := mergeChains(defaultGroupChains, x.groupChains, x.groupChainsExt)
+	if err := x.InitializeGroupChains(gc); err != nil {
+		return nil, err
+	}
 
 	// Check that required chains are loaded, bailing out if they aren't.
 	if err := x.CheckRequiredGroupChains(); err != nil {
@@ -61,6 +74,33 @@ func New(opts ...Option) (*Manager, error) {
 	return &x, nil
 }
 
+// mergeChains builds the chains that a manager is initialized with.
+// Chains in override replace the default chain of the same name or
+// define a new one, and then the hooks in extend are added to their
+// chains.  A hook is only added to a chain once.
+func mergeChains(defaults, override, extend ChainConfig) ChainConfig {
+	out := make(ChainConfig, len(defaults))
+	for chain, hooks := range defaults {
+		out[chain] = append([]string{}, hooks...)
+	}
+	for chain, hooks := range override {
+		out[chain] = append([]string{}, hooks...)
+	}
+	for chain, hooks := range extend {
+		have := make(map[string]bool)
+		for _, h := range out[chain] {
+			have[h] = true
+		}
+		for _, h := range hooks {
+			if !have[h] {
+				out[chain] = append(out[chain], h)
+				have[h] = true
+			}
+		}
+	}
+	return out
+}
+
 // SetParentLogger sets the parent logger for this instance.
 func SetParentLogger(l hclog.Logger) {
 	initlb = l.Named("tree.init")
@@ -74,3 +114,13 @@ func log() hclog.Logger {
 	}
 	return initlb
 }
+
+// Atomically runs f so that everything the chains it runs save is
+// committed together, or not at all if f returns an error.
+func (m *Manager) Atomically(ctx context.Context, f func(context.Context) error) error {
+	err := m.db.Atomically(ctx, f)
+	if err == db.ErrRevisionConflict {
+		return ErrConflict
+	}
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestSetParentLogger(t *testing.T) {
@@ -23,3 +24,27 @@ func TestLogParentUnset(t *testing.T) {
 		t.Error("auto log was not aquired")
 	}
 }
+
+func TestMergeChains(t *testing.T) {
+	defaults := ChainConfig{
+		"CREATE": {"set-entity-id", "save-entity"},
+		"FETCH":  {"load-entity"},
+	}
+	override := ChainConfig{
+		"FETCH":  {"load-entity", "check-policy"},
+		"CUSTOM": {"load-entity"},
+	}
+	extend := ChainConfig{
+		"CREATE": {"check-policy", "save-entity"},
+	}
+
+	got := mergeChains(defaults, override, extend)
+	assert.Equal(t, ChainConfig{
+		"CREATE": {"set-entity-id", "save-entity", "check-policy"},
+		"FETCH":  {"load-entity", "check-policy"},
+		"CUSTOM": {"load-entity"},
+	}, got)
+
+	// The defaults are left alone.
+	assert.Equal(t, []string{"set-entity-id", "save-entity"}, defaults["CREATE"])
+}
@@ -17,3 +17,32 @@ func WithCrypto(c crypto.EMCrypto) Option {
 func WithLogger(l hclog.Logger) Option {
 	return func(m *Manager) { m.log = l.Named("tree") }
 }
+
+// WithEntityChains defines entity chains, replacing the default chain
+// of the same name if there is one.
+func WithEntityChains(c ChainConfig) Option {
+	return func(m *Manager) { m.entityChains = c }
+}
+
+// WithEntityChainExtensions adds hooks to entity chains, after any
+// replacement from WithEntityChains.
+func WithEntityChainExtensions(c ChainConfig) Option {
+	return func(m *Manager) { m.entityChainsExt = c }
+}
+
+// WithGroupChains defines group chains, replacing the default chain
+// of the same name if there is one.
+func WithGroupChains(c ChainConfig) Option {
+	return func(m *Manager) { m.groupChains = c }
+}
+
+// WithGroupChainExtensions adds hooks to group chains, after any
+// replacement from WithGroupChains.
+func WithGroupChainExtensions(c ChainConfig) Option {
+	return func(m *Manager) { m.groupChainsExt = c }
+}
+
+// WithSecretPolicy sets the policy that new secrets must meet.
+func WithSecretPolicy(p SecretPolicy) Option {
+	return func(m *Manager) { m.secretPolicy = p }
+}
@@ -8,23 +8,23 @@ import (
 	pb "github.com/netauth/protocol"
 )
 
-// SearchGroups returns a list of groups filtered by the search
+// SearchGroups returns a page of groups filtered by the search
 // criteria.
-func (m *Manager) SearchGroups(ctx context.Context, r db.SearchRequest) ([]*pb.Group, error) {
+func (m *Manager) SearchGroups(ctx context.Context, r db.SearchRequest) ([]*pb.Group, db.SearchResult, error) {
 	return m.db.SearchGroups(ctx, r)
 }
 
-// SearchEntities returns a list of entities filtered by the search
+// SearchEntities returns a page of entities filtered by the search
 // criteria.
-func (m *Manager) SearchEntities(ctx context.Context, r db.SearchRequest) ([]*pb.Entity, error) {
-	entities, err := m.db.SearchEntities(ctx, r)
+func (m *Manager) SearchEntities(ctx context.Context, r db.SearchRequest) ([]*pb.Entity, db.SearchResult, error) {
+	entities, res, err := m.db.SearchEntities(ctx, r)
 	if err != nil {
-		return nil, err
+		return nil, db.SearchResult{}, err
 	}
 
 	out := make([]*pb.Entity, len(entities))
 	for i := range entities {
 		out[i] = safeCopyEntity(entities[i])
 	}
-	return out, nil
+	return out, res, nil
 }
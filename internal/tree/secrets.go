@@ -0,0 +1,63 @@
+package tree
+
+import (
+	"time"
+
+	"github.com/netauth/netauth/internal/tree/util"
+)
+
+// The untyped metadata of an entity records when its secret was last
+// set, in RFC 3339 format, and whether the secret must be changed
+// before the entity may authenticate again.  Only the hooks that
+// manage secrets may write these keys.
+const (
+	SecretChangedKey    = "secret-changed"
+	SecretMustChangeKey = "secret-must-change"
+)
+
+// IsSecretKey reports whether key is one of the keys above, ignoring
+// any Z-Ordering annotations.
+func IsSecretKey(key string) bool {
+	k := util.StripKVIndex(key)
+	return k == SecretChangedKey || k == SecretMustChangeKey
+}
+
+// A SecretPolicy describes the secrets that entities may have.  The
+// zero value accepts any secret.
+type SecretPolicy struct {
+	// MinLength is the number of characters that a secret must
+	// have at least.
+	MinLength int
+
+	// Each of these requires at least one character of its class.
+	// Symbols are any characters that aren't letters or digits.
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+
+	// RejectIdentity refuses secrets that are the entity's ID or
+	// GECOS, regardless of case.
+	RejectIdentity bool
+
+	// CompromisedList is the path of a file of secrets that are
+	// known to be compromised, one per line.  None of them may be
+	// used.
+	CompromisedList string
+
+	// MaxAge is how long a secret may be used for before it must
+	// be changed.  A secret with no recorded change time never
+	// expires by age.  Zero disables the limit.
+	MaxAge time.Duration
+}
+
+// A SecretPolicyError is returned when a secret is refused by the
+// SecretPolicy.  The reason is suitable to be shown to the person
+// that chose the secret.
+type SecretPolicyError struct {
+	Reason string
+}
+
+func (e *SecretPolicyError) Error() string {
+	return "secret rejected by policy: " + e.Reason
+}
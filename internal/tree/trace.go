@@ -0,0 +1,64 @@
+package tree
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A HookTrace records a single run of a hook as part of a chain.  Err
+// is the error that the hook returned, if any.
+type HookTrace struct {
+	Chain    string
+	Hook     string
+	Duration time.Duration
+	Err      error
+}
+
+// A Trace collects the hooks that run on behalf of a single request,
+// in the order that they ran.  This makes it possible to find out
+// which hook rejected a request when hooks come from many places.
+type Trace struct {
+	mu    sync.Mutex
+	hooks []HookTrace
+}
+
+type traceKey struct{}
+
+// WithTrace returns a context that records every hook that runs with
+// it in the returned Trace.
+func WithTrace(ctx context.Context) (context.Context, *Trace) {
+	t := new(Trace)
+	return context.WithValue(ctx, traceKey{}, t), t
+}
+
+// Hooks returns the hooks that have run so far.
+func (t *Trace) Hooks() []HookTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]HookTrace{}, t.hooks...)
+}
+
+// traceFrom returns the trace that ctx records into, or nil if the
+// request isn't being traced.
+func traceFrom(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
+
+// add records a hook's run.  It is safe to call on a nil trace, which
+// records nothing.
+func (t *Trace) add(chain, hook string, d time.Duration, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.hooks = append(t.hooks, HookTrace{Chain: chain, Hook: hook, Duration: d, Err: err})
+	t.mu.Unlock()
+}
+
+// A HookInfo describes a hook as it appears in a chain.
+type HookInfo struct {
+	Name     string
+	Priority int
+}
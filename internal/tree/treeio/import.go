@@ -0,0 +1,203 @@
+package treeio
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/db"
+	"github.com/netauth/netauth/internal/tree"
+
+	pb "github.com/netauth/protocol"
+)
+
+// Tree is the part of the tree.Manager that Import needs.
+type Tree interface {
+	RunEntityChain(context.Context, string, *pb.Entity) (*pb.Entity, error)
+	RunGroupChain(context.Context, string, *pb.Group) (*pb.Group, error)
+	Atomically(context.Context, func(context.Context) error) error
+}
+
+// Import creates every entity and group in the document.  Each part
+// of an object is applied with the chain that would apply it over the
+// API, so an import is rejected by the same hooks that would reject
+// the equivalent requests.  Objects that already exist are not
+// overwritten.
+//
+// Entities without a secret are given a random one so that they
+// can't be logged in to until a secret is set.  Secrets that are
+// present are assumed to be the secured form written by Export and
+// are stored as they are.
+//
+// Import stops at the first error.  Each entity is imported all at
+// once, as are the parts of each group that follow its creation, so
+// an error doesn't leave the object it stopped at half imported.
+// Objects imported before the error are left in place.
+func Import(ctx context.Context, t Tree, d *Document) error {
+	if err := createGroups(ctx, t, d.Groups); err != nil {
+		return err
+	}
+	for _, g := range d.Groups {
+		err := t.Atomically(ctx, func(ctx context.Context) error { return fillGroup(ctx, t, g) })
+		if err != nil {
+			return fmt.Errorf("group %s: %w", g.GetName(), err)
+		}
+	}
+	// Expansions are added last since they may refer to any other
+	// group.
+	for _, g := range d.Groups {
+		if len(g.GetExpansions()) == 0 {
+			continue
+		}
+		dg := &pb.Group{Name: g.Name, Expansions: g.GetExpansions()}
+		if _, err := t.RunGroupChain(ctx, "MODIFY-EXPANSIONS", dg); err != nil {
+			return fmt.Errorf("group %s: %w", g.GetName(), err)
+		}
+	}
+
+	for _, e := range d.Entities {
+		err := t.Atomically(ctx, func(ctx context.Context) error { return importEntity(ctx, t, e) })
+		if err != nil {
+			return fmt.Errorf("entity %s: %w", e.GetID(), err)
+		}
+	}
+	return nil
+}
+
+// createGroups creates the groups, retrying those whose managing
+// group hasn't been created yet until no more progress can be made.
+func createGroups(ctx context.Context, t Tree, groups []*pb.Group) error {
+	pending := groups
+	for len(pending) > 0 {
+		var retry []*pb.Group
+		var lastErr error
+		for _, g := range pending {
+			dg := &pb.Group{
+				Name:        g.Name,
+				DisplayName: g.DisplayName,
+				ManagedBy:   g.ManagedBy,
+				Number:      g.Number,
+			}
+			_, err := t.RunGroupChain(ctx, "CREATE", dg)
+			switch {
+			case err == db.ErrUnknownGroup:
+				retry = append(retry, g)
+				lastErr = fmt.Errorf("group %s: %w", g.GetName(), err)
+			case err != nil:
+				return fmt.Errorf("group %s: %w", g.GetName(), err)
+			}
+		}
+		if len(retry) == len(pending) {
+			return lastErr
+		}
+		pending = retry
+	}
+	return nil
+}
+
+func fillGroup(ctx context.Context, t Tree, g *pb.Group) error {
+	if len(g.GetCapabilities()) > 0 {
+		dg := &pb.Group{Name: g.Name, Capabilities: g.GetCapabilities()}
+		if _, err := t.RunGroupChain(ctx, "SET-CAPABILITY", dg); err != nil {
+			return err
+		}
+	}
+	if len(g.GetUntypedMeta()) > 0 {
+		dg := &pb.Group{Name: g.Name, UntypedMeta: g.GetUntypedMeta()}
+		if _, err := t.RunGroupChain(ctx, "UGM-UPSERT", dg); err != nil {
+			return err
+		}
+	}
+	for _, kv := range g.GetKV() {
+		dg := &pb.Group{Name: g.Name, KV: []*pb.KVData{kv}}
+		if _, err := t.RunGroupChain(ctx, "KV-ADD", dg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importEntity(ctx context.Context, t Tree, e *pb.Entity) error {
+	secret, err := randomSecret()
+	if err != nil {
+		return err
+	}
+	de := &pb.Entity{ID: e.ID, Number: e.Number, Secret: &secret}
+	if _, err := t.RunEntityChain(ctx, "CREATE", de); err != nil {
+		return err
+	}
+
+	// The age of the secret is only kept if the secret is, and
+	// goes in with it since it can't be set as untyped metadata.
+	var secretMeta, untypedMeta []string
+	for _, um := range e.GetMeta().GetUntypedMeta() {
+		if tree.IsSecretKey(strings.SplitN(um, ":", 2)[0]) {
+			secretMeta = append(secretMeta, um)
+		} else {
+			untypedMeta = append(untypedMeta, um)
+		}
+	}
+
+	if e.GetSecret() != "" {
+		de := &pb.Entity{ID: e.ID, Secret: e.Secret, Meta: &pb.EntityMeta{UntypedMeta: secretMeta}}
+		if _, err := t.RunEntityChain(ctx, "IMPORT-SECRET", de); err != nil {
+			return err
+		}
+	}
+
+	m := e.GetMeta()
+	if m == nil {
+		return nil
+	}
+
+	// The scalar fields are merged in one go, everything else is
+	// added with its own chain.
+	meta := proto.Clone(m).(*pb.EntityMeta)
+	meta.Groups = nil
+	meta.Capabilities = nil
+	meta.Keys = nil
+	meta.UntypedMeta = nil
+	meta.KV = nil
+	if _, err := t.RunEntityChain(ctx, "MERGE-METADATA", &pb.Entity{ID: e.ID, Meta: meta}); err != nil {
+		return err
+	}
+
+	steps := []struct {
+		chain string
+		meta  *pb.EntityMeta
+	}{
+		{"SET-CAPABILITY", &pb.EntityMeta{Capabilities: m.GetCapabilities()}},
+		{"ADD-KEY", &pb.EntityMeta{Keys: m.GetKeys()}},
+		{"UEM-UPSERT", &pb.EntityMeta{UntypedMeta: untypedMeta}},
+		{"GROUP-ADD", &pb.EntityMeta{Groups: m.GetGroups()}},
+	}
+	for _, s := range steps {
+		if proto.Equal(s.meta, &pb.EntityMeta{}) {
+			continue
+		}
+		if _, err := t.RunEntityChain(ctx, s.chain, &pb.Entity{ID: e.ID, Meta: s.meta}); err != nil {
+			return err
+		}
+	}
+	for _, kv := range m.GetKV() {
+		de := &pb.Entity{ID: e.ID, Meta: &pb.EntityMeta{KV: []*pb.KVData{kv}}}
+		if _, err := t.RunEntityChain(ctx, "KV-ADD", de); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// randomSecret returns a secret that nobody knows, for entities that
+// were exported without one.
+func randomSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,348 @@
+// Package treeio converts the whole tree to and from a human readable
+// form.  Entities and groups are written with protojson, either all
+// together in a single document or one file per object in a
+// directory, in JSON or YAML.  The directory form is meant to be kept
+// in version control and reviewed like any other change.
+//
+// Importing goes through the tree's chains rather than writing to the
+// datastore directly, so everything that is imported is checked the
+// same way as a change made over the API.
+package treeio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	atomic "github.com/google/renameio"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+
+	pb "github.com/netauth/protocol"
+)
+
+// Formats that documents can be written in.
+const (
+	JSON = "json"
+	YAML = "yaml"
+)
+
+var (
+	// ErrUnknownFormat is returned for formats other than JSON and
+	// YAML.
+	ErrUnknownFormat = errors.New("unknown format")
+
+	// ErrBadName is returned when an entity or group can't be
+	// written to a directory because its name isn't usable as a
+	// file name.
+	ErrBadName = errors.New("name cannot be used as a file name")
+)
+
+// Source is the part of the datastore that Export reads from.
+type Source interface {
+	DiscoverEntityIDs(context.Context) ([]string, error)
+	LoadEntity(context.Context, string) (*pb.Entity, error)
+	DiscoverGroupNames(context.Context) ([]string, error)
+	LoadGroup(context.Context, string) (*pb.Group, error)
+}
+
+// A Document holds every entity and group in the tree.
+type Document struct {
+	Entities []*pb.Entity
+	Groups   []*pb.Group
+}
+
+// document is the on-disk shape of a single document.
+type document struct {
+	Entities []interface{} `json:"entities" yaml:"entities"`
+	Groups   []interface{} `json:"groups" yaml:"groups"`
+}
+
+// Export reads every entity and group from src, sorted by ID and
+// name.  Entity secrets are left out unless secrets is set.
+func Export(ctx context.Context, src Source, secrets bool) (*Document, error) {
+	d := &Document{}
+
+	ids, err := src.DiscoverEntityIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		e, err := src.LoadEntity(ctx, path.Base(id))
+		if err != nil {
+			return nil, err
+		}
+		if !secrets {
+			e.Secret = nil
+		}
+		d.Entities = append(d.Entities, e)
+	}
+	sort.Slice(d.Entities, func(i, j int) bool {
+		return d.Entities[i].GetID() < d.Entities[j].GetID()
+	})
+
+	names, err := src.DiscoverGroupNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		g, err := src.LoadGroup(ctx, path.Base(name))
+		if err != nil {
+			return nil, err
+		}
+		d.Groups = append(d.Groups, g)
+	}
+	sort.Slice(d.Groups, func(i, j int) bool {
+		return d.Groups[i].GetName() < d.Groups[j].GetName()
+	})
+	return d, nil
+}
+
+// Marshal encodes the document as a single JSON or YAML document.
+func (d *Document) Marshal(format string) ([]byte, error) {
+	doc := document{Entities: []interface{}{}, Groups: []interface{}{}}
+	for _, e := range d.Entities {
+		v, err := toGeneric(e)
+		if err != nil {
+			return nil, err
+		}
+		doc.Entities = append(doc.Entities, v)
+	}
+	for _, g := range d.Groups {
+		v, err := toGeneric(g)
+		if err != nil {
+			return nil, err
+		}
+		doc.Groups = append(doc.Groups, v)
+	}
+	return encode(doc, format)
+}
+
+// Unmarshal decodes a single JSON or YAML document.
+func Unmarshal(b []byte, format string) (*Document, error) {
+	var doc document
+	if err := decode(b, format, &doc); err != nil {
+		return nil, err
+	}
+
+	d := &Document{}
+	for _, v := range doc.Entities {
+		e := &pb.Entity{}
+		if err := fromGeneric(v, e); err != nil {
+			return nil, err
+		}
+		d.Entities = append(d.Entities, e)
+	}
+	for _, v := range doc.Groups {
+		g := &pb.Group{}
+		if err := fromGeneric(v, g); err != nil {
+			return nil, err
+		}
+		d.Groups = append(d.Groups, g)
+	}
+	return d, nil
+}
+
+// WriteDir writes each entity to dir/entities/<ID>.<format> and each
+// group to dir/groups/<name>.<format>.  Files in those directories
+// for objects that are no longer in the document are removed, so
+// that the directory always matches the most recent export.
+func (d *Document) WriteDir(dir, format string) error {
+	if format != JSON && format != YAML {
+		return ErrUnknownFormat
+	}
+
+	files := make(map[string][]byte)
+	for _, e := range d.Entities {
+		b, err := marshalOne(e, format)
+		if err != nil {
+			return err
+		}
+		if !goodName(e.GetID()) {
+			return ErrBadName
+		}
+		files[filepath.Join("entities", e.GetID()+"."+format)] = b
+	}
+	for _, g := range d.Groups {
+		b, err := marshalOne(g, format)
+		if err != nil {
+			return err
+		}
+		if !goodName(g.GetName()) {
+			return ErrBadName
+		}
+		files[filepath.Join("groups", g.GetName()+"."+format)] = b
+	}
+
+	for _, sub := range []string{"entities", "groups"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return err
+		}
+		existing, err := listDir(filepath.Join(dir, sub))
+		if err != nil {
+			return err
+		}
+		for _, f := range existing {
+			if _, ok := files[filepath.Join(sub, f)]; !ok {
+				if err := os.Remove(filepath.Join(dir, sub, f)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for f, b := range files {
+		if err := atomic.WriteFile(filepath.Join(dir, f), b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadDir reads a directory written by WriteDir.  The format of each
+// file is taken from its extension, so JSON and YAML may be mixed.
+func ReadDir(dir string) (*Document, error) {
+	d := &Document{}
+
+	files, err := listDir(filepath.Join(dir, "entities"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, f := range files {
+		e := &pb.Entity{}
+		if err := readOne(filepath.Join(dir, "entities", f), e); err != nil {
+			return nil, err
+		}
+		d.Entities = append(d.Entities, e)
+	}
+
+	files, err = listDir(filepath.Join(dir, "groups"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, f := range files {
+		g := &pb.Group{}
+		if err := readOne(filepath.Join(dir, "groups", f), g); err != nil {
+			return nil, err
+		}
+		d.Groups = append(d.Groups, g)
+	}
+	return d, nil
+}
+
+// listDir returns the names of the JSON and YAML files in dir.
+func listDir(dir string) ([]string, error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, ent := range ents {
+		if ent.IsDir() {
+			continue
+		}
+		if formatOf(ent.Name()) != "" {
+			out = append(out, ent.Name())
+		}
+	}
+	return out, nil
+}
+
+func readOne(file string, m proto.Message) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	if err := decode(b, formatOf(file), &v); err != nil {
+		return err
+	}
+	return fromGeneric(v, m)
+}
+
+func marshalOne(m proto.Message, format string) ([]byte, error) {
+	v, err := toGeneric(m)
+	if err != nil {
+		return nil, err
+	}
+	return encode(v, format)
+}
+
+// formatOf returns the format a file is in based on its extension,
+// or an empty string if it isn't one that can be read.
+func formatOf(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return JSON
+	case ".yaml", ".yml":
+		return YAML
+	}
+	return ""
+}
+
+func goodName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// toGeneric converts a message to plain maps and slices.  protojson
+// deliberately varies its output, so going through a generic value
+// is what keeps exports stable enough to diff.
+func toGeneric(m proto.Message) (interface{}, error) {
+	b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func fromGeneric(v interface{}, m proto.Message) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return protojson.Unmarshal(b, m)
+}
+
+func encode(v interface{}, format string) ([]byte, error) {
+	switch format {
+	case JSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	case YAML:
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+func decode(b []byte, format string, v interface{}) error {
+	switch format {
+	case JSON:
+		return json.Unmarshal(b, v)
+	case YAML:
+		return yaml.Unmarshal(b, v)
+	}
+	return ErrUnknownFormat
+}
@@ -0,0 +1,217 @@
+package treeio
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/crypto/nocrypto"
+	"github.com/netauth/netauth/internal/db"
+	_ "github.com/netauth/netauth/internal/db/memory"
+	"github.com/netauth/netauth/internal/startup"
+	"github.com/netauth/netauth/internal/tree"
+	_ "github.com/netauth/netauth/internal/tree/hooks"
+
+	pb "github.com/netauth/protocol"
+)
+
+func newTree(t *testing.T) (*tree.Manager, *db.DB) {
+	startup.DoCallbacks()
+
+	mdb, err := db.New("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crypt, err := nocrypto.New(hclog.NewNullLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := tree.New(tree.WithStorage(mdb), tree.WithCrypto(crypt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, mdb
+}
+
+// sampleTree builds a tree that uses every part of an entity and
+// group that Import has to restore.
+func sampleTree(t *testing.T) *db.DB {
+	ctx := context.Background()
+	m, mdb := newTree(t)
+
+	assert.Nil(t, m.CreateGroup(ctx, "admins", "Administrators", "", 10))
+	assert.Nil(t, m.CreateGroup(ctx, "users", "Users", "admins", 11))
+	assert.Nil(t, m.CreateGroup(ctx, "staff", "Staff", "", 12))
+	assert.Nil(t, m.SetGroupCapability2(ctx, "admins", pb.Capability_GLOBAL_ROOT.Enum()))
+	_, err := m.ManageUntypedGroupMeta(ctx, "users", "UPSERT", "color", "blue")
+	assert.Nil(t, err)
+	assert.Nil(t, m.GroupKVAdd(ctx, "users", []*pb.KVData{{Key: proto.String("quota"), Values: []*pb.KVValue{{Value: proto.String("10G")}}}}))
+	assert.Nil(t, m.ModifyGroupExpansions(ctx, "staff", "admins", pb.ExpansionMode_INCLUDE))
+
+	assert.Nil(t, m.CreateEntity(ctx, "alice", 1000, "alice-secret"))
+	assert.Nil(t, m.UpdateEntityMeta(ctx, "alice", &pb.EntityMeta{DisplayName: proto.String("Alice"), Shell: proto.String("/bin/sh")}))
+	assert.Nil(t, m.SetEntityCapability2(ctx, "alice", pb.Capability_CREATE_ENTITY.Enum()))
+	_, err = m.UpdateEntityKeys(ctx, "alice", "ADD", "SSH", "ssh-ed25519 AAAA")
+	assert.Nil(t, err)
+	_, err = m.ManageUntypedEntityMeta(ctx, "alice", "UPSERT", "pet", "cat")
+	assert.Nil(t, err)
+	assert.Nil(t, m.EntityKVAdd(ctx, "alice", []*pb.KVData{{Key: proto.String("office"), Values: []*pb.KVValue{{Value: proto.String("B12")}}}}))
+	assert.Nil(t, m.AddEntityToGroup(ctx, "alice", "users"))
+	assert.Nil(t, m.CreateEntity(ctx, "bob", 1001, "bob-secret"))
+	assert.Nil(t, m.LockEntity(ctx, "bob"))
+	assert.Nil(t, m.ExpireSecret(ctx, "bob"))
+	return mdb
+}
+
+func TestExportSecrets(t *testing.T) {
+	mdb := sampleTree(t)
+
+	d, err := Export(context.Background(), mdb, false)
+	assert.Nil(t, err)
+	assert.Len(t, d.Entities, 2)
+	assert.Equal(t, "alice", d.Entities[0].GetID())
+	assert.Nil(t, d.Entities[0].Secret)
+	assert.Equal(t, []string{"admins", "staff", "users"}, []string{d.Groups[0].GetName(), d.Groups[1].GetName(), d.Groups[2].GetName()})
+
+	d, err = Export(context.Background(), mdb, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice-secret", d.Entities[0].GetSecret())
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	d, err := Export(ctx, sampleTree(t), true)
+	assert.Nil(t, err)
+
+	for _, format := range []string{JSON, YAML} {
+		b, err := d.Marshal(format)
+		assert.Nil(t, err)
+		again, err := d.Marshal(format)
+		assert.Nil(t, err)
+		assert.Equal(t, b, again, "output is not stable")
+
+		d2, err := Unmarshal(b, format)
+		assert.Nil(t, err)
+
+		m, mdb := newTree(t)
+		assert.Nil(t, Import(ctx, m, d2))
+
+		imported, err := Export(ctx, mdb, true)
+		assert.Nil(t, err)
+		assert.Equal(t, len(d.Entities), len(imported.Entities))
+		for i := range d.Entities {
+			assert.True(t, proto.Equal(d.Entities[i], imported.Entities[i]), "%s: %v != %v", format, d.Entities[i], imported.Entities[i])
+		}
+		for i := range d.Groups {
+			assert.True(t, proto.Equal(d.Groups[i], imported.Groups[i]), "%s: %v != %v", format, d.Groups[i], imported.Groups[i])
+		}
+	}
+}
+
+func TestImportNoSecret(t *testing.T) {
+	ctx := context.Background()
+	d, err := Export(ctx, sampleTree(t), false)
+	assert.Nil(t, err)
+
+	m, _ := newTree(t)
+	assert.Nil(t, Import(ctx, m, d))
+	assert.NotNil(t, m.ValidateSecret(ctx, "bob", ""))
+	assert.NotNil(t, m.ValidateSecret(ctx, "alice", "alice-secret"))
+}
+
+func TestImportValidation(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		d       *Document
+		wantErr error
+	}{
+		{&Document{Groups: []*pb.Group{
+			{Name: proto.String("a"), Number: proto.Int32(1), ManagedBy: proto.String("missing")},
+		}}, db.ErrUnknownGroup},
+		{&Document{Groups: []*pb.Group{
+			{Name: proto.String("a"), Number: proto.Int32(1), Expansions: []string{"INCLUDE:missing"}},
+		}}, db.ErrUnknownGroup},
+		{&Document{Groups: []*pb.Group{
+			{Name: proto.String("a"), Number: proto.Int32(1), Expansions: []string{"INCLUDE:b"}},
+			{Name: proto.String("b"), Number: proto.Int32(2), Expansions: []string{"INCLUDE:a"}},
+		}}, tree.ErrExistingExpansion},
+		{&Document{Entities: []*pb.Entity{
+			{ID: proto.String("a"), Number: proto.Int32(1)},
+			{ID: proto.String("a"), Number: proto.Int32(2)},
+		}}, tree.ErrDuplicateEntityID},
+	}
+	for i, c := range cases {
+		m, _ := newTree(t)
+		assert.ErrorIs(t, Import(ctx, m, c.d), c.wantErr, i)
+	}
+}
+
+func TestImportAtomic(t *testing.T) {
+	ctx := context.Background()
+	d := &Document{Entities: []*pb.Entity{{
+		ID:     proto.String("a"),
+		Number: proto.Int32(1),
+		Meta: &pb.EntityMeta{Shell: proto.String("/bin/sh"), KV: []*pb.KVData{
+			{Key: proto.String("office"), Values: []*pb.KVValue{{Value: proto.String("B12")}}},
+			{Key: proto.String("office"), Values: []*pb.KVValue{{Value: proto.String("C3")}}},
+		}},
+	}}}
+
+	// The second key fails after the entity has been created,
+	// which must leave no entity behind.
+	m, _ := newTree(t)
+	assert.ErrorIs(t, Import(ctx, m, d), tree.ErrKeyExists)
+	_, err := m.FetchEntity(ctx, "a")
+	assert.Equal(t, db.ErrUnknownEntity, err)
+}
+
+func TestImportManagedByOrder(t *testing.T) {
+	ctx := context.Background()
+	d := &Document{Groups: []*pb.Group{
+		{Name: proto.String("a"), Number: proto.Int32(1), ManagedBy: proto.String("b")},
+		{Name: proto.String("b"), Number: proto.Int32(2), ManagedBy: proto.String("b")},
+	}}
+
+	m, _ := newTree(t)
+	assert.Nil(t, Import(ctx, m, d))
+	g, err := m.FetchGroup(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", g.GetManagedBy())
+}
+
+func TestDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	d, err := Export(ctx, sampleTree(t), false)
+	assert.Nil(t, err)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "entities"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "entities", "stale.json"), []byte("{}"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "entities", "README"), []byte("keep"), 0644))
+
+	assert.Nil(t, d.WriteDir(dir, YAML))
+	_, err = os.Stat(filepath.Join(dir, "entities", "alice.yaml"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "groups", "staff.yaml"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "entities", "stale.json"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "entities", "README"))
+	assert.Nil(t, err)
+
+	d2, err := ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, d2.Entities, 2)
+	assert.Len(t, d2.Groups, 3)
+	assert.True(t, proto.Equal(d.Entities[0], d2.Entities[0]))
+
+	bad := &Document{Groups: []*pb.Group{{Name: proto.String("../escape")}}}
+	assert.Equal(t, ErrBadName, bad.WriteDir(dir, JSON))
+	assert.Equal(t, ErrUnknownFormat, d.WriteDir(dir, "toml"))
+}
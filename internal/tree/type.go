@@ -32,6 +32,16 @@ type Manager struct {
 	entityProcesses map[string][]EntityHook
 	groupProcesses  map[string][]GroupHook
 
+	// Chains from the configuration that replace or add to the
+	// default chains.
+	entityChains    ChainConfig
+	entityChainsExt ChainConfig
+	groupChains     ChainConfig
+	groupChainsExt  ChainConfig
+
+	// The policy that hooks apply to new secrets.
+	secretPolicy SecretPolicy
+
 	resolver *mresolver.MResolver
 
 	log hclog.Logger
@@ -44,19 +54,33 @@ type DB interface {
 	LoadEntity(context.Context, string) (*types.Entity, error)
 	SaveEntity(context.Context, *types.Entity) error
 	DeleteEntity(context.Context, string) error
+	TombstoneEntity(context.Context, string) error
+	RestoreEntity(context.Context, string) error
+	EntityHistory(context.Context, string) ([]db.EntityRevision, error)
+	SecretHistory(context.Context, string) ([]string, error)
 	NextEntityNumber(context.Context) (int32, error)
-	SearchEntities(context.Context, db.SearchRequest) ([]*types.Entity, error)
+	ClaimEntityNumber(context.Context, int32) error
+	SearchEntities(context.Context, db.SearchRequest) ([]*types.Entity, db.SearchResult, error)
 
 	// Group handling
 	DiscoverGroupNames(context.Context) ([]string, error)
 	LoadGroup(context.Context, string) (*types.Group, error)
 	SaveGroup(context.Context, *types.Group) error
 	DeleteGroup(context.Context, string) error
+	TombstoneGroup(context.Context, string) error
+	RestoreGroup(context.Context, string) error
+	GroupHistory(context.Context, string) ([]db.GroupRevision, error)
 	NextGroupNumber(context.Context) (int32, error)
-	SearchGroups(context.Context, db.SearchRequest) ([]*types.Group, error)
+	ClaimGroupNumber(context.Context, int32) error
+	SearchGroups(context.Context, db.SearchRequest) ([]*types.Group, db.SearchResult, error)
+
+	// Batches of changes across multiple objects
+	Batch(context.Context, func(*db.Batch) error) error
+	Atomically(context.Context, func(context.Context) error) error
 
 	// Callbacks
 	RegisterCallback(string, db.Callback)
+	Subscribe(string, db.Callback)
 }
 
 // The ChainConfig type maps from chain name to a list of hooks that
@@ -43,6 +43,12 @@ func PatchStringSlice(in []string, patch string, insert bool, matchExact bool) [
 	return DedupStringSlice(retSlice)
 }
 
+// StripKVIndex returns key without the OpenLDAP-style Z-Ordering
+// annotations that fuzzy matching ignores.
+func StripKVIndex(key string) string {
+	return kvIndexRegexp.ReplaceAllString(key, "")
+}
+
 // PatchKeyValueSlice patches slices that use key/value pairs.  Its
 // designed with more advanced functionality around exact key
 // matching, fuzzy and exact clearing, and OpenLDAP-style Z-Ordering.
@@ -3,6 +3,9 @@ package netauth
 import (
 	"context"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	pb "github.com/netauth/protocol"
 	rpc "github.com/netauth/protocol/v2"
 )
@@ -50,10 +53,18 @@ func (c *Client) AuthValidateToken(ctx context.Context, token string) error {
 	return err
 }
 
+// IsSecretExpired reports whether err was returned because the secret
+// that was presented is correct, but has expired.  The entity must
+// change its secret with AuthChangeSecret before it can authenticate.
+func IsSecretExpired(err error) bool {
+	return status.Code(err) == codes.FailedPrecondition
+}
+
 // AuthChangeSecret changes the secret for a given entity.  If the
 // entity is changing its own secret, then the original secret must be
 // supplied.  If an administrator is changing the secret, an
-// appropriate token must be present.
+// appropriate token must be present.  An entity whose secret has
+// expired changes it with the expired secret, and without a token.
 func (c *Client) AuthChangeSecret(ctx context.Context, entity, secret, oldsecret string) error {
 	if err := c.makeWritable(); err != nil {
 		return err
@@ -0,0 +1,132 @@
+package netauth
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Diff compares two revisions of an entity or group field by field
+// and returns the fields that differ, sorted by their path.  Nested
+// messages such as an entity's meta are compared field by field, and
+// repeated fields such as meta.Groups by the values they hold, so
+// that a membership that was removed shows up as a single removed
+// value.  Either revision may be nil, which compares against an empty
+// object.
+func Diff(before, after proto.Message) []FieldChange {
+	b := make(map[string][]string)
+	a := make(map[string][]string)
+	if before != nil {
+		flatten(b, "", before.ProtoReflect())
+	}
+	if after != nil {
+		flatten(a, "", after.ProtoReflect())
+	}
+
+	fields := make(map[string]struct{})
+	for f := range b {
+		fields[f] = struct{}{}
+	}
+	for f := range a {
+		fields[f] = struct{}{}
+	}
+
+	var out []FieldChange
+	for f := range fields {
+		c := FieldChange{
+			Field:   f,
+			Removed: subtract(b[f], a[f]),
+			Added:   subtract(a[f], b[f]),
+		}
+		if len(c.Removed) > 0 || len(c.Added) > 0 {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Field < out[j].Field })
+	return out
+}
+
+// flatten records the value of every populated field of m, with
+// nested messages flattened into paths below the field that holds
+// them.
+func flatten(out map[string][]string, prefix string, m protoreflect.Message) {
+	if !m.IsValid() {
+		return
+	}
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if !m.Has(fd) {
+			continue
+		}
+		name := prefix + string(fd.Name())
+		v := m.Get(fd)
+		switch {
+		case fd.IsList():
+			l := v.List()
+			for j := 0; j < l.Len(); j++ {
+				out[name] = append(out[name], formatValue(fd, l.Get(j)))
+			}
+		case fd.Message() != nil && !fd.IsMap():
+			flatten(out, name+".", v.Message())
+		default:
+			out[name] = append(out[name], formatValue(fd, v))
+		}
+	}
+}
+
+// formatValue renders a single value of the field fd.  Messages that
+// appear in lists, such as KV data, are rendered whole on one line.
+func formatValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch {
+	case fd.Enum() != nil:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return fmt.Sprint(v.Enum())
+	case fd.Message() != nil && !fd.IsMap():
+		m := v.Message()
+		var parts []string
+		fields := m.Descriptor().Fields()
+		for i := 0; i < fields.Len(); i++ {
+			f := fields.Get(i)
+			if !m.Has(f) {
+				continue
+			}
+			if f.IsList() {
+				l := m.Get(f).List()
+				var vals []string
+				for j := 0; j < l.Len(); j++ {
+					vals = append(vals, formatValue(f, l.Get(j)))
+				}
+				parts = append(parts, fmt.Sprintf("%s:[%s]", f.Name(), strings.Join(vals, ", ")))
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("%s:%s", f.Name(), formatValue(f, m.Get(f))))
+		}
+		return "{" + strings.Join(parts, " ") + "}"
+	default:
+		return v.String()
+	}
+}
+
+// subtract returns the values in a that aren't matched by a value in
+// b, keeping their order.
+func subtract(a, b []string) []string {
+	have := make(map[string]int)
+	for _, v := range b {
+		have[v]++
+	}
+	var out []string
+	for _, v := range a {
+		if have[v] > 0 {
+			have[v]--
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
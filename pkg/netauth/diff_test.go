@@ -0,0 +1,51 @@
+package netauth
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/netauth/protocol"
+)
+
+func TestDiff(t *testing.T) {
+	before := &pb.Entity{
+		ID:     proto.String("foo"),
+		Number: proto.Int32(1),
+		Meta: &pb.EntityMeta{
+			Shell:        proto.String("/bin/sh"),
+			Groups:       []string{"users", "sudoers"},
+			Capabilities: []pb.Capability{pb.Capability_CREATE_ENTITY},
+		},
+	}
+	after := &pb.Entity{
+		ID:     proto.String("foo"),
+		Number: proto.Int32(1),
+		Meta: &pb.EntityMeta{
+			Shell:  proto.String("/bin/zsh"),
+			Groups: []string{"users"},
+			KV: []*pb.KVData{{
+				Key:    proto.String("office"),
+				Values: []*pb.KVValue{{Value: proto.String("B2")}},
+			}},
+		},
+	}
+
+	want := []FieldChange{
+		{Field: "meta.Capabilities", Removed: []string{"CREATE_ENTITY"}},
+		{Field: "meta.Groups", Removed: []string{"sudoers"}},
+		{Field: "meta.KV", Added: []string{"{Key:office Values:[{Value:B2}]}"}},
+		{Field: "meta.Shell", Removed: []string{"/bin/sh"}, Added: []string{"/bin/zsh"}},
+	}
+	if got := Diff(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v; Want %v", got, want)
+	}
+
+	if got := Diff(nil, &pb.Group{Name: proto.String("bar")}); !reflect.DeepEqual(got, []FieldChange{{Field: "Name", Added: []string{"bar"}}}) {
+		t.Errorf("Diff against nil: %v", got)
+	}
+	if got := Diff(before, before); len(got) != 0 {
+		t.Errorf("Identical revisions differ: %v", got)
+	}
+}
@@ -5,9 +5,14 @@ import (
 	"errors"
 	"sort"
 	"strings"
+	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/netauth/netauth/internal/rpc2/adminpb"
+
 	pb "github.com/netauth/protocol"
 	rpc "github.com/netauth/protocol/v2"
 )
@@ -73,13 +78,23 @@ func (c *Client) EntityInfo(ctx context.Context, id string) (pb.Entity, error) {
 // return a slice of zero or more entities that matched the search
 // criteria.  Searching does not require an authenticated context.
 func (c *Client) EntitySearch(ctx context.Context, expr string) ([]*pb.Entity, error) {
+	res, _, err := c.EntitySearchPage(ctx, expr, SearchOptions{})
+	return res, err
+}
+
+// EntitySearchPage performs a search of all entities and returns one
+// page of the results, sorted as requested.  The returned SearchPage
+// holds the total number of matches and the token for the next page.
+func (c *Client) EntitySearchPage(ctx context.Context, expr string, opts SearchOptions) ([]*pb.Entity, SearchPage, error) {
 	ctx = c.appendMetadata(ctx)
+	ctx = opts.appendMetadata(ctx)
 	r := rpc.SearchRequest{
 		Expression: &expr,
 	}
 
-	res, err := c.rpc.EntitySearch(ctx, &r)
-	return res.GetEntities(), err
+	var hdr metadata.MD
+	res, err := c.rpc.EntitySearch(ctx, &r, grpc.Header(&hdr))
+	return res.GetEntities(), parseSearchPage(hdr), err
 }
 
 // EntityUM handles operations concerning the untyped key-value store
@@ -272,8 +287,10 @@ func (c *Client) EntityKeys(ctx context.Context, id, action, ktype, key string)
 	return nil, nil
 }
 
-// EntityDestroy is used to permanently remove entities from the
-// server.  This is not recommended and should not be done without
+// EntityDestroy is used to remove entities from the server.  A
+// destroyed entity is kept by the server until it is purged, and can
+// be brought back with EntityRestore until then.  This is not
+// recommended and should not be done without
 // good reason.  The best practice is to instead have a group that
 // defunct entities get moved to and then locked.  This will prevent
 // authentication, while maintaining integrity of the backing tree.
@@ -296,6 +313,92 @@ func (c *Client) EntityDestroy(ctx context.Context, id string) error {
 	return err
 }
 
+// EntityRestore brings back an entity that was destroyed, along with
+// its group memberships.  This fails if the entity has already been
+// purged, or if its ID or number has been given to another entity
+// since it was destroyed.
+func (c *Client) EntityRestore(ctx context.Context, id string) error {
+	if err := c.makeWritable(); err != nil {
+		return err
+	}
+
+	ctx = c.appendMetadata(ctx)
+	r := rpc.EntityRequest{
+		Entity: &pb.Entity{
+			ID: &id,
+		},
+	}
+
+	_, err := c.admin.EntityRestore(ctx, &r)
+	return err
+}
+
+// EntityHistory returns the revisions of an entity that the server
+// still keeps, oldest first.  Use Diff to see what changed from one
+// revision to the next.
+func (c *Client) EntityHistory(ctx context.Context, id string) ([]EntityRevision, error) {
+	ctx = c.appendMetadata(ctx)
+	r := rpc.EntityRequest{
+		Entity: &pb.Entity{
+			ID: &id,
+		},
+	}
+
+	res, err := c.admin.EntityHistory(ctx, &r)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]EntityRevision, len(res.GetRevisions()))
+	for i, rev := range res.GetRevisions() {
+		out[i] = EntityRevision{
+			Revision: Revision{
+				Rev:   int(rev.GetRev()),
+				Time:  time.Unix(rev.GetTime(), 0),
+				Actor: rev.GetActor(),
+			},
+			Entity: rev.GetEntity(),
+		}
+	}
+	return out, nil
+}
+
+// EntityExpireSecret marks the secret of an entity as needing to be
+// changed.  Until it is changed, authenticating with it fails with an
+// error for which IsSecretExpired is true.
+func (c *Client) EntityExpireSecret(ctx context.Context, id string) error {
+	if err := c.makeWritable(); err != nil {
+		return err
+	}
+
+	ctx = c.appendMetadata(ctx)
+	r := rpc.EntityRequest{
+		Entity: &pb.Entity{
+			ID: &id,
+		},
+	}
+
+	_, err := c.admin.EntityExpireSecret(ctx, &r)
+	return err
+}
+
+// EntityRollback returns an entity to the way it was at an earlier
+// revision.  The entity keeps its current secret, and the rollback
+// shows up in its history as a new revision.
+func (c *Client) EntityRollback(ctx context.Context, id string, rev int) error {
+	if err := c.makeWritable(); err != nil {
+		return err
+	}
+
+	ctx = c.appendMetadata(ctx)
+	r := adminpb.RollbackRequest{
+		Target: &id,
+		Rev:    proto.Int32(int32(rev)),
+	}
+
+	_, err := c.admin.EntityRollback(ctx, &r)
+	return err
+}
+
 // EntityLock sets the lock bit on the provided entity which will
 // effectively prevent authentication from proceeding even if correct
 // authentication information is provided.
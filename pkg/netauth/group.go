@@ -6,9 +6,14 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/netauth/netauth/internal/rpc2/adminpb"
+
 	pb "github.com/netauth/protocol"
 	rpc "github.com/netauth/protocol/v2"
 )
@@ -301,8 +306,9 @@ func (c *Client) GroupDelMember(ctx context.Context, group, entity string) error
 	return err
 }
 
-// GroupDestroy permanently removes a group from the server.  This is
-// not recommended as NetAuth does not perform internal referential
+// GroupDestroy removes a group from the server.  A destroyed group is
+// kept by the server until it is purged, and can be brought back with
+// GroupRestore until then.  This is not recommended as NetAuth does not perform internal referential
 // integrity checks, so it is possible to remove a group that has
 // rules pointing at it or otherwise create cycles in the graph.  The
 // best practices are to keep groups forever.  They're cheap and as
@@ -322,6 +328,72 @@ func (c *Client) GroupDestroy(ctx context.Context, name string) error {
 	return err
 }
 
+// GroupRestore brings back a group that was destroyed.  Entities that
+// were members of the group when it was destroyed are members again.
+// This fails if the group has already been purged, or if its name or
+// number has been given to another group since it was destroyed.
+func (c *Client) GroupRestore(ctx context.Context, name string) error {
+	if err := c.makeWritable(); err != nil {
+		return err
+	}
+
+	ctx = c.appendMetadata(ctx)
+	r := rpc.GroupRequest{
+		Group: &pb.Group{
+			Name: &name,
+		},
+	}
+	_, err := c.admin.GroupRestore(ctx, &r)
+	return err
+}
+
+// GroupHistory returns the revisions of a group that the server still
+// keeps, oldest first.  Use Diff to see what changed from one
+// revision to the next.
+func (c *Client) GroupHistory(ctx context.Context, name string) ([]GroupRevision, error) {
+	ctx = c.appendMetadata(ctx)
+	r := rpc.GroupRequest{
+		Group: &pb.Group{
+			Name: &name,
+		},
+	}
+
+	res, err := c.admin.GroupHistory(ctx, &r)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]GroupRevision, len(res.GetRevisions()))
+	for i, rev := range res.GetRevisions() {
+		out[i] = GroupRevision{
+			Revision: Revision{
+				Rev:   int(rev.GetRev()),
+				Time:  time.Unix(rev.GetTime(), 0),
+				Actor: rev.GetActor(),
+			},
+			Group: rev.GetGroup(),
+		}
+	}
+	return out, nil
+}
+
+// GroupRollback returns a group to the way it was at an earlier
+// revision.  Expansions that the earlier revision has must still be
+// valid, and the rollback shows up in the group's history as a new
+// revision.
+func (c *Client) GroupRollback(ctx context.Context, name string, rev int) error {
+	if err := c.makeWritable(); err != nil {
+		return err
+	}
+
+	ctx = c.appendMetadata(ctx)
+	r := adminpb.RollbackRequest{
+		Target: &name,
+		Rev:    proto.Int32(int32(rev)),
+	}
+	_, err := c.admin.GroupRollback(ctx, &r)
+	return err
+}
+
 // GroupMembers returns the membership of a group including any member
 // alterations as a result of rules on the group.
 func (c *Client) GroupMembers(ctx context.Context, name string) ([]*pb.Entity, error) {
@@ -338,14 +410,24 @@ func (c *Client) GroupMembers(ctx context.Context, name string) ([]*pb.Entity, e
 // GroupSearch returns a list of groups that satisfy the given search
 // expression.  This function requires no authorization.
 func (c *Client) GroupSearch(ctx context.Context, expression string) ([]*pb.Group, error) {
+	res, _, err := c.GroupSearchPage(ctx, expression, SearchOptions{})
+	return res, err
+}
+
+// GroupSearchPage returns one page of the groups that satisfy the
+// given search expression, sorted as requested.  The returned
+// SearchPage holds the total number of matches and the token for the
+// next page.
+func (c *Client) GroupSearchPage(ctx context.Context, expression string, opts SearchOptions) ([]*pb.Group, SearchPage, error) {
 	ctx = c.appendMetadata(ctx)
+	ctx = opts.appendMetadata(ctx)
 	r := rpc.SearchRequest{
 		Expression: &expression,
 	}
-	res, err := c.rpc.GroupSearch(ctx, &r)
+	var hdr metadata.MD
+	res, err := c.rpc.GroupSearch(ctx, &r, grpc.Header(&hdr))
 	if err != nil {
-		return nil, err
-
+		return nil, SearchPage{}, err
 	}
-	return res.GetGroups(), err
+	return res.GetGroups(), parseSearchPage(hdr), nil
 }
@@ -1,9 +1,11 @@
 package netauth
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/viper"
 
@@ -11,9 +13,15 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
+	"github.com/netauth/netauth/internal/rpc2/adminpb"
+
 	rpc "github.com/netauth/protocol/v2"
 )
 
+// leaderTimeout is how long the client waits to be told which server
+// accepts writes.
+const leaderTimeout = 5 * time.Second
+
 func init() {
 	viper.SetDefault("core.port", 1729)
 	viper.SetDefault("tls.certificate", "keys/tls.pem")
@@ -56,8 +64,10 @@ func NewWithLog(l hclog.Logger) (*Client, error) {
 
 	return &Client{
 		rpc:        rpc.NewNetAuth2Client(conn),
+		admin:      adminpb.NewAdminClient(conn),
 		log:        l,
 		clientName: viper.GetString("client.ID"),
+		realm:      viper.GetString("core.realm"),
 	}, nil
 }
 
@@ -79,6 +89,11 @@ func connect(writable bool) (*grpc.ClientConn, error) {
 		addr = viper.GetString("core.master")
 	}
 
+	return dial(fmt.Sprintf("%s:%d", addr, viper.GetInt("core.port")))
+}
+
+// dial connects to the server at target, which includes the port.
+func dial(target string) (*grpc.ClientConn, error) {
 	var opts []grpc.DialOption
 	if viper.GetBool("tls.pwn_me") {
 		opts = []grpc.DialOption{grpc.WithInsecure()}
@@ -96,10 +111,8 @@ func connect(writable bool) (*grpc.ClientConn, error) {
 		}
 		opts = []grpc.DialOption{grpc.WithTransportCredentials(creds)}
 	}
-	return grpc.Dial(
-		fmt.Sprintf("%s:%d", addr, viper.GetInt("core.port")),
-		opts...,
-	)
+	opts = append(opts, grpc.WithChainUnaryInterceptor(traceInterceptor, dryRunInterceptor))
+	return grpc.Dial(target, opts...)
 }
 
 // SetServiceName sets the self identified service this client serves.
@@ -108,11 +121,59 @@ func (c *Client) SetServiceName(s string) {
 	c.serviceName = s
 }
 
+// SetRealm selects the realm that requests are made in.  The default
+// realm is used if no realm is set, and otherwise core.realm from the
+// config is used.  Tokens are only valid in the realm that issued
+// them.
+func (c *Client) SetRealm(r string) {
+	c.realm = r
+}
+
+// SetTrace asks the server to trace the hooks that it runs for each
+// request, and calls f with the trace once the request is done.  This
+// shows which hook rejected a request.  The server only returns the
+// trace to a request that carries a token with GLOBAL_ROOT, and logs
+// it otherwise.  Tracing is turned off again by passing nil.
+func (c *Client) SetTrace(f TraceFunc) {
+	c.trace = f
+}
+
+// SetDryRun makes every change that the client requests a dry run.
+// The server checks the change as it normally would but doesn't save
+// it, and f is called with what would have been saved.  Changes that
+// would run hooks from plugins can't be dry run and fail instead.
+// Dry runs are turned off again by passing nil.
+func (c *Client) SetDryRun(f DryRunFunc) {
+	c.dryRun = f
+}
+
+// makeWritable switches the client over to a server that accepts
+// writes.  Servers that share a clustered store know which of them
+// that is at the moment, so the server is asked first.  Otherwise the
+// server at core.master is used.
 func (c *Client) makeWritable() error {
+	if c.writeable {
+		return nil
+	}
+
+	leader, clustered := c.leader()
+	if clustered {
+		if leader == "" {
+			// Without a leader no server can accept the
+			// write, and the server will say as much.
+			return nil
+		}
+		conn, err := dial(leader)
+		if err != nil {
+			return err
+		}
+		c.useConn(conn)
+		return nil
+	}
+
 	// If the master server is the one that we would already be
-	// connected to, then just return.  Also return if we are
-	// already not readonly.
-	if viper.GetString("core.server") == viper.GetString("core.master") || c.writeable {
+	// connected to, then just return.
+	if viper.GetString("core.server") == viper.GetString("core.master") {
 		return nil
 	}
 
@@ -120,7 +181,28 @@ func (c *Client) makeWritable() error {
 	if err != nil {
 		return err
 	}
+	c.useConn(conn)
+	return nil
+}
+
+// leader asks the server which server currently accepts writes.
+// Servers that don't know about clusters are treated as not being
+// part of one.
+func (c *Client) leader() (string, bool) {
+	ctx, cancel := context.WithTimeout(c.appendMetadata(context.Background()), leaderTimeout)
+	defer cancel()
+	res, err := c.admin.Leader(ctx, &rpc.Empty{})
+	if err != nil {
+		c.log.Debug("Unable to ask for the cluster leader", "error", err)
+		return "", false
+	}
+	return res.GetAddress(), res.GetClustered()
+}
+
+// useConn sends all further requests over a connection to a server
+// that accepts writes.
+func (c *Client) useConn(conn *grpc.ClientConn) {
 	c.rpc = rpc.NewNetAuth2Client(conn)
+	c.admin = adminpb.NewAdminClient(conn)
 	c.writeable = true
-	return nil
 }
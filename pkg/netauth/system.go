@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/netauth/netauth/internal/rpc2/adminpb"
+
 	pb "github.com/netauth/protocol"
 	rpc "github.com/netauth/protocol/v2"
 )
@@ -57,3 +59,27 @@ func (c *Client) SystemStatus(ctx context.Context) (*rpc.ServerStatus, error) {
 	ctx = c.appendMetadata(ctx)
 	return c.rpc.SystemStatus(ctx, &rpc.Empty{})
 }
+
+// SystemChains returns the entity and group chains of the server,
+// sorted by name, along with the hooks in each in the order that they
+// run.  Hooks that plugins provide are included.  This requires a
+// token with GLOBAL_ROOT.
+func (c *Client) SystemChains(ctx context.Context) ([]Chain, []Chain, error) {
+	ctx = c.appendMetadata(ctx)
+	res, err := c.admin.Chains(ctx, &rpc.Empty{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return chainsFromProto(res.GetEntity()), chainsFromProto(res.GetGroup()), nil
+}
+
+func chainsFromProto(in []*adminpb.Chain) []Chain {
+	out := make([]Chain, len(in))
+	for i, c := range in {
+		out[i].Name = c.GetName()
+		for _, h := range c.GetHooks() {
+			out[i].Hooks = append(out[i].Hooks, Hook{Name: h.GetName(), Priority: int(h.GetPriority())})
+		}
+	}
+	return out
+}
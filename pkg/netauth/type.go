@@ -1,8 +1,13 @@
 package netauth
 
 import (
+	"time"
+
 	"github.com/hashicorp/go-hclog"
 
+	"github.com/netauth/netauth/internal/rpc2/adminpb"
+
+	pb "github.com/netauth/protocol"
 	rpc "github.com/netauth/protocol/v2"
 )
 
@@ -11,11 +16,97 @@ import (
 // parameters to the request, for crafting protobufs, and for handling
 // other common tasks.
 type Client struct {
-	rpc rpc.NetAuth2Client
-	log hclog.Logger
+	rpc   rpc.NetAuth2Client
+	admin adminpb.AdminClient
+	log   hclog.Logger
 
 	clientName  string
 	serviceName string
+	realm       string
+	trace       TraceFunc
+	dryRun      DryRunFunc
 
 	writeable bool
 }
+
+// SearchOptions page and sort the results of a search.  The zero
+// value returns every result at once.
+type SearchOptions struct {
+	// PageSize is the most results to return, or 0 for all of
+	// them.
+	PageSize int
+
+	// PageToken continues a search from the NextPageToken of an
+	// earlier page.
+	PageToken string
+
+	// Sort lists the fields to order results by, each prefixed
+	// with '-' to reverse the order.
+	Sort []string
+}
+
+// SearchPage describes where a page of results sits in the full set
+// of results.
+type SearchPage struct {
+	// Total is the number of matches across all pages.
+	Total uint64
+
+	// NextPageToken fetches the next page, and is empty on the
+	// last one.
+	NextPageToken string
+}
+
+// A Revision identifies one change in the history of an entity or
+// group.  Actor is the ID of the entity that made the change, if the
+// server knows it.
+type Revision struct {
+	Rev   int
+	Time  time.Time
+	Actor string
+}
+
+// An EntityRevision is an entity as it was saved by one change.  The
+// server never returns an entity's secret as part of its history.
+type EntityRevision struct {
+	Revision
+	Entity *pb.Entity
+}
+
+// A GroupRevision is a group as it was saved by one change.
+type GroupRevision struct {
+	Revision
+	Group *pb.Group
+}
+
+// A FieldChange lists the values that a single field lost and gained
+// between two revisions.  Field is the path to the field, such as
+// meta.Groups.  Fields that hold a single value lose at most one
+// value and gain at most one.
+type FieldChange struct {
+	Field   string
+	Removed []string
+	Added   []string
+}
+
+// A Chain is one of the server's chains of hooks, with the hooks in
+// the order that they run.
+type Chain struct {
+	Name  string
+	Hooks []Hook
+}
+
+// A Hook is a hook as it appears in a chain.  Hooks run in order of
+// increasing priority.
+type Hook struct {
+	Name     string
+	Priority int
+}
+
+// A TraceFunc receives the hooks that the server ran on behalf of a
+// request, one per line with the chain and hook names, how long the
+// hook took and the error that it returned, if any.
+type TraceFunc func(method string, hooks []string)
+
+// A DryRunFunc receives the entities and groups that a request would
+// have saved, had it not been a dry run.  Secrets are never included.
+type DryRunFunc func(method string, entities []*pb.Entity, groups []*pb.Group)
@@ -2,18 +2,27 @@ package netauth
 
 import (
 	"context"
+	"path"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/netauth/protocol"
 )
 
 var (
 	kvIndexRegexp = regexp.MustCompile(`{(\d+)}$`)
 )
 
+type traceKey struct{}
+
+type dryRunKey struct{}
+
 // Authorize attaches a token to a provided context, returning a new
 // context that is authorized to make calls with the provided token.
 func Authorize(ctx context.Context, token string) context.Context {
@@ -64,8 +73,91 @@ func parseKV(in []string) map[string][]string {
 }
 
 func (c *Client) appendMetadata(ctx context.Context) context.Context {
-	return metadata.AppendToOutgoingContext(ctx,
+	kv := []string{
 		"client-name", c.clientName,
 		"service-name", c.serviceName,
-	)
+	}
+	if c.realm != "" {
+		kv = append(kv, "realm", c.realm)
+	}
+	if c.trace != nil {
+		kv = append(kv, "trace", "true")
+		ctx = context.WithValue(ctx, traceKey{}, c.trace)
+	}
+	if c.dryRun != nil {
+		kv = append(kv, "dry-run", "true")
+		ctx = context.WithValue(ctx, dryRunKey{}, c.dryRun)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// traceInterceptor hands the trace that the server returns in the
+// trailer of a traced request to the TraceFunc that asked for it.
+func traceInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	f, ok := ctx.Value(traceKey{}).(TraceFunc)
+	if !ok {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	var md metadata.MD
+	err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Trailer(&md))...)
+	f(path.Base(method), md.Get("trace"))
+	return err
+}
+
+// dryRunInterceptor hands the entities and groups that the server
+// returns in the trailer of a dry run to the DryRunFunc that asked
+// for them.
+func dryRunInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	f, ok := ctx.Value(dryRunKey{}).(DryRunFunc)
+	if !ok {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	var md metadata.MD
+	err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Trailer(&md))...)
+
+	var entities []*pb.Entity
+	for _, b := range md.Get("dry-run-entity-bin") {
+		e := new(pb.Entity)
+		if proto.Unmarshal([]byte(b), e) == nil {
+			entities = append(entities, e)
+		}
+	}
+	var groups []*pb.Group
+	for _, b := range md.Get("dry-run-group-bin") {
+		g := new(pb.Group)
+		if proto.Unmarshal([]byte(b), g) == nil {
+			groups = append(groups, g)
+		}
+	}
+	f(path.Base(method), entities, groups)
+	return err
+}
+
+// appendMetadata attaches the paging and sorting options to a
+// search request.
+func (o SearchOptions) appendMetadata(ctx context.Context) context.Context {
+	kv := []string{}
+	if o.PageSize > 0 {
+		kv = append(kv, "page-size", strconv.Itoa(o.PageSize))
+	}
+	if o.PageToken != "" {
+		kv = append(kv, "page-token", o.PageToken)
+	}
+	for _, f := range o.Sort {
+		kv = append(kv, "sort", f)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// parseSearchPage reads the page information from the header of a
+// search response.  Servers that don't page searches leave it empty.
+func parseSearchPage(md metadata.MD) SearchPage {
+	p := SearchPage{}
+	if v := md.Get("total"); len(v) == 1 {
+		p.Total, _ = strconv.ParseUint(v[0], 10, 64)
+	}
+	if v := md.Get("next-page-token"); len(v) == 1 {
+		p.NextPageToken = v[0]
+	}
+	return p
 }
@@ -4,7 +4,18 @@ import (
 	"context"
 	"testing"
 
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/netauth/netauth/internal/rpc2/adminpb"
+
+	pb "github.com/netauth/protocol"
+	rpc "github.com/netauth/protocol/v2"
 )
 
 func TestAuthorize(t *testing.T) {
@@ -40,3 +51,164 @@ func TestParseKV(t *testing.T) {
 		t.Errorf("k does not contain the correct sorted value!: %v", res["k"])
 	}
 }
+
+func TestSearchOptionsMetadata(t *testing.T) {
+	opts := SearchOptions{PageSize: 10, PageToken: "20", Sort: []string{"-Number", "ID"}}
+	md, _ := metadata.FromOutgoingContext(opts.appendMetadata(context.Background()))
+	if md.Get("page-size")[0] != "10" || md.Get("page-token")[0] != "20" {
+		t.Errorf("Paging was not attached: %v", md)
+	}
+	if s := md.Get("sort"); len(s) != 2 || s[0] != "-Number" || s[1] != "ID" {
+		t.Errorf("Sort was not attached in order: %v", s)
+	}
+
+	md, _ = metadata.FromOutgoingContext(SearchOptions{}.appendMetadata(context.Background()))
+	if len(md) != 0 {
+		t.Errorf("Empty options attached metadata: %v", md)
+	}
+}
+
+func TestClientMetadata(t *testing.T) {
+	c := &Client{clientName: "client", serviceName: "service"}
+	md, _ := metadata.FromOutgoingContext(c.appendMetadata(context.Background()))
+	if md.Get("client-name")[0] != "client" || md.Get("service-name")[0] != "service" {
+		t.Errorf("Names were not attached: %v", md)
+	}
+	if r := md.Get("realm"); len(r) != 0 {
+		t.Errorf("Default realm was attached: %v", r)
+	}
+
+	c.SetRealm("lab")
+	md, _ = metadata.FromOutgoingContext(c.appendMetadata(context.Background()))
+	if r := md.Get("realm"); len(r) != 1 || r[0] != "lab" {
+		t.Errorf("Realm was not attached: %v", r)
+	}
+}
+
+func TestParseSearchPage(t *testing.T) {
+	p := parseSearchPage(metadata.Pairs("total", "42", "next-page-token", "10"))
+	if p.Total != 42 || p.NextPageToken != "10" {
+		t.Errorf("Bad page: %v", p)
+	}
+	if p := parseSearchPage(nil); p != (SearchPage{}) {
+		t.Errorf("Page from empty header: %v", p)
+	}
+}
+
+type leaderAdmin struct {
+	adminpb.AdminClient
+	res *adminpb.LeaderResult
+	err error
+}
+
+func (a *leaderAdmin) Leader(context.Context, *rpc.Empty, ...grpc.CallOption) (*adminpb.LeaderResult, error) {
+	return a.res, a.err
+}
+
+func TestMakeWritable(t *testing.T) {
+	viper.Set("tls.pwn_me", true)
+	defer viper.Set("tls.pwn_me", nil)
+	viper.Set("core.server", "netauth1")
+	viper.Set("core.master", "netauth1")
+	defer viper.Set("core.server", nil)
+	defer viper.Set("core.master", nil)
+
+	cases := []struct {
+		admin     *leaderAdmin
+		writeable bool
+	}{
+		// Not clustered, and core.server is the master.
+		{&leaderAdmin{err: status.Error(codes.Unimplemented, "")}, false},
+		{&leaderAdmin{res: &adminpb.LeaderResult{Clustered: proto.Bool(false)}}, false},
+		// Clustered, but there's no leader to write to.
+		{&leaderAdmin{res: &adminpb.LeaderResult{Clustered: proto.Bool(true)}}, false},
+		// Clustered, and the leader is known.
+		{&leaderAdmin{res: &adminpb.LeaderResult{Clustered: proto.Bool(true), Address: proto.String("netauth2:1729")}}, true},
+	}
+	for i, tc := range cases {
+		c := &Client{admin: tc.admin, log: hclog.NewNullLogger()}
+		if err := c.makeWritable(); err != nil {
+			t.Errorf("%d: %v", i, err)
+		}
+		if c.writeable != tc.writeable {
+			t.Errorf("%d: writeable is %v", i, c.writeable)
+		}
+	}
+}
+
+func TestTraceInterceptor(t *testing.T) {
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		for _, o := range opts {
+			if tr, ok := o.(grpc.TrailerCallOption); ok && len(md.Get("trace")) == 1 {
+				*tr.TrailerAddr = metadata.Pairs("trace", "FETCH load-entity 1ms")
+			}
+		}
+		return nil
+	}
+
+	var gotMethod string
+	var gotHooks []string
+	c := &Client{}
+	c.SetTrace(func(method string, hooks []string) {
+		gotMethod = method
+		gotHooks = hooks
+	})
+
+	if err := traceInterceptor(c.appendMetadata(context.Background()), "/netauth.v2.NetAuth2/EntityInfo", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if gotMethod != "EntityInfo" || len(gotHooks) != 1 || gotHooks[0] != "FETCH load-entity 1ms" {
+		t.Errorf("Bad trace: %s %v", gotMethod, gotHooks)
+	}
+
+	// Without a TraceFunc nothing is traced.
+	gotMethod = ""
+	c.SetTrace(nil)
+	if err := traceInterceptor(c.appendMetadata(context.Background()), "/netauth.v2.NetAuth2/EntityInfo", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if gotMethod != "" {
+		t.Error("Request was traced without a TraceFunc")
+	}
+}
+
+func TestDryRunInterceptor(t *testing.T) {
+	b, _ := proto.Marshal(&pb.Entity{ID: proto.String("foo")})
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		for _, o := range opts {
+			if tr, ok := o.(grpc.TrailerCallOption); ok && len(md.Get("dry-run")) == 1 {
+				*tr.TrailerAddr = metadata.Pairs("dry-run-entity-bin", string(b))
+			}
+		}
+		return nil
+	}
+
+	var gotMethod string
+	var gotEntities []*pb.Entity
+	c := &Client{}
+	c.SetDryRun(func(method string, entities []*pb.Entity, groups []*pb.Group) {
+		gotMethod = method
+		gotEntities = entities
+	})
+
+	if err := dryRunInterceptor(c.appendMetadata(context.Background()), "/netauth.v2.NetAuth2/EntityCreate", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if gotMethod != "EntityCreate" || len(gotEntities) != 1 || gotEntities[0].GetID() != "foo" {
+		t.Errorf("Bad dry run: %s %v", gotMethod, gotEntities)
+	}
+}
+
+func TestIsSecretExpired(t *testing.T) {
+	if !IsSecretExpired(status.Error(codes.FailedPrecondition, "The secret has expired and must be changed")) {
+		t.Error("Expired secret was not recognized")
+	}
+	if IsSecretExpired(status.Error(codes.Unauthenticated, "Authentication failed")) {
+		t.Error("Failed authentication was taken as an expired secret")
+	}
+	if IsSecretExpired(nil) {
+		t.Error("nil was taken as an expired secret")
+	}
+}
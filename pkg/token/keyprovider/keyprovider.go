@@ -40,6 +40,27 @@ func New(b string) (KeyProvider, error) {
 	return p(log())
 }
 
+// ForRealm returns a KeyProvider that provides the keys of the named
+// realm from kp.  A realm's keys have the realm's name in front of
+// their use, so the fs provider loads the public RSA key of the realm
+// lab from rsa-lab-public.tokenkey.  The default realm, whose name is
+// empty, uses the keys of kp as they are.
+func ForRealm(kp KeyProvider, realm string) KeyProvider {
+	if realm == "" {
+		return kp
+	}
+	return realmProvider{kp: kp, realm: realm}
+}
+
+type realmProvider struct {
+	kp    KeyProvider
+	realm string
+}
+
+func (rp realmProvider) Provide(mech, use string) ([]byte, error) {
+	return rp.kp.Provide(mech, rp.realm+"-"+use)
+}
+
 // SetParentLogger sets the parent logger for this instance.
 func SetParentLogger(l hclog.Logger) {
 	lb = l.Named("keyprovider")
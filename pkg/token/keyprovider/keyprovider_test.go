@@ -42,6 +42,20 @@ func TestNewUnknown(t *testing.T) {
 	assert.Equal(t, err, ErrUnknownKeyProvider)
 }
 
+type useProvider struct{}
+
+func (useProvider) Provide(mech, use string) ([]byte, error) { return []byte(mech + "-" + use), nil }
+
+func TestForRealm(t *testing.T) {
+	b, err := ForRealm(useProvider{}, "").Provide("rsa", "public")
+	assert.Nil(t, err)
+	assert.Equal(t, "rsa-public", string(b))
+
+	b, err = ForRealm(useProvider{}, "lab").Provide("rsa", "public")
+	assert.Nil(t, err)
+	assert.Equal(t, "rsa-lab-public", string(b))
+}
+
 func TestSetParentLogger(t *testing.T) {
 	lb = nil
 	assert.Nil(t, lb)